@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"grinder/pkg/camera"
+	"grinder/pkg/renderer"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// parseFrames parses a -frames range "first:last", both ends included.
+func parseFrames(s string) (first, last int, err error) {
+	a, b, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("frames %q: want first:last", s)
+	}
+	if first, err = strconv.Atoi(a); err != nil {
+		return 0, 0, fmt.Errorf("frames %q: %v", s, err)
+	}
+	if last, err = strconv.Atoi(b); err != nil {
+		return 0, 0, fmt.Errorf("frames %q: %v", s, err)
+	}
+	if first < 0 || last < first {
+		return 0, 0, fmt.Errorf("frames %q: want 0 <= first <= last", s)
+	}
+	return first, last, nil
+}
+
+// framesPerUnit returns how many frames span one unit of the shapes' motion:
+// perUnit if it is set, and otherwise last, so a range from frame 0 covers
+// the whole motion.
+func framesPerUnit(perUnit, last int) int {
+	if perUnit > 0 {
+		return perUnit
+	}
+	return last
+}
+
+// frameTime maps frame i onto the shapes' motion at perUnit frames to one
+// unit of time. It doesn't depend on the range being baked, so a range
+// split across several runs bakes each frame at the same time.
+func frameTime(i, perUnit int) float64 {
+	if perUnit == 0 {
+		return 0
+	}
+	return float64(i) / float64(perUnit)
+}
+
+// setFrame points engine at time t of the animation: the shapes at t and the
+// camera at cam.AtTime(t), with the header's view to match.
+func setFrame(engine *renderer.BakeEngine, cam camera.Camera, t float64) {
+	engine.Time = t
+	engine.Camera = cam.AtTime(t)
+	engine.CamTarget, engine.CamUp, engine.CamFov = cameraView(engine.Camera)
+}
+
+// frameFile numbers out for frame i: final.bin becomes final_0007.bin.
+func frameFile(out string, i int) string {
+	ext := filepath.Ext(out)
+	return fmt.Sprintf("%s_%04d%s", strings.TrimSuffix(out, ext), i, ext)
+}
+
+// bakeSequence bakes frames first..last, at perUnit frames to one unit of
+// time, into one baked sequence at path, storing every keyEvery-th frame
+// whole and the rest as deltas.
+func bakeSequence(engine *renderer.BakeEngine, cam camera.Camera, path string, first, last, perUnit, keyEvery int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// Atoms closer than a hundredth of a voxel count as unchanged.
+	sw, err := renderer.NewSequenceWriter(f, keyEvery, float32(engine.MinSize/100))
+	if err != nil {
+		return err
+	}
+	for i := first; i <= last; i++ {
+		setFrame(engine, cam, frameTime(i, perUnit))
+		atoms, err := engine.BakeAtoms()
+		if err != nil {
+			return err
+		}
+		if err := sw.WriteFrame(atoms); err != nil {
+			return err
+		}
+		stored := sw.Frames()[len(sw.Frames())-1]
+		fmt.Printf("Frame %d (t=%.3f): %d atoms, stored %d bytes\n", i, engine.Time, len(atoms), stored.Size())
+	}
+	if err := sw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// unpackFrame rebuilds frame i of the baked sequence at path and indexes it
+// into a bake at out.
+func unpackFrame(engine *renderer.BakeEngine, path string, i int, tempFile, out string) error {
+	seq, err := renderer.LoadSequence(path)
+	if err != nil {
+		return err
+	}
+	defer seq.Close()
+	atoms, err := seq.Frame(i)
+	if err != nil {
+		return err
+	}
+	return engine.IndexAtoms(atoms, tempFile, out)
+}
@@ -11,13 +11,34 @@ import (
 )
 
 func main() {
-	scenePath := flag.String("scene", "scenes/simple.json", "path to scene JSON file")
+	scenePath := flag.String("scene", "scenes/simple.json", "path to scene file (.json, .yaml or .yml)")
 	tempFile := flag.String("temp", "temp.bin", "temporary atom file")
 	outFile := flag.String("out", "final.bin", "output baked scene file")
 	minSize := flag.Float64("minsize", 0.05, "minimum voxel size")
+	pixelSize := flag.Float64("pixelsize", 0, "bake by distance: stop voxels at this many pixels of the 1024x1024 bake view, with -minsize as a world-space floor (0 = off)")
+	compress := flag.Bool("compress", false, "zstd-compress the atom blocks of each BLAS leaf")
+	sortMem := flag.Int64("sortmem", 256, "memory budget in MB for each sort run of the indexer")
+	strict := flag.Bool("strict", false, "reject unknown fields in the scene file")
+	viewIndependent := flag.Bool("viewindependent", false, "subdivide the scene's bounds in world space so surfaces the camera can't see are baked too; -minsize is then in world units")
+	frames := flag.String("frames", "", "bake an animation: frames first:last spread over the shapes' motion, each to -out numbered as name_0000.bin")
+	perUnit := flag.Int("framesperunit", 0, "with -frames, frames per unit of the shapes' motion, so frame i is baked at time i/n whatever the range (0 = the last of -frames)")
+	sequence := flag.String("sequence", "", "with -frames, write the frames to this delta-compressed sequence file instead of one bake each")
+	keyEvery := flag.Int("keyevery", 12, "with -sequence, store every n-th frame whole")
+	unpack := flag.Int("unpack", -1, "rebuild frame n, counting from 0, of the -sequence file into the -out bake")
+	dryRun := flag.Bool("dryrun", false, "count the atoms and estimate the output size without writing anything")
+	aoRadius := flag.Float64("ao", 0, "bake ambient occlusion from atoms within this distance (0 = off)")
+	aoSamples := flag.Int("aosamples", 16, "with -ao, rays per atom")
 	flag.Parse()
 
-	cam, shapes, light, _, near, far, shutter, err := loader.LoadScene(*scenePath)
+	cam, shapes, light, _, near, far, err := loader.Options{Strict: *strict}.LoadScene(*scenePath)
+	if err != nil {
+		fmt.Printf("Error loading scene: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Stored in the bake so the tracer can rebuild the light and atmosphere
+	// without the scene file.
+	sceneJSON, err := loader.ReadJSON(*scenePath)
 	if err != nil {
 		fmt.Printf("Error loading scene: %v\n", err)
 		os.Exit(1)
@@ -35,15 +56,61 @@ func main() {
 	fmt.Printf("Voxel MinSize: %f, Near: %f, Far: %f\n", *minSize, near, far)
 
 	// Extract camera info for header
-	var target, up math.Point3D
-	var fov float64
-	if pc, ok := cam.(*camera.PerspectiveCamera); ok {
-		target = pc.GetEye().Add(pc.GetForward())
-		up = pc.GetUp()
-		fov = pc.GetFov()
-	}
+	target, up, fov := cameraView(cam)
 
-	engine := renderer.NewBakeEngine(cam, shapes, *light, 1024, 1024, *minSize, near, far, shutter, target, up, fov)
+	engine := renderer.NewBakeEngine(cam, shapes, *light, 1024, 1024, *minSize, near, far, target, up, fov)
+	engine.Compress = *compress
+	engine.PixelSize = *pixelSize
+	engine.ViewIndependent = *viewIndependent
+	engine.SortBudget = *sortMem * 1024 * 1024
+	engine.AORadius = *aoRadius
+	engine.AOSamples = *aoSamples
+	engine.SceneJSON = sceneJSON
+	if *unpack >= 0 {
+		if err := unpackFrame(engine, *sequence, *unpack, *tempFile, *outFile); err != nil {
+			fmt.Printf("Error unpacking frame %d: %v\n", *unpack, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *frames != "" {
+		first, last, err := parseFrames(*frames)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if *perUnit < 0 {
+			fmt.Printf("Error: framesperunit %d: want >= 0\n", *perUnit)
+			os.Exit(1)
+		}
+		rate := framesPerUnit(*perUnit, last)
+		if *sequence != "" && !*dryRun {
+			if err := bakeSequence(engine, cam, *sequence, first, last, rate, *keyEvery); err != nil {
+				fmt.Printf("Error during sequence bake: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+		counts := make([]int64, 0, last-first+1)
+		for i := first; i <= last; i++ {
+			setFrame(engine, cam, frameTime(i, rate))
+			atoms, err := bakeFrame(engine, *tempFile, frameFile(*outFile, i), *dryRun)
+			if err != nil {
+				fmt.Printf("Error during bake of frame %d: %v\n", i, err)
+				os.Exit(1)
+			}
+			counts = append(counts, atoms)
+		}
+		for k, atoms := range counts {
+			fmt.Printf("Frame %d (t=%.3f): %d atoms\n", first+k, frameTime(first+k, rate), atoms)
+		}
+		return
+	}
+	if *dryRun {
+		atoms, size := engine.DryRun()
+		fmt.Printf("Dry run: %d atoms, about %.1f MB uncompressed.\n", atoms, float64(size)/(1024*1024))
+		return
+	}
 	err = engine.Bake(*tempFile, *outFile)
 	if err != nil {
 		fmt.Printf("Error during bake: %v\n", err)
@@ -60,3 +127,30 @@ func main() {
 
 	fmt.Println("Verification completed.")
 }
+
+// cameraView returns the target, up vector and field of view the bake header
+// records for cam. Only a perspective camera has them.
+func cameraView(cam camera.Camera) (target, up math.Point3D, fov float64) {
+	if pc, ok := cam.(*camera.PerspectiveCamera); ok {
+		return pc.GetEye().Add(pc.GetForward()), pc.GetUp(), pc.GetFov()
+	}
+	return math.Point3D{}, math.Point3D{}, 0
+}
+
+// bakeFrame bakes one frame of an animation to out and returns its atom
+// count. A dry run only counts.
+func bakeFrame(engine *renderer.BakeEngine, tempFile, out string, dryRun bool) (int64, error) {
+	if dryRun {
+		atoms, _ := engine.DryRun()
+		return atoms, nil
+	}
+	if err := engine.Bake(tempFile, out); err != nil {
+		return 0, err
+	}
+	scene, err := renderer.LoadBakedScene(out)
+	if err != nil {
+		return 0, err
+	}
+	defer scene.Close()
+	return scene.Header.AtomCount, nil
+}
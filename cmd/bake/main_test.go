@@ -0,0 +1,105 @@
+package main
+
+import (
+	"grinder/pkg/camera"
+	"grinder/pkg/geometry"
+	"grinder/pkg/math"
+	"grinder/pkg/renderer"
+	"grinder/pkg/shading"
+	"image/color"
+	"slices"
+	"testing"
+)
+
+func TestParseFrames(t *testing.T) {
+	first, last, err := parseFrames("0:24")
+	if err != nil || first != 0 || last != 24 {
+		t.Errorf("parseFrames(0:24) = %d, %d, %v; want 0, 24, nil", first, last, err)
+	}
+	for _, bad := range []string{"24", "a:3", "3:b", "5:2", "-1:3"} {
+		if _, _, err := parseFrames(bad); err == nil {
+			t.Errorf("parseFrames(%q) accepted a bad range", bad)
+		}
+	}
+}
+
+func TestFrameTime(t *testing.T) {
+	for _, tt := range []struct {
+		i, perUnit int
+		want       float64
+	}{{0, 24, 0}, {12, 24, 0.5}, {24, 24, 1}, {36, 24, 1.5}, {0, 0, 0}} {
+		if got := frameTime(tt.i, tt.perUnit); got != tt.want {
+			t.Errorf("frameTime(%d, %d) = %v, want %v", tt.i, tt.perUnit, got, tt.want)
+		}
+	}
+}
+
+// TestFrameTime_SplitRange bakes frames 0:24 in one run and 12:24 in
+// another: frame 12 must land at the same time in both.
+func TestFrameTime_SplitRange(t *testing.T) {
+	at12 := func(frames string, perUnit int) float64 {
+		_, last, err := parseFrames(frames)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return frameTime(12, framesPerUnit(perUnit, last))
+	}
+	if whole, split := at12("0:24", 0), at12("12:24", 0); whole != split {
+		t.Errorf("frame 12 at t=%v of 0:24 but t=%v of 12:24", whole, split)
+	}
+	if whole, split := at12("0:24", 48), at12("12:24", 48); whole != 0.25 || split != 0.25 {
+		t.Errorf("frame 12 at 48 frames per unit: t=%v of 0:24 and t=%v of 12:24, want 0.25", whole, split)
+	}
+}
+
+func TestFrameFile(t *testing.T) {
+	if got := frameFile("out/final.bin", 7); got != "out/final_0007.bin" {
+		t.Errorf("frameFile = %q, want out/final_0007.bin", got)
+	}
+}
+
+// TestSetFrame_MovingCamera bakes two frames of a camera flying from in
+// front of a still sphere to its side: each frame must be diced from its own
+// view, so their atoms differ.
+func TestSetFrame_MovingCamera(t *testing.T) {
+	up := math.Point3D{X: 0, Y: 1, Z: 0}
+	cam := camera.NewLookAtCamera(math.Point3D{Z: 5}, math.Point3D{}, up, 45, 1)
+	cam.Motion = &camera.Motion{
+		Eye: math.Motion{Keyframes: []math.Keyframe{
+			{Time: 0, Position: math.Point3D{Z: 5}},
+			{Time: 1, Position: math.Point3D{X: 5}},
+		}},
+		Target: math.Motion{Keyframes: []math.Keyframe{{Time: 0, Position: math.Point3D{}}}},
+	}
+	shapes := []geometry.Shape{
+		geometry.Sphere3D{Radius: 1, Color: color.RGBA{R: 255, A: 255}},
+	}
+	light := shading.Light{Position: math.Point3D{X: 5, Y: 5, Z: 5}, Intensity: 1}
+	target, _, fov := cameraView(cam)
+	engine := renderer.NewBakeEngine(cam, shapes, light, 64, 64, 0.05, 3, 7, target, up, fov)
+
+	setFrame(engine, cam, 0)
+	first, err := engine.BakeAtoms()
+	if err != nil {
+		t.Fatalf("BakeAtoms of frame 0 failed: %v", err)
+	}
+	setFrame(engine, cam, 1)
+	if got := engine.Camera.GetEye(); got != (math.Point3D{X: 5}) {
+		t.Errorf("frame 1 camera eye = %v, want the last keyframe's (5, 0, 0)", got)
+	}
+	// The header's target is one unit along the view, here toward the sphere.
+	if d := engine.CamTarget.Sub(math.Point3D{X: 4}).Length(); d > 1e-9 {
+		t.Errorf("frame 1 header target = %v, want (4, 0, 0)", engine.CamTarget)
+	}
+	last, err := engine.BakeAtoms()
+	if err != nil {
+		t.Fatalf("BakeAtoms of frame 1 failed: %v", err)
+	}
+
+	if len(first) == 0 {
+		t.Fatal("frame 0 baked no atoms")
+	}
+	if slices.Equal(first, last) {
+		t.Error("both frames baked the same atoms; the second ignored the camera's motion")
+	}
+}
@@ -0,0 +1,125 @@
+//go:build ebiten
+
+package main
+
+import (
+	"fmt"
+	"grinder/pkg/geometry"
+	"grinder/pkg/loader"
+	"grinder/pkg/math"
+	"grinder/pkg/shading"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// editKeys move the selected light or shape: IJKL across the ground plane,
+// U and O up and down.
+var editKeys = []struct {
+	key ebiten.Key
+	dir math.Point3D
+}{
+	{ebiten.KeyI, math.Point3D{Z: -1}},
+	{ebiten.KeyK, math.Point3D{Z: 1}},
+	{ebiten.KeyJ, math.Point3D{X: -1}},
+	{ebiten.KeyL, math.Point3D{X: 1}},
+	{ebiten.KeyU, math.Point3D{Y: 1}},
+	{ebiten.KeyO, math.Point3D{Y: -1}},
+}
+
+// edit applies one tick of scene editing input. Tab cycles the selection
+// through the light and then each shape; the editKeys move what is
+// selected, re-rendering only what the move can change. A headlamp follows
+// the camera, so with one the light can't be moved.
+func (g *Game) edit() {
+	if inpututil.IsKeyJustPressed(ebiten.KeyTab) {
+		g.selected = (g.selected + 1) % (len(g.view.shapes) + 1)
+	}
+	var move math.Point3D
+	for _, k := range editKeys {
+		if ebiten.IsKeyPressed(k.key) {
+			move = move.Add(k.dir)
+		}
+	}
+	if move == (math.Point3D{}) {
+		return
+	}
+	move = move.Mul(g.view.dist * 0.02)
+	if g.selected == 0 {
+		if g.view.headlamp > 0 {
+			return
+		}
+		l := g.view.light
+		l.Position = l.Position.Add(move)
+		g.moveLight(l)
+		return
+	}
+	i := g.selected - 1
+	if moved, ok := translate(g.view.shapes[i], move); ok {
+		g.moveShape(i, moved)
+	}
+}
+
+// moveShape replaces shape i of the viewer's scene with s and re-renders
+// only the tiles the shape covers or shadows, before or after the move.
+func (g *Game) moveShape(i int, s geometry.Shape) {
+	old := g.view.setShape(i, s)
+	full := g.fullRenderer()
+	g.view.renderRegion(full, full.ShapeRect(old).Union(full.ShapeRect(s)))
+}
+
+// moveLight replaces the viewer's light with l and re-renders only the
+// tiles it can light.
+func (g *Game) moveLight(l shading.Light) {
+	g.view.light = l
+	full := g.fullRenderer()
+	g.view.renderRegion(full, full.LightRect())
+}
+
+// save writes the scene as edited, seen from the current view, to
+// g.savePath. The scene's own light is saved, not a headlamp standing in
+// for it.
+func (g *Game) save() {
+	v := g.view
+	light := v.light
+	sc := &loader.Scene{
+		Camera:      v.camera(),
+		Shapes:      v.shapes,
+		Light:       &light,
+		Atmosphere:  v.atmos,
+		Near:        v.near,
+		Far:         v.far,
+		Environment: v.env,
+		Background:  v.background,
+	}
+	if err := loader.Save(g.savePath, sc); err != nil {
+		fmt.Printf("Error saving scene: %v\n", err)
+		return
+	}
+	fmt.Printf("Saved scene to %s\n", g.savePath)
+}
+
+// editStatus returns the overlay lines for scene editing: the light's
+// position and what is selected.
+func (g *Game) editStatus() string {
+	p := g.view.light.Position
+	status := fmt.Sprintf("Light: (%.2f, %.2f, %.2f)", p.X, p.Y, p.Z)
+	if g.view.headlamp > 0 {
+		status += " headlamp"
+	}
+	if g.selected == 0 {
+		return status + "\nSelected: light (Tab cycles, IJKL/UO move, Ctrl+S saves)"
+	}
+	s := g.view.shapes[g.selected-1]
+	return status + fmt.Sprintf("\nSelected: shape %d, %T (Tab cycles, IJKL/UO move, Ctrl+S saves)", g.selected-1, geometry.Unwrap(s))
+}
+
+// translate returns s moved by d. A transformed shape has the move folded
+// into its transform; any other shape is wrapped in one.
+func translate(s geometry.Shape, d math.Point3D) (geometry.Shape, bool) {
+	m := math.Translate4(d)
+	if ts, ok := s.(*geometry.TransformedShape); ok {
+		return geometry.NewTransformedShape(ts.Shape, m.Mul(ts.ToWorld))
+	}
+	return geometry.NewTransformedShape(s, m)
+}
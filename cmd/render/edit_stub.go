@@ -0,0 +1,7 @@
+//go:build !ebiten
+
+package main
+
+// editStatus returns no overlay: scene editing is built only with the
+// ebiten tag (see edit.go).
+func (g *Game) editStatus() string { return "" }
@@ -0,0 +1,295 @@
+//go:build ebiten
+
+package main
+
+import (
+	"grinder/pkg/camera"
+	"grinder/pkg/geometry"
+	"grinder/pkg/loader"
+	"grinder/pkg/math"
+	"grinder/pkg/renderer"
+	"grinder/pkg/shading"
+	"image"
+	gomath "math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// previewDiv is how much smaller the first, coarse pass of a re-render is.
+const previewDiv = 8
+
+// viewer orbits a camera around a pivot from keyboard and mouse input and
+// re-renders progressively into the preview image whenever the view changes.
+type viewer struct {
+	shapes     []geometry.Shape
+	light      shading.Light
+	headlamp   float64 // if positive, replaces light with a headlamp of this intensity
+	atmos      shading.AtmosphereConfig
+	near, far  float64
+	shutter    float64
+	antiAlias  bool
+	noEarlyOut bool
+	prepass    bool
+	debug      renderer.DebugMode
+	sampler    renderer.LightSampler
+	env        shading.Environment
+	background shading.Environment
+	fov        float64
+	aspect     float64
+	dst        *image.RGBA
+	mu         *sync.Mutex
+	onDone     func() // called after a full-resolution pass finishes
+	progress   *renderProgress
+	generation atomic.Int64
+
+	// shown is the renderer of the latest render started, nil before the
+	// first, and dirty the pixels it redraws: all of them unless it was
+	// started by renderRegion. done is the generation of the latest render
+	// to finish.
+	shown *renderer.Renderer
+	dirty image.Rectangle
+	done  atomic.Int64
+
+	pivot      math.Point3D
+	dist       float64
+	yaw, pitch float64
+
+	dragging     bool
+	lastX, lastY int
+}
+
+// startViewer makes the preview navigable, orbiting from the scene's
+// camera with g.full's render settings, starts its first render and
+// watches scenePath for edits. onDone is called after each full-resolution
+// pass. It reports false, leaving the preview static, for a camera that
+// can't be orbited.
+func (g *Game) startViewer(sc *loader.Scene, headlamp float64, scenePath string, strict bool, onDone func()) bool {
+	pc, ok := sc.Camera.(*camera.PerspectiveCamera)
+	if !ok {
+		return false
+	}
+	full := g.full
+	v := newViewer(pc, (full.Near+full.Far)/2, sc.Shapes, *sc.Light, sc.Atmosphere, sc.Near, sc.Far, full.AntiAlias, g.MasterImage, g.mu, g.progress)
+	v.headlamp = headlamp
+	v.noEarlyOut = full.NoEarlyOut
+	v.prepass = full.DepthPrepass
+	v.debug = full.Debug
+	v.sampler = full.Sampler
+	v.env = sc.Environment
+	v.background = sc.Background
+	v.onDone = onDone
+	g.view, g.sceneCam = v, pc
+	g.reloads = make(chan *loader.Scene)
+	go watchScene(scenePath, strict, g.reloads)
+	v.render(full)
+	return true
+}
+
+// interact applies one tick of preview input: a reloaded scene, then
+// navigation, then scene editing.
+func (g *Game) interact() {
+	select {
+	case sc := <-g.reloads:
+		g.reload(sc)
+	default:
+	}
+	// Ctrl holds off navigation and editing, so Ctrl+S doesn't also back
+	// the camera off.
+	if ebiten.IsKeyPressed(ebiten.KeyControl) {
+		if inpututil.IsKeyJustPressed(ebiten.KeyS) {
+			g.save()
+		}
+		return
+	}
+	if g.view.update() {
+		g.view.render(g.fullRenderer())
+	}
+	g.edit()
+}
+
+// fullRenderer builds a full-resolution renderer for the viewer's current
+// camera, light and shapes.
+func (g *Game) fullRenderer() *renderer.Renderer {
+	return g.view.newRenderer(g.view.camera(), g.full.Width, g.full.Height, g.full.MinSize)
+}
+
+// newViewer starts the orbit at the scene camera, pivoting dist along its
+// forward axis.
+func newViewer(cam *camera.PerspectiveCamera, dist float64, shapes []geometry.Shape, light shading.Light, atmos shading.AtmosphereConfig, near, far float64, antiAlias bool, dst *image.RGBA, mu *sync.Mutex, progress *renderProgress) *viewer {
+	v := &viewer{
+		shapes: shapes, light: light, atmos: atmos, near: near, far: far,
+		antiAlias: antiAlias, dst: dst, mu: mu, progress: progress,
+	}
+	v.lookFrom(cam, dist)
+	return v
+}
+
+// lookFrom moves the orbit to cam, pivoting dist along its forward axis,
+// and takes on its lens and shutter.
+func (v *viewer) lookFrom(cam *camera.PerspectiveCamera, dist float64) {
+	v.fov, v.aspect, v.shutter, v.dist = cam.GetFov(), cam.GetAspect(), cam.GetShutter(), dist
+	f := cam.GetForward()
+	v.pivot = cam.GetEye().Add(f.Mul(dist))
+	// The eye sits opposite the forward axis from the pivot.
+	v.yaw = gomath.Atan2(-f.X, -f.Z)
+	v.pitch = gomath.Asin(gomath.Max(-1, gomath.Min(1, -f.Y)))
+}
+
+// camera builds the camera for the current orbit state.
+func (v *viewer) camera() *camera.PerspectiveCamera {
+	offset := math.Point3D{
+		X: gomath.Cos(v.pitch) * gomath.Sin(v.yaw),
+		Y: gomath.Sin(v.pitch),
+		Z: gomath.Cos(v.pitch) * gomath.Cos(v.yaw),
+	}
+	eye := v.pivot.Add(offset.Mul(v.dist))
+	c := camera.NewLookAtCamera(eye, v.pivot, math.Point3D{X: 0, Y: 1, Z: 0}, v.fov, v.aspect)
+	c.Shutter = v.shutter
+	return c
+}
+
+// update applies one tick of input and reports whether the view changed.
+// WASD and the arrow keys move the camera and pivot together; dragging with
+// the left mouse button orbits around the pivot.
+func (v *viewer) update() bool {
+	changed := false
+	cam := v.camera()
+	forward, right := cam.GetForward(), cam.Right
+	step := v.dist * 0.02
+	moves := []struct {
+		keys []ebiten.Key
+		dir  math.Point3D
+	}{
+		{[]ebiten.Key{ebiten.KeyW, ebiten.KeyArrowUp}, forward},
+		{[]ebiten.Key{ebiten.KeyS, ebiten.KeyArrowDown}, forward.Mul(-1)},
+		{[]ebiten.Key{ebiten.KeyD, ebiten.KeyArrowRight}, right},
+		{[]ebiten.Key{ebiten.KeyA, ebiten.KeyArrowLeft}, right.Mul(-1)},
+	}
+	for _, m := range moves {
+		for _, k := range m.keys {
+			if ebiten.IsKeyPressed(k) {
+				v.pivot = v.pivot.Add(m.dir.Mul(step))
+				changed = true
+				break
+			}
+		}
+	}
+
+	x, y := ebiten.CursorPosition()
+	if ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
+		if v.dragging && (x != v.lastX || y != v.lastY) {
+			v.yaw -= float64(x-v.lastX) * 0.01
+			v.pitch += float64(y-v.lastY) * 0.01
+			v.pitch = gomath.Max(-1.5, gomath.Min(1.5, v.pitch))
+			changed = true
+		}
+		v.dragging = true
+	} else {
+		v.dragging = false
+	}
+	v.lastX, v.lastY = x, y
+	return changed
+}
+
+// newRenderer builds a renderer for cam at the given resolution, scaling the
+// dicing size so coarse passes stop subdividing at the same pixel footprint.
+func (v *viewer) newRenderer(cam camera.Camera, width, height int, minSize float64) *renderer.Renderer {
+	light := v.light
+	if v.headlamp > 0 {
+		light = shading.Headlamp(cam.AtTime(0).GetEye(), v.headlamp)
+	}
+	rndr := renderer.NewRenderer(cam, v.shapes, light, width, height, minSize, v.near, v.far, v.atmos)
+	rndr.FitDepthPlanes()
+	rndr.AntiAlias = v.antiAlias
+	rndr.NoEarlyOut = v.noEarlyOut
+	rndr.DepthPrepass = v.prepass
+	rndr.Debug = v.debug
+	rndr.Sampler = v.sampler
+	rndr.Environment = v.env
+	rndr.Background = v.background
+	return rndr
+}
+
+// render starts a progressive render of full in the background: a coarse
+// pass is stretched over the preview first, then full-resolution tiles are
+// drawn over it. Starting another render abandons this one.
+func (v *viewer) render(full *renderer.Renderer) {
+	gen := v.generation.Add(1)
+	v.shown, v.dirty = full, v.dst.Bounds()
+	stale := func() bool { return v.generation.Load() != gen }
+	lw, lh := max(1, full.Width/previewDiv), max(1, full.Height/previewDiv)
+	coarse := v.newRenderer(full.Camera, lw, lh, full.MinSize*previewDiv)
+	go func() {
+		low := image.NewRGBA(image.Rect(0, 0, lw, lh))
+		var lowMu sync.Mutex
+		if !renderTiles(coarse, low, &lowMu, low.Bounds(), stale, v.progress, "Preview") {
+			return
+		}
+		v.mu.Lock()
+		upscaleNearest(v.dst, low)
+		v.mu.Unlock()
+
+		if !renderTiles(full, v.dst, v.mu, v.dst.Bounds(), stale, v.progress, "Refining") {
+			return
+		}
+		drawDebugOverlay(full, v.dst, v.mu)
+		v.done.Store(gen)
+		if v.onDone != nil {
+			v.onDone()
+		}
+	}()
+}
+
+// renderRegion re-renders only the tiles of full that overlap dirty, at full
+// resolution straight over the preview, for a change to the scene that
+// leaves the rest of the image as it was. Pixels an unfinished render
+// still owed are redrawn too. Where that can't hold, because full fits
+// its depth planes wider than the image on show, which would shift the
+// dicing of every tile, or the BVH overlay is drawn over the whole frame,
+// it falls back to render.
+func (v *viewer) renderRegion(full *renderer.Renderer, dirty image.Rectangle) {
+	shown := v.shown
+	if shown == nil || full.Debug == renderer.DebugBVH || full.Near < shown.Near || full.Far > shown.Far {
+		v.render(full)
+		return
+	}
+	// Keep the shown planes, so the untouched tiles still match.
+	full.Near, full.Far = shown.Near, shown.Far
+	if v.done.Load() != v.generation.Load() {
+		dirty = dirty.Union(v.dirty)
+	}
+	gen := v.generation.Add(1)
+	v.shown, v.dirty = full, dirty
+	stale := func() bool { return v.generation.Load() != gen }
+	go func() {
+		if renderTiles(full, v.dst, v.mu, dirty, stale, v.progress, "Updating") {
+			v.done.Store(gen)
+		}
+	}()
+}
+
+// setShape replaces shape i of the scene with s and returns the shape it
+// replaced. Renders already running keep the shapes they started with.
+func (v *viewer) setShape(i int, s geometry.Shape) geometry.Shape {
+	old := v.shapes[i]
+	v.shapes = append([]geometry.Shape(nil), v.shapes...)
+	v.shapes[i] = s
+	return old
+}
+
+// upscaleNearest stretches src over all of dst with nearest-neighbour sampling.
+func upscaleNearest(dst, src *image.RGBA) {
+	db, sb := dst.Bounds(), src.Bounds()
+	for y := 0; y < db.Dy(); y++ {
+		sy := y * sb.Dy() / db.Dy()
+		for x := 0; x < db.Dx(); x++ {
+			sx := x * sb.Dx() / db.Dx()
+			si := src.PixOffset(sb.Min.X+sx, sb.Min.Y+sy)
+			di := dst.PixOffset(db.Min.X+x, db.Min.Y+y)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !ebiten
+
+package main
+
+import "grinder/pkg/loader"
+
+// viewer is the navigable preview, built only with the ebiten tag (see
+// interactive.go). Without it the -fb window shows the render as it is
+// drawn and takes no input.
+type viewer struct{}
+
+// startViewer reports false: in this build the preview stays static.
+func (g *Game) startViewer(sc *loader.Scene, headlamp float64, scenePath string, strict bool, onDone func()) bool {
+	return false
+}
+
+// interact never runs, there being no viewer to take input.
+func (g *Game) interact() {}
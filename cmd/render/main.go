@@ -3,29 +3,47 @@ package main
 import (
 	"flag"
 	"fmt"
+	"grinder/pkg/camera"
+	gimage "grinder/pkg/image"
 	"grinder/pkg/loader"
 	"grinder/pkg/renderer"
+	"grinder/pkg/shading"
 	"image"
-	"image/draw"
-	"image/png"
 	"log"
+	gomath "math"
 	"os"
-	"runtime"
+	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
 )
 
 // Game holds the Ebitengine game state.
 type Game struct {
 	MasterImage *image.RGBA
 	mu          *sync.Mutex
+	view        *viewer // nil when the camera can't be navigated or built without the ebiten tag
+	full        *renderer.Renderer
+	progress    *renderProgress
+	selected    int    // what scene editing moves: 0 for the light, i+1 for shape i
+	savePath    string // where Ctrl+S saves the edited scene
+
+	// reloads delivers the scene file each time it is edited on disk, and
+	// sceneCam is the camera of the one on show, to tell whether an edit
+	// moved it.
+	reloads  chan *loader.Scene
+	sceneCam *camera.PerspectiveCamera
 }
 
 // Update proceeds the game state.
 // Update is called every tick (1/60 [s] by default).
 func (g *Game) Update() error {
-	// We don't need to update any state here.
+	if g.view != nil {
+		g.interact()
+	}
 	return nil
 }
 
@@ -37,12 +55,24 @@ func (g *Game) Draw(screen *ebiten.Image) {
 	if g.MasterImage != nil {
 		screen.WritePixels(g.MasterImage.Pix)
 	}
+	msg := g.progress.String()
+	if g.view != nil {
+		if msg != "" {
+			msg += "\n"
+		}
+		msg += g.editStatus()
+	}
+	if msg != "" {
+		ebitenutil.DebugPrint(screen, msg)
+	}
 }
 
 // Layout takes the outside size (e.g., the window size) and returns the (logical) screen size.
 // If you don't have to adjust the screen size with the outside size, just return a fixed size.
 func (g *Game) Layout(outsideWidth, outsideHeight int) (screenWidth, screenHeight int) {
-	return 512, 512 // Should match the image dimensions
+	// Should match the image dimensions; the window scales supersampled renders down.
+	b := g.MasterImage.Bounds()
+	return b.Dx(), b.Dy()
 }
 
 const sampleScene = `{
@@ -80,10 +110,46 @@ const sampleScene = `{
 }`
 
 func main() {
-	scenePath := flag.String("scene", "", "Path to the scene JSON file")
+	scenePath := flag.String("scene", "", "Path to the scene file (.json, .yaml or .yml)")
 	fb := flag.Bool("fb", false, "Enable framebuffer preview window")
+	aa := flag.Bool("aa", false, "Anti-alias silhouettes using sub-pixel coverage")
+	ss := flag.Int("ss", 1, "Supersampling factor: render at ss x resolution and box-downsample")
+	strict := flag.Bool("strict", false, "reject unknown fields in the scene file")
+	debug := flag.String("debug", "", "Debug view instead of shading: bvh, atoms or normals")
+	samplerName := flag.String("sampler", "jittered", "Soft shadow sampling pattern: jittered, mj or bluenoise")
+	outPath := flag.String("out", "render.png", "Output image path (.png, .jpg, .jpeg or .ppm)")
+	quality := flag.Int("quality", gimage.DefaultQuality, "JPEG quality (1-100)")
+	scale := flag.Float64("scale", 1, "Scale the saved image by this factor after supersampling")
+	filterName := flag.String("filter", "lanczos", "Resampling filter for -scale: box, bilinear or lanczos")
+	vignette := flag.Float64("vignette", 0, "Darken the saved image toward its corners by this strength (0 disables)")
+	aberration := flag.Float64("aberration", 0, "Chromatic aberration: red/blue offset in pixels at the corners (0 disables)")
+	headlamp := flag.Float64("headlamp", 0, "Replace the scene light with one at the camera of this intensity (0 disables)")
+	noEarlyOut := flag.Bool("noearlyout", false, "Dice octants hidden behind nearer surfaces too (for debugging)")
+	prepass := flag.Bool("prepass", false, "Find solid occluders in a coarse depth pre-pass first, to skip more hidden octants")
+	sceneOut := flag.String("sceneout", "", "Where Ctrl+S in the preview saves the edited scene (default: the scene's name with -edited.json)")
+	statsFlag := flag.Bool("stats", false, "Report timing and ray and node counts of the first render")
 	flag.Parse()
 
+	debugMode, err := renderer.ParseDebugMode(*debug)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	sampler, err := renderer.ParseLightSampler(*samplerName)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	filter, err := gimage.ParseFilter(*filterName)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *scale <= 0 {
+		fmt.Println("Error: -scale must be > 0")
+		os.Exit(1)
+	}
+
 	if *scenePath == "" {
 		fmt.Println("Error: Scene file not provided.")
 		fmt.Println("Usage: go run . -scene=<path_to_scene.json>")
@@ -92,33 +158,44 @@ func main() {
 		os.Exit(1)
 	}
 
-	cam, scene, light, atmos, near, far, shutter, err := loader.LoadScene(*scenePath)
+	sc, err := loader.Options{Strict: *strict}.Load(*scenePath)
 	if err != nil {
 		fmt.Printf("Error loading scene: %v\n", err)
 		os.Exit(1)
 	}
 
-	width, height := 512, 512
-	rndr := renderer.NewRenderer(cam, scene, *light, width, height, 0.004, near, far, atmos, shutter)
+	if *headlamp > 0 {
+		// The renderer draws the frame with the camera at its start.
+		light := shading.Headlamp(sc.Camera.AtTime(0).GetEye(), *headlamp)
+		sc.Light = &light
+	}
+
+	outWidth, outHeight := 512, 512
+	ssFactor := max(1, *ss)
+	// Tiles are rendered at the supersampled resolution and resolved on save.
+	width, height := outWidth*ssFactor, outHeight*ssFactor
+	rndr := renderer.NewRenderer(sc.Camera, sc.Shapes, *sc.Light, width, height, 0.004, sc.Near, sc.Far, sc.Atmosphere)
 	rndr.FitDepthPlanes()
+	rndr.Environment = sc.Environment
+	rndr.Background = sc.Background
+	rndr.AntiAlias = *aa
+	rndr.NoEarlyOut = *noEarlyOut
+	rndr.DepthPrepass = *prepass
+	rndr.Debug = debugMode
+	rndr.Sampler = sampler
+	var stats *renderer.Stats
+	if *statsFlag {
+		stats = rndr.CollectStats()
+	}
 
 	fmt.Println("Rendering...")
-
-	// --- Tiling and Concurrency ---
-	const tileSize = 64
-	const overdraw = 1
-	numTilesX := width / tileSize
-	numTilesY := height / tileSize
-
-	type RenderJob struct {
-		RenderBounds renderer.ScreenBounds
-		DrawBounds   image.Rectangle
+	start := time.Now()
+	reportStats := func() {
+		if stats != nil {
+			stats.Report(os.Stdout, time.Since(start))
+		}
 	}
 
-	// Create a channel with enough buffer for all jobs
-	jobs := make(chan RenderJob, numTilesX*numTilesY)
-	var wg sync.WaitGroup
-
 	finalImage := image.NewRGBA(image.Rect(0, 0, width, height))
 	var mu sync.Mutex
 
@@ -127,76 +204,93 @@ func main() {
 		mu.Lock() // Ensure we aren't saving while a worker is mid-draw
 		defer mu.Unlock()
 
-		f, err := os.Create("render.png")
-		if err != nil {
-			log.Fatalf("Failed to create render.png: %v", err)
+		out := renderer.Downsample(finalImage, ssFactor)
+		if *scale != 1 {
+			w := max(1, int(gomath.Round(float64(outWidth)**scale)))
+			h := max(1, int(gomath.Round(float64(outHeight)**scale)))
+			out = gimage.Resize(out, w, h, filter)
 		}
-		defer f.Close()
-
-		if err := png.Encode(f, finalImage); err != nil {
-			log.Fatalf("Failed to encode PNG: %v", err)
+		if *aberration > 0 {
+			out = gimage.ChromaticAberration(out, *aberration)
 		}
-		fmt.Println("Saved to render.png")
-	}
-
-	// --- WORKER POOL ---
-	worker := func() {
-		for job := range jobs {
-			tileImg := rndr.Render(job.RenderBounds)
-			mu.Lock()
-			draw.Draw(finalImage, job.DrawBounds, tileImg, image.Point{overdraw, overdraw}, draw.Src)
-			mu.Unlock()
-			wg.Done()
+		if *vignette > 0 {
+			gimage.Vignette(out, *vignette)
 		}
-	}
-
-	// 1. IMPORTANT: Pre-add to the WaitGroup so wg.Wait() doesn't bypass early
-	totalTiles := numTilesX * numTilesY
-	wg.Add(totalTiles)
-
-	// 2. Start the workers
-	for i := 0; i < runtime.NumCPU(); i++ {
-		go worker()
-	}
-
-	// 3. Feed the jobs
-	go func() {
-		for y := 0; y < height; y += tileSize {
-			for x := 0; x < width; x += tileSize {
-				jobs <- RenderJob{
-					RenderBounds: renderer.ScreenBounds{
-						MinX: x - overdraw,
-						MinY: y - overdraw,
-						MaxX: x + tileSize + overdraw,
-						MaxY: y + tileSize + overdraw,
-					},
-					DrawBounds: image.Rect(x, y, x+tileSize, y+tileSize),
-				}
-			}
+		if err := gimage.WriteImage(*outPath, out, *quality); err != nil {
+			log.Fatal(err)
 		}
-		close(jobs)
-	}()
+		fmt.Printf("Saved to %s\n", *outPath)
+	}
 
 	// --- MAIN CONTROL FLOW ---
 	if *fb {
-		// FB Mode: Save in background when done, but keep window open
-		go func() {
-			wg.Wait()
-			fmt.Println("Render complete. Saving auto-snapshot...")
-			saveImage()
-		}()
-
-		game := &Game{MasterImage: finalImage, mu: &mu}
-		ebiten.SetWindowSize(width, height)
+		// FB Mode: Save in background when the first view is done, but keep
+		// the window open for navigation.
+		progress := &renderProgress{}
+		game := &Game{MasterImage: finalImage, mu: &mu, full: rndr, progress: progress, savePath: *sceneOut}
+		if game.savePath == "" {
+			game.savePath = strings.TrimSuffix(*scenePath, filepath.Ext(*scenePath)) + "-edited.json"
+		}
+		var once sync.Once
+		snapshot := func() {
+			once.Do(func() {
+				reportStats()
+				fmt.Println("Render complete. Saving auto-snapshot...")
+				saveImage()
+			})
+		}
+		if !game.startViewer(sc, *headlamp, *scenePath, *strict, snapshot) {
+			go func() {
+				renderTiles(rndr, finalImage, &mu, finalImage.Bounds(), nil, progress, "Rendering")
+				drawDebugOverlay(rndr, finalImage, &mu)
+				snapshot()
+			}()
+		}
+
+		ebiten.SetWindowSize(outWidth, outHeight)
 		ebiten.SetWindowTitle("Grinder Live Preview")
 
 		if err := ebiten.RunGame(game); err != nil {
 			log.Fatalf("Ebitengine error: %v", err)
 		}
 	} else {
-		// Headless Mode: Block here until all workers call wg.Done()
-		wg.Wait()
+		// Headless Mode: Block here until every tile is drawn
+		renderTiles(rndr, finalImage, &mu, finalImage.Bounds(), nil, nil, "")
+		drawDebugOverlay(rndr, finalImage, &mu)
+		reportStats()
 		fmt.Println("Render complete. Saving...")
 		saveImage()
 	}
 }
+
+// renderTiles renders the tiles of rndr that overlap region into dst and
+// blocks until every one is done (see Renderer.RenderTiles). Tiles are
+// counted in prog under stage when prog is non-nil. Tiles still queued when
+// stale reports true are skipped; it returns false then.
+func renderTiles(rndr *renderer.Renderer, dst *image.RGBA, mu *sync.Mutex, region image.Rectangle, stale func() bool, prog *renderProgress, stage string) bool {
+	live := func() bool { return stale == nil || !stale() }
+	tiles := rndr.Tiles(region)
+	var done func()
+	if prog != nil {
+		if live() {
+			prog.start(stage, len(tiles))
+		}
+		done = func() {
+			if live() {
+				prog.tick()
+			}
+		}
+	}
+	return rndr.RenderTiles(dst, mu, tiles, stale, done)
+}
+
+// drawDebugOverlay draws the BVH node boxes over a finished frame in -debug=bvh.
+func drawDebugOverlay(rndr *renderer.Renderer, dst *image.RGBA, mu *sync.Mutex) {
+	pc, ok := rndr.Camera.(*camera.PerspectiveCamera)
+	if rndr.Debug != renderer.DebugBVH || !ok {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	renderer.DrawBVH(dst, pc, rndr.BVH)
+}
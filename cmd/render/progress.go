@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// renderProgress counts finished tiles of the current pass for the preview
+// overlay. Passes of abandoned renders never reach the overlay because a new
+// pass resets the counters.
+type renderProgress struct {
+	mu          sync.Mutex
+	stage       string
+	done, total int
+}
+
+func (p *renderProgress) start(stage string, total int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stage, p.done, p.total = stage, 0, total
+}
+
+func (p *renderProgress) tick() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+}
+
+// String returns the overlay text, or "" once the final pass is complete.
+func (p *renderProgress) String() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.total == 0 || p.done >= p.total {
+		return ""
+	}
+	return fmt.Sprintf("%s: %d/%d tiles (%d%%)", p.stage, p.done, p.total, p.done*100/p.total)
+}
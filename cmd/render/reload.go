@@ -0,0 +1,68 @@
+//go:build ebiten
+
+package main
+
+import (
+	"fmt"
+	"grinder/pkg/camera"
+	"grinder/pkg/loader"
+	"grinder/pkg/renderer"
+	"os"
+	"time"
+)
+
+// reloadInterval is how often the preview checks the scene file for edits.
+const reloadInterval = 500 * time.Millisecond
+
+// watchScene polls the scene file at path and sends it, loaded afresh, each
+// time its modification time or size changes. A scene that fails to load
+// is reported and skipped, so the preview keeps the last good one until
+// the next edit. Only the scene file itself is watched, not its includes.
+func watchScene(path string, strict bool, scenes chan<- *loader.Scene) {
+	last, _ := os.Stat(path)
+	for range time.Tick(reloadInterval) {
+		info, err := os.Stat(path)
+		if err != nil || (last != nil && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size()) {
+			continue
+		}
+		last = info
+		sc, err := loader.Options{Strict: strict}.Load(path)
+		if err != nil {
+			fmt.Printf("Error reloading scene, keeping the last good one: %v\n", err)
+			continue
+		}
+		scenes <- sc
+	}
+}
+
+// reload swaps the preview's scene for sc and renders it afresh. The orbit
+// stays where it was navigated to unless the scene's camera itself was
+// edited, when it moves to the new camera. Edits made in the preview are
+// replaced by the file's.
+func (g *Game) reload(sc *loader.Scene) {
+	pc, ok := sc.Camera.(*camera.PerspectiveCamera)
+	if !ok {
+		fmt.Println("Error reloading scene: the preview needs a perspective camera, keeping the last good scene")
+		return
+	}
+	v := g.view
+	v.shapes, v.light, v.atmos, v.near, v.far = sc.Shapes, *sc.Light, sc.Atmosphere, sc.Near, sc.Far
+	v.env, v.background = sc.Environment, sc.Background
+	v.shutter = pc.GetShutter()
+	if !sameView(pc, g.sceneCam) {
+		fit := renderer.NewRenderer(pc, sc.Shapes, *sc.Light, g.full.Width, g.full.Height, g.full.MinSize, sc.Near, sc.Far, sc.Atmosphere)
+		fit.FitDepthPlanes()
+		v.lookFrom(pc, (fit.Near+fit.Far)/2)
+	}
+	g.sceneCam = pc
+	g.selected = min(g.selected, len(v.shapes))
+	fmt.Println("Scene reloaded.")
+	v.render(g.fullRenderer())
+}
+
+// sameView reports whether a and b look from the same place in the same
+// direction through the same lens.
+func sameView(a, b *camera.PerspectiveCamera) bool {
+	return b != nil && a.Position == b.Position && a.Forward == b.Forward && a.Up == b.Up &&
+		a.FovScale == b.FovScale && a.Aspect == b.Aspect
+}
@@ -3,8 +3,10 @@ package main
 import (
 	"flag"
 	"fmt"
+	gimage "grinder/pkg/image"
 	"grinder/pkg/loader"
 	"grinder/pkg/renderer"
+	"grinder/pkg/shading"
 	"image"
 	"image/draw"
 	"image/png"
@@ -12,43 +14,96 @@ import (
 	"os"
 	"runtime"
 	"sync"
+	"time"
 )
 
 func main() {
-	scenePath := flag.String("scene", "", "Path to the scene JSON file")
+	scenePath := flag.String("scene", "", "Path to the scene file (.json, .yaml or .yml)")
+	aa := flag.Bool("aa", false, "Anti-alias silhouettes using sub-pixel coverage")
+	ss := flag.Int("ss", 1, "Supersampling factor: render at ss x resolution and box-downsample")
+	strict := flag.Bool("strict", false, "reject unknown fields in the scene file")
+	regionFlag := flag.String("region", "", "Only render the output pixels x0,y0,x1,y1 (x1,y1 exclusive)")
+	basePath := flag.String("base", "", "Previous render to keep outside -region (default: transparent)")
+	outPath := flag.String("out", "render.png", "Output image path (.png, .jpg, .jpeg or .ppm), or - for PNG on stdout")
+	quality := flag.Int("quality", gimage.DefaultQuality, "JPEG quality (1-100)")
+	samplerName := flag.String("sampler", "jittered", "Soft shadow sampling pattern: jittered, mj or bluenoise")
+	headlamp := flag.Float64("headlamp", 0, "Replace the scene light with one at the camera of this intensity (0 disables)")
+	noEarlyOut := flag.Bool("noearlyout", false, "Dice octants hidden behind nearer surfaces too (for debugging)")
+	prepass := flag.Bool("prepass", false, "Find solid occluders in a coarse depth pre-pass first, to skip more hidden octants")
+	statsFlag := flag.Bool("stats", false, "Report timing and ray and node counts on stderr")
 	flag.Parse()
 
 	if *scenePath == "" {
-		fmt.Println("Error: Scene file not provided.")
-		fmt.Println("Usage: go run ./cmd/render_headless -scene=<path_to_scene.json>")
+		fmt.Fprintln(os.Stderr, "Error: Scene file not provided.")
+		fmt.Fprintln(os.Stderr, "Usage: go run ./cmd/render_headless -scene=<path_to_scene.json>")
 		os.Exit(1)
 	}
 
-	cam, scene, light, atmos, near, far, shutter, err := loader.LoadScene(*scenePath)
+	sampler, err := renderer.ParseLightSampler(*samplerName)
 	if err != nil {
-		fmt.Printf("Error loading scene: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	width, height := 512, 512
-	rndr := renderer.NewRenderer(cam, scene, *light, width, height, 0.004, near, far, atmos, shutter)
-	rndr.FitDepthPlanes()
+	sc, err := loader.Options{Strict: *strict}.Load(*scenePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading scene: %v\n", err)
+		os.Exit(1)
+	}
 
-	fmt.Println("Rendering...")
+	if *headlamp > 0 {
+		// The renderer draws the frame with the camera at its start.
+		light := shading.Headlamp(sc.Camera.AtTime(0).GetEye(), *headlamp)
+		sc.Light = &light
+	}
+
+	outWidth, outHeight := 512, 512
+	ssFactor := max(1, *ss)
+	region := image.Rect(0, 0, outWidth, outHeight)
+	if *regionFlag != "" {
+		if region, err = parseRegion(*regionFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		region = region.Intersect(image.Rect(0, 0, outWidth, outHeight))
+	}
+	var base *image.RGBA
+	if *basePath != "" {
+		if base, err = loadBase(*basePath, outWidth, outHeight); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	// Tiles are rendered at the supersampled resolution and resolved on save.
+	width, height := outWidth*ssFactor, outHeight*ssFactor
+	rndr := renderer.NewRenderer(sc.Camera, sc.Shapes, *sc.Light, width, height, 0.004, sc.Near, sc.Far, sc.Atmosphere)
+	rndr.FitDepthPlanes()
+	rndr.Environment = sc.Environment
+	rndr.Background = sc.Background
+	rndr.AntiAlias = *aa
+	rndr.NoEarlyOut = *noEarlyOut
+	rndr.DepthPrepass = *prepass
+	rndr.Sampler = sampler
+	var stats *renderer.Stats
+	if *statsFlag {
+		stats = rndr.CollectStats()
+	}
 
-	// --- Tiling and Concurrency ---
-	const tileSize = 64
-	const overdraw = 1
-	numTilesX := width / tileSize
-	numTilesY := height / tileSize
+	fmt.Fprintln(os.Stderr, "Rendering...")
+	start := time.Now()
 
-	type RenderJob struct {
-		RenderBounds renderer.ScreenBounds
-		DrawBounds   image.Rectangle
+	// The region in supersampled pixels; tiles are clipped to it.
+	renderRegion := image.Rect(region.Min.X*ssFactor, region.Min.Y*ssFactor, region.Max.X*ssFactor, region.Max.Y*ssFactor)
+	tiles := rndr.Tiles(renderRegion)
+	for i := range tiles {
+		tiles[i] = tiles[i].Intersect(renderRegion)
 	}
 
-	jobs := make(chan RenderJob, numTilesX*numTilesY)
-	var wg sync.WaitGroup
+	// A small -region may leave cores idle; let each tile dice its
+	// quadrants in parallel instead.
+	if n := runtime.NumCPU(); len(tiles) > 0 && len(tiles) < n {
+		rndr.SplitWorkers = n / len(tiles)
+	}
 
 	finalImage := image.NewRGBA(image.Rect(0, 0, width, height))
 	var mu sync.Mutex
@@ -57,53 +112,52 @@ func main() {
 		mu.Lock()
 		defer mu.Unlock()
 
-		f, err := os.Create("render.png")
-		if err != nil {
-			log.Fatalf("Failed to create render.png: %v", err)
+		out := renderer.Downsample(finalImage, ssFactor)
+		if base != nil {
+			draw.Draw(base, region, out, region.Min, draw.Src)
+			out = base
 		}
-		defer f.Close()
-
-		if err := png.Encode(f, finalImage); err != nil {
-			log.Fatalf("Failed to encode PNG: %v", err)
+		if err := gimage.WriteImage(*outPath, out, *quality); err != nil {
+			log.Fatal(err)
 		}
-		fmt.Println("Saved to render.png")
+		fmt.Fprintf(os.Stderr, "Saved to %s\n", *outPath)
 	}
 
-	worker := func() {
-		for job := range jobs {
-			tileImg := rndr.Render(job.RenderBounds)
-			mu.Lock()
-			draw.Draw(finalImage, job.DrawBounds, tileImg, image.Point{overdraw, overdraw}, draw.Src)
-			mu.Unlock()
-			wg.Done()
-		}
+	rndr.RenderTiles(finalImage, &mu, tiles, nil, nil)
+	if stats != nil {
+		stats.Report(os.Stderr, time.Since(start))
 	}
+	fmt.Fprintln(os.Stderr, "Render complete. Saving...")
+	saveImage()
+}
 
-	totalTiles := numTilesX * numTilesY
-	wg.Add(totalTiles)
-
-	for i := 0; i < runtime.NumCPU(); i++ {
-		go worker()
+// parseRegion parses "x0,y0,x1,y1" into a rectangle.
+func parseRegion(s string) (image.Rectangle, error) {
+	var r image.Rectangle
+	if _, err := fmt.Sscanf(s, "%d,%d,%d,%d", &r.Min.X, &r.Min.Y, &r.Max.X, &r.Max.Y); err != nil {
+		return r, fmt.Errorf("invalid -region %q, want x0,y0,x1,y1: %w", s, err)
 	}
+	if r.Empty() {
+		return r, fmt.Errorf("invalid -region %q: empty rectangle", s)
+	}
+	return r, nil
+}
 
-	go func() {
-		for y := 0; y < height; y += tileSize {
-			for x := 0; x < width; x += tileSize {
-				jobs <- RenderJob{
-					RenderBounds: renderer.ScreenBounds{
-						MinX: x - overdraw,
-						MinY: y - overdraw,
-						MaxX: x + tileSize + overdraw,
-						MaxY: y + tileSize + overdraw,
-					},
-					DrawBounds: image.Rect(x, y, x+tileSize, y+tileSize),
-				}
-			}
-		}
-		close(jobs)
-	}()
-
-	wg.Wait()
-	fmt.Println("Render complete. Saving...")
-	saveImage()
+// loadBase reads a previous render to composite the region over.
+func loadBase(path string, width, height int) (*image.RGBA, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open base image: %w", err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode base image: %w", err)
+	}
+	if b := img.Bounds(); b.Dx() != width || b.Dy() != height {
+		return nil, fmt.Errorf("base image is %dx%d, want %dx%d", b.Dx(), b.Dy(), width, height)
+	}
+	base := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(base, base.Bounds(), img, img.Bounds().Min, draw.Src)
+	return base, nil
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"grinder/pkg/math"
+	gomath "math"
+)
+
+// bloomSigmas are the blur radii, in pixels, of the glow scales summed by
+// bloom: a tight core and a wider, softer halo.
+var bloomSigmas = []float64{2, 8}
+
+// bloom adds a glow around pixels brighter than threshold. The energy above
+// the threshold is blurred at each of bloomSigmas and added back to hdr,
+// scaled by intensity and averaged over the scales. hdr holds w*h linear
+// colors and is modified in place, before tone mapping or clamping.
+func bloom(hdr []math.Point3D, w, h int, threshold, intensity float64) {
+	bright := make([]math.Point3D, len(hdr))
+	found := false
+	for i, c := range hdr {
+		b := math.Point3D{
+			X: gomath.Max(0, c.X-threshold),
+			Y: gomath.Max(0, c.Y-threshold),
+			Z: gomath.Max(0, c.Z-threshold),
+		}
+		if b != (math.Point3D{}) {
+			found = true
+		}
+		bright[i] = b
+	}
+	if !found {
+		return
+	}
+
+	scale := intensity / float64(len(bloomSigmas))
+	for _, sigma := range bloomSigmas {
+		glow := gaussianBlur(bright, w, h, sigma)
+		for i := range hdr {
+			hdr[i] = hdr[i].Add(glow[i].Mul(scale))
+		}
+	}
+}
+
+// gaussianBlur returns src blurred by a separable Gaussian of the given
+// standard deviation, clamping at the image edges.
+func gaussianBlur(src []math.Point3D, w, h int, sigma float64) []math.Point3D {
+	radius := int(gomath.Ceil(3 * sigma))
+	kernel := make([]float64, 2*radius+1)
+	var sum float64
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = gomath.Exp(-d * d / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+
+	tmp := make([]math.Point3D, len(src))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var acc math.Point3D
+			for k, wt := range kernel {
+				sx := min(max(x+k-radius, 0), w-1)
+				acc = acc.Add(src[y*w+sx].Mul(wt))
+			}
+			tmp[y*w+x] = acc
+		}
+	}
+	out := make([]math.Point3D, len(src))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var acc math.Point3D
+			for k, wt := range kernel {
+				sy := min(max(y+k-radius, 0), h-1)
+				acc = acc.Add(tmp[sy*w+x].Mul(wt))
+			}
+			out[y*w+x] = acc
+		}
+	}
+	return out
+}
@@ -4,47 +4,86 @@ import (
 	"flag"
 	"fmt"
 	"grinder/pkg/camera"
+	"grinder/pkg/geometry"
+	gimage "grinder/pkg/image"
 	"grinder/pkg/loader"
 	"grinder/pkg/math"
 	"grinder/pkg/renderer"
 	"grinder/pkg/shading"
 	"image"
-	"image/color"
-	"image/png"
 	gomath "math"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
+	"time"
 )
 
 func main() {
-	scenePath := flag.String("scene", "", "path to scene JSON file (optional, uses header if omitted)")
+	scenePath := flag.String("scene", "", "path to scene JSON file (optional, uses the scene stored in the bake, or its camera, if omitted)")
 	bakedPath := flag.String("baked", "final.bin", "path to baked scene binary")
-	outPath := flag.String("out", "trace.png", "output image path")
+	outPath := flag.String("out", "trace.png", "output image path (.png, .jpg, .jpeg, .ppm or unclamped .pfm), or - for PNG on stdout")
+	quality := flag.Int("quality", gimage.DefaultQuality, "JPEG quality (1-100)")
 	width := flag.Int("width", 800, "image width")
 	height := flag.Int("height", 800, "image height")
 	samples := flag.Int("samples", 4, "samples per pixel")
 	memLimit := flag.Int64("memlimit", 2048, "memory limit in MB for in-memory loading (default 2GB)")
+	strict := flag.Bool("strict", false, "reject unknown fields in the scene file")
+	autofit := flag.Bool("autofit", true, "fit near/far to the baked scene bounds")
+	bloomIntensity := flag.Float64("bloom", 0, "strength of the glow around bright pixels (0 disables)")
+	bloomThreshold := flag.Float64("bloomThreshold", 1.0, "linear brightness above which pixels bloom")
+	vignette := flag.Float64("vignette", 0, "darken the image toward its corners by this strength (0 disables)")
+	aberration := flag.Float64("aberration", 0, "chromatic aberration: red/blue offset in pixels at the corners (0 disables)")
+	motion := flag.Bool("motion", false, "spread each pixel's samples across the shutter (time-varying rays)")
+	shutterFlag := flag.Float64("shutter", -1, "shutter length for -motion (default: the scene's shutter, or 1)")
+	headlamp := flag.Float64("headlamp", 0, "replace the scene light with one at the camera of this intensity (0 disables)")
+	smooth := flag.Bool("smooth", false, "blend each hit atom's color and normal with its neighbours to hide the voxel grid (costs a lookup per hit)")
+	validatePath := flag.String("validate", "", "also render the scene live at the same camera, report the per-pixel difference and write a difference heatmap to this path")
+	aa := flag.Bool("aa", false, "with -validate, anti-alias the live render's silhouettes as cmd/render_headless -aa does")
+	samplerName := flag.String("sampler", "jittered", "with -validate, the live render's soft shadow sampling pattern: jittered, mj or bluenoise")
+	statsFlag := flag.Bool("stats", false, "report timing and ray, node and atom counts on stderr (each row is a tile)")
 	flag.Parse()
 
+	sampler, err := renderer.ParseLightSampler(*samplerName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
 	scene, err := renderer.LoadBakedScene(*bakedPath, *memLimit*1024*1024)
 	if err != nil {
-		fmt.Printf("Error loading baked scene: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error loading baked scene: %v\n", err)
 		os.Exit(1)
 	}
 	defer scene.Close()
+	var stats *renderer.Stats
+	if *statsFlag {
+		stats = &renderer.Stats{}
+		scene.Stats = stats
+	}
 
-	        var cam camera.Camera
-	        var near, far float64
-			var light *shading.Light
-	        if *scenePath != "" {
-	                var err error
-	                cam, _, light, _, near, far, _, err = loader.LoadScene(*scenePath)
-	                if err != nil {
-	                        fmt.Printf("Error loading scene: %v\n", err)
-	                        os.Exit(1)
-	                }
-	        } else {		// Use camera from header
+	var cam camera.Camera
+	var near, far float64
+	var light *shading.Light
+	var sky shading.Environment = defaultSky
+	var shapes []geometry.Shape
+	sc, err := loadScene(scene, *scenePath, *bakedPath, *strict)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading scene: %v\n", err)
+		os.Exit(1)
+	}
+	if *validatePath != "" && sc == nil {
+		fmt.Fprintln(os.Stderr, "Error: -validate needs the scene, from -scene or stored in the bake")
+		os.Exit(1)
+	}
+	if sc != nil {
+		cam, light, near, far = sc.Camera, sc.Light, sc.Near, sc.Far
+		shapes = sc.Shapes
+		if sc.Background != nil {
+			sky = sc.Background
+		}
+	} else { // Use camera from header
 		bc := scene.Header.BakeCamera
 		cam = camera.NewLookAtCamera(
 			math.Point3D{X: float64(bc.Eye[0]), Y: float64(bc.Eye[1]), Z: float64(bc.Eye[2])},
@@ -56,14 +95,40 @@ func main() {
 		near, far = float64(bc.Near), float64(bc.Far)
 	}
 
+	// The scene's planes are traced as infinite, beyond the bake bounds.
+	w := newWorld(scene, shapes)
+	w.smooth = *smooth
+
+	if *headlamp > 0 {
+		// This stands for the frame's start, which -validate renders; each
+		// traced ray takes the headlamp from the camera at its own time.
+		l := shading.Headlamp(cam.AtTime(0).GetEye(), *headlamp)
+		light = &l
+	}
+
+	if *autofit {
+		if n, f, ok := scene.Header.FitDepthPlanes(cam.GetEye()); ok {
+			near, far = n, f
+		}
+	}
 	if near == 0 {
 		near = 0.1
 	}
+	shutter := cam.GetShutter()
+	if *shutterFlag >= 0 {
+		shutter = *shutterFlag
+	}
+	if !*motion {
+		shutter = 0
+	}
+	cam = camera.WithShutter(cam, shutter)
 	if far == 0 {
 		far = 50.0
 	}
 
-	img := image.NewRGBA(image.Rect(0, 0, *width, *height))
+	// Colors are accumulated unclamped so post effects see the full range.
+	hdr := make([]math.Point3D, *width**height)
+	start := time.Now()
 
 	numCPUs := runtime.NumCPU()
 	var wg sync.WaitGroup
@@ -83,160 +148,273 @@ func main() {
 			prng := math.NewXorShift32(uint32(cpuID + 1))
 
 			for y := startY; y < endY; y++ {
+				rowStart := time.Now()
 				for x := 0; x < *width; x++ {
 					var colorSum math.Point3D
 					for s := 0; s < *samples; s++ {
 						fx := (float64(x) + prng.NextFloat64()) / float64(*width)
 						fy := (float64(y) + prng.NextFloat64()) / float64(*height)
 
-						pNear := cam.Project(fx, fy, near)
-						pFar := cam.Project(fx, fy, far)
+						t := rayTime(s, *samples, shutter, prng)
+						c := cam.AtTime(t)
+						pNear := c.Project(fx, fy, near)
+						pFar := c.Project(fx, fy, far)
 						rayDir := pFar.Sub(pNear).Normalize()
-						ray := math.Ray{Origin: pNear, Direction: rayDir}
-
-						                                                colorSum = colorSum.Add(trace(ray, scene, light, 0, prng))					}
-					avg := colorSum.Mul(1.0 / float64(*samples))
-					img.Set(x, y, color.RGBA{
-						R: uint8(gomath.Min(255, avg.X*255)),
-						G: uint8(gomath.Min(255, avg.Y*255)),
-						B: uint8(gomath.Min(255, avg.Z*255)),
-						A: 255,
-					})
+						ray := math.Ray{Origin: pNear, Direction: rayDir, Time: t}
+
+						colorSum = colorSum.Add(trace(ray, w, rayLight(light, *headlamp, c), sky, 0, prng))
+					}
+					hdr[y**width+x] = colorSum.Mul(1.0 / float64(*samples))
+				}
+				if stats != nil {
+					stats.PrimaryRays.Add(int64(*width * *samples))
+					stats.AddTile(time.Since(rowStart))
 				}
 			}
 		}(cpu)
 	}
 
 	wg.Wait()
-
-	f, err := os.Create(*outPath)
-	if err != nil {
-		fmt.Printf("Error creating output file: %v\n", err)
-		os.Exit(1)
+	if stats != nil {
+		stats.Report(os.Stderr, time.Since(start))
 	}
-	png.Encode(f, img)
-	f.Close()
-	fmt.Printf("Trace complete. Saved to %s\n", *outPath)
-}
 
-func trace(ray math.Ray, scene *renderer.BakedScene, light *shading.Light, depth int, prng *math.XorShift32) math.Point3D {
-	if depth > 2 {
-		return math.Point3D{}
+	if *bloomIntensity > 0 {
+		bloom(hdr, *width, *height, *bloomThreshold, *bloomIntensity)
 	}
-
-	hit, atom := scene.Intersect(ray)
-	if !hit {
-		return math.Point3D{X: 0.05, Y: 0.05, Z: 0.1} // Dark blue sky
+	if strings.EqualFold(filepath.Ext(*outPath), ".pfm") {
+		// PFM keeps the unclamped float buffer; the 8-bit lens effects
+		// don't apply.
+		rgb := make([]float32, 0, len(hdr)*3)
+		for _, c := range hdr {
+			rgb = append(rgb, float32(c.X), float32(c.Y), float32(c.Z))
+		}
+		if err := gimage.WritePFM(*outPath, *width, *height, rgb); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Trace complete. Saved to %s\n", *outPath)
+		return
+	}
+	img := image.NewRGBA(image.Rect(0, 0, *width, *height))
+	for y := 0; y < *height; y++ {
+		for x := 0; x < *width; x++ {
+			c := hdr[y**width+x]
+			img.Set(x, y, math.ClampColor(c.Mul(255)))
+		}
 	}
 
-	pos := math.Point3D{X: float64(atom.Pos[0]), Y: float64(atom.Pos[1]), Z: float64(atom.Pos[2])}
-	normal := renderer.OctDecode(atom.Normal)
-	albedo := math.Point3D{X: float64(atom.Albedo[0]) / 255, Y: float64(atom.Albedo[1]) / 255, Z: float64(atom.Albedo[2]) / 255}
-
-		            // Direct Light
-
-		            var direct math.Point3D
-
-		            if light != nil {
-
-		                    var shadowContribution math.Point3D // Accumulate light contribution
-
-		                    numShadowSamples := light.Samples   // Use the configured number of samples for the light
-
-		                    if numShadowSamples <= 0 {
-
-		                            numShadowSamples = 1 // Ensure at least one sample
-
-		                    }
-
-		
-
-		                    for s := 0; s < numShadowSamples; s++ { // Loop for shadow samples
-
-		                            lightPos := light.Position
-
-		                            if light.Radius > 0 {
-
-		                                    u, v := prng.NextFloat64(), prng.NextFloat64()
-
-		                                    theta := 2 * gomath.Pi * u
-
-		                                    phi := gomath.Acos(2*v - 1)
-
-		                                    lightPos = lightPos.Add(math.Point3D{
-
-		                                            X: light.Radius * gomath.Sin(phi) * gomath.Cos(theta),
-
-		                                            Y: light.Radius * gomath.Sin(phi) * gomath.Sin(theta),
-
-		                                            Z: light.Radius * gomath.Cos(phi),
-
-		                                    })
-
-		                            }
-
-		
-
-		                            lDir := lightPos.Sub(pos).Normalize()
-
-		
-
-		                            // Shadow ray
+	if *validatePath != "" {
+		fmt.Fprintln(os.Stderr, "Rendering live for validation...")
+		live := renderLive(sc, cam, *light, *width, *height, near, far, *aa, sampler)
+		if err := validate(os.Stderr, img, live, *validatePath, *quality); err != nil {
+			fmt.Fprintf(os.Stderr, "Error validating: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
-		                            shadowRayOrigin := pos.Add(normal.Mul(float64(atom.HalfExtent) * 2.0))
+	if *aberration > 0 {
+		img = gimage.ChromaticAberration(img, *aberration)
+	}
+	if *vignette > 0 {
+		gimage.Vignette(img, *vignette)
+	}
 
-		                            shadowRay := math.Ray{Origin: shadowRayOrigin, Direction: lDir}
+	if err := gimage.WriteImage(*outPath, img, *quality); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Trace complete. Saved to %s\n", *outPath)
+}
 
-		
+// rayTime returns the shutter time for sample s of n in a pixel. The shutter
+// is split into n strata with one jittered time in each, so the samples cover
+// it evenly. The baked scene is static today, but the time rides along every
+// path so animated geometry blurs correctly once the tracer can see it.
+func rayTime(s, n int, shutter float64, prng *math.XorShift32) float64 {
+	if shutter <= 0 || n <= 0 {
+		return 0
+	}
+	return (float64(s) + prng.NextFloat64()) / float64(n) * shutter
+}
 
-		                            if !scene.IntersectP(shadowRay) { // If not in shadow for this sample
+// rayLight returns the light for a ray from camera c: the scene light or,
+// with a positive headlamp intensity, a headlamp at c's eye, so that it
+// follows an animated camera across the shutter.
+func rayLight(light *shading.Light, headlamp float64, c camera.Camera) *shading.Light {
+	if headlamp <= 0 {
+		return light
+	}
+	l := shading.Headlamp(c.GetEye(), headlamp)
+	return &l
+}
 
-		                                    lCol := math.Point3D{X: light.Intensity, Y: light.Intensity, Z: light.Intensity}  
+// loadScene loads the scene file at scenePath or, without one, the scene
+// document stored in the bake, resolving the files it names next to
+// bakedPath. It returns nil if the bake stored none either.
+func loadScene(scene *renderer.BakedScene, scenePath, bakedPath string, strict bool) (*loader.Scene, error) {
+	if scenePath != "" {
+		return loader.Options{Strict: strict}.Load(scenePath)
+	}
+	doc, err := scene.SceneJSON()
+	if err != nil || doc == nil {
+		return nil, err
+	}
+	return loader.Options{Strict: strict}.Parse(doc, bakedPath)
+}
 
-		                                    dot := gomath.Max(0.0, normal.Dot(lDir))
+// defaultSky is what rays that escape the scene see when the scene file
+// sets no background.
+var defaultSky = shading.UniformEnvironment{Color: math.Point3D{X: 0.05, Y: 0.05, Z: 0.1}} // Dark blue sky
+
+// maxBounce is the last path vertex that still receives direct light.
+const maxBounce = 2
+
+// maxTransmissions is how many surfaces of glass a path may pass through
+// without them counting as bounces: a ray has to both enter and leave each
+// piece, often across several shell atoms.
+const maxTransmissions = 8
+
+// trace follows one camera path. Every vertex gets next-event estimation
+// through sampleDirect, weighted by the path throughput so far. The light is
+// not scene geometry, so escaping rays never pick up its emission twice.
+func trace(ray math.Ray, scene *world, light *shading.Light, sky shading.Environment, depth int, prng *math.XorShift32) math.Point3D {
+	var radiance math.Point3D
+	throughput := math.Point3D{X: 1, Y: 1, Z: 1}
+	transmissions := 0
+	for ; depth <= maxBounce; depth++ {
+		hit, atom := scene.Intersect(ray)
+		if !hit {
+			return radiance.Add(mulColor(throughput, sky.Radiance(ray.Direction)))
+		}
+
+		pos := atomPos(atom)
+		normal := renderer.OctDecode(atom.Normal)
+		albedo := math.Point3D{X: float64(atom.Albedo[0]) / 255, Y: float64(atom.Albedo[1]) / 255, Z: float64(atom.Albedo[2]) / 255}
+		origin := offsetOrigin(pos, normal, atom)
+
+		mat := scene.Material(atom.MaterialID)
+		emission := math.Point3D{X: float64(mat.Emission[0]), Y: float64(mat.Emission[1]), Z: float64(mat.Emission[2])}
+		radiance = radiance.Add(mulColor(throughput, emission))
+		albedo = mulColor(albedo, math.Point3D{X: float64(mat.Tint[0]), Y: float64(mat.Tint[1]), Z: float64(mat.Tint[2])})
+		throughput = mulColor(throughput, albedo)
+
+		if mat.Opacity < 1 && prng.NextFloat64() >= float64(mat.Opacity) {
+			// Glass lets the rest of the light through, bent at its surface,
+			// and gets no direct light.
+			ray, throughput = transmit(ray, pos, normal, atom, mat, throughput, prng)
+			if transmissions < maxTransmissions {
+				transmissions++
+				depth--
+			}
+			continue
+		}
+		if prng.NextFloat64() < float64(mat.Metalness) {
+			// Metals reflect around the mirror direction, blurred by roughness,
+			// and get no diffuse direct light.
+			mirror := ray.Direction.Sub(normal.Mul(2 * ray.Direction.Dot(normal)))
+			dir := mirror.Add(sampleHemisphere(normal, prng).Mul(float64(mat.Roughness))).Normalize()
+			if dir.Dot(normal) <= 0 {
+				dir = mirror
+			}
+			ray = math.Ray{Origin: origin, Direction: dir, Time: ray.Time}
+			continue
+		}
+
+		radiance = radiance.Add(mulColor(throughput, sampleDirect(origin, normal, ray.Time, scene, light, prng)))
+		// Baked ambient occlusion darkens what bounces in from around the
+		// atom, such as in crevices the atoms' gaps let light into.
+		throughput = throughput.Mul(scene.AtomAO(atom))
+
+		// Cosine-weighted sampling: the cosine term cancels against the PDF,
+		// leaving only the albedo already folded into the throughput.
+		ray = math.Ray{Origin: origin, Direction: sampleHemisphere(normal, prng), Time: ray.Time}
+	}
+	return radiance
+}
 
-		                                    shadowContribution = shadowContribution.Add(lCol.Mul(dot))
+// offsetOrigin lifts a hit off the atom's surface for the rays leaving it.
+// The atom's size, twice its half extent, clears it and its neighbours;
+// plane hits have no extent and only need to clear rounding.
+func offsetOrigin(pos, normal math.Point3D, atom renderer.BakedAtom) math.Point3D {
+	return pos.Add(normal.Mul(shading.ShadowBias(pos, 2*float64(atom.HalfExtent))))
+}
 
-		                            }
+// sampleDirect estimates the light arriving at a surface point by casting
+// light.Samples shadow rays towards points on the (spherical) light at shutter
+// time t.
+func sampleDirect(origin, normal math.Point3D, t float64, scene *world, light *shading.Light, prng *math.XorShift32) math.Point3D {
+	if light == nil {
+		return math.Point3D{}
+	}
+	numShadowSamples := light.Samples
+	if numShadowSamples <= 0 {
+		numShadowSamples = 1 // Ensure at least one sample
+	}
 
-		                    }
+	lightDist := light.Position.Sub(origin).Length()
+	var sum float64
+	for s := 0; s < numShadowSamples; s++ {
+		lDir := sampleLight(origin, normal, light, prng)
+		if cos := normal.Dot(lDir); cos > 0 {
+			sum += cos * scene.Transmittance(math.Ray{Origin: origin, Direction: lDir, Time: t}, lightDist)
+		}
+	}
+	falloff := light.Falloff(lightDist)
+	return light.Radiance().Mul(falloff * sum / float64(numShadowSamples))
+}
 
-		                    direct = shadowContribution.Mul(1.0 / float64(numShadowSamples)) // Average the contributions     
+// sampleLight returns a unit direction from origin towards a point on the
+// light. When the light sphere is in front of the surface, directions are
+// drawn uniformly from the cone it subtends, so no sample is wasted on its far
+// side. Otherwise (the light straddles the surface or contains origin) points
+// are drawn uniformly from the sphere's volume.
+func sampleLight(origin, normal math.Point3D, light *shading.Light, prng *math.XorShift32) math.Point3D {
+	toLight := light.Position.Sub(origin)
+	dist := toLight.Length()
+	if light.Radius <= 0 {
+		return toLight.Normalize()
+	}
+	axis := toLight.Mul(1 / dist)
+	if dist > light.Radius && normal.Dot(axis) > 0 {
+		sinMax := light.Radius / dist
+		cosMax := gomath.Sqrt(1 - sinMax*sinMax)
+		cosTheta := 1 - prng.NextFloat64()*(1-cosMax)
+		sinTheta := gomath.Sqrt(gomath.Max(0, 1-cosTheta*cosTheta))
+		phi := 2 * gomath.Pi * prng.NextFloat64()
+		var up math.Point3D
+		if gomath.Abs(axis.Y) < 0.9 {
+			up = math.Point3D{X: 0, Y: 1, Z: 0}
+		} else {
+			up = math.Point3D{X: 1, Y: 0, Z: 0}
+		}
+		tangent := axis.Cross(up).Normalize()
+		bitangent := axis.Cross(tangent)
+		return axis.Mul(cosTheta).
+			Add(tangent.Mul(sinTheta * gomath.Cos(phi))).
+			Add(bitangent.Mul(sinTheta * gomath.Sin(phi))).Normalize()
+	}
 
-		            }
-	            // Indirect Bounce
-	            var indirect math.Point3D
-	            if depth < 2 {
-	                    nextDir := sampleHemisphere(normal, prng)
-	                    // Offset by 2.0 times the atom's half-extent to avoid self-intersection
-	                    offset := normal.Mul(float64(atom.HalfExtent) * 2.0)
-	                    nextRayOrigin := pos.Add(offset)
-	                    nextRay := math.Ray{Origin: nextRayOrigin, Direction: nextDir}
-	                    indirect = trace(nextRay, scene, light, depth+1, prng).Mul(0.5)
-	            }
+	u, v := prng.NextFloat64(), prng.NextFloat64()
+	theta := 2 * gomath.Pi * u
+	phi := gomath.Acos(2*v - 1)
+	lightPos := light.Position.Add(math.Point3D{
+		X: light.Radius * gomath.Sin(phi) * gomath.Cos(theta),
+		Y: light.Radius * gomath.Sin(phi) * gomath.Sin(theta),
+		Z: light.Radius * gomath.Cos(phi),
+	})
+	return lightPos.Sub(origin).Normalize()
+}
 
-	res := direct.Add(indirect)
-	return math.Point3D{X: albedo.X * res.X, Y: albedo.Y * res.Y, Z: albedo.Z * res.Z}
+// mulColor multiplies two RGB triples component-wise.
+func mulColor(a, b math.Point3D) math.Point3D {
+	return math.Point3D{X: a.X * b.X, Y: a.Y * b.Y, Z: a.Z * b.Z}
 }
+
+// sampleHemisphere returns a cosine-weighted direction about n; see
+// math.CosineHemisphere.
 func sampleHemisphere(n math.Point3D, prng *math.XorShift32) math.Point3D {
 	u1 := prng.NextFloat64()
 	u2 := prng.NextFloat64()
-
-	r := gomath.Sqrt(1.0 - u1*u1)
-	phi := 2.0 * gomath.Pi * u2
-
-	x := r * gomath.Cos(phi)
-	y := r * gomath.Sin(phi)
-	z := u1
-
-	var up math.Point3D
-	if gomath.Abs(n.Y) < 0.9 {
-		up = math.Point3D{X: 0, Y: 1, Z: 0}
-	} else {
-		up = math.Point3D{X: 1, Y: 0, Z: 0}
-	}
-	tangent := n.Cross(up).Normalize()
-	bitangent := n.Cross(tangent).Normalize()
-
-	return tangent.Mul(x).Add(bitangent.Mul(y)).Add(n.Mul(z)).Normalize()
+	return math.CosineHemisphere(n, u1, u2)
 }
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"grinder/pkg/camera"
+	"grinder/pkg/geometry"
+	"grinder/pkg/loader"
+	"grinder/pkg/math"
+	"grinder/pkg/renderer"
+	"grinder/pkg/shading"
+	"image/color"
+	gomath "math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// bakeTestScene bakes engine's scene into a temporary directory and loads
+// it back, returning the scene and the path of the baked file. The scene is
+// closed when the test ends.
+func bakeTestScene(t testing.TB, engine *renderer.BakeEngine) (*renderer.BakedScene, string) {
+	t.Helper()
+	dir := t.TempDir()
+	final := filepath.Join(dir, "final.bin")
+	if err := engine.Bake(filepath.Join(dir, "temp.bin"), final); err != nil {
+		t.Fatalf("Bake failed: %v", err)
+	}
+	scene, err := renderer.LoadBakedScene(final)
+	if err != nil {
+		t.Fatalf("LoadBakedScene failed: %v", err)
+	}
+	t.Cleanup(func() { scene.Close() })
+	return scene, final
+}
+
+// TestTrace_Furnace bakes a white diffuse sphere and lights it only with a
+// uniform white environment. With correct importance weighting every path
+// returns the environment color, so the estimate must not darken.
+func TestTrace_Furnace(t *testing.T) {
+	eye := math.Point3D{X: 0, Y: 0, Z: 5}
+	target := math.Point3D{X: 0, Y: 0, Z: 0}
+	up := math.Point3D{X: 0, Y: 1, Z: 0}
+	cam := camera.NewLookAtCamera(eye, target, up, 45, 1)
+	shapes := []geometry.Shape{
+		geometry.Sphere3D{Center: target, Radius: 1, Color: color.RGBA{R: 255, G: 255, B: 255, A: 255}},
+	}
+	engine := renderer.NewBakeEngine(cam, shapes, shading.Light{}, 64, 64, 0.05, 3, 7, target, up, 45)
+	scene, _ := bakeTestScene(t, engine)
+
+	sky := shading.UniformEnvironment{Color: math.Point3D{X: 1, Y: 1, Z: 1}}
+	prng := math.NewXorShift32(7)
+	var sum float64
+	var hits int
+	for i := 0; i < 2000; i++ {
+		fx := 0.4 + 0.2*prng.NextFloat64()
+		fy := 0.4 + 0.2*prng.NextFloat64()
+		pNear, pFar := cam.Project(fx, fy, engine.Near), cam.Project(fx, fy, engine.Far)
+		ray := math.Ray{Origin: pNear, Direction: pFar.Sub(pNear).Normalize()}
+		if hit, _ := scene.Intersect(ray); !hit {
+			continue
+		}
+		hits++
+		sum += trace(ray, newWorld(scene, nil), nil, sky, 0, prng).X
+	}
+	if hits < 1000 {
+		t.Fatalf("expected most rays to hit the sphere, got %d", hits)
+	}
+	if mean := sum / float64(hits); mean < 0.9 || mean > 1.01 {
+		t.Errorf("furnace mean = %.3f, want ~1 (environment color)", mean)
+	}
+}
+
+func TestBloom(t *testing.T) {
+	const w, h = 32, 32
+	hdr := make([]math.Point3D, w*h)
+	for i := range hdr {
+		hdr[i] = math.Point3D{X: 0.5, Y: 0.5, Z: 0.5}
+	}
+	dim := append([]math.Point3D(nil), hdr...)
+	bloom(dim, w, h, 1, 1)
+	for i := range dim {
+		if dim[i] != hdr[i] {
+			t.Fatalf("pixel %d changed from %v to %v with nothing above the threshold", i, hdr[i], dim[i])
+		}
+	}
+
+	hdr[16*w+16] = math.Point3D{X: 50, Y: 50, Z: 50}
+	bloom(hdr, w, h, 1, 1)
+	near, far := hdr[16*w+19].X, hdr[16*w+28].X
+	if near <= 0.5 || far <= 0.5 {
+		t.Errorf("expected a halo around the bright pixel, got %v at 3px and %v at 12px", near, far)
+	}
+	if near <= far {
+		t.Errorf("expected the halo to fade with distance, got %v at 3px and %v at 12px", near, far)
+	}
+}
+
+func TestSampleLight_Cone(t *testing.T) {
+	origin := math.Point3D{}
+	normal := math.Point3D{X: 0, Y: 1, Z: 0}
+	light := &shading.Light{Position: math.Point3D{X: 1, Y: 3, Z: 0}, Radius: 2}
+	toLight := light.Position.Sub(origin)
+	dist := toLight.Length()
+	cosMax := gomath.Sqrt(1 - (light.Radius/dist)*(light.Radius/dist))
+	prng := math.NewXorShift32(3)
+	for i := 0; i < 5000; i++ {
+		d := sampleLight(origin, normal, light, prng)
+		if gomath.Abs(d.Length()-1) > 1e-9 {
+			t.Fatalf("sample %d: direction %v is not unit length", i, d)
+		}
+		// Every direction must hit the light sphere, i.e. lie in its cone.
+		if c := d.Dot(toLight) / dist; c < cosMax-1e-9 {
+			t.Fatalf("sample %d: direction %v is outside the light's cone (cos %v < %v)", i, d, c, cosMax)
+		}
+	}
+}
+
+// TestRayLight_Headlamp flies a keyframed camera across the shutter: a ray
+// traced at each end takes its headlamp from the camera's eye at that time,
+// and without a headlamp the scene light is kept.
+func TestRayLight_Headlamp(t *testing.T) {
+	up := math.Point3D{X: 0, Y: 1, Z: 0}
+	cam := camera.NewLookAtCamera(math.Point3D{Z: 5}, math.Point3D{}, up, 45, 1)
+	cam.Motion = &camera.Motion{
+		Eye: math.Motion{Keyframes: []math.Keyframe{
+			{Time: 0, Position: math.Point3D{Z: 5}},
+			{Time: 1, Position: math.Point3D{X: 5}},
+		}},
+		Target: math.Motion{Keyframes: []math.Keyframe{{Time: 0, Position: math.Point3D{}}}},
+	}
+	scene := &shading.Light{Position: math.Point3D{Y: 10}, Intensity: 1}
+	for _, tt := range []struct {
+		time float64
+		want math.Point3D
+	}{{0, math.Point3D{Z: 5}}, {0.5, math.Point3D{X: 2.5, Z: 2.5}}, {1, math.Point3D{X: 5}}} {
+		l := rayLight(scene, 2, cam.AtTime(tt.time))
+		if l.Position.Sub(tt.want).Length() > 1e-9 || l.Intensity != 2 {
+			t.Errorf("headlamp at t=%v: %v at intensity %v, want %v at 2", tt.time, l.Position, l.Intensity, tt.want)
+		}
+	}
+	if l := rayLight(scene, 0, cam.AtTime(1)); l != scene {
+		t.Errorf("rayLight without a headlamp = %+v, want the scene light", l)
+	}
+}
+
+// TestRayTime checks that a pixel's samples land one per shutter stratum and
+// collapse to time 0 without a shutter.
+func TestRayTime(t *testing.T) {
+	prng := math.NewXorShift32(3)
+	const n, shutter = 8, 0.5
+	for s := 0; s < n; s++ {
+		got := rayTime(s, n, shutter, prng)
+		lo, hi := float64(s)/n*shutter, float64(s+1)/n*shutter
+		if got < lo || got >= hi {
+			t.Errorf("sample %d: time %v outside stratum [%v, %v)", s, got, lo, hi)
+		}
+	}
+	if got := rayTime(3, n, 0, prng); got != 0 {
+		t.Errorf("rayTime with no shutter = %v, want 0", got)
+	}
+}
+
+// TestRefract checks Snell's law going into and out of glass, the Fresnel
+// share at normal incidence and total internal reflection.
+func TestRefract(t *testing.T) {
+	const ior = 1.5
+	n := math.Point3D{Y: 1}
+	in := math.Point3D{X: gomath.Sin(0.5), Y: -gomath.Cos(0.5)}
+	dir, r := refract(in, n, ior)
+	if sinT := dir.X; gomath.Abs(sinT*ior-gomath.Sin(0.5)) > 1e-9 || dir.Y >= 0 {
+		t.Errorf("entering: direction %v breaks Snell's law for sin %v", dir, gomath.Sin(0.5))
+	}
+	if r <= 0 || r >= 1 {
+		t.Errorf("entering: reflectance %v, want in (0, 1)", r)
+	}
+	// The far face of a slab faces the other way.
+	out, _ := refract(dir, n.Mul(-1), ior)
+	if out.Sub(in).Length() > 1e-9 {
+		t.Errorf("leaving a slab: direction %v, want the incoming %v", out, in)
+	}
+	if _, r := refract(math.Point3D{Y: -1}, n, ior); gomath.Abs(r-0.04) > 1e-9 {
+		t.Errorf("normal incidence reflectance = %v, want 0.04", r)
+	}
+	// Inside, past the critical angle of about 41.8 degrees.
+	if _, r := refract(math.Point3D{X: gomath.Sin(0.8), Y: gomath.Cos(0.8)}, n, ior); r != 1 {
+		t.Errorf("reflectance past the critical angle = %v, want 1", r)
+	}
+}
+
+// TestRefract_Prism sends a beam through a 60 degree glass wedge. A
+// dispersive glass must fan the channels out with blue bent furthest; one
+// without dispersion must not.
+func TestRefract_Prism(t *testing.T) {
+	// Outward normals of the wedge's two faces, 60 degrees apart.
+	entry := math.Point3D{X: -gomath.Cos(gomath.Pi / 6), Y: gomath.Sin(gomath.Pi / 6)}
+	exit := math.Point3D{X: gomath.Cos(gomath.Pi / 6), Y: gomath.Sin(gomath.Pi / 6)}
+	beam := math.Point3D{X: 1}
+	through := func(ior float64) math.Point3D {
+		in, _ := refract(beam, entry, ior)
+		out, r := refract(in, exit, ior)
+		if r == 1 {
+			t.Fatalf("beam was trapped in the wedge at index %v", ior)
+		}
+		return out
+	}
+	deviation := func(d math.Point3D) float64 { return gomath.Acos(d.Dot(beam)) }
+
+	var dev [3]float64
+	for c, wl := range shading.ChannelWavelengths {
+		dev[c] = deviation(through(shading.DispersedIOR(1.5, 30, wl)))
+	}
+	if !(dev[2] > dev[1] && dev[1] > dev[0]) {
+		t.Errorf("deviations red %v, green %v, blue %v: want blue > green > red", dev[0], dev[1], dev[2])
+	}
+	if spread := dev[2] - dev[0]; spread < 0.005 {
+		t.Errorf("red to blue spread %v rad is too small to see a fringe", spread)
+	}
+	plain := deviation(through(1.5))
+	for _, wl := range shading.ChannelWavelengths {
+		if d := deviation(through(shading.DispersedIOR(1.5, 0, wl))); d != plain {
+			t.Errorf("glass without dispersion deviates %v at %v nm, want %v", d, wl, plain)
+		}
+	}
+}
+
+// TestTransmit_Dispersion checks that a dispersive material sends each path
+// on in one color channel, at three times its weight, and a plain glass in
+// all three.
+func TestTransmit_Dispersion(t *testing.T) {
+	ray := math.Ray{Origin: math.Point3D{Y: 1}, Direction: math.Point3D{X: 0.6, Y: -0.8}}
+	normal := math.Point3D{Y: 1}
+	atom := renderer.BakedAtom{HalfExtent: 0.01}
+	white := math.Point3D{X: 1, Y: 1, Z: 1}
+	prng := math.NewXorShift32(5)
+	var channels math.Point3D
+	for i := 0; i < 300; i++ {
+		mat := renderer.BakedMaterial{IOR: 1.5, Opacity: 0.1, Dispersion: 30}
+		_, tp := transmit(ray, math.Point3D{}, normal, atom, mat, white, prng)
+		if tp != (math.Point3D{X: 3}) && tp != (math.Point3D{Y: 3}) && tp != (math.Point3D{Z: 3}) {
+			t.Fatalf("dispersive throughput = %v, want one channel at 3", tp)
+		}
+		channels = channels.Add(tp)
+	}
+	if channels.X == 0 || channels.Y == 0 || channels.Z == 0 {
+		t.Errorf("channels followed = %v, want all three", channels)
+	}
+	next, tp := transmit(ray, math.Point3D{}, normal, atom, renderer.BakedMaterial{IOR: 1.5, Opacity: 0.1}, white, prng)
+	if tp != white {
+		t.Errorf("plain glass throughput = %v, want %v", tp, white)
+	}
+	if next.Direction.Dot(normal) < 0 && next.Origin.Y >= 0 {
+		t.Errorf("refracted ray starts at %v, above the surface it went through", next.Origin)
+	}
+}
+
+// TestWorld_GroundPlane checks that every downward ray hits the scene's
+// ground plane, far outside the bake bounds as well as inside them.
+func TestWorld_GroundPlane(t *testing.T) {
+	eye := math.Point3D{X: 0, Y: 1, Z: 5}
+	target := math.Point3D{X: 0, Y: 0, Z: 0}
+	up := math.Point3D{X: 0, Y: 1, Z: 0}
+	cam := camera.NewLookAtCamera(eye, target, up, 45, 1)
+	shapes := []geometry.Shape{
+		geometry.Sphere3D{Center: target, Radius: 1, Color: color.RGBA{R: 255, A: 255}},
+		geometry.Plane3D{Point: math.Point3D{Y: -1}, Normal: math.Normal3D{Y: 1}, Color: color.RGBA{G: 255, A: 255}},
+	}
+	engine := renderer.NewBakeEngine(cam, shapes, shading.Light{}, 32, 32, 0.05, 3, 7, target, up, 45)
+	scene, _ := bakeTestScene(t, engine)
+	w := newWorld(scene, shapes)
+
+	prng := math.NewXorShift32(5)
+	for i := 0; i < 500; i++ {
+		// Origins spread well past the bake, at heights above the sphere.
+		origin := math.Point3D{X: prng.NextFloat64()*200 - 100, Y: 2 + prng.NextFloat64()*10, Z: prng.NextFloat64()*200 - 100}
+		d := math.Point3D{X: prng.NextFloat64()*2 - 1, Y: -0.1 - prng.NextFloat64(), Z: prng.NextFloat64()*2 - 1}
+		ray := math.Ray{Origin: origin, Direction: d.Normalize()}
+		hit, atom := w.Intersect(ray)
+		if !hit {
+			t.Fatalf("ray %v missed the ground", ray)
+		}
+		if atom.MaterialID == 1 && gomath.Abs(float64(atom.Pos[1])+1) > 0.2 {
+			t.Errorf("ray %v hit the ground at %v, want y = -1", ray, atom.Pos)
+		}
+	}
+}
+
+// TestWorld_TranslucentShadow checks that a shadow ray through a baked glass
+// sphere keeps most of its light while a solid sphere blocks it.
+func TestWorld_TranslucentShadow(t *testing.T) {
+	eye := math.Point3D{X: 0, Y: 0, Z: 8}
+	target := math.Point3D{X: 0, Y: 0, Z: 0}
+	up := math.Point3D{X: 0, Y: 1, Z: 0}
+	cam := camera.NewLookAtCamera(eye, target, up, 45, 1)
+	shapes := []geometry.Shape{
+		geometry.Translucent{Shape: geometry.Sphere3D{Center: math.Point3D{X: -1.5}, Radius: 1, Color: color.RGBA{R: 255, G: 255, B: 255, A: 255}}, Opacity: 0.2},
+		geometry.Sphere3D{Center: math.Point3D{X: 1.5}, Radius: 1, Color: color.RGBA{R: 255, A: 255}},
+	}
+	engine := renderer.NewBakeEngine(cam, shapes, shading.Light{}, 32, 32, 0.02, 3, 13, target, up, 45)
+	scene, _ := bakeTestScene(t, engine)
+	w := newWorld(scene, shapes)
+
+	toLight := math.Point3D{Y: 1}
+	glass := w.Transmittance(math.Ray{Origin: math.Point3D{X: -1.5, Y: -3}, Direction: toLight}, 10)
+	if gomath.Abs(glass-0.8) > 1e-6 {
+		t.Errorf("transmittance through glass = %v, want 0.8", glass)
+	}
+	if solid := w.Transmittance(math.Ray{Origin: math.Point3D{X: 1.5, Y: -3}, Direction: toLight}, 10); solid != 0 {
+		t.Errorf("transmittance through a solid = %v, want 0", solid)
+	}
+	if clear := w.Transmittance(math.Ray{Origin: math.Point3D{X: 4, Y: -3}, Direction: toLight}, 10); clear != 1 {
+		t.Errorf("transmittance past both spheres = %v, want 1", clear)
+	}
+}
+
+// TestWorld_ShadowPastLight checks that a solid sphere shadows a light
+// beyond it but not one short of it, on the opaque-only path that
+// Transmittance takes for scenes with nothing translucent.
+func TestWorld_ShadowPastLight(t *testing.T) {
+	eye := math.Point3D{X: 0, Y: 0, Z: 8}
+	target := math.Point3D{X: 0, Y: 0, Z: 0}
+	up := math.Point3D{X: 0, Y: 1, Z: 0}
+	cam := camera.NewLookAtCamera(eye, target, up, 45, 1)
+	shapes := []geometry.Shape{
+		geometry.Sphere3D{Center: target, Radius: 1, Color: color.RGBA{R: 255, A: 255}},
+	}
+	engine := renderer.NewBakeEngine(cam, shapes, shading.Light{}, 32, 32, 0.02, 3, 13, target, up, 45)
+	scene, _ := bakeTestScene(t, engine)
+	w := newWorld(scene, shapes)
+
+	ray := math.Ray{Origin: math.Point3D{Y: -4}, Direction: math.Point3D{Y: 1}}
+	if beyond := w.Transmittance(ray, 8); beyond != 0 {
+		t.Errorf("transmittance to a light beyond the sphere = %v, want 0", beyond)
+	}
+	if short := w.Transmittance(ray, 2); short != 1 {
+		t.Errorf("transmittance to a light short of the sphere = %v, want 1", short)
+	}
+}
+
+// TestOffsetOrigin_Scale bakes a sphere resting on a much larger one, at a
+// tiny scale away from the origin and at a large scale. In both, the open
+// floor must be lit (no acne) and the floor in the sphere's umbra shadowed
+// (no detached shadow).
+func TestOffsetOrigin_Scale(t *testing.T) {
+	tests := []struct {
+		name   string
+		scale  float64
+		offset math.Point3D
+	}{
+		{"tiny", 1e-3, math.Point3D{X: 10, Y: 5, Z: -8}},
+		{"large", 1e3, math.Point3D{}},
+	}
+	for _, tt := range tests {
+		at := func(x, y, z float64) math.Point3D {
+			return math.Point3D{X: x, Y: y, Z: z}.Mul(tt.scale).Add(tt.offset)
+		}
+		// Looking down, so the bake sees the floor around the sphere and
+		// the sphere's lit side.
+		eye, target, up := at(0, 8, 0.5), at(0, 0, 0), math.Point3D{Z: -1}
+		cam := camera.NewLookAtCamera(eye, target, up, 45, 1)
+		shapes := []geometry.Shape{
+			geometry.Sphere3D{Center: at(0, -21, 0), Radius: 20 * tt.scale, Color: color.RGBA{R: 200, G: 200, B: 200, A: 255}},
+			geometry.Sphere3D{Center: target, Radius: tt.scale, Color: color.RGBA{R: 255, A: 255}},
+		}
+		dist := eye.Sub(target).Length()
+		engine := renderer.NewBakeEngine(cam, shapes, shading.Light{}, 32, 32, 0.01, dist-2*tt.scale, dist+3*tt.scale, target, up, 45)
+		scene, _ := bakeTestScene(t, engine)
+		w := newWorld(scene, shapes)
+		light := at(10, 10, 0)
+
+		// shadowAt drops a ray onto the floor from height y and returns the
+		// light reaching the hit, or -1 on a miss.
+		shadowAt := func(x, y, z float64) float64 {
+			hit, atom := w.Intersect(math.Ray{Origin: at(x, y, z), Direction: math.Point3D{Y: -1}})
+			if !hit || atom.MaterialID != 0 {
+				return -1
+			}
+			pos := atomPos(atom)
+			origin := offsetOrigin(pos, renderer.OctDecode(atom.Normal), atom)
+			toLight := light.Sub(origin)
+			return w.Transmittance(math.Ray{Origin: origin, Direction: toLight.Normalize()}, toLight.Length())
+		}
+		// The bake only keeps what its camera saw, so some drops find a hole
+		// and are skipped.
+		var open, umbra, acne, detached int
+		for i := 0; i < 400; i++ {
+			// Open floor on the light's side of the sphere.
+			a, r := (float64(i%20)/19-0.5)*gomath.Pi*2/3, 1.5+float64(i/20)*0.05
+			if v := shadowAt(r*gomath.Cos(a), 2, r*gomath.Sin(a)); v >= 0 {
+				open++
+				if v != 1 {
+					acne++
+				}
+			}
+			// The umbra the sphere casts away from the light.
+			x, z := -1.2-float64(i%20)*0.035, (float64(i/20)/19-0.5)*0.5
+			if v := shadowAt(x, 2, z); v >= 0 {
+				umbra++
+				if v != 0 {
+					detached++
+				}
+			}
+		}
+		scene.Close()
+		if open < 100 || umbra < 100 {
+			t.Fatalf("%s: only %d open and %d umbra floor points found", tt.name, open, umbra)
+		}
+		if acne > 0 {
+			t.Errorf("%s: %d of %d open floor points in shadow", tt.name, acne, open)
+		}
+		if detached > 0 {
+			t.Errorf("%s: %d of %d points in the umbra lit", tt.name, detached, umbra)
+		}
+	}
+}
+
+// TestLoadScene_FromBake bakes a scene with its document stored in the bake,
+// then loads it back without the scene file and recovers the light.
+func TestLoadScene_FromBake(t *testing.T) {
+	dir := t.TempDir()
+	scenePath := filepath.Join(dir, "scene.json")
+	doc := `{
+		"camera": {"eye": {"x": 0, "y": 0, "z": 5}, "target": {"x": 0, "y": 0, "z": 0}, "up": {"x": 0, "y": 1, "z": 0}, "fov": 45, "aspect": 1, "near": 3, "far": 7},
+		"light": {"position": {"x": 1, "y": 2, "z": 3}, "intensity": 0.8},
+		"shapes": [{"type": "sphere", "center": {"x": 0, "y": 0, "z": 0}, "radius": 1}]
+	}`
+	if err := os.WriteFile(scenePath, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sc, err := loader.Load(scenePath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	sceneJSON, err := loader.ReadJSON(scenePath)
+	if err != nil {
+		t.Fatalf("ReadJSON failed: %v", err)
+	}
+	up := math.Point3D{Y: 1}
+	engine := renderer.NewBakeEngine(sc.Camera, sc.Shapes, *sc.Light, 64, 64, 0.05, sc.Near, sc.Far, math.Point3D{}, up, 45)
+	engine.Compress = true
+	engine.SceneJSON = sceneJSON
+	scene, final := bakeTestScene(t, engine)
+	os.Remove(scenePath)
+
+	got, err := loadScene(scene, "", final, true)
+	if err != nil {
+		t.Fatalf("loadScene failed: %v", err)
+	}
+	if got == nil {
+		t.Fatal("loadScene found no scene in the bake")
+	}
+	if want := (math.Point3D{X: 1, Y: 2, Z: 3}); got.Light.Position != want || got.Light.Intensity != 0.8 {
+		t.Errorf("light at %v with intensity %v, want %v with 0.8", got.Light.Position, got.Light.Intensity, want)
+	}
+	if len(got.Shapes) != 1 {
+		t.Errorf("got %d shapes, want 1", len(got.Shapes))
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"grinder/pkg/math"
+	"grinder/pkg/renderer"
+	"grinder/pkg/shading"
+	gomath "math"
+)
+
+// refract bends the unit direction d through a surface with outward normal
+// n between air and a medium of index ior, by Snell's law. It also returns
+// the share of the light the surface reflects instead, by Schlick's
+// approximation of the Fresnel term; total internal reflection reflects all
+// of it and leaves no refracted direction.
+func refract(d, n math.Point3D, ior float64) (math.Point3D, float64) {
+	eta := 1 / ior
+	cosI := -d.Dot(n)
+	if cosI < 0 { // leaving the medium
+		n, eta, cosI = n.Mul(-1), ior, -cosI
+	}
+	k := 1 - eta*eta*(1-cosI*cosI)
+	if k < 0 {
+		return math.Point3D{}, 1
+	}
+	cosT := gomath.Sqrt(k)
+	r0 := (1 - eta) / (1 + eta)
+	r0 *= r0
+	// Schlick's formula takes the angle on the side of the thinner medium.
+	c := cosI
+	if eta > 1 {
+		c = cosT
+	}
+	return d.Mul(eta).Add(n.Mul(eta*cosI - cosT)), r0 + (1-r0)*gomath.Pow(1-c, 5)
+}
+
+// transmit carries a path on through the glass it hit: the material lets
+// 1-Opacity of the light through, reflecting the Fresnel share of it. A
+// dispersive material bends each color channel by its own index, so the
+// path picks one channel at random to follow and carries it at three times
+// its weight, which keeps the estimate of the full spectrum unbiased.
+func transmit(ray math.Ray, pos, normal math.Point3D, atom renderer.BakedAtom, mat renderer.BakedMaterial, throughput math.Point3D, prng *math.XorShift32) (math.Ray, math.Point3D) {
+	ior := float64(mat.IOR)
+	if mat.Dispersion > 0 {
+		c := min(int(prng.NextFloat64()*3), 2)
+		ior = shading.DispersedIOR(ior, float64(mat.Dispersion), shading.ChannelWavelengths[c])
+		var channel [3]float64
+		channel[c] = 3
+		throughput = mulColor(throughput, math.Point3D{X: channel[0], Y: channel[1], Z: channel[2]})
+	}
+	dir, reflectance := refract(ray.Direction, normal, ior)
+	if prng.NextFloat64() < reflectance {
+		dir = ray.Direction.Sub(normal.Mul(2 * ray.Direction.Dot(normal)))
+	}
+	side := normal
+	if dir.Dot(normal) < 0 {
+		side = normal.Mul(-1)
+	}
+	return math.Ray{Origin: offsetOrigin(pos, side, atom), Direction: dir, Time: ray.Time}, throughput
+}
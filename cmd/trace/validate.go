@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"grinder/pkg/camera"
+	gimage "grinder/pkg/image"
+	"grinder/pkg/loader"
+	"grinder/pkg/renderer"
+	"grinder/pkg/shading"
+	"image"
+	"io"
+	"sync"
+)
+
+// renderLive renders sc's shapes with the live renderer from cam, the way
+// cmd/render_headless does with -aa and -sampler, for comparison with the
+// traced bake.
+func renderLive(sc *loader.Scene, cam camera.Camera, light shading.Light, width, height int, near, far float64, antiAlias bool, sampler renderer.LightSampler) *image.RGBA {
+	rndr := renderer.NewRenderer(cam, sc.Shapes, light, width, height, 0.004, near, far, sc.Atmosphere)
+	rndr.Environment = sc.Environment
+	rndr.Background = sc.Background
+	rndr.AntiAlias = antiAlias
+	rndr.Sampler = sampler
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	var mu sync.Mutex
+	rndr.RenderTiles(img, &mu, rndr.Tiles(img.Bounds()), nil, nil)
+	return img
+}
+
+// validate compares the traced image with the live one, reports their mean
+// and largest per-pixel difference to w and writes the difference heatmap
+// to heatPath. Dropped geometry and wrong normals show up as hot regions;
+// the path tracer's noise and bounce light as a faint haze.
+func validate(w io.Writer, traced, live *image.RGBA, heatPath string, quality int) error {
+	heat, mean, worst, err := gimage.Diff(traced, live)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Bake vs live: mean difference %.2f%%, max %.2f%%\n", 100*mean, 100*worst)
+	if err := gimage.WriteImage(heatPath, heat, quality); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Difference heatmap saved to %s\n", heatPath)
+	return nil
+}
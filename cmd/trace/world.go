@@ -0,0 +1,140 @@
+package main
+
+import (
+	"grinder/pkg/geometry"
+	"grinder/pkg/math"
+	"grinder/pkg/renderer"
+	gomath "math"
+)
+
+// scenePlane is an infinite plane from the scene file, tagged with the
+// material ID the bake gave its clipped atoms. shape is the plane as the
+// scene file wraps it, which may color it with a texture.
+type scenePlane struct {
+	geometry.Plane3D
+	shape geometry.Shape
+	id    uint8
+}
+
+// world is what the tracer shoots rays at: the baked atoms plus the scene's
+// infinite planes, which the bake can only store clipped to its bounds.
+type world struct {
+	*renderer.BakedScene
+	planes []scenePlane
+	// translucent is set when some baked material lets light through, so
+	// shadow rays have to look past their first hit.
+	translucent bool
+	// smooth blends each hit atom with its neighbours (see
+	// renderer.BakedScene.Smooth).
+	smooth bool
+}
+
+// newWorld pairs scene with the planes among shapes. Shapes are numbered the
+// way the bake numbers them, by their index in the scene file.
+func newWorld(scene *renderer.BakedScene, shapes []geometry.Shape) *world {
+	w := &world{BakedScene: scene}
+	for _, m := range scene.Header.Materials {
+		if m.Opacity > 0 && m.Opacity < 1 {
+			w.translucent = true
+		}
+	}
+	for i, s := range shapes {
+		if pl, ok := geometry.Unwrap(s).(geometry.Plane3D); ok {
+			w.planes = append(w.planes, scenePlane{Plane3D: pl, shape: s, id: uint8(i)})
+		}
+	}
+	return w
+}
+
+// Intersect returns the nearer of the baked atom hit and the analytic plane
+// hits. A plane hit comes back as an atom with no extent at the exact
+// crossing point. Where the ray meets the plane's own baked atoms they are
+// kept, so bounce and shadow rays leave them with the atom's offset rather
+// than grazing them.
+func (w *world) Intersect(ray math.Ray) (bool, renderer.BakedAtom) {
+	hit, atom := w.BakedScene.Intersect(ray)
+	best := gomath.Inf(1)
+	if hit && w.smooth {
+		atom = w.Smooth(atom, ray)
+	}
+	if hit {
+		best = atomPos(atom).Sub(ray.Origin).Length()
+	}
+	for _, pl := range w.planes {
+		t, ok := pl.IntersectRay(ray)
+		if !ok || t >= best || (hit && atom.MaterialID == pl.id) {
+			continue
+		}
+		p := ray.Origin.Add(ray.Direction.Mul(t))
+		c := pl.shape.GetColorAt(p, ray.Time)
+		hit, best = true, t
+		atom = renderer.BakedAtom{
+			Pos:        [3]float32{float32(p.X), float32(p.Y), float32(p.Z)},
+			Normal:     renderer.OctEncode(pl.NormalAtPoint(p, ray.Time).ToVector().Normalize()),
+			Albedo:     [3]uint8{c.R, c.G, c.B},
+			MaterialID: pl.id,
+			AO:         255, // the bake's occlusion doesn't cover the infinite plane
+		}
+	}
+	return hit, atom
+}
+
+// maxShadowHits caps the translucent atoms one shadow ray steps through;
+// a ray still inside them after that many is treated as blocked.
+const maxShadowHits = 64
+
+// minShadowStep is the least a shadow ray advances past a translucent atom.
+const minShadowStep = 1e-6
+
+// Transmittance returns the fraction of light that gets along ray to tMax.
+// Planes and opaque atoms block it. Each translucent shape it enters dims
+// it by 1-opacity: consecutive atoms of one shape, such as the front and
+// back of a glass sphere's shell, count once.
+func (w *world) Transmittance(ray math.Ray, tMax float64) float64 {
+	if w.Stats != nil {
+		w.Stats.ShadowRays.Add(1)
+	}
+	for _, pl := range w.planes {
+		if t, ok := pl.IntersectRay(ray); ok && t < tMax {
+			return 0
+		}
+	}
+	if !w.translucent {
+		if w.BakedScene.IntersectP(ray, tMax) {
+			return 0
+		}
+		return 1
+	}
+	transmitted, last := 1.0, -1
+	for i := 0; i < maxShadowHits; i++ {
+		hit, atom := w.BakedScene.Intersect(ray)
+		if !hit {
+			return transmitted
+		}
+		t := atomPos(atom).Sub(ray.Origin).Dot(ray.Direction)
+		if t > tMax {
+			return transmitted
+		}
+		opacity := float64(w.Material(atom.MaterialID).Opacity)
+		if opacity >= 1 {
+			return 0
+		}
+		if int(atom.MaterialID) != last {
+			transmitted *= 1 - opacity
+			last = int(atom.MaterialID)
+		}
+		// Step out of the atom's box and keep looking. Its centre can lie
+		// behind the origin, so the step is the box's exit distance, kept
+		// positive so the ray always moves on.
+		_, exit, _ := atom.Bounds().IntersectRay(ray)
+		step := max(exit, minShadowStep)
+		ray.Origin = ray.Origin.Add(ray.Direction.Mul(step))
+		tMax -= step
+	}
+	return 0
+}
+
+// atomPos returns an atom's position in double precision.
+func atomPos(a renderer.BakedAtom) math.Point3D {
+	return math.Point3D{X: float64(a.Pos[0]), Y: float64(a.Pos[1]), Z: float64(a.Pos[2])}
+}
@@ -4,7 +4,9 @@ go 1.24.3
 
 require (
 	github.com/hajimehoshi/ebiten/v2 v2.9.7
+	github.com/klauspost/compress v1.18.0
 	golang.org/x/exp v0.0.0-20260112195511-716be5621a96
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,32 @@
+package camera
+
+import (
+	"grinder/pkg/geometry"
+	"grinder/pkg/math"
+	gomath "math"
+)
+
+// autoFrameDir is the direction from the scene toward an auto-framed eye:
+// in front of it and a little above.
+var autoFrameDir = math.Point3D{X: 0, Y: 0.5, Z: 2}.Normalize()
+
+// AutoFrame returns a camera looking at the bounding sphere of shapes from
+// far enough back that the whole sphere fits the field of view (fov is
+// vertical, in degrees). Infinite shapes such as planes are ignored. With no
+// finite shapes it frames the unit sphere at the origin.
+func AutoFrame(shapes []geometry.Shape, aspect, fov float64) *PerspectiveCamera {
+	center, radius, ok := geometry.BoundingSphere(shapes)
+	if !ok || radius == 0 {
+		center, radius = math.Point3D{}, 1
+	}
+	return NewLookAtCamera(center.Add(autoFrameDir.Mul(FrameDistance(radius, aspect, fov))), center, math.Point3D{X: 0, Y: 1, Z: 0}, fov, aspect)
+}
+
+// FrameDistance returns how far from its center a sphere of the given radius
+// must be viewed to fit a field of view (vertical, in degrees) on the
+// narrower axis.
+func FrameDistance(radius, aspect, fov float64) float64 {
+	tanHalf := gomath.Tan(fov * 0.5 * gomath.Pi / 180)
+	half := gomath.Atan(tanHalf * gomath.Min(1, aspect))
+	return radius / gomath.Sin(half)
+}
@@ -0,0 +1,65 @@
+package camera
+
+import (
+	"grinder/pkg/math"
+	gomath "math"
+)
+
+// boundsGrid is how many segments each screen axis of a box is split into
+// when bounding it for a non-perspective camera.
+const boundsGrid = 4
+
+// Bounds returns a world-space AABB enclosing every point Project maps the
+// screen-space box (x, y in screen units, z in depth) to. A perspective
+// camera maps the box to a convex frustum slice, so its eight corners are
+// exact. Other cameras bend rays across the box; for them a grid of rays is
+// sampled at the near and far depths and the result is padded by how far the
+// curved far surface can bulge past the flat patches between samples.
+func Bounds(c Camera, box math.AABB3D) math.AABB3D {
+	first := true
+	var res math.AABB3D
+	add := func(p math.Point3D) {
+		if first {
+			res = math.AABB3D{Min: p, Max: p}
+			first = false
+		} else {
+			res = res.Expand(p)
+		}
+	}
+	if _, ok := c.(*PerspectiveCamera); ok {
+		for _, p := range box.GetCorners() {
+			add(c.Project(p.X, p.Y, p.Z))
+		}
+		return res
+	}
+
+	eye := c.GetEye()
+	var dirs [boundsGrid + 1][boundsGrid + 1]math.Point3D
+	for j := 0; j <= boundsGrid; j++ {
+		sy := box.Min.Y + (box.Max.Y-box.Min.Y)*float64(j)/boundsGrid
+		for i := 0; i <= boundsGrid; i++ {
+			sx := box.Min.X + (box.Max.X-box.Min.X)*float64(i)/boundsGrid
+			add(c.Project(sx, sy, box.Min.Z))
+			add(c.Project(sx, sy, box.Max.Z))
+			dirs[j][i] = c.Project(sx, sy, 1).Sub(eye)
+		}
+	}
+	// The widest angle spanned by any grid cell's diagonal bounds how far its
+	// spherical patch strays from the flat quad through its corners.
+	var widest float64
+	for j := 0; j < boundsGrid; j++ {
+		for i := 0; i < boundsGrid; i++ {
+			widest = gomath.Max(widest, angle(dirs[j][i], dirs[j+1][i+1]))
+			widest = gomath.Max(widest, angle(dirs[j+1][i], dirs[j][i+1]))
+		}
+	}
+	pad := box.Max.Z * (1 - gomath.Cos(widest/2))
+	pv := math.Point3D{X: pad, Y: pad, Z: pad}
+	return math.AABB3D{Min: res.Min.Sub(pv), Max: res.Max.Add(pv)}
+}
+
+// angle returns the angle in radians between two non-zero vectors.
+func angle(a, b math.Point3D) float64 {
+	d := a.Dot(b) / (a.Length() * b.Length())
+	return gomath.Acos(gomath.Max(-1, gomath.Min(1, d)))
+}
@@ -9,24 +9,109 @@ import (
 type Camera interface {
 	Project(sx, sy, z float64) math.Point3D
 	GetEye() math.Point3D
+	// GetShutter returns how much of the frame the shutter stays open for,
+	// from 0 for a still frame to 1 for a whole frame of motion.
+	GetShutter() float64
+	// AtTime returns the camera at time t of the shutter, from 0 at its
+	// start to 1 at its end.
+	AtTime(t float64) Camera
 }
 
 // PerspectiveCamera represents a camera with perspective projection.
 type PerspectiveCamera struct {
 	Position, Forward, Right, Up math.Point3D
 	FovScale, Aspect             float64
+	Shutter                      float64
+	// Motion, if set, moves the camera over the shutter; see AtTime.
+	Motion *Motion
+
+	worldUp math.Point3D // the up vector the camera was built with
+	roll    float64      // degrees rolled since
+}
+
+// Motion is a keyframed camera path: the eye and the point it looks at
+// each follow their own keyframes.
+type Motion struct {
+	Eye, Target math.Motion
 }
 
-// NewLookAtCamera creates a new camera that looks at a target from a given position.
+// NewLookAtCamera creates a new camera that looks at a target from a given
+// position, with its shutter open for the whole frame.
 func NewLookAtCamera(pos, target, up math.Point3D, fov, aspect float64) *PerspectiveCamera {
-	f := target.Sub(pos).Normalize()
-	r := f.Cross(up).Normalize()
-	u := r.Cross(f)
+	f, r, u := lookAtBasis(pos, target, up)
 	return &PerspectiveCamera{
 		Position: pos, Forward: f, Right: r, Up: u,
 		FovScale: gomath.Tan(fov * 0.5 * gomath.Pi / 180.0),
 		Aspect:   aspect,
+		Shutter:  1,
+		worldUp:  up,
+	}
+}
+
+// AtTime returns the camera at time t of its Motion, from 0 at the start of
+// the shutter to 1 at its end, with the same lens, shutter, up vector and
+// roll. A camera without motion returns itself.
+func (c *PerspectiveCamera) AtTime(t float64) Camera {
+	if c.Motion == nil {
+		return c
+	}
+	at := NewLookAtCamera(c.Motion.Eye.At(t), c.Motion.Target.At(t), c.worldUp, c.GetFov(), c.Aspect)
+	at.Roll(c.roll)
+	at.Shutter = c.Shutter
+	return at
+}
+
+// WithShutter returns a copy of c with its shutter open for the given share
+// of the frame. Cameras of other types are returned as they are.
+func WithShutter(c Camera, shutter float64) Camera {
+	switch c := c.(type) {
+	case *PerspectiveCamera:
+		cc := *c
+		cc.Shutter = shutter
+		return &cc
+	case *EquirectangularCamera:
+		cc := *c
+		cc.Shutter = shutter
+		return &cc
+	case *FisheyeCamera:
+		cc := *c
+		cc.Shutter = shutter
+		return &cc
+	}
+	return c
+}
+
+// lookAtBasis returns the orthonormal forward, right and up axes of a camera
+// at pos looking at target. An up vector parallel to the view direction has
+// no usable cross product, so another world axis stands in for it.
+func lookAtBasis(pos, target, up math.Point3D) (f, r, u math.Point3D) {
+	f = target.Sub(pos)
+	if f.Length() == 0 {
+		f = math.Point3D{X: 0, Y: 0, Z: -1}
+	}
+	f = f.Normalize()
+	if f.Cross(up).Length() < 1e-9*up.Length() || up.Length() == 0 {
+		up = math.Point3D{X: 0, Y: 1, Z: 0}
+		if gomath.Abs(f.Y) > 0.9 {
+			up = math.Point3D{X: 0, Y: 0, Z: 1}
+		}
 	}
+	r = f.Cross(up).Normalize()
+	u = r.Cross(f)
+	return f, r, u
+}
+
+// rollBasis rotates the right and up axes about forward by deg degrees,
+// turning right toward up. At 90 degrees right takes the place of up.
+func rollBasis(r, u math.Point3D, deg float64) (math.Point3D, math.Point3D) {
+	sin, cos := gomath.Sincos(deg * gomath.Pi / 180)
+	return r.Mul(cos).Add(u.Mul(sin)), u.Mul(cos).Sub(r.Mul(sin))
+}
+
+// Roll rotates the camera about its forward axis by deg degrees.
+func (c *PerspectiveCamera) Roll(deg float64) {
+	c.Right, c.Up = rollBasis(c.Right, c.Up, deg)
+	c.roll += deg
 }
 
 // Project transforms a screen-space coordinate (sx, sy) and a depth (z) to a 3D world point.
@@ -47,7 +132,27 @@ func (c *PerspectiveCamera) GetEye() math.Point3D {
 
 func (c *PerspectiveCamera) GetForward() math.Point3D { return c.Forward }
 func (c *PerspectiveCamera) GetUp() math.Point3D      { return c.Up }
-func (c *PerspectiveCamera) GetAspect() float64      { return c.Aspect }
+func (c *PerspectiveCamera) GetAspect() float64       { return c.Aspect }
+func (c *PerspectiveCamera) GetShutter() float64      { return c.Shutter }
 func (c *PerspectiveCamera) GetFov() float64 {
 	return 2.0 * gomath.Atan(c.FovScale) * 180.0 / gomath.Pi
 }
+
+// Orientation returns the up vector c was built with and the degrees it has
+// rolled since, which AtTime keeps as the camera moves.
+func (c *PerspectiveCamera) Orientation() (up math.Point3D, roll float64) {
+	return c.worldUp, c.roll
+}
+
+// ScreenPoint is the inverse of Project: it returns the screen coordinate and
+// depth of a world point. Points behind the eye have z <= 0.
+func (c *PerspectiveCamera) ScreenPoint(p math.Point3D) (sx, sy, z float64) {
+	d := p.Sub(c.Position)
+	z = d.Dot(c.Forward)
+	if z <= 0 {
+		return 0, 0, z
+	}
+	nx := d.Dot(c.Right) / (c.Aspect * c.FovScale * z)
+	ny := d.Dot(c.Up) / (c.FovScale * z)
+	return (nx + 1) / 2, (1 - ny) / 2, z
+}
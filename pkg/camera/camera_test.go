@@ -0,0 +1,179 @@
+package camera
+
+import (
+	"grinder/pkg/geometry"
+	"grinder/pkg/math"
+	gomath "math"
+	"testing"
+)
+
+func near(a, b math.Point3D) bool {
+	return a.Sub(b).Length() < 1e-9
+}
+
+func TestEquirectangularCamera_Directions(t *testing.T) {
+	eye := math.Point3D{X: 1, Y: 2, Z: 3}
+	c := NewEquirectangularCamera(eye, eye.Add(math.Point3D{X: 0, Y: 0, Z: -1}), math.Point3D{X: 0, Y: 1, Z: 0})
+	tests := []struct {
+		name   string
+		sx, sy float64
+		want   math.Point3D
+	}{
+		{"center", 0.5, 0.5, math.Point3D{X: 0, Y: 0, Z: -1}},
+		{"right", 0.75, 0.5, math.Point3D{X: 1, Y: 0, Z: 0}},
+		{"left", 0.25, 0.5, math.Point3D{X: -1, Y: 0, Z: 0}},
+		{"behind", 0, 0.5, math.Point3D{X: 0, Y: 0, Z: 1}},
+		{"zenith", 0.3, 0, math.Point3D{X: 0, Y: 1, Z: 0}},
+		{"nadir", 0.3, 1, math.Point3D{X: 0, Y: -1, Z: 0}},
+	}
+	for _, tt := range tests {
+		// Near and far points must lie on the same ray from the eye.
+		pNear, pFar := c.Project(tt.sx, tt.sy, 0.5), c.Project(tt.sx, tt.sy, 20)
+		if !near(pNear, eye.Add(tt.want.Mul(0.5))) || !near(pFar, eye.Add(tt.want.Mul(20))) {
+			t.Errorf("%s: Project = %v, %v, want along %v", tt.name, pNear, pFar, tt.want)
+		}
+	}
+}
+
+func TestBounds_Equirectangular(t *testing.T) {
+	c := NewEquirectangularCamera(math.Point3D{}, math.Point3D{X: 0, Y: 0, Z: -1}, math.Point3D{X: 0, Y: 1, Z: 0})
+	box := math.AABB3D{Min: math.Point3D{X: 0.3, Y: 0.3, Z: 1}, Max: math.Point3D{X: 0.7, Y: 0.6, Z: 10}}
+	b := Bounds(c, box)
+	// Every point the box maps to, including between the grid samples, must
+	// be inside the bounds.
+	for j := 0; j <= 40; j++ {
+		for i := 0; i <= 40; i++ {
+			sx := box.Min.X + (box.Max.X-box.Min.X)*float64(i)/40
+			sy := box.Min.Y + (box.Max.Y-box.Min.Y)*float64(j)/40
+			for _, z := range []float64{box.Min.Z, (box.Min.Z + box.Max.Z) / 2, box.Max.Z} {
+				if p := c.Project(sx, sy, z); !b.Contains(p) {
+					t.Fatalf("point %v at (%v, %v, %v) outside bounds %v", p, sx, sy, z, b)
+				}
+			}
+		}
+	}
+}
+
+func TestBounds_PerspectiveCorners(t *testing.T) {
+	c := NewLookAtCamera(math.Point3D{X: 0, Y: 0, Z: 5}, math.Point3D{}, math.Point3D{X: 0, Y: 1, Z: 0}, 60, 1)
+	box := math.AABB3D{Min: math.Point3D{X: 0, Y: 0, Z: 1}, Max: math.Point3D{X: 1, Y: 1, Z: 2}}
+	b := Bounds(c, box)
+	half := gomath.Tan(gomath.Pi/6) * 2
+	want := math.AABB3D{Min: math.Point3D{X: -half, Y: -half, Z: 3}, Max: math.Point3D{X: half, Y: half, Z: 4}}
+	if !near(b.Min, want.Min) || !near(b.Max, want.Max) {
+		t.Errorf("Bounds = %v, want %v", b, want)
+	}
+}
+
+func TestFisheyeCamera(t *testing.T) {
+	eye := math.Point3D{}
+	for _, mapping := range []FisheyeMapping{Equidistant, Equisolid} {
+		c := NewFisheyeCamera(eye, math.Point3D{X: 0, Y: 0, Z: -1}, math.Point3D{X: 0, Y: 1, Z: 0}, 180, 1, mapping)
+		if d := c.Project(0.5, 0.5, 3); !near(d, math.Point3D{X: 0, Y: 0, Z: -3}) {
+			t.Errorf("mapping %d: screen center projects to %v, want straight ahead", mapping, d)
+		}
+		// The edge of the image circle looks 90 degrees to the side.
+		if d := c.Direction(1, 0.5); !near(d, math.Point3D{X: 1, Y: 0, Z: 0}) {
+			t.Errorf("mapping %d: right edge looks along %v, want +X", mapping, d)
+		}
+		for _, s := range [][2]float64{{0.2, 0.7}, {0.9, 0.1}, {0.5, 0.05}} {
+			sx, sy, z := c.ScreenPoint(c.Project(s[0], s[1], 4))
+			if gomath.Abs(sx-s[0]) > 1e-9 || gomath.Abs(sy-s[1]) > 1e-9 || gomath.Abs(z-4) > 1e-9 {
+				t.Errorf("mapping %d: ScreenPoint(Project(%v)) = %v, %v, %v", mapping, s, sx, sy, z)
+			}
+		}
+	}
+
+	// A straight world line across the top of the view stays straight in a
+	// perspective image but bows toward the center in a fisheye one.
+	fish := NewFisheyeCamera(eye, math.Point3D{X: 0, Y: 0, Z: -1}, math.Point3D{X: 0, Y: 1, Z: 0}, 170, 1, Equidistant)
+	_, syMid, _ := fish.ScreenPoint(math.Point3D{X: 0, Y: 1, Z: -1})
+	_, syEnd, _ := fish.ScreenPoint(math.Point3D{X: 3, Y: 1, Z: -1})
+	if syEnd <= syMid+0.05 {
+		t.Errorf("expected the line to bow toward the center at its end: sy %v at the middle, %v at the end", syMid, syEnd)
+	}
+}
+
+func TestLookAtCamera_Roll(t *testing.T) {
+	eye, target, up := math.Point3D{X: 1, Y: 2, Z: 5}, math.Point3D{}, math.Point3D{X: 0, Y: 1, Z: 0}
+	plain := NewLookAtCamera(eye, target, up, 45, 1)
+	rolled := NewLookAtCamera(eye, target, up, 45, 1)
+	rolled.Roll(90)
+	if !near(rolled.Right, plain.Up) || !near(rolled.Up, plain.Right.Mul(-1)) {
+		t.Errorf("roll 90: right %v up %v, want right %v up %v", rolled.Right, rolled.Up, plain.Up, plain.Right.Mul(-1))
+	}
+	if !near(rolled.Forward, plain.Forward) {
+		t.Errorf("roll changed forward: %v, want %v", rolled.Forward, plain.Forward)
+	}
+}
+
+// TestLookAtCamera_AtTime flies a rolled camera between two keyframes: in
+// between it must sit halfway and keep its lens and roll.
+func TestLookAtCamera_AtTime(t *testing.T) {
+	up := math.Point3D{Y: 1}
+	c := NewLookAtCamera(math.Point3D{Z: 5}, math.Point3D{}, up, 60, 2)
+	c.Roll(30)
+	c.Shutter = 0.5
+	if c.AtTime(0.5) != Camera(c) {
+		t.Error("AtTime of a camera without motion made a new camera")
+	}
+	c.Motion = &Motion{
+		Eye:    math.Motion{Keyframes: []math.Keyframe{{Time: 0, Position: math.Point3D{Z: 5}}, {Time: 1, Position: math.Point3D{X: 4, Z: 5}}}},
+		Target: math.Motion{Keyframes: []math.Keyframe{{Time: 0}, {Time: 1, Position: math.Point3D{X: 4}}}},
+	}
+	mid := c.AtTime(0.5).(*PerspectiveCamera)
+	if !near(mid.Position, math.Point3D{X: 2, Z: 5}) {
+		t.Errorf("eye at 0.5 = %v, want (2, 0, 5)", mid.Position)
+	}
+	// The path slides the camera sideways, so its axes stay put.
+	if !near(mid.Forward, c.Forward) || !near(mid.Right, c.Right) || !near(mid.Up, c.Up) {
+		t.Errorf("basis at 0.5 = %v %v %v, want the rolled %v %v %v", mid.Forward, mid.Right, mid.Up, c.Forward, c.Right, c.Up)
+	}
+	if gomath.Abs(mid.GetFov()-60) > 1e-9 || mid.Aspect != 2 {
+		t.Errorf("lens at 0.5 = fov %v aspect %v, want 60 and 2", mid.GetFov(), mid.Aspect)
+	}
+	if mid.GetShutter() != 0.5 {
+		t.Errorf("shutter at 0.5 = %v, want 0.5", mid.GetShutter())
+	}
+}
+
+func TestLookAtCamera_DegenerateUp(t *testing.T) {
+	for _, up := range []math.Point3D{{X: 0, Y: 1, Z: 0}, {X: 0, Y: -3, Z: 0}, {}} {
+		c := NewLookAtCamera(math.Point3D{X: 0, Y: 5, Z: 0}, math.Point3D{}, up, 45, 1)
+		for _, v := range []math.Point3D{c.Forward, c.Right, c.Up} {
+			if gomath.IsNaN(v.X) || gomath.IsNaN(v.Y) || gomath.IsNaN(v.Z) || gomath.Abs(v.Length()-1) > 1e-9 {
+				t.Fatalf("up %v: basis %v %v %v is not orthonormal", up, c.Forward, c.Right, c.Up)
+			}
+		}
+		if gomath.Abs(c.Forward.Dot(c.Right)) > 1e-9 || gomath.Abs(c.Forward.Dot(c.Up)) > 1e-9 {
+			t.Errorf("up %v: basis is not orthogonal", up)
+		}
+	}
+}
+
+// TestAutoFrame checks that an auto-framed camera sees every shape: points
+// on the bounding sphere must land on screen, and the infinite plane must not
+// push the eye away.
+func TestAutoFrame(t *testing.T) {
+	shapes := []geometry.Shape{
+		geometry.Sphere3D{Center: math.Point3D{X: 10, Y: 0, Z: 0}, Radius: 1},
+		geometry.Box3D{Min: math.Point3D{X: 12, Y: -1, Z: -3}, Max: math.Point3D{X: 14, Y: 2, Z: -1}},
+		geometry.Plane3D{Point: math.Point3D{X: 0, Y: -1, Z: 0}, Normal: math.Normal3D{X: 0, Y: 1, Z: 0}},
+	}
+	center, radius, ok := geometry.BoundingSphere(shapes)
+	if !ok {
+		t.Fatal("BoundingSphere found no finite shapes")
+	}
+	for _, aspect := range []float64{0.5, 1, 2} {
+		c := AutoFrame(shapes, aspect, 45)
+		if d := c.GetEye().Sub(center).Length(); gomath.Abs(d-FrameDistance(radius, aspect, 45)) > 1e-9 {
+			t.Errorf("aspect %v: eye is %v from the center, want %v", aspect, d, FrameDistance(radius, aspect, 45))
+		}
+		for _, dir := range []math.Point3D{{X: 1}, {X: -1}, {Y: 1}, {Y: -1}, {Z: 1}, {Z: -1}} {
+			sx, sy, z := c.ScreenPoint(center.Add(dir.Mul(radius)))
+			if z <= 0 || sx < 0 || sx > 1 || sy < 0 || sy > 1 {
+				t.Errorf("aspect %v: sphere point along %v is off screen at (%v, %v, %v)", aspect, dir, sx, sy, z)
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package camera
+
+import (
+	"grinder/pkg/math"
+	gomath "math"
+)
+
+// EquirectangularCamera captures the full sphere of directions around its
+// eye. Screen x maps to longitude [-π, π] and screen y to latitude [π/2, -π/2],
+// so the center of the frame looks along Forward. Depth is distance along the
+// ray rather than along Forward.
+type EquirectangularCamera struct {
+	Position, Forward, Right, Up math.Point3D
+	Shutter                      float64
+}
+
+// NewEquirectangularCamera creates a 360x180 camera at pos whose frame is
+// centered on target, with its shutter open for the whole frame.
+func NewEquirectangularCamera(pos, target, up math.Point3D) *EquirectangularCamera {
+	f, r, u := lookAtBasis(pos, target, up)
+	return &EquirectangularCamera{Position: pos, Forward: f, Right: r, Up: u, Shutter: 1}
+}
+
+// Direction returns the unit ray direction through screen point (sx, sy).
+func (c *EquirectangularCamera) Direction(sx, sy float64) math.Point3D {
+	lon := (2*sx - 1) * gomath.Pi
+	lat := (1 - 2*sy) * gomath.Pi / 2
+	cosLat := gomath.Cos(lat)
+	return c.Forward.Mul(cosLat * gomath.Cos(lon)).
+		Add(c.Right.Mul(cosLat * gomath.Sin(lon))).
+		Add(c.Up.Mul(gomath.Sin(lat)))
+}
+
+// Roll rotates the camera about its forward axis by deg degrees.
+func (c *EquirectangularCamera) Roll(deg float64) {
+	c.Right, c.Up = rollBasis(c.Right, c.Up, deg)
+}
+
+// Project returns the point at distance z along the ray through (sx, sy).
+func (c *EquirectangularCamera) Project(sx, sy, z float64) math.Point3D {
+	return c.Position.Add(c.Direction(sx, sy).Mul(z))
+}
+
+// GetEye returns the position of the camera.
+func (c *EquirectangularCamera) GetEye() math.Point3D {
+	return c.Position
+}
+
+func (c *EquirectangularCamera) GetForward() math.Point3D { return c.Forward }
+func (c *EquirectangularCamera) GetUp() math.Point3D      { return c.Up }
+func (c *EquirectangularCamera) GetShutter() float64      { return c.Shutter }
+
+// AtTime returns the camera itself; it doesn't move over the shutter.
+func (c *EquirectangularCamera) AtTime(t float64) Camera { return c }
@@ -0,0 +1,107 @@
+package camera
+
+import (
+	"grinder/pkg/math"
+	gomath "math"
+)
+
+// FisheyeMapping selects how a fisheye lens maps image radius to ray angle.
+type FisheyeMapping int
+
+const (
+	// Equidistant maps radius linearly to the angle off the forward axis.
+	Equidistant FisheyeMapping = iota
+	// Equisolid preserves solid angle: r = sin(θ/2) / sin(fov/4).
+	Equisolid
+)
+
+// FisheyeCamera is a wide-angle camera whose image circle is inscribed in
+// the frame and covers Fov degrees (up to 180) across. Depth is distance
+// along the ray rather than along Forward.
+type FisheyeCamera struct {
+	Position, Forward, Right, Up math.Point3D
+	Shutter                      float64
+	Fov, Aspect                  float64
+	Mapping                      FisheyeMapping
+}
+
+// NewFisheyeCamera creates a fisheye camera at pos looking at target. fov is
+// clamped to (0, 180] degrees. The shutter is open for the whole frame.
+func NewFisheyeCamera(pos, target, up math.Point3D, fov, aspect float64, mapping FisheyeMapping) *FisheyeCamera {
+	f, r, u := lookAtBasis(pos, target, up)
+	return &FisheyeCamera{
+		Position: pos, Forward: f, Right: r, Up: u,
+		Fov: gomath.Max(1e-6, gomath.Min(180, fov)), Aspect: aspect, Mapping: mapping,
+		Shutter: 1,
+	}
+}
+
+// halfFov returns half the field of view in radians.
+func (c *FisheyeCamera) halfFov() float64 {
+	return c.Fov * gomath.Pi / 360
+}
+
+// Direction returns the unit ray direction through screen point (sx, sy).
+// Points outside the image circle continue the mapping past the edge.
+func (c *FisheyeCamera) Direction(sx, sy float64) math.Point3D {
+	nx := (2*sx - 1) * c.Aspect
+	ny := 1 - 2*sy
+	r := gomath.Hypot(nx, ny)
+	if r == 0 {
+		return c.Forward
+	}
+	var theta float64
+	switch c.Mapping {
+	case Equisolid:
+		theta = 2 * gomath.Asin(gomath.Min(1, r*gomath.Sin(c.halfFov()/2)))
+	default:
+		theta = r * c.halfFov()
+	}
+	s := gomath.Sin(theta) / r
+	return c.Forward.Mul(gomath.Cos(theta)).Add(c.Right.Mul(nx * s)).Add(c.Up.Mul(ny * s))
+}
+
+// Roll rotates the camera about its forward axis by deg degrees.
+func (c *FisheyeCamera) Roll(deg float64) {
+	c.Right, c.Up = rollBasis(c.Right, c.Up, deg)
+}
+
+// Project returns the point at distance z along the ray through (sx, sy).
+func (c *FisheyeCamera) Project(sx, sy, z float64) math.Point3D {
+	return c.Position.Add(c.Direction(sx, sy).Mul(z))
+}
+
+// ScreenPoint is the inverse of Project: it returns the screen coordinate of
+// a world point and its distance from the eye.
+func (c *FisheyeCamera) ScreenPoint(p math.Point3D) (sx, sy, z float64) {
+	d := p.Sub(c.Position)
+	z = d.Length()
+	if z == 0 {
+		return 0.5, 0.5, 0
+	}
+	x, y := d.Dot(c.Right), d.Dot(c.Up)
+	theta := gomath.Acos(gomath.Max(-1, gomath.Min(1, d.Dot(c.Forward)/z)))
+	var r float64
+	switch c.Mapping {
+	case Equisolid:
+		r = gomath.Sin(theta/2) / gomath.Sin(c.halfFov()/2)
+	default:
+		r = theta / c.halfFov()
+	}
+	if l := gomath.Hypot(x, y); l > 0 {
+		x, y = x/l*r, y/l*r
+	}
+	return (x/c.Aspect + 1) / 2, (1 - y) / 2, z
+}
+
+// GetEye returns the position of the camera.
+func (c *FisheyeCamera) GetEye() math.Point3D {
+	return c.Position
+}
+
+func (c *FisheyeCamera) GetForward() math.Point3D { return c.Forward }
+func (c *FisheyeCamera) GetUp() math.Point3D      { return c.Up }
+func (c *FisheyeCamera) GetShutter() float64      { return c.Shutter }
+
+// AtTime returns the camera itself; it doesn't move over the shutter.
+func (c *FisheyeCamera) AtTime(t float64) Camera { return c }
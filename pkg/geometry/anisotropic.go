@@ -0,0 +1,70 @@
+package geometry
+
+import (
+	"grinder/pkg/math"
+	gomath "math"
+)
+
+// Anisotropic gives a shape a brushed-metal highlight: its specular term
+// becomes an anisotropic GGX lobe with roughness AnisotropyX along the
+// surface tangent and AnisotropyY across it, so the highlight stretches
+// along whichever is rougher. Tangent, if non-zero, sets the brushing
+// direction; otherwise the shape's default from TangentAt is used. Only the
+// highlight's shape changes: its color and strength still come from the
+// shape's GetSpecularColor and GetSpecularIntensity, and GetShininess, which
+// the Phong lobe it replaces used, goes unused.
+type Anisotropic struct {
+	Shape
+	AnisotropyX, AnisotropyY float64
+	Tangent                  math.Point3D
+}
+
+// Inner returns the shape given the brushed highlight.
+func (a Anisotropic) Inner() Shape { return a.Shape }
+
+// AnisotropyOf returns the roughness pair of s along and across its tangent
+// if it has an anisotropic highlight, looking through transforms, instancing
+// and the other decorators.
+func AnisotropyOf(s Shape) (ax, ay float64, ok bool) {
+	a, ok := layerOf[Anisotropic](s)
+	return a.AnisotropyX, a.AnisotropyY, ok
+}
+
+// TangentAt returns the unit surface tangent of s at p at time t, made
+// perpendicular to its normal there: an Anisotropic's own Tangent if set, a
+// quad's u direction, the axis of a cylinder or cone, and for other shapes
+// the direction around the world's y axis.
+func TangentAt(s Shape, p math.Point3D, t float64) math.Point3D {
+	var tangent math.Point3D
+	switch v := s.(type) {
+	case Anisotropic:
+		if v.Tangent == (math.Point3D{}) {
+			return TangentAt(v.Shape, p, t)
+		}
+		tangent = v.Tangent
+	case *TransformedShape:
+		local := TangentAt(v.Shape, v.ToLocal.TransformPoint(p), t)
+		tangent = v.ToWorld.TransformVector(local)
+	case *BilinearQuad:
+		u, w := v.findUVForPoint(p)
+		tangent = v.partialDerivativeU(u, w)
+	case Cylinder3D, Cone3D:
+		tangent = math.Point3D{Y: 1}
+	default:
+		if inner, ok := decorated(s); ok {
+			return TangentAt(inner, p, t)
+		}
+	}
+	n := s.NormalAtPoint(p, t).ToVector()
+	tangent = tangent.Sub(n.Mul(n.Dot(tangent)))
+	if tangent.Length() < 1e-9 {
+		// No usable direction, such as the caps of a cylinder: circle the
+		// y axis, or the x axis where the normal is along y.
+		axis := math.Point3D{Y: 1}
+		if gomath.Abs(n.Y) > 0.9 {
+			axis = math.Point3D{X: 1}
+		}
+		tangent = axis.Cross(n)
+	}
+	return tangent.Normalize()
+}
@@ -0,0 +1,48 @@
+package geometry
+
+import (
+	"grinder/pkg/math"
+	gomath "math"
+	"testing"
+)
+
+func near3(a, b math.Point3D) bool { return a.Sub(b).Length() < 1e-9 }
+
+func TestTangentAt(t *testing.T) {
+	cylinder := Cylinder3D{Height: 2, Radius: 1}
+	quad := &BilinearQuad{P00: math.Point3D{}, P10: math.Point3D{X: 2}, P11: math.Point3D{X: 2, Z: -2}, P01: math.Point3D{Z: -2}}
+	tilted, _ := NewTransformedShape(cylinder, math.Rotate4(math.Point3D{Z: 1}, 90))
+
+	tests := []struct {
+		name  string
+		shape Shape
+		p     math.Point3D
+		want  math.Point3D
+	}{
+		{"cylinder side", cylinder, math.Point3D{X: 1, Y: 1}, math.Point3D{Y: 1}},
+		{"quad", quad, math.Point3D{X: 1, Z: -1}, math.Point3D{X: 1}},
+		{"rotated cylinder", tilted, math.Point3D{X: -1, Z: 1}, math.Point3D{X: -1}},
+		{"sphere", Sphere3D{Radius: 1}, math.Point3D{Z: 1}, math.Point3D{X: 1}},
+		{"own tangent", Anisotropic{Shape: cylinder, Tangent: math.Point3D{Y: 1, Z: 1}}, math.Point3D{X: 1, Y: 1}, math.Point3D{Y: gomath.Sqrt2 / 2, Z: gomath.Sqrt2 / 2}},
+		{"own tangent, made perpendicular", Anisotropic{Shape: cylinder, Tangent: math.Point3D{X: 1, Y: 1}}, math.Point3D{X: 1, Y: 1}, math.Point3D{Y: 1}},
+	}
+	for _, tt := range tests {
+		if got := TangentAt(tt.shape, tt.p, 0); !near3(got, tt.want) {
+			t.Errorf("%s: TangentAt = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAnisotropyOf(t *testing.T) {
+	brushed := Anisotropic{Shape: Cylinder3D{Height: 2, Radius: 1}, AnisotropyX: 0.4, AnisotropyY: 0.1}
+	moved, _ := NewTransformedShape(Translucent{Shape: brushed, Opacity: 0.5}, math.Translate4(math.Point3D{X: 2}))
+	if ax, ay, ok := AnisotropyOf(moved); !ok || ax != 0.4 || ay != 0.1 {
+		t.Errorf("AnisotropyOf(moved brushed cylinder) = %v, %v, %v; want 0.4, 0.1, true", ax, ay, ok)
+	}
+	if _, _, ok := AnisotropyOf(brushed.Shape); ok {
+		t.Error("AnisotropyOf reported a plain cylinder as anisotropic")
+	}
+	if _, ok := Unwrap(brushed).(Cylinder3D); !ok {
+		t.Errorf("Unwrap(brushed) = %T, want the cylinder", Unwrap(brushed))
+	}
+}
@@ -0,0 +1,38 @@
+package geometry
+
+import (
+	"grinder/pkg/math"
+	gomath "math"
+)
+
+// BoundingSphere returns a sphere enclosing the finite bounds of shapes: the
+// center of their combined AABB and its half diagonal. Unbounded shapes such
+// as planes are skipped; ok is false if nothing finite is left.
+func BoundingSphere(shapes []Shape) (center math.Point3D, radius float64, ok bool) {
+	var box math.AABB3D
+	for _, s := range shapes {
+		b := s.GetAABB()
+		if !finite(b) {
+			continue
+		}
+		if !ok {
+			box, ok = b, true
+			continue
+		}
+		box = box.Expand(b.Min).Expand(b.Max)
+	}
+	if !ok {
+		return math.Point3D{}, 0, false
+	}
+	return box.Center(), box.Max.Sub(box.Min).Length() / 2, true
+}
+
+// finite reports whether every bound of b is a finite number.
+func finite(b math.AABB3D) bool {
+	for _, v := range []float64{b.Min.X, b.Min.Y, b.Min.Z, b.Max.X, b.Max.Y, b.Max.Z} {
+		if gomath.IsInf(v, 0) || gomath.IsNaN(v) {
+			return false
+		}
+	}
+	return true
+}
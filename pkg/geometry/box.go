@@ -10,6 +10,7 @@ import (
 type Box3D struct {
 	Min, Max          math.Point3D
 	Velocity          math.Point3D // Displacement over the shutter window
+	Motion            *math.Motion // Keyframed path of Min, which Max follows; overrides Velocity
 	Color             color.RGBA
 	Shininess         float64
 	SpecularIntensity float64
@@ -19,6 +20,9 @@ type Box3D struct {
 // GetBoxAt returns the box at a specific time t
 func (b Box3D) GetBoxAt(t float64) Box3D {
 	displacement := b.Velocity.Mul(t)
+	if b.Motion != nil {
+		displacement = b.Motion.At(t).Sub(b.Min)
+	}
 	return Box3D{
 		Min: b.Min.Add(displacement),
 		Max: b.Max.Add(displacement),
@@ -62,6 +66,9 @@ func (b Box3D) NormalAtPoint(p math.Point3D, t float64) math.Normal3D {
 // GetColor returns the color of the box.
 func (s Box3D) GetColor() color.RGBA { return s.Color }
 
+// GetColorAt returns the box's color, which is the same everywhere.
+func (s Box3D) GetColorAt(p math.Point3D, t float64) color.RGBA { return s.Color }
+
 // GetShininess returns the shininess of the box.
 func (s Box3D) GetShininess() float64 { return s.Shininess }
 
@@ -72,6 +79,10 @@ func (s Box3D) GetSpecularIntensity() float64 { return s.SpecularIntensity }
 func (s Box3D) GetSpecularColor() color.RGBA { return s.SpecularColor }
 
 func (b Box3D) GetAABB() math.AABB3D {
+	if b.Motion != nil {
+		path := b.Motion.Bounds()
+		return math.AABB3D{Min: path.Min, Max: path.Max.Add(b.Max.Sub(b.Min))}
+	}
 	startBox := b.GetBoxAt(0)
 	endBox := b.GetBoxAt(1)
 
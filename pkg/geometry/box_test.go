@@ -48,3 +48,23 @@ func TestBox3D_Intersects(t *testing.T) {
 		t.Errorf("Box3D Intersects failed: AABB %v should intersect (containing)", aabbContaining)
 	}
 }
+
+// TestBox3D_IntersectsAlongMotion checks that the cull test covers the whole
+// motion path, not just the box at t=0.
+func TestBox3D_IntersectsAlongMotion(t *testing.T) {
+	box := Box3D{
+		Min:      math.Point3D{X: -1, Y: -1, Z: -1},
+		Max:      math.Point3D{X: 1, Y: 1, Z: 1},
+		Velocity: math.Point3D{X: 4},
+	}
+	aabb := math.AABB3D{Min: math.Point3D{X: 4, Y: -0.5, Z: -0.5}, Max: math.Point3D{X: 4.5, Y: 0.5, Z: 0.5}}
+	if (math.AABB3D{Min: box.Min, Max: box.Max}).Intersects(aabb) {
+		t.Fatal("test setup: the static box should miss the AABB")
+	}
+	if !box.Contains(math.Point3D{X: 4.2}, 1) {
+		t.Fatal("test setup: the box should reach the AABB at t=1")
+	}
+	if !box.Intersects(aabb) {
+		t.Error("Intersects culled an AABB the moving box passes through")
+	}
+}
@@ -0,0 +1,31 @@
+package geometry
+
+import (
+	gimage "grinder/pkg/image"
+	"grinder/pkg/math"
+)
+
+// BumpMap tilts a surface's normal by the slope of a grayscale height
+// texture, adding detail without geometry.
+type BumpMap struct {
+	Height   *gimage.Texture
+	Strength float64 // normal tilt for a full black-to-white step between neighbouring texels
+	Scale    float64 // planes: world units per texture repeat (0 means 1)
+}
+
+// perturb returns n tilted by the height gradient at (u, v). tangent and
+// bitangent are the surface directions in which u and v grow.
+func (b *BumpMap) perturb(n, tangent, bitangent math.Point3D, u, v float64) math.Normal3D {
+	du := 1 / float64(b.Height.Width)
+	dv := 1 / float64(b.Height.Height)
+	hu := height(b.Height.Sample(u+du, v)) - height(b.Height.Sample(u-du, v))
+	hv := height(b.Height.Sample(u, v+dv)) - height(b.Height.Sample(u, v-dv))
+	// Central differences span two texels.
+	p := n.Sub(tangent.Mul(b.Strength * hu / 2)).Sub(bitangent.Mul(b.Strength * hv / 2)).Normalize()
+	return math.Normal3D{X: p.X, Y: p.Y, Z: p.Z}
+}
+
+// height reads a texel as gray.
+func height(c math.Point3D) float64 {
+	return 0.2126*c.X + 0.7152*c.Y + 0.0722*c.Z
+}
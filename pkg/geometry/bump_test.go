@@ -0,0 +1,73 @@
+package geometry
+
+import (
+	gimage "grinder/pkg/image"
+	"grinder/pkg/math"
+	"testing"
+)
+
+// rampTexture is 8x1 with height rising along u.
+func rampTexture() *gimage.Texture {
+	tex := &gimage.Texture{Width: 8, Height: 1}
+	for i := 0; i < 8; i++ {
+		h := float64(i) / 7
+		tex.Pix = append(tex.Pix, math.Point3D{X: h, Y: h, Z: h})
+	}
+	return tex
+}
+
+// TestBumpMap_TiltsAwayFromSlope checks that a height ramp rising along +X
+// tilts the normal of a floor plane and of a floor quad toward -X.
+func TestBumpMap_TiltsAwayFromSlope(t *testing.T) {
+	bump := &BumpMap{Height: rampTexture(), Strength: 4}
+	plane := Plane3D{Normal: math.Normal3D{Y: 1}, Bump: bump}
+	// u = 0.5 is mid-ramp, away from the wrap-around at the edges.
+	n := plane.NormalAtPoint(math.Point3D{X: 0.5}, 0)
+	if n.X >= 0 || n.Y <= 0 {
+		t.Errorf("plane normal = %v, want tilted toward -X", n)
+	}
+
+	quad := &BilinearQuad{
+		P00: math.Point3D{X: 0, Z: 0}, P10: math.Point3D{X: 1, Z: 0},
+		P11: math.Point3D{X: 1, Z: -1}, P01: math.Point3D{X: 0, Z: -1},
+		Thickness: 0.01, Bump: bump,
+	}
+	n = quad.NormalAtPoint(math.Point3D{X: 0.5, Z: -0.5}, 0)
+	if n.X >= 0 || n.Y <= 0 {
+		t.Errorf("quad normal = %v, want tilted toward -X", n)
+	}
+
+	flat := Plane3D{Normal: math.Normal3D{Y: 1}}
+	if n := flat.NormalAtPoint(math.Point3D{X: 0.5}, 0); n != (math.Normal3D{Y: 1}) {
+		t.Errorf("plane without a bump map has normal %v", n)
+	}
+}
+
+// TestBilinearQuad_NormalMap checks that a flat texel keeps the base normal,
+// including a smooth vertex normal, and that red tilts along the quad's u.
+func TestBilinearQuad_NormalMap(t *testing.T) {
+	texel := func(c math.Point3D) *gimage.Texture {
+		return &gimage.Texture{Width: 1, Height: 1, Pix: []math.Point3D{c}}
+	}
+	quad := &BilinearQuad{
+		P00: math.Point3D{X: -1, Y: -1}, P10: math.Point3D{X: 1, Y: -1},
+		P11: math.Point3D{X: 1, Y: 1}, P01: math.Point3D{X: -1, Y: 1},
+		Thickness: 0.01,
+		NormalMap: texel(math.Point3D{X: 0.5, Y: 0.5, Z: 1}),
+	}
+	if n := quad.NormalAtPoint(math.Point3D{}, 0); n.ToVector().Sub(math.Point3D{Z: 1}).Length() > 1e-9 {
+		t.Errorf("flat normal map: got %v, want +Z", n)
+	}
+
+	tilted := math.Normal3D{X: 0.6, Z: 0.8}
+	quad.N00, quad.N10, quad.N11, quad.N01 = tilted, tilted, tilted, tilted
+	if n := quad.NormalAtPoint(math.Point3D{}, 0); n.ToVector().Sub(tilted.ToVector()).Length() > 1e-9 {
+		t.Errorf("flat normal map over vertex normals: got %v, want %v", n, tilted)
+	}
+
+	quad.N00, quad.N10, quad.N11, quad.N01 = math.Normal3D{}, math.Normal3D{}, math.Normal3D{}, math.Normal3D{}
+	quad.NormalMap = texel(math.Point3D{X: 1, Y: 0.5, Z: 0.5})
+	if n := quad.NormalAtPoint(math.Point3D{}, 0); n.ToVector().Sub(math.Point3D{X: 1}).Length() > 1e-9 {
+		t.Errorf("red normal map: got %v, want +X (along u)", n)
+	}
+}
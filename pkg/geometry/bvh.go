@@ -5,6 +5,7 @@ import (
 	"image/color"
 	gomath "math"
 	"sort"
+	"sync/atomic"
 )
 
 type BVHNode struct {
@@ -17,6 +18,9 @@ type BVHNode struct {
 type BVH struct {
 	Root           *BVHNode
 	InfiniteShapes []Shape
+	// Visits, if set, counts the nodes shape queries test, for render
+	// statistics. Each query adds its count once.
+	Visits *atomic.Int64
 }
 
 func NewBVH(shapes []Shape) *BVH {
@@ -24,9 +28,20 @@ func NewBVH(shapes []Shape) *BVH {
 		return &BVH{}
 	}
 
+	// Instanced shapes enter the tree one instance at a time so each copy
+	// is culled by its own bounds.
+	var expanded []Shape
+	for _, s := range shapes {
+		if is, ok := s.(*InstancedShape); ok {
+			expanded = append(expanded, is.Instances()...)
+		} else {
+			expanded = append(expanded, s)
+		}
+	}
+
 	var finite []Shape
 	var infinite []Shape
-	for _, s := range shapes {
+	for _, s := range expanded {
 		aabb := s.GetAABB()
 		if gomath.IsInf(aabb.Min.X, -1) || gomath.IsInf(aabb.Max.X, 1) {
 			infinite = append(infinite, s)
@@ -124,14 +139,25 @@ func buildBVH(shapes []Shape) *BVHNode {
 
 // IntersectsShapes returns all shapes in the BVH that might intersect the given AABB.
 func (b *BVH) IntersectsShapes(aabb math.AABB3D) []Shape {
-	result := append([]Shape{}, b.InfiniteShapes...)
+	return b.IntersectsShapesInto(aabb, nil)
+}
+
+// IntersectsShapesInto is IntersectsShapes appending to buf, so a caller
+// that reuses buf[:0] across queries doesn't allocate once it has grown.
+func (b *BVH) IntersectsShapesInto(aabb math.AABB3D, buf []Shape) []Shape {
+	result := append(buf, b.InfiniteShapes...)
 	if b.Root != nil {
-		b.Root.intersectsShapes(aabb, &result)
+		var visits int64
+		b.Root.intersectsShapes(aabb, &result, &visits)
+		if b.Visits != nil {
+			b.Visits.Add(visits)
+		}
 	}
 	return result
 }
 
-func (node *BVHNode) intersectsShapes(aabb math.AABB3D, result *[]Shape) {
+func (node *BVHNode) intersectsShapes(aabb math.AABB3D, result *[]Shape, visits *int64) {
+	*visits++
 	if !node.AABB.Intersects(aabb) {
 		return
 	}
@@ -146,10 +172,10 @@ func (node *BVHNode) intersectsShapes(aabb math.AABB3D, result *[]Shape) {
 	}
 
 	if node.Left != nil {
-		node.Left.intersectsShapes(aabb, result)
+		node.Left.intersectsShapes(aabb, result, visits)
 	}
 	if node.Right != nil {
-		node.Right.intersectsShapes(aabb, result)
+		node.Right.intersectsShapes(aabb, result, visits)
 	}
 }
 
@@ -176,6 +202,10 @@ func (b *BVH) GetColor() color.RGBA {
 	return color.RGBA{}
 }
 
+func (b *BVH) GetColorAt(p math.Point3D, t float64) color.RGBA {
+	return color.RGBA{}
+}
+
 func (b *BVH) GetShininess() float64 { return 0 }
 
 func (b *BVH) GetSpecularIntensity() float64 { return 0 }
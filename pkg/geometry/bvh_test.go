@@ -84,3 +84,44 @@ func TestBVHWithInfiniteShape(t *testing.T) {
 		t.Error("Expected to find plane in results")
 	}
 }
+
+// benchGrid returns a BVH over a 10x10x10 grid of spheres.
+func benchGrid() *BVH {
+	var shapes []Shape
+	for i := 0; i < 1000; i++ {
+		shapes = append(shapes, Sphere3D{
+			Center: math.Point3D{X: float64(i % 10), Y: float64(i / 10 % 10), Z: float64(i / 100)},
+			Radius: 0.3,
+		})
+	}
+	return NewBVH(shapes)
+}
+
+// benchQuery returns the i'th of 512 query boxes, each a few grid cells wide.
+func benchQuery(i int) math.AABB3D {
+	min := math.Point3D{X: float64(i % 8), Y: float64(i / 8 % 8), Z: float64(i / 64 % 8)}
+	return math.AABB3D{Min: min, Max: min.Add(math.Point3D{X: 2, Y: 2, Z: 2})}
+}
+
+// BenchmarkBVH_IntersectsShapes queries the sphere grid with boxes a few
+// cells wide, as the shadow culling does.
+func BenchmarkBVH_IntersectsShapes(b *testing.B) {
+	bvh := benchGrid()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bvh.IntersectsShapes(benchQuery(i))
+	}
+}
+
+// BenchmarkBVH_IntersectsShapesInto runs the same queries as
+// BenchmarkBVH_IntersectsShapes, reusing one result buffer.
+func BenchmarkBVH_IntersectsShapesInto(b *testing.B) {
+	bvh := benchGrid()
+	var buf []Shape
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf = bvh.IntersectsShapesInto(benchQuery(i), buf[:0])
+	}
+}
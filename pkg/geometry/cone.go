@@ -10,6 +10,7 @@ import (
 type Cone3D struct {
 	Center            math.Point3D // Center of the circular base
 	Velocity          math.Point3D // Displacement over the shutter window
+	Motion            *math.Motion // Keyframed path of the base's center; overrides Velocity
 	Radius            float64
 	Height            float64
 	Color             color.RGBA
@@ -20,6 +21,9 @@ type Cone3D struct {
 
 // GetCenterAt calculates the position for a specific sample's time
 func (c Cone3D) GetCenterAt(t float64) math.Point3D {
+	if c.Motion != nil {
+		return c.Motion.At(t)
+	}
 	return c.Center.Add(c.Velocity.Mul(t))
 }
 
@@ -41,7 +45,62 @@ func (c Cone3D) Contains(p math.Point3D, t float64) bool {
 
 func (c Cone3D) Intersects(aabb math.AABB3D) bool {
 	// Account for motion by using the full motion-expanded AABB
-	return c.GetAABB().Intersects(aabb)
+	if !c.GetAABB().Intersects(aabb) {
+		return false
+	}
+	if c.Velocity != (math.Point3D{}) || c.Motion != nil {
+		return true
+	}
+	// The cross-sections are nested circles shrinking toward the tip, so
+	// the widest one within the box's height range, at its bottom, decides.
+	y := gomath.Max(aabb.Min.Y, c.Center.Y)
+	r := c.Radius * (1 - (y-c.Center.Y)/c.Height)
+	dx := c.Center.X - gomath.Max(aabb.Min.X, gomath.Min(c.Center.X, aabb.Max.X))
+	dz := c.Center.Z - gomath.Max(aabb.Min.Z, gomath.Min(c.Center.Z, aabb.Max.Z))
+	return dx*dx+dz*dz <= r*r
+}
+
+// IntersectRay returns the distance along r to where it first enters the
+// cone, through its slanted side or its base disk, at the ray's time. Hits
+// behind the origin miss; a ray starting inside finds where it leaves.
+func (c Cone3D) IntersectRay(r math.Ray) (float64, bool) {
+	center := c.GetCenterAt(r.Time)
+	o, d := r.Origin.Sub(center), r.Direction
+	best := gomath.Inf(1)
+
+	// Side: x²+z² = (k(h-y))² with k the radius lost per unit of height.
+	k2 := (c.Radius / c.Height) * (c.Radius / c.Height)
+	h := c.Height - o.Y
+	a := d.X*d.X + d.Z*d.Z - k2*d.Y*d.Y
+	b := 2 * (o.X*d.X + o.Z*d.Z + k2*h*d.Y)
+	cc := o.X*o.X + o.Z*o.Z - k2*h*h
+	var roots []float64
+	if gomath.Abs(a) < 1e-12 {
+		// Parallel to the slant: the quadratic drops to a line.
+		if gomath.Abs(b) > 1e-12 {
+			roots = append(roots, -cc/b)
+		}
+	} else if disc := b*b - 4*a*cc; disc >= 0 {
+		sq := gomath.Sqrt(disc)
+		roots = append(roots, (-b-sq)/(2*a), (-b+sq)/(2*a))
+	}
+	for _, t := range roots {
+		// The equation also holds on the mirrored cone past the tip.
+		if y := o.Y + t*d.Y; t > 0 && t < best && y >= 0 && y <= c.Height {
+			best = t
+		}
+	}
+
+	// Base cap
+	if gomath.Abs(d.Y) > 1e-12 {
+		if t := -o.Y / d.Y; t > 0 && t < best {
+			x, z := o.X+t*d.X, o.Z+t*d.Z
+			if x*x+z*z <= c.Radius*c.Radius {
+				best = t
+			}
+		}
+	}
+	return best, !gomath.IsInf(best, 1)
 }
 
 func (c Cone3D) NormalAtPoint(p math.Point3D, t float64) math.Normal3D {
@@ -55,6 +114,10 @@ func (c Cone3D) NormalAtPoint(p math.Point3D, t float64) math.Normal3D {
 	// Side normal: Slanted outward and slightly upward
 	dx, dz := p.X-center.X, p.Z-center.Z
 	horizontalDist := gomath.Sqrt(dx*dx + dz*dz)
+	if horizontalDist < eps {
+		// On the axis the side has no outward direction; use the apex normal.
+		return math.Normal3D{X: 0, Y: 1, Z: 0}
+	}
 
 	// The slope of the cone side
 	slope := c.Radius / c.Height
@@ -63,6 +126,13 @@ func (c Cone3D) NormalAtPoint(p math.Point3D, t float64) math.Normal3D {
 }
 
 func (c Cone3D) GetAABB() math.AABB3D {
+	if c.Motion != nil {
+		b := c.Motion.Bounds()
+		return math.AABB3D{
+			Min: b.Min.Sub(math.Point3D{X: c.Radius, Z: c.Radius}),
+			Max: b.Max.Add(math.Point3D{X: c.Radius, Y: c.Height, Z: c.Radius}),
+		}
+	}
 	startCenter := c.GetCenterAt(0)
 	endCenter := c.GetCenterAt(1)
 
@@ -82,6 +152,9 @@ func (c Cone3D) GetAABB() math.AABB3D {
 // GetColor returns the color of the cone.
 func (s Cone3D) GetColor() color.RGBA { return s.Color }
 
+// GetColorAt returns the cone's color, which is the same everywhere.
+func (s Cone3D) GetColorAt(p math.Point3D, t float64) color.RGBA { return s.Color }
+
 // GetShininess returns the shininess of the cone.
 func (s Cone3D) GetShininess() float64 { return s.Shininess }
 
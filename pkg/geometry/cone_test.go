@@ -2,6 +2,7 @@ package geometry
 
 import (
 	"grinder/pkg/math"
+	gomath "math"
 	"testing"
 )
 
@@ -54,3 +55,67 @@ func TestCone3D_Intersects(t *testing.T) {
 		t.Errorf("Cone3D Intersects failed: AABB %v should intersect (containing)", aabbContaining)
 	}
 }
+
+// TestCone3D_IntersectsMidHeight checks boxes against the cone's slant
+// rather than its bounding box.
+func TestCone3D_IntersectsMidHeight(t *testing.T) {
+	cone := Cone3D{Center: math.Point3D{X: 0, Y: 0, Z: 0}, Radius: 1, Height: 2}
+
+	// Beside the side at mid-height, within the radius of 0.6 at y=0.8.
+	side := math.AABB3D{Min: math.Point3D{X: 0.3, Y: 0.8, Z: -0.1}, Max: math.Point3D{X: 0.5, Y: 1.2, Z: 0.1}}
+	if !cone.Intersects(side) {
+		t.Errorf("Intersects(%v) = false, want true", side)
+	}
+	// In the corner of the bounding box near the tip, clear of the slant.
+	corner := math.AABB3D{Min: math.Point3D{X: 0.8, Y: 1.5, Z: 0.8}, Max: math.Point3D{X: 1, Y: 2, Z: 1}}
+	if cone.Intersects(corner) {
+		t.Errorf("Intersects(%v) = true, want false", corner)
+	}
+}
+
+func TestCone3D_IntersectRay(t *testing.T) {
+	cone := Cone3D{Center: math.Point3D{X: 0, Y: 0, Z: 0}, Radius: 1, Height: 2}
+
+	tests := []struct {
+		name   string
+		ray    math.Ray
+		want   float64
+		wantOK bool
+	}{
+		// At y=1 the cone's radius is 0.5.
+		{"side", math.Ray{Origin: math.Point3D{X: -5, Y: 1, Z: 0}, Direction: math.Point3D{X: 1}}, 4.5, true},
+		{"base", math.Ray{Origin: math.Point3D{X: 0.5, Y: -3, Z: 0}, Direction: math.Point3D{Y: 1}}, 3, true},
+		{"tip", math.Ray{Origin: math.Point3D{X: 0, Y: 5, Z: 0}, Direction: math.Point3D{Y: -1}}, 3, true},
+		{"from inside", math.Ray{Origin: math.Point3D{X: 0, Y: 1, Z: 0}, Direction: math.Point3D{X: 1}}, 0.5, true},
+		// Grazing the slant at y=1, z=0.5, where it runs along the side.
+		{"grazing", math.Ray{Origin: math.Point3D{X: -5, Y: 1, Z: 0.5}, Direction: math.Point3D{X: 1}}, 5, true},
+		{"just past the side", math.Ray{Origin: math.Point3D{X: -5, Y: 1, Z: 0.501}, Direction: math.Point3D{X: 1}}, 0, false},
+		// The mirrored cone above the tip is not part of the shape.
+		{"above the tip", math.Ray{Origin: math.Point3D{X: -5, Y: 3, Z: 0}, Direction: math.Point3D{X: 1}}, 0, false},
+		{"behind", math.Ray{Origin: math.Point3D{X: 5, Y: 1, Z: 0}, Direction: math.Point3D{X: 1}}, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := cone.IntersectRay(tt.ray)
+		if ok != tt.wantOK || (ok && gomath.Abs(got-tt.want) > 1e-6) {
+			t.Errorf("%s: IntersectRay = %v, %v; want %v, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	// A moving cone is hit where it is at the ray's time.
+	moving := cone
+	moving.Velocity = math.Point3D{X: 2}
+	ray := math.Ray{Origin: math.Point3D{X: -5, Y: 1, Z: 0}, Direction: math.Point3D{X: 1}, Time: 0.5}
+	if got, ok := moving.IntersectRay(ray); !ok || gomath.Abs(got-5.5) > 1e-6 {
+		t.Errorf("moving cone: IntersectRay = %v, %v; want 5.5, true", got, ok)
+	}
+}
+
+func TestCone3D_NormalOnAxis(t *testing.T) {
+	cone := Cone3D{Center: math.Point3D{X: 1, Y: 0, Z: 2}, Radius: 1, Height: 2}
+	for _, y := range []float64{0.5, 1, 2} {
+		n := cone.NormalAtPoint(math.Point3D{X: 1, Y: y, Z: 2}, 0)
+		if n != (math.Normal3D{X: 0, Y: 1, Z: 0}) {
+			t.Errorf("normal on the axis at y=%v = %v, want the apex normal (0, 1, 0)", y, n)
+		}
+	}
+}
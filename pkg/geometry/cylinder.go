@@ -10,6 +10,7 @@ import (
 type Cylinder3D struct {
 	Center            math.Point3D // Center of the base
 	Velocity          math.Point3D // Displacement over the shutter window
+	Motion            *math.Motion // Keyframed path of the base's center; overrides Velocity
 	Height, Radius    float64
 	Color             color.RGBA
 	Shininess         float64
@@ -19,6 +20,9 @@ type Cylinder3D struct {
 
 // GetCenterAt calculates the position for a specific sample's time
 func (c Cylinder3D) GetCenterAt(t float64) math.Point3D {
+	if c.Motion != nil {
+		return c.Motion.At(t)
+	}
 	return c.Center.Add(c.Velocity.Mul(t))
 }
 
@@ -45,13 +49,69 @@ func (c Cylinder3D) NormalAtPoint(p math.Point3D, t float64) math.Normal3D {
 	if p.Y <= center.Y+eps {
 		return math.Normal3D{X: 0, Y: -1, Z: 0}
 	}
-	n := math.Point3D{X: p.X - center.X, Y: 0, Z: p.Z - center.Z}.Normalize()
+	dx, dz := p.X-center.X, p.Z-center.Z
+	if dx*dx+dz*dz < eps*eps {
+		// On the axis the side has no outward direction; use the top cap's.
+		return math.Normal3D{X: 0, Y: 1, Z: 0}
+	}
+	n := math.Point3D{X: dx, Y: 0, Z: dz}.Normalize()
 	return math.Normal3D{X: n.X, Y: 0, Z: n.Z}
 }
 
+// IntersectRay returns the distance along r to where it first enters the
+// cylinder at the ray's time. Hits behind the origin miss; a ray starting
+// inside finds where it leaves.
+func (c Cylinder3D) IntersectRay(r math.Ray) (float64, bool) {
+	t, _, ok := c.IntersectRayNormal(r)
+	return t, ok
+}
+
+// IntersectRayNormal is IntersectRay that also returns the outward normal of
+// the side or cap that was hit. Unlike NormalAtPoint it needs no tolerance
+// to tell a side hit near the rim from a cap hit.
+func (c Cylinder3D) IntersectRayNormal(r math.Ray) (float64, math.Normal3D, bool) {
+	center := c.GetCenterAt(r.Time)
+	o, d := r.Origin.Sub(center), r.Direction
+	best, n := gomath.Inf(1), math.Normal3D{}
+
+	// Side: the infinite cylinder x²+z² = r², cut to the height range.
+	a := d.X*d.X + d.Z*d.Z
+	if a > 1e-12 {
+		b := 2 * (o.X*d.X + o.Z*d.Z)
+		cc := o.X*o.X + o.Z*o.Z - c.Radius*c.Radius
+		if disc := b*b - 4*a*cc; disc >= 0 {
+			sq := gomath.Sqrt(disc)
+			for _, t := range []float64{(-b - sq) / (2 * a), (-b + sq) / (2 * a)} {
+				if y := o.Y + t*d.Y; t > 0 && t < best && y >= 0 && y <= c.Height {
+					best = t
+					n = math.Normal3D{X: (o.X + t*d.X) / c.Radius, Z: (o.Z + t*d.Z) / c.Radius}
+				}
+			}
+		}
+	}
+
+	// End caps
+	if gomath.Abs(d.Y) > 1e-12 {
+		for _, cp := range []struct{ y, ny float64 }{{0, -1}, {c.Height, 1}} {
+			t := (cp.y - o.Y) / d.Y
+			if t <= 0 || t >= best {
+				continue
+			}
+			x, z := o.X+t*d.X, o.Z+t*d.Z
+			if x*x+z*z <= c.Radius*c.Radius {
+				best, n = t, math.Normal3D{Y: cp.ny}
+			}
+		}
+	}
+	return best, n, !gomath.IsInf(best, 1)
+}
+
 // GetColor returns the color of the cylinder.
 func (s Cylinder3D) GetColor() color.RGBA { return s.Color }
 
+// GetColorAt returns the cylinder's color, which is the same everywhere.
+func (s Cylinder3D) GetColorAt(p math.Point3D, t float64) color.RGBA { return s.Color }
+
 // GetShininess returns the shininess of the cylinder.
 func (s Cylinder3D) GetShininess() float64 { return s.Shininess }
 
@@ -63,6 +123,13 @@ func (s Cylinder3D) GetSpecularColor() color.RGBA { return s.SpecularColor }
 
 // GetAABB returns the bounding box of the cylinder.
 func (c Cylinder3D) GetAABB() math.AABB3D {
+	if c.Motion != nil {
+		b := c.Motion.Bounds()
+		return math.AABB3D{
+			Min: b.Min.Sub(math.Point3D{X: c.Radius, Z: c.Radius}),
+			Max: b.Max.Add(math.Point3D{X: c.Radius, Y: c.Height, Z: c.Radius}),
+		}
+	}
 	startCenter := c.GetCenterAt(0)
 	endCenter := c.GetCenterAt(1)
 
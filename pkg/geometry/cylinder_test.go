@@ -2,6 +2,7 @@ package geometry
 
 import (
 	"grinder/pkg/math"
+	gomath "math"
 	"testing"
 )
 
@@ -54,3 +55,44 @@ func TestCylinder3D_Intersects(t *testing.T) {
 		t.Errorf("Cylinder3D Intersects failed: AABB %v should intersect (containing)", aabbContaining)
 	}
 }
+
+func TestCylinder3D_NormalOnAxis(t *testing.T) {
+	cyl := Cylinder3D{Center: math.Point3D{X: 1, Y: 0, Z: 2}, Radius: 1, Height: 2}
+	n := cyl.NormalAtPoint(math.Point3D{X: 1, Y: 1, Z: 2}, 0)
+	if n != (math.Normal3D{X: 0, Y: 1, Z: 0}) {
+		t.Errorf("normal on the axis = %v, want the cap normal (0, 1, 0)", n)
+	}
+}
+
+func TestCylinder3D_IntersectRay(t *testing.T) {
+	cylinder := Cylinder3D{Center: math.Point3D{X: 0, Y: 0, Z: 0}, Radius: 1, Height: 2}
+
+	tests := []struct {
+		name   string
+		ray    math.Ray
+		want   float64
+		wantN  math.Normal3D
+		wantOK bool
+	}{
+		{"side", math.Ray{Origin: math.Point3D{X: -5, Y: 1, Z: 0}, Direction: math.Point3D{X: 1}}, 4, math.Normal3D{X: -1}, true},
+		{"top cap", math.Ray{Origin: math.Point3D{X: 0.5, Y: 5, Z: 0}, Direction: math.Point3D{Y: -1}}, 3, math.Normal3D{Y: 1}, true},
+		{"bottom cap", math.Ray{Origin: math.Point3D{X: 0, Y: -1, Z: 0.5}, Direction: math.Point3D{Y: 1}}, 1, math.Normal3D{Y: -1}, true},
+		// Entering the top just inside the rim, where NormalAtPoint's
+		// tolerance can't tell the cap from the side.
+		{"rim", math.Ray{Origin: math.Point3D{X: -3, Y: 4.99995, Z: 0}, Direction: math.Point3D{X: 1, Y: -1}}, 2.99995, math.Normal3D{Y: 1}, true},
+		{"from inside", math.Ray{Origin: math.Point3D{X: 0, Y: 1, Z: 0}, Direction: math.Point3D{Z: 1}}, 1, math.Normal3D{Z: 1}, true},
+		{"over the top", math.Ray{Origin: math.Point3D{X: -5, Y: 2.5, Z: 0}, Direction: math.Point3D{X: 1}}, 0, math.Normal3D{}, false},
+		{"beside", math.Ray{Origin: math.Point3D{X: -5, Y: 1, Z: 1.5}, Direction: math.Point3D{X: 1}}, 0, math.Normal3D{}, false},
+		{"behind", math.Ray{Origin: math.Point3D{X: 5, Y: 1, Z: 0}, Direction: math.Point3D{X: 1}}, 0, math.Normal3D{}, false},
+	}
+	for _, tt := range tests {
+		got, n, ok := cylinder.IntersectRayNormal(tt.ray)
+		if ok != tt.wantOK || (ok && gomath.Abs(got-tt.want) > 1e-9) {
+			t.Errorf("%s: IntersectRayNormal = %v, %v; want %v, %v", tt.name, got, ok, tt.want, tt.wantOK)
+			continue
+		}
+		if ok && n != tt.wantN {
+			t.Errorf("%s: normal = %v, want %v", tt.name, n, tt.wantN)
+		}
+	}
+}
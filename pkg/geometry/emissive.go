@@ -0,0 +1,29 @@
+package geometry
+
+import (
+	"grinder/pkg/math"
+	"image/color"
+)
+
+// Emissive makes a shape glow: it gives off Color at Intensity on top of the
+// light it reflects, in the rasterizer's shading as in the path tracer's.
+// It lights nothing else; only the tracer's bounces carry its glow onward.
+type Emissive struct {
+	Shape
+	Color     color.RGBA
+	Intensity float64
+}
+
+// Inner returns the shape made emissive.
+func (e Emissive) Inner() Shape { return e.Shape }
+
+// EmissionOf returns the radiance s gives off, each channel in units of the
+// light's, looking through transforms, instancing and the other decorators.
+// ok is false if s does not glow.
+func EmissionOf(s Shape) (radiance math.Point3D, ok bool) {
+	e, ok := layerOf[Emissive](s)
+	if !ok {
+		return math.Point3D{}, false
+	}
+	return math.Point3D{X: float64(e.Color.R), Y: float64(e.Color.G), Z: float64(e.Color.B)}.Mul(e.Intensity / 255), true
+}
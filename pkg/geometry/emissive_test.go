@@ -0,0 +1,19 @@
+package geometry
+
+import (
+	"grinder/pkg/math"
+	"image/color"
+	"testing"
+)
+
+func TestEmissionOf(t *testing.T) {
+	lamp := Emissive{Shape: Sphere3D{Radius: 1}, Color: color.RGBA{R: 255, G: 51, A: 255}, Intensity: 2}
+	moved, _ := NewTransformedShape(Textured{Shape: lamp}, math.Translate4(math.Point3D{Y: 1}))
+	got, ok := EmissionOf(moved)
+	if want := (math.Point3D{X: 2, Y: 0.4}); !ok || got.Sub(want).Length() > 1e-12 {
+		t.Errorf("EmissionOf(moved lamp) = %v, %v; want %v, true", got, ok, want)
+	}
+	if _, ok := EmissionOf(lamp.Shape); ok {
+		t.Error("EmissionOf reported a plain sphere as emissive")
+	}
+}
@@ -0,0 +1,123 @@
+package geometry
+
+import (
+	"grinder/pkg/math"
+	"image/color"
+)
+
+// InstancedShape places one shared base shape at many transforms without
+// copying its geometry. NewBVH splits it into its instances so each one gets
+// its own world-space bounds.
+type InstancedShape struct {
+	Base      Shape
+	instances []Shape
+	aabb      math.AABB3D
+}
+
+// NewInstancedShape builds an instance of base for each local-to-world
+// transform. It returns false if any transform is singular.
+func NewInstancedShape(base Shape, transforms []math.Mat4) (*InstancedShape, bool) {
+	is := &InstancedShape{Base: base}
+	for i, m := range transforms {
+		ts, ok := NewTransformedShape(base, m)
+		if !ok {
+			return nil, false
+		}
+		if i == 0 {
+			is.aabb = ts.GetAABB()
+		} else {
+			b := ts.GetAABB()
+			is.aabb = is.aabb.Expand(b.Min).Expand(b.Max)
+		}
+		is.instances = append(is.instances, ts)
+	}
+	return is, true
+}
+
+// Instances returns one shape per transform. They share the base geometry and
+// are stable across calls, so they can be used as map keys.
+func (is *InstancedShape) Instances() []Shape { return is.instances }
+
+// Contains checks the point against each instance in turn.
+func (is *InstancedShape) Contains(p math.Point3D, t float64) bool {
+	if !is.aabb.Contains(p) {
+		return false
+	}
+	for _, inst := range is.instances {
+		if inst.GetAABB().Contains(p) && inst.Contains(p, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Intersects checks if any instance intersects the AABB.
+func (is *InstancedShape) Intersects(aabb math.AABB3D) bool {
+	if !is.aabb.Intersects(aabb) {
+		return false
+	}
+	for _, inst := range is.instances {
+		if inst.Intersects(aabb) {
+			return true
+		}
+	}
+	return false
+}
+
+// instanceAt returns the first instance containing p, or the one with the
+// nearest center when p lies just outside every instance.
+func (is *InstancedShape) instanceAt(p math.Point3D, t float64) Shape {
+	var nearest Shape
+	best := -1.0
+	for _, inst := range is.instances {
+		if inst.Contains(p, t) {
+			return inst
+		}
+		if d := p.Sub(inst.GetCenter()).LengthSquared(); best < 0 || d < best {
+			best, nearest = d, inst
+		}
+	}
+	return nearest
+}
+
+// NormalAtPoint returns the normal of the instance at p.
+func (is *InstancedShape) NormalAtPoint(p math.Point3D, t float64) math.Normal3D {
+	inst := is.instanceAt(p, t)
+	if inst == nil {
+		return math.Normal3D{}
+	}
+	return inst.NormalAtPoint(p, t)
+}
+
+// GetColor returns the color of the base shape.
+func (is *InstancedShape) GetColor() color.RGBA { return is.Base.GetColor() }
+
+// GetColorAt returns the color of the instance at p.
+func (is *InstancedShape) GetColorAt(p math.Point3D, t float64) color.RGBA {
+	inst := is.instanceAt(p, t)
+	if inst == nil {
+		return is.Base.GetColor()
+	}
+	return inst.GetColorAt(p, t)
+}
+
+// GetShininess returns the shininess of the base shape.
+func (is *InstancedShape) GetShininess() float64 { return is.Base.GetShininess() }
+
+// GetSpecularIntensity returns the specular intensity of the base shape.
+func (is *InstancedShape) GetSpecularIntensity() float64 { return is.Base.GetSpecularIntensity() }
+
+// GetSpecularColor returns the specular color of the base shape.
+func (is *InstancedShape) GetSpecularColor() color.RGBA { return is.Base.GetSpecularColor() }
+
+// GetAABB returns the union of every instance's world bounds.
+func (is *InstancedShape) GetAABB() math.AABB3D { return is.aabb }
+
+// GetCenter returns the center of the combined bounds.
+func (is *InstancedShape) GetCenter() math.Point3D { return is.aabb.Center() }
+
+// IsVolumetric reports whether the base shape is volumetric.
+func (is *InstancedShape) IsVolumetric() bool { return is.Base.IsVolumetric() }
+
+// Inner returns the base shape the instances copy.
+func (is *InstancedShape) Inner() Shape { return is.Base }
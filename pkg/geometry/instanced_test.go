@@ -0,0 +1,55 @@
+package geometry
+
+import (
+	"grinder/pkg/math"
+	"testing"
+)
+
+func TestInstancedShape_Contains(t *testing.T) {
+	base := Sphere3D{Radius: 0.5}
+	var transforms []math.Mat4
+	for i := 0; i < 3; i++ {
+		transforms = append(transforms, math.Translate4(math.Point3D{X: float64(i) * 2}))
+	}
+	is, ok := NewInstancedShape(base, transforms)
+	if !ok {
+		t.Fatal("NewInstancedShape rejected invertible transforms")
+	}
+	for i := 0; i < 3; i++ {
+		p := math.Point3D{X: float64(i) * 2}
+		if !is.Contains(p, 0) {
+			t.Errorf("instance %d center %v should be contained", i, p)
+		}
+	}
+	if is.Contains(math.Point3D{X: 1}, 0) {
+		t.Error("point between instances should be outside")
+	}
+	aabb := is.GetAABB()
+	if aabb.Min.X != -0.5 || aabb.Max.X != 4.5 {
+		t.Errorf("GetAABB should cover every instance, got %v", aabb)
+	}
+}
+
+func TestNewBVH_SplitsInstances(t *testing.T) {
+	var transforms []math.Mat4
+	for i := 0; i < 100; i++ {
+		transforms = append(transforms, math.Translate4(math.Point3D{X: float64(i % 10), Z: float64(i / 10)}))
+	}
+	is, _ := NewInstancedShape(Sphere3D{Radius: 0.25}, transforms)
+	bvh := NewBVH([]Shape{is})
+
+	var leaves int
+	var walk func(n *BVHNode)
+	walk = func(n *BVHNode) {
+		if n == nil {
+			return
+		}
+		leaves += len(n.Shapes)
+		walk(n.Left)
+		walk(n.Right)
+	}
+	walk(bvh.Root)
+	if leaves != 100 {
+		t.Errorf("expected 100 instances in the BVH leaves, got %d", leaves)
+	}
+}
@@ -0,0 +1,23 @@
+package geometry
+
+// Matte gives a shape rough, chalky diffuse light by the Oren-Nayar model
+// in place of Lambert's: Roughness is the standard deviation, in radians, of
+// the slopes of its microfacets, and the rougher it is, the more light it
+// throws back toward the light and the less it darkens toward the
+// terminator. Zero is as smooth as Lambert. Only the diffuse term changes;
+// the shader looks Roughness up with RoughnessOf, and the shape's color and
+// Phong highlight are its own.
+type Matte struct {
+	Shape
+	Roughness float64
+}
+
+// Inner returns the shape made matte.
+func (m Matte) Inner() Shape { return m.Shape }
+
+// RoughnessOf returns the Oren-Nayar roughness of s if it is matte, looking
+// through transforms, instancing and the other decorators.
+func RoughnessOf(s Shape) (roughness float64, ok bool) {
+	m, ok := layerOf[Matte](s)
+	return m.Roughness, ok
+}
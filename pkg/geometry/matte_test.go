@@ -0,0 +1,20 @@
+package geometry
+
+import (
+	"grinder/pkg/math"
+	"testing"
+)
+
+func TestRoughnessOf(t *testing.T) {
+	clay := Matte{Shape: Sphere3D{Radius: 1}, Roughness: 0.4}
+	moved, _ := NewTransformedShape(Textured{Shape: clay}, math.Translate4(math.Point3D{Y: 1}))
+	if roughness, ok := RoughnessOf(moved); !ok || roughness != 0.4 {
+		t.Errorf("RoughnessOf(moved matte sphere) = %v, %v; want 0.4, true", roughness, ok)
+	}
+	if _, ok := RoughnessOf(clay.Shape); ok {
+		t.Error("RoughnessOf reported a plain sphere as matte")
+	}
+	if _, ok := Unwrap(clay).(Sphere3D); !ok {
+		t.Errorf("Unwrap(matte sphere) = %T, want the sphere", Unwrap(clay))
+	}
+}
@@ -0,0 +1,20 @@
+package geometry
+
+// Metal makes a shape reflect like metal in the path tracer: Metalness is
+// the fraction of light it mirrors, in [0, 1], blurred by its shininess, and
+// the reflection takes its specular color. Shapes that are not metal mirror
+// nothing.
+type Metal struct {
+	Shape
+	Metalness float64
+}
+
+// Inner returns the shape made metal.
+func (m Metal) Inner() Shape { return m.Shape }
+
+// MetalnessOf returns the metalness of s, looking through transforms,
+// instancing and the other decorators, and 0 if it is not metal.
+func MetalnessOf(s Shape) float64 {
+	m, _ := layerOf[Metal](s)
+	return m.Metalness
+}
@@ -0,0 +1,20 @@
+package geometry
+
+import (
+	"grinder/pkg/math"
+	"testing"
+)
+
+func TestMetalnessOf(t *testing.T) {
+	chrome := Metal{Shape: Sphere3D{Radius: 1}, Metalness: 0.9}
+	instanced, _ := NewInstancedShape(Matte{Shape: chrome}, []math.Mat4{math.Translate4(math.Point3D{X: 2})})
+	if got := MetalnessOf(instanced.Instances()[0]); got != 0.9 {
+		t.Errorf("MetalnessOf(instanced matte chrome) = %v, want 0.9", got)
+	}
+	if got := MetalnessOf(chrome.Shape); got != 0 {
+		t.Errorf("MetalnessOf(plain sphere) = %v, want 0", got)
+	}
+	if _, ok := Unwrap(chrome).(Sphere3D); !ok {
+		t.Errorf("Unwrap(metal sphere) = %T, want the sphere", Unwrap(chrome))
+	}
+}
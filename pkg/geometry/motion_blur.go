@@ -0,0 +1,28 @@
+package geometry
+
+// MotionBlurred sets how much of its motion a shape shows while the shutter
+// is open. The renderer samples the shape at Scale times each pixel's
+// shutter time, so 0 renders it sharp where its path starts and 1 blurs it
+// like any other. The path itself is the inner shape's, so a bake at a
+// given time still finds the shape where it is then.
+type MotionBlurred struct {
+	Shape
+	Scale float64
+}
+
+// Inner returns the shape whose blur is scaled.
+func (m MotionBlurred) Inner() Shape { return m.Shape }
+
+// MotionBlurOf returns the share of the shutter s moves through, looking
+// through transforms, instancing and the other decorators: its Scale if it
+// is MotionBlurred, and 1 otherwise.
+func MotionBlurOf(s Shape) float64 {
+	if m, ok := layerOf[MotionBlurred](s); ok {
+		return m.Scale
+	}
+	return 1
+}
+
+// ShapeTime returns the time along s's own motion that shutter time t
+// samples.
+func ShapeTime(s Shape, t float64) float64 { return t * MotionBlurOf(s) }
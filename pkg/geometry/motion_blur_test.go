@@ -0,0 +1,24 @@
+package geometry
+
+import (
+	"grinder/pkg/math"
+	"testing"
+)
+
+func TestShapeTime(t *testing.T) {
+	ball := Sphere3D{Radius: 1, Velocity: math.Point3D{X: 4}}
+	sharp, _ := NewTransformedShape(Textured{Shape: MotionBlurred{Shape: ball, Scale: 0}}, math.Translate4(math.Point3D{Y: 1}))
+	half := MotionBlurred{Shape: ball, Scale: 0.5}
+	for _, tt := range []struct {
+		name string
+		s    Shape
+		want float64
+	}{{"plain", ball, 0.8}, {"sharp", sharp, 0}, {"half", half, 0.4}} {
+		if got := ShapeTime(tt.s, 0.8); got != tt.want {
+			t.Errorf("ShapeTime(%s, 0.8) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if _, ok := Unwrap(half).(Sphere3D); !ok {
+		t.Errorf("Unwrap(motion blurred sphere) = %T, want the sphere", Unwrap(half))
+	}
+}
@@ -14,13 +14,31 @@ type Plane3D struct {
 	Shininess         float64
 	SpecularIntensity float64
 	SpecularColor     color.RGBA
+	Bump              *BumpMap // optional surface detail
 }
 
 // Contains checks if a point is "under" the plane (in the direction opposite the normal).
 func (pl Plane3D) Contains(p math.Point3D, t float64) bool {
-	v := p.Sub(pl.Point)
 	// Add a tiny epsilon (0.0001) to reduce sampling noise at the surface
-	return v.DotNormal(pl.Normal) <= 0.0001
+	return pl.SignedDistance(p) <= 0.0001
+}
+
+// SignedDistance returns how far p is above the plane, in units of the
+// normal's length: positive on the side the normal faces.
+func (pl Plane3D) SignedDistance(p math.Point3D) float64 {
+	return p.Sub(pl.Point).DotNormal(pl.Normal)
+}
+
+// IntersectRay returns the distance along r to where it crosses the plane,
+// from either side. Rays parallel to the plane, or crossing it behind their
+// origin, miss.
+func (pl Plane3D) IntersectRay(r math.Ray) (float64, bool) {
+	denom := r.Direction.DotNormal(pl.Normal)
+	if gomath.Abs(denom) < 1e-12 {
+		return 0, false
+	}
+	t := pl.Point.Sub(r.Origin).DotNormal(pl.Normal) / denom
+	return t, t > 0
 }
 
 // Intersects checks if the plane intersects with an AABB.
@@ -50,14 +68,40 @@ func (pl Plane3D) Intersects(aabb math.AABB3D) bool {
 	return hasIn
 }
 
-// NormalAtPoint returns the normal of the plane, which is constant.
+// NormalAtPoint returns the normal of the plane, which is constant unless a
+// bump map tilts it.
 func (p Plane3D) NormalAtPoint(pos math.Point3D, t float64) math.Normal3D {
-	return p.Normal // Planes usually have a constant normal
+	if p.Bump == nil {
+		return p.Normal // Planes usually have a constant normal
+	}
+	n := p.Normal.ToVector().Normalize()
+	tangent, bitangent := p.basis()
+	scale := p.Bump.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	d := pos.Sub(p.Point)
+	return p.Bump.perturb(n, tangent, bitangent, d.Dot(tangent)/scale, d.Dot(bitangent)/scale)
+}
+
+// basis returns two unit directions spanning the plane, used as its texture
+// axes. On a floor facing +Y, the tangent is +X.
+func (p Plane3D) basis() (tangent, bitangent math.Point3D) {
+	n := p.Normal.ToVector().Normalize()
+	ref := math.Point3D{X: 0, Y: 0, Z: 1}
+	if gomath.Abs(n.Z) > 0.9 {
+		ref = math.Point3D{X: 1, Y: 0, Z: 0}
+	}
+	tangent = n.Cross(ref).Normalize()
+	return tangent, n.Cross(tangent)
 }
 
 // GetColor returns the color of the plane.
 func (pl Plane3D) GetColor() color.RGBA { return pl.Color }
 
+// GetColorAt returns the plane's color, which is the same everywhere.
+func (pl Plane3D) GetColorAt(p math.Point3D, t float64) color.RGBA { return pl.Color }
+
 // GetShininess returns the shininess of the plane.
 func (pl Plane3D) GetShininess() float64 { return pl.Shininess }
 
@@ -48,3 +48,27 @@ func TestPlane3D_Intersects(t *testing.T) {
 		t.Errorf("Plane3D Intersects failed: AABB %v should not intersect (above)", aabbAbove)
 	}
 }
+
+func TestPlane3D_IntersectRay(t *testing.T) {
+	plane := Plane3D{Point: math.Point3D{X: 0, Y: -1, Z: 0}, Normal: math.Normal3D{X: 0, Y: 1, Z: 0}}
+
+	down := math.Ray{Origin: math.Point3D{X: 3, Y: 1, Z: 0}, Direction: math.Point3D{X: 0, Y: -1, Z: 0}}
+	if tHit, ok := plane.IntersectRay(down); !ok || tHit != 2 {
+		t.Errorf("IntersectRay(down) = %v, %v; want 2, true", tHit, ok)
+	}
+
+	// From below, facing up, the plane is hit from its back side.
+	up := math.Ray{Origin: math.Point3D{X: 0, Y: -4, Z: 0}, Direction: math.Point3D{X: 0, Y: 1, Z: 0}}
+	if tHit, ok := plane.IntersectRay(up); !ok || tHit != 3 {
+		t.Errorf("IntersectRay(up) = %v, %v; want 3, true", tHit, ok)
+	}
+
+	away := math.Ray{Origin: math.Point3D{X: 0, Y: 1, Z: 0}, Direction: math.Point3D{X: 0, Y: 1, Z: 0}}
+	if _, ok := plane.IntersectRay(away); ok {
+		t.Error("IntersectRay hit the plane behind the ray origin")
+	}
+	parallel := math.Ray{Origin: math.Point3D{X: 0, Y: 1, Z: 0}, Direction: math.Point3D{X: 1, Y: 0, Z: 0}}
+	if _, ok := plane.IntersectRay(parallel); ok {
+		t.Error("IntersectRay hit the plane with a parallel ray")
+	}
+}
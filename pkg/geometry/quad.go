@@ -1,6 +1,7 @@
 package geometry
 
 import (
+	gimage "grinder/pkg/image"
 	"grinder/pkg/math"
 	"image/color"
 	gomath "math"
@@ -15,6 +16,8 @@ type BilinearQuad struct {
 	Shininess          float64
 	SpecularIntensity  float64
 	SpecularColor      color.RGBA
+	Bump               *BumpMap        // optional surface detail, mapped once across u and v
+	NormalMap          *gimage.Texture // optional tangent-space normals, mapped once across u and v
 }
 
 // PositionAt calculates the point on the quad at parameters u, v
@@ -44,6 +47,45 @@ func (q *BilinearQuad) DistanceToPoint(p math.Point3D) float64 {
 	return gomath.Abs(p.Sub(center).Dot(n))
 }
 func (q *BilinearQuad) NormalAtPoint(p math.Point3D, t float64) math.Normal3D {
+	n := q.baseNormal(p)
+	if q.Bump == nil && q.NormalMap == nil {
+		return n
+	}
+	u, v := q.findUVForPoint(p)
+	tangent, bitangent := q.tangentFrame(n.ToVector(), u, v)
+	if q.NormalMap != nil {
+		// The frame is built around the (possibly smooth) base normal, so
+		// mapped detail rides on top of the vertex-normal shading.
+		n = applyNormalMap(q.NormalMap.Sample(u, v), n.ToVector(), tangent, bitangent)
+		tangent, bitangent = q.tangentFrame(n.ToVector(), u, v)
+	}
+	if q.Bump == nil {
+		return n
+	}
+	return q.Bump.perturb(n.ToVector(), tangent, bitangent, u, v)
+}
+
+// applyNormalMap turns a normal-map texel into a world normal. Channels map
+// from [0, 1] to [-1, 1]: red along the tangent, green toward the top of the
+// image (against the bitangent, since v grows downward) and blue along n.
+func applyNormalMap(texel, n, tangent, bitangent math.Point3D) math.Normal3D {
+	x, y, z := 2*texel.X-1, 2*texel.Y-1, 2*texel.Z-1
+	w := tangent.Mul(x).Sub(bitangent.Mul(y)).Add(n.Mul(z)).Normalize()
+	return math.Normal3D{X: w.X, Y: w.Y, Z: w.Z}
+}
+
+// tangentFrame returns the surface's u and v directions at (u, v), made
+// perpendicular to n.
+func (q *BilinearQuad) tangentFrame(n math.Point3D, u, v float64) (tangent, bitangent math.Point3D) {
+	tangent = q.partialDerivativeU(u, v)
+	tangent = tangent.Sub(n.Mul(n.Dot(tangent))).Normalize()
+	bitangent = q.partialDerivativeV(u, v)
+	bitangent = bitangent.Sub(n.Mul(n.Dot(bitangent))).Sub(tangent.Mul(tangent.Dot(bitangent))).Normalize()
+	return tangent, bitangent
+}
+
+// baseNormal is the quad's normal at p before any bump mapping.
+func (q *BilinearQuad) baseNormal(p math.Point3D) math.Normal3D {
 	// Use smooth normals interpolated from vertex normals if they are defined (non-zero)
 	zeroNormal := math.Normal3D{}
 	if q.N00 != zeroNormal || q.N10 != zeroNormal || q.N11 != zeroNormal || q.N01 != zeroNormal {
@@ -161,6 +203,11 @@ func (q *BilinearQuad) GetColor() color.RGBA {
 	return q.Color
 }
 
+// GetColorAt returns the quad's color, which is the same everywhere.
+func (q *BilinearQuad) GetColorAt(p math.Point3D, t float64) color.RGBA {
+	return q.Color
+}
+
 func (q *BilinearQuad) GetShininess() float64 {
 	return 32.0 // Default or add to struct
 }
@@ -74,3 +74,23 @@ func TestBilinearQuadPositionAt(t *testing.T) {
 		t.Errorf("Center position should be (0,0,0), got %v", centerActual)
 	}
 }
+
+// BenchmarkBilinearQuad_FindUVForPoint inverts points on a twisted quad,
+// where Newton's method needs several iterations to converge.
+func BenchmarkBilinearQuad_FindUVForPoint(b *testing.B) {
+	quad := &BilinearQuad{
+		P00: math.Point3D{X: -1, Y: -1, Z: 0},
+		P10: math.Point3D{X: 1, Y: -1, Z: 0.5},
+		P11: math.Point3D{X: 1, Y: 1, Z: 0},
+		P01: math.Point3D{X: -1, Y: 1, Z: -0.5},
+	}
+	var targets []math.Point3D
+	for i := 0; i < 64; i++ {
+		targets = append(targets, quad.PositionAt(float64(i%8)/7, float64(i/8)/7))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		quad.findUVForPoint(targets[i%len(targets)])
+	}
+}
@@ -61,6 +61,9 @@ func (s *SDSObject) NormalAtPoint(p math.Point3D, t float64) math.Normal3D {
 }
 func (s *SDSObject) GetColor() color.RGBA { return s.Color }
 
+// GetColorAt returns the object's color, which is the same everywhere.
+func (s *SDSObject) GetColorAt(p math.Point3D, t float64) color.RGBA { return s.Color }
+
 func (s *SDSObject) GetAABB() math.AABB3D    { return s.AABB }
 func (s *SDSObject) GetCenter() math.Point3D { return s.AABB.Center() }
 func (s *SDSObject) GetShininess() float64   { return s.Shininess }
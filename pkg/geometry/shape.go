@@ -11,6 +11,9 @@ type Shape interface {
 	Intersects(aabb math.AABB3D) bool
 	NormalAtPoint(p math.Point3D, t float64) math.Normal3D
 	GetColor() color.RGBA
+	// GetColorAt returns the surface color at p; shapes with a single
+	// color return GetColor().
+	GetColorAt(p math.Point3D, t float64) color.RGBA
 	GetShininess() float64
 	GetSpecularIntensity() float64
 	GetSpecularColor() color.RGBA
@@ -20,7 +23,54 @@ type Shape interface {
 }
 
 // VolumetricShape defines the interface for all volumetric objects in the scene.
+// Renderers find volumes with VolumeOf, which also sees through wrappers.
 type VolumetricShape interface {
 	Shape
-	GetDensity() float64
+	GetDensity() float64                         // nominal density, e.g. for display
+	DensityAt(p math.Point3D, t float64) float64 // density at p at time t, 0 outside the volume
+}
+
+// Wrapper is a shape built around another one. The decorators, such as
+// Textured and Matte, only change how the inner shape looks;
+// TransformedShape and InstancedShape move it.
+type Wrapper interface {
+	Shape
+	Inner() Shape
+}
+
+// layerOf returns the outermost layer of s, s itself included, that is a
+// T, looking through every Wrapper. Lookups of what a decorator adds, such
+// as RoughnessOf, use it to find the decorator wherever it sits.
+func layerOf[T any](s Shape) (T, bool) {
+	for {
+		if v, ok := s.(T); ok {
+			return v, true
+		}
+		w, ok := s.(Wrapper)
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		s = w.Inner()
+	}
+}
+
+// decorated returns the shape inside s if s is a decorator: a Wrapper that
+// leaves the inner shape where it is.
+func decorated(s Shape) (Shape, bool) {
+	switch s.(type) {
+	case *TransformedShape, *InstancedShape:
+		return nil, false
+	}
+	if w, ok := s.(Wrapper); ok {
+		return w.Inner(), true
+	}
+	return nil, false
+}
+
+// TranslucentShape is a solid that lets part of the light through, such as
+// glass. Shadow tests detect it by asserting a Shape to this interface.
+type TranslucentShape interface {
+	Shape
+	GetOpacity() float64 // in (0, 1]; 1 blocks like any other solid
 }
@@ -10,6 +10,7 @@ import (
 type Sphere3D struct {
 	Center            math.Point3D
 	Velocity          math.Point3D // Displacement over the shutter window
+	Motion            *math.Motion // Keyframed path of the center; overrides Velocity
 	Radius            float64
 	Color             color.RGBA
 	Shininess         float64
@@ -19,6 +20,9 @@ type Sphere3D struct {
 
 // GetCenterAt calculates the position for a specific sample's time
 func (s Sphere3D) GetCenterAt(t float64) math.Point3D {
+	if s.Motion != nil {
+		return s.Motion.At(t)
+	}
 	return s.Center.Add(s.Velocity.Mul(t))
 }
 
@@ -52,6 +56,9 @@ func (s Sphere3D) NormalAtPoint(p math.Point3D, t float64) math.Normal3D {
 // GetColor returns the color of the sphere.
 func (s Sphere3D) GetColor() color.RGBA { return s.Color }
 
+// GetColorAt returns the sphere's color, which is the same everywhere.
+func (s Sphere3D) GetColorAt(p math.Point3D, t float64) color.RGBA { return s.Color }
+
 // GetShininess returns the shininess of the sphere.
 func (s Sphere3D) GetShininess() float64 { return s.Shininess }
 
@@ -63,6 +70,11 @@ func (s Sphere3D) GetSpecularColor() color.RGBA { return s.SpecularColor }
 
 // GetAABB returns the bounding box of the sphere.
 func (s Sphere3D) GetAABB() math.AABB3D {
+	if s.Motion != nil {
+		b := s.Motion.Bounds()
+		r := math.Point3D{X: s.Radius, Y: s.Radius, Z: s.Radius}
+		return math.AABB3D{Min: b.Min.Sub(r), Max: b.Max.Add(r)}
+	}
 	// The bounds must encapsulate the sphere at BOTH ends of the motion
 	startCenter := s.Center
 	endCenter := s.Center.Add(s.Velocity)
@@ -0,0 +1,86 @@
+package geometry
+
+import (
+	"grinder/pkg/math"
+	"image/color"
+	gomath "math"
+)
+
+// Texture gives a surface its color at a point in the shape's own space.
+type Texture interface {
+	ColorAt(p math.Point3D) color.RGBA
+}
+
+// Textured colors a shape with a texture: GetColorAt samples Texture at the
+// point in place of the shape's own color. GetColor, which callers wanting
+// one color per shape use, still returns the shape's.
+type Textured struct {
+	Shape
+	Texture Texture
+}
+
+// Inner returns the textured shape.
+func (t Textured) Inner() Shape { return t.Shape }
+
+// GetColorAt returns the texture's color at p.
+func (t Textured) GetColorAt(p math.Point3D, _ float64) color.RGBA { return t.Texture.ColorAt(p) }
+
+// Procedural pattern kinds.
+const (
+	Marble = "marble" // veins across X, bent by noise
+	Wood   = "wood"   // rings around the Y axis, bent by noise
+)
+
+// fbmOctaves, fbmLacunarity and fbmGain shape the noise that bends the
+// procedural patterns.
+const (
+	fbmOctaves    = 5
+	fbmLacunarity = 2.0
+	fbmGain       = 0.5
+)
+
+// Procedural is a solid texture computed from noise, so a shape shows the
+// same pattern whatever its resolution or how it is sliced. It blends from
+// Color1 to Color2 along a pattern of Kind.
+type Procedural struct {
+	Kind           string
+	Color1, Color2 color.RGBA
+	Frequency      float64 // pattern repeats per world unit
+	Turbulence     float64 // how far the noise bends the pattern
+	Noise          *math.Perlin
+}
+
+// ColorAt returns the pattern's color at p.
+func (pr Procedural) ColorAt(p math.Point3D) color.RGBA {
+	q := p.Mul(pr.Frequency)
+	bend := pr.Turbulence * pr.Noise.Fbm(q.X, q.Y, q.Z, fbmOctaves, fbmLacunarity, fbmGain)
+	var f float64
+	switch pr.Kind {
+	case Wood:
+		r := gomath.Sqrt(q.X*q.X+q.Z*q.Z) + bend
+		f = r - gomath.Floor(r)
+	default:
+		f = 0.5 + 0.5*gomath.Sin((q.X+bend)*gomath.Pi)
+	}
+	return lerpColor(pr.Color1, pr.Color2, f)
+}
+
+// lerpColor blends a toward b by f in [0, 1].
+func lerpColor(a, b color.RGBA, f float64) color.RGBA {
+	mix := func(x, y uint8) uint8 { return uint8(gomath.Round(float64(x) + f*(float64(y)-float64(x)))) }
+	return color.RGBA{R: mix(a.R, b.R), G: mix(a.G, b.G), B: mix(a.B, b.B), A: mix(a.A, b.A)}
+}
+
+// Unwrap strips the decorators that only change how a shape looks, such as
+// Textured, Translucent, Anisotropic, Toon and Matte, returning the geometry
+// beneath. Code that special-cases a shape type, such as an infinite plane,
+// looks through them with it.
+func Unwrap(s Shape) Shape {
+	for {
+		inner, ok := decorated(s)
+		if !ok {
+			return s
+		}
+		s = inner
+	}
+}
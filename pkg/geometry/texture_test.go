@@ -0,0 +1,70 @@
+package geometry
+
+import (
+	"grinder/pkg/math"
+	"image/color"
+	"testing"
+)
+
+// TestProcedural_Marble checks that marble veins vary across the surface
+// and that a point's color depends only on the point.
+func TestProcedural_Marble(t *testing.T) {
+	black, white := color.RGBA{A: 255}, color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	marble := Procedural{Kind: Marble, Color1: black, Color2: white, Frequency: 2, Turbulence: 1, Noise: math.NewPerlin(7)}
+
+	lo, hi := uint8(255), uint8(0)
+	for i := 0; i < 200; i++ {
+		p := math.Point3D{X: float64(i) * 0.013, Y: 0.3, Z: -0.2}
+		c := marble.ColorAt(p)
+		if again := marble.ColorAt(p); again != c {
+			t.Fatalf("ColorAt(%v) = %v then %v", p, c, again)
+		}
+		lo, hi = min(lo, c.R), max(hi, c.R)
+	}
+	if lo > 30 || hi < 225 {
+		t.Errorf("marble spans %d..%d along X, want veins from near black to near white", lo, hi)
+	}
+
+	other := marble
+	other.Noise = math.NewPerlin(8)
+	p := math.Point3D{X: 0.4, Y: 0.3, Z: 0.9}
+	if marble.ColorAt(p) == other.ColorAt(p) && marble.ColorAt(p.Mul(2)) == other.ColorAt(p.Mul(2)) {
+		t.Errorf("seeds 7 and 8 give the same marble")
+	}
+}
+
+// TestProcedural_Wood checks that without turbulence wood rings are circles
+// around the Y axis, one per 1/Frequency of radius.
+func TestProcedural_Wood(t *testing.T) {
+	black, white := color.RGBA{A: 255}, color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	wood := Procedural{Kind: Wood, Color1: black, Color2: white, Frequency: 4, Noise: math.NewPerlin(1)}
+
+	a := wood.ColorAt(math.Point3D{X: 0.3, Y: 5})
+	b := wood.ColorAt(math.Point3D{Z: 0.3, Y: -2})
+	c := wood.ColorAt(math.Point3D{X: 0.55})
+	if a != b || a != c {
+		t.Errorf("colors on one ring and the next = %v, %v, %v, want equal", a, b, c)
+	}
+	if a.R < 45 || a.R > 57 {
+		t.Errorf("a fifth of the way through a ring = %v, want a fifth of the way to white", a)
+	}
+}
+
+// TestTextured_GetColorAt checks that a textured shape takes its color from
+// the texture and that Unwrap finds the plane under it.
+func TestTextured_GetColorAt(t *testing.T) {
+	red := color.RGBA{R: 255, A: 255}
+	plane := Plane3D{Normal: math.Normal3D{Y: 1}, Color: color.RGBA{B: 255, A: 255}}
+	tex := Procedural{Kind: Marble, Color1: red, Color2: red, Frequency: 1, Noise: math.NewPerlin(1)}
+	s := Translucent{Shape: Textured{Shape: plane, Texture: tex}, Opacity: 0.5}
+
+	if got := s.GetColorAt(math.Point3D{X: 3}, 0); got != red {
+		t.Errorf("GetColorAt = %v, want the texture's %v", got, red)
+	}
+	if _, ok := Unwrap(s).(Plane3D); !ok {
+		t.Errorf("Unwrap = %T, want Plane3D", Unwrap(s))
+	}
+	if got := OpacityOf(Textured{Shape: s, Texture: tex}); got != 0.5 {
+		t.Errorf("OpacityOf through a texture = %v, want 0.5", got)
+	}
+}
@@ -0,0 +1,23 @@
+package geometry
+
+// Toon shades a shape like cel animation: its diffuse light falls into
+// Bands flat steps, its highlight is either on or off, and where the surface
+// turns away from the eye, the cosine between the view direction and the
+// normal dropping below Outline, it is drawn as a dark outline. The shader
+// reads Bands and Outline through ToonOf and steps whichever diffuse and
+// highlight terms the shape would otherwise get, Oren-Nayar and GGX included.
+type Toon struct {
+	Shape
+	Bands   int
+	Outline float64
+}
+
+// Inner returns the toon shaded shape.
+func (v Toon) Inner() Shape { return v.Shape }
+
+// ToonOf returns the band count and outline threshold of s if it is toon
+// shaded, looking through transforms, instancing and the other decorators.
+func ToonOf(s Shape) (bands int, outline float64, ok bool) {
+	v, ok := layerOf[Toon](s)
+	return v.Bands, v.Outline, ok
+}
@@ -0,0 +1,20 @@
+package geometry
+
+import (
+	"grinder/pkg/math"
+	"testing"
+)
+
+func TestToonOf(t *testing.T) {
+	cel := Toon{Shape: Sphere3D{Radius: 1}, Bands: 4, Outline: 0.2}
+	moved, _ := NewTransformedShape(Translucent{Shape: cel, Opacity: 0.5}, math.Translate4(math.Point3D{X: 2}))
+	if bands, outline, ok := ToonOf(moved); !ok || bands != 4 || outline != 0.2 {
+		t.Errorf("ToonOf(moved toon sphere) = %v, %v, %v; want 4, 0.2, true", bands, outline, ok)
+	}
+	if _, _, ok := ToonOf(cel.Shape); ok {
+		t.Error("ToonOf reported a plain sphere as toon shaded")
+	}
+	if _, ok := Unwrap(cel).(Sphere3D); !ok {
+		t.Errorf("Unwrap(toon sphere) = %T, want the sphere", Unwrap(cel))
+	}
+}
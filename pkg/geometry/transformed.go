@@ -0,0 +1,127 @@
+package geometry
+
+import (
+	"grinder/pkg/math"
+	"image/color"
+	gomath "math"
+)
+
+// TransformedShape places a shape authored in local space into the world
+// through an affine transform. Queries are mapped back into local space.
+type TransformedShape struct {
+	Shape   Shape
+	ToWorld math.Mat4
+	ToLocal math.Mat4
+}
+
+// NewTransformedShape wraps s with the local-to-world transform m. It returns
+// false if m is singular (e.g. a zero scale).
+func NewTransformedShape(s Shape, m math.Mat4) (*TransformedShape, bool) {
+	inv, ok := m.Inverse()
+	if !ok {
+		return nil, false
+	}
+	return &TransformedShape{Shape: s, ToWorld: m, ToLocal: inv}, true
+}
+
+// Contains checks the point against the wrapped shape in local space.
+func (ts *TransformedShape) Contains(p math.Point3D, t float64) bool {
+	return ts.Shape.Contains(ts.ToLocal.TransformPoint(p), t)
+}
+
+// Intersects tests the local bounds of the world-space box against the
+// wrapped shape. This is conservative under rotation, which is all the
+// subdivider needs. For a wrapped box the two bounds tests cover the face
+// axes of both boxes, so the edge-edge axes are added to make it an exact
+// separating-axis test.
+func (ts *TransformedShape) Intersects(aabb math.AABB3D) bool {
+	if !ts.GetAABB().Intersects(aabb) {
+		return false
+	}
+	if !ts.Shape.Intersects(ts.ToLocal.TransformAABB(aabb)) {
+		return false
+	}
+	if b, ok := ts.Shape.(Box3D); ok {
+		return !edgeAxesSeparate(ts.ToWorld, b.GetAABB(), aabb)
+	}
+	return true
+}
+
+// edgeAxesSeparate reports whether the local box, carried into the world by
+// m, and the world aabb are separated along any cross product of their edge
+// directions.
+func edgeAxesSeparate(m math.Mat4, local, aabb math.AABB3D) bool {
+	half := local.Max.Sub(local.Min).Mul(0.5)
+	edges := [3]math.Point3D{
+		m.TransformVector(math.Point3D{X: half.X}),
+		m.TransformVector(math.Point3D{Y: half.Y}),
+		m.TransformVector(math.Point3D{Z: half.Z}),
+	}
+	h := aabb.Max.Sub(aabb.Min).Mul(0.5)
+	d := m.TransformPoint(local.Center()).Sub(aabb.Center())
+	worldAxes := [3]math.Point3D{{X: 1}, {Y: 1}, {Z: 1}}
+	for _, e := range edges {
+		for _, w := range worldAxes {
+			a := e.Cross(w)
+			if a.Length() < 1e-12 {
+				continue // parallel edges: covered by the face axes
+			}
+			r := h.X*gomath.Abs(a.X) + h.Y*gomath.Abs(a.Y) + h.Z*gomath.Abs(a.Z)
+			for _, e2 := range edges {
+				r += gomath.Abs(e2.Dot(a))
+			}
+			if gomath.Abs(d.Dot(a)) > r {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NormalAtPoint transforms the local normal by the inverse-transpose so it
+// stays perpendicular to the surface under non-uniform scale.
+func (ts *TransformedShape) NormalAtPoint(p math.Point3D, t float64) math.Normal3D {
+	n := ts.Shape.NormalAtPoint(ts.ToLocal.TransformPoint(p), t)
+	w := ts.ToLocal.Transpose().TransformVector(n.ToVector()).Normalize()
+	return math.Normal3D{X: w.X, Y: w.Y, Z: w.Z}
+}
+
+// GetColor returns the color of the wrapped shape.
+func (ts *TransformedShape) GetColor() color.RGBA { return ts.Shape.GetColor() }
+
+// GetColorAt returns the wrapped shape's color at p mapped into local space.
+func (ts *TransformedShape) GetColorAt(p math.Point3D, t float64) color.RGBA {
+	return ts.Shape.GetColorAt(ts.ToLocal.TransformPoint(p), t)
+}
+
+// GetShininess returns the shininess of the wrapped shape.
+func (ts *TransformedShape) GetShininess() float64 { return ts.Shape.GetShininess() }
+
+// GetSpecularIntensity returns the specular intensity of the wrapped shape.
+func (ts *TransformedShape) GetSpecularIntensity() float64 { return ts.Shape.GetSpecularIntensity() }
+
+// GetSpecularColor returns the specular color of the wrapped shape.
+func (ts *TransformedShape) GetSpecularColor() color.RGBA { return ts.Shape.GetSpecularColor() }
+
+// GetAABB transforms the eight corners of the local bounds into world space.
+// Unbounded shapes such as planes keep their infinite box.
+func (ts *TransformedShape) GetAABB() math.AABB3D {
+	local := ts.Shape.GetAABB()
+	for _, v := range []float64{local.Min.X, local.Min.Y, local.Min.Z, local.Max.X, local.Max.Y, local.Max.Z} {
+		if gomath.IsInf(v, 0) {
+			return local
+		}
+	}
+	return ts.ToWorld.TransformAABB(local)
+}
+
+// GetCenter returns the wrapped shape's center in world space.
+func (ts *TransformedShape) GetCenter() math.Point3D {
+	return ts.ToWorld.TransformPoint(ts.Shape.GetCenter())
+}
+
+// IsVolumetric reports whether the wrapped shape is volumetric.
+func (ts *TransformedShape) IsVolumetric() bool { return ts.Shape.IsVolumetric() }
+
+// Inner returns the shape in its local space.
+func (ts *TransformedShape) Inner() Shape { return ts.Shape }
@@ -0,0 +1,102 @@
+package geometry
+
+import (
+	"grinder/pkg/math"
+	"image/color"
+	gomath "math"
+	"testing"
+)
+
+// splitSphere is a sphere colored red on its -X half and blue on its +X
+// half, in its own space.
+type splitSphere struct{ Sphere3D }
+
+func (s splitSphere) GetColorAt(p math.Point3D, t float64) color.RGBA {
+	if p.X < s.Center.X {
+		return color.RGBA{R: 255, A: 255}
+	}
+	return color.RGBA{B: 255, A: 255}
+}
+
+func TestTransformedShape_Contains(t *testing.T) {
+	// A unit cube stretched 3x along X and moved to x=10.
+	box := Box3D{Min: math.Point3D{X: -0.5, Y: -0.5, Z: -0.5}, Max: math.Point3D{X: 0.5, Y: 0.5, Z: 0.5}}
+	m := math.Translate4(math.Point3D{X: 10}).Mul(math.Scale4(math.Point3D{X: 3, Y: 1, Z: 1}))
+	ts, ok := NewTransformedShape(box, m)
+	if !ok {
+		t.Fatal("NewTransformedShape rejected an invertible transform")
+	}
+	if !ts.Contains(math.Point3D{X: 11.4, Y: 0, Z: 0}, 0) {
+		t.Error("point inside the stretched box should be contained")
+	}
+	if ts.Contains(math.Point3D{X: 0, Y: 0, Z: 0}, 0) {
+		t.Error("the untransformed origin should be outside")
+	}
+	aabb := ts.GetAABB()
+	if gomath.Abs(aabb.Min.X-8.5) > 1e-9 || gomath.Abs(aabb.Max.X-11.5) > 1e-9 {
+		t.Errorf("GetAABB failed: got %v", aabb)
+	}
+}
+
+func TestTransformedShape_NormalAtPoint(t *testing.T) {
+	// A sphere squashed along Y: the normal on a slanted point must use the
+	// inverse-transpose, not the plain transform.
+	sphere := Sphere3D{Radius: 1}
+	ts, _ := NewTransformedShape(sphere, math.Scale4(math.Point3D{X: 1, Y: 0.5, Z: 1}))
+	local := math.Point3D{X: 1, Y: 1, Z: 0}.Normalize()
+	world := ts.ToWorld.TransformPoint(local)
+	n := ts.NormalAtPoint(world, 0)
+	// Gradient of x^2 + (2y)^2 = 1 at world is (x, 4y).
+	want := math.Point3D{X: world.X, Y: 4 * world.Y}.Normalize()
+	if gomath.Abs(n.X-want.X) > 1e-9 || gomath.Abs(n.Y-want.Y) > 1e-9 || gomath.Abs(n.Z) > 1e-9 {
+		t.Errorf("NormalAtPoint failed: got %v, want %v", n, want)
+	}
+}
+
+// TestTransformedShape_IntersectsRotatedBox uses an AABB that no face axis
+// separates from a doubly rotated cube; only an edge-edge axis does.
+func TestTransformedShape_IntersectsRotatedBox(t *testing.T) {
+	box := Box3D{Min: math.Point3D{X: -1, Y: -1, Z: -1}, Max: math.Point3D{X: 1, Y: 1, Z: 1}}
+	m := math.Rotate4(math.Point3D{X: 1}, 45).Mul(math.Rotate4(math.Point3D{Z: 1}, 45))
+	ts, _ := NewTransformedShape(box, m)
+
+	near := math.AABB3D{Min: math.Point3D{X: 0.43, Y: -0.15, Z: 1.42}, Max: math.Point3D{X: 0.73, Y: 0.15, Z: 1.72}}
+	if !ts.GetAABB().Intersects(near) || !box.Intersects(ts.ToLocal.TransformAABB(near)) {
+		t.Fatal("test setup: the face-axis bounds tests should overlap")
+	}
+	if ts.Intersects(near) {
+		t.Error("Intersects kept an AABB separated along an edge-edge axis")
+	}
+
+	touching := math.AABB3D{Min: math.Point3D{X: -0.2, Y: -0.2, Z: 1}, Max: math.Point3D{X: 0.2, Y: 0.2, Z: 1.2}}
+	if !ts.Contains(math.Point3D{X: 0, Y: 0, Z: 1.1}, 0) {
+		t.Fatal("test setup: the rotated cube should reach z=1.1 on its axis")
+	}
+	if !ts.Intersects(touching) {
+		t.Error("Intersects rejected an AABB overlapping the rotated box")
+	}
+}
+
+// TestTransformedShape_GetColorAt checks that colors are looked up in the
+// wrapped shape's own space, through transforms and instancing.
+func TestTransformedShape_GetColorAt(t *testing.T) {
+	base := splitSphere{Sphere3D{Radius: 1}}
+	red, blue := color.RGBA{R: 255, A: 255}, color.RGBA{B: 255, A: 255}
+	// Turned half a turn about Y, the red half faces +X.
+	turned := math.Translate4(math.Point3D{X: 10}).Mul(math.Rotate4(math.Point3D{Y: 1}, 180))
+	ts, _ := NewTransformedShape(base, turned)
+	if got := ts.GetColorAt(math.Point3D{X: 10.9}, 0); got != red {
+		t.Errorf("turned +X side = %v, want red", got)
+	}
+	if got := ts.GetColorAt(math.Point3D{X: 9.1}, 0); got != blue {
+		t.Errorf("turned -X side = %v, want blue", got)
+	}
+
+	is, _ := NewInstancedShape(base, []math.Mat4{math.Translate4(math.Point3D{X: -5}), turned})
+	if got := is.GetColorAt(math.Point3D{X: -4.1}, 0); got != blue {
+		t.Errorf("first instance's +X side = %v, want blue", got)
+	}
+	if got := is.GetColorAt(math.Point3D{X: 10.9}, 0); got != red {
+		t.Errorf("turned instance's +X side = %v, want red", got)
+	}
+}
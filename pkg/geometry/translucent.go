@@ -0,0 +1,53 @@
+package geometry
+
+// Translucent gives a solid shape an opacity below 1, so shadows cast
+// through it are dimmed rather than black. It adds GetOpacity, which makes
+// it a TranslucentShape to the shadow tests, and an IOR and Dispersion for
+// the tracer's refraction; the shape still answers Contains, normals and color
+// itself, so it bakes and shades like the solid it wraps.
+type Translucent struct {
+	Shape
+	Opacity float64
+	// IOR is the index of refraction of the glass; zero means DefaultIOR.
+	IOR float64
+	// Dispersion is the Abbe number of the glass: the lower it is, the
+	// further apart the colors of light passing through spread. Zero
+	// disperses nothing.
+	Dispersion float64
+}
+
+// GetOpacity returns the fraction of light the shape stops.
+func (t Translucent) GetOpacity() float64 { return t.Opacity }
+
+// Inner returns the shape made translucent.
+func (t Translucent) Inner() Shape { return t.Shape }
+
+// OpacityOf returns the fraction of light s stops: its opacity if it is
+// translucent, looking through transforms, instancing and the other
+// decorators, and 1 otherwise.
+func OpacityOf(s Shape) float64 {
+	if v, ok := layerOf[TranslucentShape](s); ok {
+		return v.GetOpacity()
+	}
+	return 1
+}
+
+// DefaultIOR is the index of refraction of translucent shapes without one
+// set, about that of window glass.
+const DefaultIOR = 1.5
+
+// IOROf returns the index of refraction of s if it is translucent, looking
+// through the same wrappers as OpacityOf, and DefaultIOR otherwise.
+func IOROf(s Shape) float64 {
+	if v, ok := layerOf[Translucent](s); ok && v.IOR != 0 {
+		return v.IOR
+	}
+	return DefaultIOR
+}
+
+// DispersionOf returns the Abbe number of s if it is dispersive glass,
+// looking through the same wrappers as OpacityOf, and 0 otherwise.
+func DispersionOf(s Shape) float64 {
+	v, _ := layerOf[Translucent](s)
+	return v.Dispersion
+}
@@ -0,0 +1,62 @@
+package geometry
+
+import (
+	"grinder/pkg/math"
+	"testing"
+)
+
+func TestOpacityOf(t *testing.T) {
+	sphere := Sphere3D{Radius: 1}
+	glass := Translucent{Shape: sphere, Opacity: 0.2}
+	moved, _ := NewTransformedShape(glass, math.Translate4(math.Point3D{X: 2}))
+	instanced, _ := NewInstancedShape(glass, []math.Mat4{math.Translate4(math.Point3D{X: 2})})
+
+	tests := []struct {
+		name  string
+		shape Shape
+		want  float64
+	}{
+		{"solid", sphere, 1},
+		{"translucent", glass, 0.2},
+		{"transformed", moved, 0.2},
+		{"instanced", instanced, 0.2},
+		{"instance", instanced.Instances()[0], 0.2},
+		{"under other decorators", Matte{Shape: Toon{Shape: Anisotropic{Shape: glass}}}, 0.2},
+	}
+	for _, tt := range tests {
+		if got := OpacityOf(tt.shape); got != tt.want {
+			t.Errorf("%s: OpacityOf = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if !glass.Contains(math.Point3D{}, 0) {
+		t.Error("Translucent changed the wrapped shape's geometry")
+	}
+}
+
+func TestDispersionOf(t *testing.T) {
+	prism := Translucent{Shape: Box3D{Max: math.Point3D{X: 1, Y: 1, Z: 1}}, Opacity: 0.1, Dispersion: 30}
+	moved, _ := NewTransformedShape(prism, math.Translate4(math.Point3D{X: 2}))
+	if got := DispersionOf(moved); got != 30 {
+		t.Errorf("DispersionOf(transformed prism) = %v, want 30", got)
+	}
+	if got := DispersionOf(Matte{Shape: prism, Roughness: 0.3}); got != 30 {
+		t.Errorf("DispersionOf(matte prism) = %v, want 30", got)
+	}
+	if got := DispersionOf(Sphere3D{Radius: 1}); got != 0 {
+		t.Errorf("DispersionOf(solid) = %v, want 0", got)
+	}
+}
+
+func TestIOROf(t *testing.T) {
+	water := Translucent{Shape: Sphere3D{Radius: 1}, Opacity: 0.1, IOR: 1.33}
+	moved, _ := NewTransformedShape(water, math.Translate4(math.Point3D{X: 2}))
+	if got := IOROf(Toon{Shape: moved}); got != 1.33 {
+		t.Errorf("IOROf(transformed water) = %v, want 1.33", got)
+	}
+	if got := IOROf(Translucent{Shape: water.Shape, Opacity: 0.1}); got != DefaultIOR {
+		t.Errorf("IOROf(glass without an IOR) = %v, want %v", got, DefaultIOR)
+	}
+	if got := IOROf(water.Shape); got != DefaultIOR {
+		t.Errorf("IOROf(solid) = %v, want %v", got, DefaultIOR)
+	}
+}
@@ -3,12 +3,13 @@ package geometry
 import (
 	"grinder/pkg/math"
 	"image/color"
-	gomath "math"
 )
 
 // VolumeBox represents a volumetric box in 3D space.
 type VolumeBox struct {
 	Min, Max          math.Point3D
+	Velocity          math.Point3D // Displacement over the shutter window
+	Motion            *math.Motion // Keyframed path of Min, which Max follows; overrides Velocity
 	Color             color.RGBA
 	Shininess         float64
 	SpecularIntensity float64
@@ -17,9 +18,12 @@ type VolumeBox struct {
 }
 
 func (b VolumeBox) Contains(p math.Point3D, t float64) bool {
-	return p.X >= b.Min.X && p.X <= b.Max.X &&
-		p.Y >= b.Min.Y && p.Y <= b.Max.Y &&
-		p.Z >= b.Min.Z && p.Z <= b.Max.Z
+	return b.box().Contains(p, t)
+}
+
+// box returns the solid box with the volume's bounds and motion.
+func (b VolumeBox) box() Box3D {
+	return Box3D{Min: b.Min, Max: b.Max, Velocity: b.Velocity, Motion: b.Motion}
 }
 
 func (b VolumeBox) Intersects(aabb math.AABB3D) bool {
@@ -27,29 +31,15 @@ func (b VolumeBox) Intersects(aabb math.AABB3D) bool {
 }
 
 func (b VolumeBox) NormalAtPoint(p math.Point3D, t float64) math.Normal3D {
-	// Find which face the point is closest to
-	eps := 0.0001
-	if gomath.Abs(p.X-b.Min.X) < eps {
-		return math.Normal3D{X: -1, Y: 0, Z: 0}
-	}
-	if gomath.Abs(p.X-b.Max.X) < eps {
-		return math.Normal3D{X: 1, Y: 0, Z: 0}
-	}
-	if gomath.Abs(p.Y-b.Min.Y) < eps {
-		return math.Normal3D{X: 0, Y: -1, Z: 0}
-	}
-	if gomath.Abs(p.Y-b.Max.Y) < eps {
-		return math.Normal3D{X: 0, Y: 1, Z: 0}
-	}
-	if gomath.Abs(p.Z-b.Min.Z) < eps {
-		return math.Normal3D{X: 0, Y: 0, Z: -1}
-	}
-	return math.Normal3D{X: 0, Y: 0, Z: 1}
+	return b.box().NormalAtPoint(p, t)
 }
 
 // GetColor returns the color of the box.
 func (s VolumeBox) GetColor() color.RGBA { return s.Color }
 
+// GetColorAt returns the volume's color, which is the same everywhere.
+func (s VolumeBox) GetColorAt(p math.Point3D, t float64) color.RGBA { return s.Color }
+
 // GetShininess returns the shininess of the box.
 func (s VolumeBox) GetShininess() float64 { return s.Shininess }
 
@@ -59,7 +49,8 @@ func (s VolumeBox) GetSpecularIntensity() float64 { return s.SpecularIntensity }
 // GetSpecularColor returns the specular color of the box.
 func (s VolumeBox) GetSpecularColor() color.RGBA { return s.SpecularColor }
 
-func (b VolumeBox) GetAABB() math.AABB3D { return math.AABB3D{Min: b.Min, Max: b.Max} }
+// GetAABB returns the box's bounds over its whole motion.
+func (b VolumeBox) GetAABB() math.AABB3D { return b.box().GetAABB() }
 
 // GetCenter returns the center of the box.
 func (b VolumeBox) GetCenter() math.Point3D {
@@ -71,3 +62,64 @@ func (b VolumeBox) IsVolumetric() bool { return true }
 
 // GetDensity returns the density of the volume.
 func (b VolumeBox) GetDensity() float64 { return b.Density }
+
+// DensityAt returns the box's uniform density inside it at time t and 0
+// outside.
+func (b VolumeBox) DensityAt(p math.Point3D, t float64) float64 {
+	if !b.Contains(p, t) {
+		return 0
+	}
+	return b.Density
+}
+
+// VolumeOf returns s as a VolumetricShape if it is a volume or wraps one,
+// such as a transformed or instanced fog box, whose density the wrappers
+// would otherwise hide. Renderers find volumes with it.
+func VolumeOf(s Shape) (VolumetricShape, bool) {
+	if v, ok := s.(VolumetricShape); ok {
+		return v, true
+	}
+	if !s.IsVolumetric() {
+		return nil, false
+	}
+	if _, ok := layerOf[VolumetricShape](s); !ok {
+		return nil, false
+	}
+	return wrappedVolume{s}, true
+}
+
+// wrappedVolume is a volume seen through its wrappers: Shape answers in
+// world space as before, and the density queries reach the volume inside.
+type wrappedVolume struct {
+	Shape
+}
+
+// GetDensity returns the nominal density of the volume inside.
+func (w wrappedVolume) GetDensity() float64 {
+	v, _ := layerOf[VolumetricShape](w.Shape)
+	return v.GetDensity()
+}
+
+// DensityAt returns the density of the volume inside at world point p.
+func (w wrappedVolume) DensityAt(p math.Point3D, t float64) float64 {
+	return densityAt(w.Shape, p, t)
+}
+
+// densityAt maps p through s's wrappers into the volume's own space and
+// returns its density there.
+func densityAt(s Shape, p math.Point3D, t float64) float64 {
+	switch v := s.(type) {
+	case VolumetricShape:
+		return v.DensityAt(p, t)
+	case *TransformedShape:
+		return densityAt(v.Shape, v.ToLocal.TransformPoint(p), t)
+	case *InstancedShape:
+		if !v.Contains(p, t) {
+			return 0
+		}
+		return densityAt(v.instanceAt(p, t), p, t)
+	case Wrapper:
+		return densityAt(v.Inner(), p, t)
+	}
+	return 0
+}
@@ -0,0 +1,62 @@
+package geometry
+
+import (
+	"grinder/pkg/math"
+	"testing"
+)
+
+func TestVolumeBox_DensityAt(t *testing.T) {
+	var s Shape = VolumeBox{Min: math.Point3D{X: -1, Y: -1, Z: -1}, Max: math.Point3D{X: 1, Y: 1, Z: 1}, Density: 0.4}
+	vol, ok := s.(VolumetricShape)
+	if !ok {
+		t.Fatal("VolumeBox does not implement VolumetricShape")
+	}
+	if got := vol.DensityAt(math.Point3D{X: 0.5}, 0); got != 0.4 {
+		t.Errorf("DensityAt inside = %v, want 0.4", got)
+	}
+	if got := vol.DensityAt(math.Point3D{X: 2}, 0); got != 0 {
+		t.Errorf("DensityAt outside = %v, want 0", got)
+	}
+	if _, ok := Shape(Box3D{}).(VolumetricShape); ok {
+		t.Error("solid Box3D should not implement VolumetricShape")
+	}
+}
+
+func TestVolumeOf(t *testing.T) {
+	fog := VolumeBox{Min: math.Point3D{X: -1, Y: -1, Z: -1}, Max: math.Point3D{X: 1, Y: 1, Z: 1}, Density: 0.4}
+	moved, _ := NewTransformedShape(fog, math.Translate4(math.Point3D{X: 5}))
+	instanced, _ := NewInstancedShape(fog, []math.Mat4{math.Translate4(math.Point3D{X: 5}), math.Translate4(math.Point3D{X: -5})})
+
+	tests := []struct {
+		name   string
+		shape  Shape
+		inside math.Point3D
+	}{
+		{"transformed", moved, math.Point3D{X: 5}},
+		{"instanced", instanced, math.Point3D{X: 5}},
+		{"second instance", instanced.Instances()[1], math.Point3D{X: -5}},
+	}
+	for _, tt := range tests {
+		vol, ok := VolumeOf(tt.shape)
+		if !ok {
+			t.Errorf("%s: VolumeOf found no volume in %T", tt.name, tt.shape)
+			continue
+		}
+		if got := vol.GetDensity(); got != 0.4 {
+			t.Errorf("%s: GetDensity = %v, want 0.4", tt.name, got)
+		}
+		if got := vol.DensityAt(tt.inside, 0); got != 0.4 {
+			t.Errorf("%s: DensityAt %v = %v, want 0.4", tt.name, tt.inside, got)
+		}
+		if got := vol.DensityAt(math.Point3D{}, 0); got != 0 {
+			t.Errorf("%s: DensityAt the untransformed box's center = %v, want 0", tt.name, got)
+		}
+	}
+	if got, _ := VolumeOf(instanced); got.DensityAt(math.Point3D{X: -5}, 0) != 0.4 {
+		t.Error("instanced: no density in the second instance")
+	}
+	solid, _ := NewTransformedShape(Box3D{Max: math.Point3D{X: 1, Y: 1, Z: 1}}, math.Translate4(math.Point3D{X: 5}))
+	if _, ok := VolumeOf(solid); ok {
+		t.Error("VolumeOf reported a transformed solid box as a volume")
+	}
+}
@@ -0,0 +1,52 @@
+package image
+
+import (
+	"fmt"
+	"grinder/pkg/math"
+	"image"
+	"image/color"
+)
+
+// Diff compares two images of the same size pixel by pixel. A pixel's
+// difference is its largest channel difference, from 0 to 1. Diff returns
+// the mean and largest difference and a heatmap that runs from black
+// through red and yellow to white as the difference grows.
+func Diff(a, b *image.RGBA) (heat *image.RGBA, mean, worst float64, err error) {
+	bounds := a.Bounds()
+	if b.Bounds().Size() != bounds.Size() {
+		return nil, 0, 0, fmt.Errorf("cannot compare a %v image with a %v one", bounds.Size(), b.Bounds().Size())
+	}
+	heat = image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	offset := b.Bounds().Min.Sub(bounds.Min)
+	var sum float64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			i, j := a.PixOffset(x, y), b.PixOffset(x+offset.X, y+offset.Y)
+			d := 0
+			for c := 0; c < 3; c++ {
+				d = max(d, abs(int(a.Pix[i+c])-int(b.Pix[j+c])))
+			}
+			v := float64(d) / 255
+			sum += v
+			worst = max(worst, v)
+			heat.SetRGBA(x-bounds.Min.X, y-bounds.Min.Y, heatColor(v))
+		}
+	}
+	if n := bounds.Dx() * bounds.Dy(); n > 0 {
+		mean = sum / float64(n)
+	}
+	return heat, mean, worst, nil
+}
+
+// heatColor maps v in [0, 1] to black, red, yellow and white in equal steps.
+func heatColor(v float64) color.RGBA {
+	t := 3 * v
+	return math.ClampColor(math.Point3D{X: t, Y: t - 1, Z: t - 2}.Mul(255))
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
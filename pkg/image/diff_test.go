@@ -0,0 +1,43 @@
+package image
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// TestDiff compares an image with a copy that has one pixel changed: only
+// that pixel may light up in the heatmap.
+func TestDiff(t *testing.T) {
+	a := smoothImage(16, 16)
+	b := image.NewRGBA(a.Bounds())
+	copy(b.Pix, a.Pix)
+	b.SetRGBA(3, 5, color.RGBA{R: 255 - a.RGBAAt(3, 5).R, G: a.RGBAAt(3, 5).G, B: a.RGBAAt(3, 5).B, A: 255})
+
+	heat, mean, worst, err := Diff(a, b)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	want := float64(absDiff(a.RGBAAt(3, 5).R, b.RGBAAt(3, 5).R)) / 255
+	if worst != want || mean != want/256 {
+		t.Errorf("mean, max = %v, %v, want %v, %v", mean, worst, want/256, want)
+	}
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			if lit := heat.RGBAAt(x, y) != (color.RGBA{A: 255}); lit != (x == 3 && y == 5) {
+				t.Errorf("heat at (%d, %d) = %v", x, y, heat.RGBAAt(x, y))
+			}
+		}
+	}
+
+	if _, _, _, err := Diff(a, smoothImage(8, 16)); err == nil {
+		t.Error("Diff of differently sized images succeeded, want an error")
+	}
+}
+
+func absDiff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
@@ -0,0 +1,70 @@
+package image
+
+import (
+	"grinder/pkg/math"
+	"image"
+	gomath "math"
+)
+
+// Vignette darkens img toward its corners in place. Pixels are scaled by
+// 1 - strength*r^2, where r is the distance from the center normalized so the
+// corners sit at 1; the center pixel is left untouched.
+func Vignette(img *image.RGBA, strength float64) {
+	b := img.Bounds()
+	cx, cy := float64(b.Min.X+b.Max.X)/2, float64(b.Min.Y+b.Max.Y)/2
+	maxR2 := (cx-float64(b.Min.X))*(cx-float64(b.Min.X)) + (cy-float64(b.Min.Y))*(cy-float64(b.Min.Y))
+	if maxR2 == 0 {
+		return
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		dy := float64(y) + 0.5 - cy
+		for x := b.Min.X; x < b.Max.X; x++ {
+			dx := float64(x) + 0.5 - cx
+			f := gomath.Max(0, 1-strength*(dx*dx+dy*dy)/maxR2)
+			i := img.PixOffset(x, y)
+			for c := 0; c < 3; c++ {
+				img.Pix[i+c] = uint8(math.Clamp(gomath.Round(float64(img.Pix[i+c])*f), 0, 255))
+			}
+		}
+	}
+}
+
+// ChromaticAberration returns a copy of img with the red channel sampled
+// slightly outward and the blue channel slightly inward along the radius from
+// the center, as a cheap lens would. The offset grows linearly to maxShift
+// pixels at the corners, so the middle of the frame is unaffected.
+func ChromaticAberration(img *image.RGBA, maxShift float64) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(b)
+	copy(out.Pix, img.Pix)
+	cx, cy := float64(b.Min.X+b.Max.X)/2, float64(b.Min.Y+b.Max.Y)/2
+	maxR := gomath.Hypot(cx-float64(b.Min.X), cy-float64(b.Min.Y))
+	if maxR == 0 {
+		return out
+	}
+	// sample bilinearly reads channel c of img at a continuous pixel position.
+	sample := func(fx, fy float64, c int) uint8 {
+		fx = gomath.Max(float64(b.Min.X), gomath.Min(float64(b.Max.X-1), fx))
+		fy = gomath.Max(float64(b.Min.Y), gomath.Min(float64(b.Max.Y-1), fy))
+		x0, y0 := int(fx), int(fy)
+		x1, y1 := min(x0+1, b.Max.X-1), min(y0+1, b.Max.Y-1)
+		tx, ty := fx-float64(x0), fy-float64(y0)
+		at := func(x, y int) float64 { return float64(img.Pix[img.PixOffset(x, y)+c]) }
+		top := at(x0, y0)*(1-tx) + at(x1, y0)*tx
+		bot := at(x0, y1)*(1-tx) + at(x1, y1)*tx
+		return uint8(gomath.Round(top*(1-ty) + bot*ty))
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			// Pixel centers, relative to the image center.
+			dx, dy := float64(x)+0.5-cx, float64(y)+0.5-cy
+			// The shift along the radius is maxShift*r/maxR, i.e. a
+			// uniform radial scale of the sample position.
+			k := maxShift / maxR
+			i := out.PixOffset(x, y)
+			out.Pix[i] = sample(cx+dx*(1+k)-0.5, cy+dy*(1+k)-0.5, 0)
+			out.Pix[i+2] = sample(cx+dx*(1-k)-0.5, cy+dy*(1-k)-0.5, 2)
+		}
+	}
+	return out
+}
@@ -0,0 +1,51 @@
+package image
+
+import (
+	"image"
+	"testing"
+)
+
+func solidImage(w, h int, v uint8) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = v
+	}
+	return img
+}
+
+func TestVignette(t *testing.T) {
+	img := solidImage(65, 65, 200)
+	Vignette(img, 0.8)
+	if c := img.RGBAAt(32, 32); c.R != 200 || c.G != 200 || c.B != 200 {
+		t.Errorf("center pixel = %v, want it unaffected", c)
+	}
+	if c := img.RGBAAt(0, 0); c.R >= 100 {
+		t.Errorf("corner pixel = %v, want it darkened", c)
+	}
+	if c := img.RGBAAt(32, 32); c.A != 200 {
+		t.Errorf("alpha = %d, want it unaffected", c.A)
+	}
+}
+
+func TestChromaticAberration(t *testing.T) {
+	// A vertical white line left of center: red is pulled from further out,
+	// so it shifts toward the center; blue moves the other way.
+	img := solidImage(64, 64, 0)
+	for y := 0; y < 64; y++ {
+		i := img.PixOffset(4, y)
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = 255, 255, 255, 255
+	}
+	out := ChromaticAberration(img, 3)
+	row := 32
+	if c := out.RGBAAt(4, row); c.G != 255 {
+		t.Errorf("green channel moved: %v", c)
+	}
+	if c := out.RGBAAt(4, row); c.R == 255 && c.B == 255 {
+		t.Errorf("expected red and blue to separate from the line near the edge, got %v", c)
+	}
+
+	flat := solidImage(64, 64, 90)
+	if out := ChromaticAberration(flat, 3); out.RGBAAt(32, 32) != flat.RGBAAt(32, 32) {
+		t.Errorf("center pixel changed on a flat image: %v", out.RGBAAt(32, 32))
+	}
+}
@@ -0,0 +1,107 @@
+package image
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	gomath "math"
+	"os"
+)
+
+// EncodePPM writes img as a binary 8-bit PPM (P6). Alpha is dropped.
+func EncodePPM(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "P6\n%d %d\n255\n", b.Dx(), b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			bw.Write([]byte{uint8(r >> 8), uint8(g >> 8), uint8(bl >> 8)})
+		}
+	}
+	return bw.Flush()
+}
+
+// EncodePFM writes a width x height float RGB image as a little-endian PFM.
+// rgb holds three values per pixel, rows top to bottom; PFM stores rows
+// bottom to top, so they are flipped on the way out. Values are written
+// unclamped, which keeps HDR highlights for denoisers and diff tools.
+func EncodePFM(w io.Writer, width, height int, rgb []float32) error {
+	if len(rgb) != width*height*3 {
+		return fmt.Errorf("PFM data has %d values, want %d for %dx%d RGB", len(rgb), width*height*3, width, height)
+	}
+	bw := bufio.NewWriter(w)
+	// A negative scale marks the data as little-endian.
+	fmt.Fprintf(bw, "PF\n%d %d\n-1.0\n", width, height)
+	var buf [4]byte
+	for y := height - 1; y >= 0; y-- {
+		for _, v := range rgb[y*width*3 : (y+1)*width*3] {
+			binary.LittleEndian.PutUint32(buf[:], gomath.Float32bits(v))
+			bw.Write(buf[:])
+		}
+	}
+	return bw.Flush()
+}
+
+// DecodePFM reads a color PFM written by EncodePFM or another tool. It
+// returns three values per pixel with rows top to bottom, whatever the byte
+// order in the file.
+func DecodePFM(r io.Reader) (width, height int, rgb []float32, err error) {
+	br := bufio.NewReader(r)
+	var magic string
+	var scale float64
+	if _, err := fmt.Fscan(br, &magic, &width, &height, &scale); err != nil {
+		return 0, 0, nil, fmt.Errorf("invalid PFM header: %w", err)
+	}
+	if magic != "PF" {
+		return 0, 0, nil, fmt.Errorf("unsupported PFM type %q, want PF (color)", magic)
+	}
+	if width <= 0 || height <= 0 {
+		return 0, 0, nil, fmt.Errorf("invalid PFM size %dx%d", width, height)
+	}
+	// A single whitespace byte separates the header from the data.
+	if _, err := br.ReadByte(); err != nil {
+		return 0, 0, nil, fmt.Errorf("invalid PFM header: %w", err)
+	}
+	var order binary.ByteOrder = binary.BigEndian
+	if scale < 0 {
+		order = binary.LittleEndian
+	}
+	row := make([]byte, width*3*4)
+	rgb = make([]float32, width*height*3)
+	for y := height - 1; y >= 0; y-- {
+		if _, err := io.ReadFull(br, row); err != nil {
+			return 0, 0, nil, fmt.Errorf("truncated PFM data: %w", err)
+		}
+		out := rgb[y*width*3 : (y+1)*width*3]
+		for i := range out {
+			out[i] = gomath.Float32frombits(order.Uint32(row[i*4:]))
+		}
+	}
+	return width, height, rgb, nil
+}
+
+// ReadPFM opens path and decodes it with DecodePFM.
+func ReadPFM(path string) (width, height int, rgb []float32, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	return DecodePFM(f)
+}
+
+// WritePFM creates path and writes the float image to it with EncodePFM.
+func WritePFM(path string, width, height int, rgb []float32) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if err := EncodePFM(f, width, height, rgb); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to encode PFM: %w", err)
+	}
+	return f.Close()
+}
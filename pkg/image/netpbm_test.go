@@ -0,0 +1,83 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	gomath "math"
+	"testing"
+)
+
+func TestEncodePFM(t *testing.T) {
+	// 2x2, top row then bottom row; an HDR value in the top-left red channel.
+	rgb := []float32{
+		3.75, 0.5, 0.25, 0, 0, 0,
+		0.125, 1, 2, 0, 0, 0,
+	}
+	var buf bytes.Buffer
+	if err := EncodePFM(&buf, 2, 2, rgb); err != nil {
+		t.Fatal(err)
+	}
+	header := "PF\n2 2\n-1.0\n"
+	data := buf.Bytes()
+	if !bytes.HasPrefix(data, []byte(header)) {
+		t.Fatalf("header = %q, want %q", data[:min(len(data), len(header))], header)
+	}
+	body := data[len(header):]
+	if len(body) != 2*2*3*4 {
+		t.Fatalf("body is %d bytes, want %d", len(body), 2*2*3*4)
+	}
+	at := func(i int) float32 { return gomath.Float32frombits(binary.LittleEndian.Uint32(body[i*4:])) }
+	// Rows are stored bottom to top, so the top-left pixel follows the
+	// bottom row's two pixels.
+	if got := at(6); got != 3.75 {
+		t.Errorf("top-left red = %v, want 3.75", got)
+	}
+	if got := at(0); got != 0.125 {
+		t.Errorf("bottom-left red = %v, want 0.125", got)
+	}
+	if err := EncodePFM(&buf, 3, 2, rgb); err == nil {
+		t.Error("expected an error for mismatched dimensions")
+	}
+}
+
+func TestDecodePFM_RoundTrip(t *testing.T) {
+	rgb := []float32{
+		3.75, 0.5, 0.25, 0, 1, 0,
+		0.125, 1, 2, 9, 8, 7,
+	}
+	var buf bytes.Buffer
+	if err := EncodePFM(&buf, 2, 2, rgb); err != nil {
+		t.Fatal(err)
+	}
+	w, h, got, err := DecodePFM(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w != 2 || h != 2 {
+		t.Fatalf("size = %dx%d, want 2x2", w, h)
+	}
+	for i := range rgb {
+		if got[i] != rgb[i] {
+			t.Fatalf("value %d = %v, want %v", i, got[i], rgb[i])
+		}
+	}
+	if _, _, _, err := DecodePFM(bytes.NewReader([]byte("Pf\n1 1\n-1.0\n\x00\x00\x00\x00"))); err == nil {
+		t.Error("expected an error for a grayscale PFM")
+	}
+}
+
+func TestEncodePPM(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.SetRGBA(0, 0, color.RGBA{R: 1, G: 2, B: 3, A: 255})
+	img.SetRGBA(1, 0, color.RGBA{R: 250, G: 251, B: 252, A: 255})
+	var buf bytes.Buffer
+	if err := EncodePPM(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	want := append([]byte("P6\n2 1\n255\n"), 1, 2, 3, 250, 251, 252)
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("PPM = %q, want %q", buf.Bytes(), want)
+	}
+}
@@ -0,0 +1,148 @@
+// Package image provides resampling helpers for rendered frames.
+package image
+
+import (
+	"fmt"
+	"grinder/pkg/math"
+	"image"
+	gomath "math"
+)
+
+// Filter selects the reconstruction kernel used by Resize.
+type Filter int
+
+const (
+	Box      Filter = iota // Area average; nearest neighbour when upscaling
+	Bilinear               // Tent filter
+	Lanczos                // Windowed sinc with three lobes
+)
+
+// ParseFilter maps a flag value to a Filter.
+func ParseFilter(s string) (Filter, error) {
+	switch s {
+	case "box":
+		return Box, nil
+	case "bilinear":
+		return Bilinear, nil
+	case "lanczos":
+		return Lanczos, nil
+	}
+	return Box, fmt.Errorf("unknown filter %q (want box, bilinear or lanczos)", s)
+}
+
+// support returns the kernel radius in source pixels at scale 1.
+func (f Filter) support() float64 {
+	switch f {
+	case Bilinear:
+		return 1
+	case Lanczos:
+		return 3
+	}
+	return 0.5
+}
+
+func (f Filter) weight(t float64) float64 {
+	t = gomath.Abs(t)
+	switch f {
+	case Bilinear:
+		return gomath.Max(0, 1-t)
+	case Lanczos:
+		if t == 0 {
+			return 1
+		}
+		if t >= 3 {
+			return 0
+		}
+		pt := gomath.Pi * t
+		return 3 * gomath.Sin(pt) * gomath.Sin(pt/3) / (pt * pt)
+	}
+	if t < 0.5 {
+		return 1
+	}
+	return 0
+}
+
+// tap is one source sample contributing to an output pixel.
+type tap struct {
+	index  int
+	weight float64
+}
+
+// taps precomputes the normalized source taps for each of dst output pixels
+// along one axis of length src. When shrinking, the kernel is widened by the
+// scale factor so every source pixel contributes.
+func (f Filter) taps(src, dst int) [][]tap {
+	scale := float64(src) / float64(dst)
+	width := gomath.Max(1, scale)
+	radius := f.support() * width
+	out := make([][]tap, dst)
+	for i := range out {
+		center := (float64(i)+0.5)*scale - 0.5
+		lo, hi := int(gomath.Ceil(center-radius)), int(gomath.Floor(center+radius))
+		var sum float64
+		for j := lo; j <= hi; j++ {
+			w := f.weight((float64(j) - center) / width)
+			if w == 0 {
+				continue
+			}
+			out[i] = append(out[i], tap{index: min(max(j, 0), src-1), weight: w})
+			sum += w
+		}
+		if sum == 0 {
+			// The box kernel can miss every sample when upscaling exactly
+			// between two pixels; fall back to the nearest one.
+			out[i] = []tap{{index: min(max(int(gomath.Round(center)), 0), src-1), weight: 1}}
+			continue
+		}
+		for k := range out[i] {
+			out[i][k].weight /= sum
+		}
+	}
+	return out
+}
+
+// Resize resamples src to w x h with the given filter, as two separable
+// passes. Lanczos can ring past the input range, so results are clamped.
+func Resize(src *image.RGBA, w, h int, filter Filter) *image.RGBA {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	if w <= 0 || h <= 0 || sw == 0 || sh == 0 {
+		return dst
+	}
+
+	// Horizontal pass into a float buffer of sh rows by w columns.
+	xTaps := filter.taps(sw, w)
+	tmp := make([]float64, sh*w*4)
+	for y := 0; y < sh; y++ {
+		row := src.Pix[src.PixOffset(b.Min.X, b.Min.Y+y):]
+		for x, taps := range xTaps {
+			o := (y*w + x) * 4
+			for _, t := range taps {
+				p := row[t.index*4 : t.index*4+4]
+				for c := 0; c < 4; c++ {
+					tmp[o+c] += float64(p[c]) * t.weight
+				}
+			}
+		}
+	}
+
+	// Vertical pass.
+	yTaps := filter.taps(sh, h)
+	for y, taps := range yTaps {
+		for x := 0; x < w; x++ {
+			var acc [4]float64
+			for _, t := range taps {
+				o := (t.index*w + x) * 4
+				for c := 0; c < 4; c++ {
+					acc[c] += tmp[o+c] * t.weight
+				}
+			}
+			d := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[d+c] = uint8(math.Clamp(gomath.Round(acc[c]), 0, 255))
+			}
+		}
+	}
+	return dst
+}
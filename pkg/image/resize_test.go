@@ -0,0 +1,75 @@
+package image
+
+import (
+	"image"
+	"image/color"
+	gomath "math"
+	"testing"
+)
+
+// smoothImage is a band-limited test pattern: resampling it up and back down
+// should lose very little.
+func smoothImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			fx, fy := float64(x)/float64(w), float64(y)/float64(h)
+			img.SetRGBA(x, y, color.RGBA{
+				R: uint8(255 * fx),
+				G: uint8(255 * fy),
+				B: uint8(127 + 100*gomath.Sin(2*gomath.Pi*fx)*gomath.Cos(2*gomath.Pi*fy)),
+				A: 255,
+			})
+		}
+	}
+	return img
+}
+
+func maxDiff(a, b *image.RGBA) int {
+	worst := 0
+	for i := range a.Pix {
+		d := int(a.Pix[i]) - int(b.Pix[i])
+		if d < 0 {
+			d = -d
+		}
+		worst = max(worst, d)
+	}
+	return worst
+}
+
+func TestResize_RoundTrip(t *testing.T) {
+	src := smoothImage(64, 48)
+	tests := []struct {
+		filter    Filter
+		tolerance int
+	}{
+		{Box, 0},
+		{Bilinear, 3},
+		{Lanczos, 3},
+	}
+	for _, tt := range tests {
+		up := Resize(src, 128, 96, tt.filter)
+		if up.Bounds().Dx() != 128 || up.Bounds().Dy() != 96 {
+			t.Fatalf("filter %d: upscale produced %v", tt.filter, up.Bounds())
+		}
+		back := Resize(up, 64, 48, tt.filter)
+		if d := maxDiff(src, back); d > tt.tolerance {
+			t.Errorf("filter %d: round trip differs by up to %d, want <= %d", tt.filter, d, tt.tolerance)
+		}
+	}
+}
+
+func TestResize_Constant(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	for i := range src.Pix {
+		src.Pix[i] = 200
+	}
+	for _, f := range []Filter{Box, Bilinear, Lanczos} {
+		out := Resize(src, 7, 13, f)
+		for i, v := range out.Pix {
+			if v != 200 {
+				t.Fatalf("filter %d: pixel byte %d = %d, want 200", f, i, v)
+			}
+		}
+	}
+}
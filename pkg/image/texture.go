@@ -0,0 +1,68 @@
+package image
+
+import (
+	"fmt"
+	"grinder/pkg/math"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+	gomath "math"
+	"os"
+)
+
+// Texture is an RGB image in [0, 1] per channel for sampling by UV. It
+// repeats in both directions; v = 0 is the top row.
+type Texture struct {
+	Width, Height int
+	Pix           []math.Point3D // rows top to bottom
+	Path          string         // the file it was loaded from, if any
+}
+
+// NewTexture converts img to a texture.
+func NewTexture(img image.Image) *Texture {
+	b := img.Bounds()
+	t := &Texture{Width: b.Dx(), Height: b.Dy(), Pix: make([]math.Point3D, 0, b.Dx()*b.Dy())}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			t.Pix = append(t.Pix, math.Point3D{X: float64(c.R) / 255, Y: float64(c.G) / 255, Z: float64(c.B) / 255})
+		}
+	}
+	return t
+}
+
+// LoadTexture decodes a PNG or JPEG file into a texture.
+func LoadTexture(path string) (*Texture, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	t := NewTexture(img)
+	t.Path = path
+	return t, nil
+}
+
+// At returns texel (x, y), wrapping coordinates outside the image.
+func (t *Texture) At(x, y int) math.Point3D {
+	x = ((x % t.Width) + t.Width) % t.Width
+	y = ((y % t.Height) + t.Height) % t.Height
+	return t.Pix[y*t.Width+x]
+}
+
+// Sample bilinearly filters the texture at (u, v), with texel centers at
+// half-integer positions.
+func (t *Texture) Sample(u, v float64) math.Point3D {
+	x := u*float64(t.Width) - 0.5
+	y := v*float64(t.Height) - 0.5
+	x0, y0 := int(gomath.Floor(x)), int(gomath.Floor(y))
+	fx, fy := x-float64(x0), y-float64(y0)
+	top := t.At(x0, y0).Mul(1 - fx).Add(t.At(x0+1, y0).Mul(fx))
+	bottom := t.At(x0, y0+1).Mul(1 - fx).Add(t.At(x0+1, y0+1).Mul(fx))
+	return top.Mul(1 - fy).Add(bottom.Mul(fy))
+}
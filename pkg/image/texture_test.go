@@ -0,0 +1,31 @@
+package image
+
+import (
+	"grinder/pkg/math"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestTexture_Sample(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.SetRGBA(0, 0, color.RGBA{A: 255})
+	img.SetRGBA(1, 0, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+	tex := NewTexture(img)
+
+	tests := []struct {
+		u    float64
+		want float64
+	}{
+		{0.25, 0},  // center of the black texel
+		{0.75, 1},  // center of the white texel
+		{0.5, 0.5}, // halfway between them
+		{1.25, 0},  // wraps around
+	}
+	for _, tt := range tests {
+		got := tex.Sample(tt.u, 0.5)
+		if got.Sub(math.Point3D{X: tt.want, Y: tt.want, Z: tt.want}).Length() > 1e-9 {
+			t.Errorf("Sample(%v) = %v, want gray %v", tt.u, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package image
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultQuality is the JPEG quality used when none is given.
+const DefaultQuality = 90
+
+// WriteImage encodes img to path in the format named by its extension:
+// .png, .ppm, or .jpg/.jpeg at the given quality (1-100; 0 means
+// DefaultQuality). Float output goes through WritePFM instead.
+// A path of "-" writes a PNG to stdout, so renders can be piped into other
+// tools.
+func WriteImage(path string, img image.Image, quality int) error {
+	if path == "-" {
+		return encode(os.Stdout, ".png", img, quality)
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	if err := checkFormat(ext); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if err := encode(f, ext, img, quality); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// checkFormat rejects extensions WriteImage can't encode before any file is
+// created.
+func checkFormat(ext string) error {
+	switch ext {
+	case ".png", ".jpg", ".jpeg", ".ppm":
+		return nil
+	case ".webp":
+		return fmt.Errorf("WebP output is not supported (the standard library has no WebP encoder); use .png or .jpg")
+	}
+	return fmt.Errorf("unsupported image format %q (want .png, .jpg, .jpeg or .ppm)", ext)
+}
+
+func encode(w io.Writer, ext string, img image.Image, quality int) error {
+	var err error
+	switch ext {
+	case ".jpg", ".jpeg":
+		if quality <= 0 {
+			quality = DefaultQuality
+		}
+		err = jpeg.Encode(w, img, &jpeg.Options{Quality: min(quality, 100)})
+	case ".ppm":
+		err = EncodePPM(w, img)
+	default:
+		err = png.Encode(w, img)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", strings.TrimPrefix(ext, "."), err)
+	}
+	return nil
+}
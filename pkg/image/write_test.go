@@ -0,0 +1,68 @@
+package image
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteImage_RoundTrip(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := range src.Pix {
+		src.Pix[i] = 128
+	}
+	src.SetRGBA(1, 2, color.RGBA{R: 140, G: 120, B: 130, A: 255})
+
+	tests := []struct {
+		name      string
+		tolerance int
+	}{
+		{"out.png", 0},
+		{"out.jpg", 12},
+		{"out.JPEG", 12},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), tt.name)
+		if err := WriteImage(path, src, 95); err != nil {
+			t.Fatalf("%s: WriteImage: %v", tt.name, err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, _, err := image.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: decode: %v", tt.name, err)
+		}
+		if img.Bounds() != src.Bounds() {
+			t.Fatalf("%s: bounds %v, want %v", tt.name, img.Bounds(), src.Bounds())
+		}
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				r, g, b, _ := img.At(x, y).RGBA()
+				want := src.RGBAAt(x, y)
+				for _, d := range []int{int(r>>8) - int(want.R), int(g>>8) - int(want.G), int(b>>8) - int(want.B)} {
+					if d > tt.tolerance || -d > tt.tolerance {
+						t.Fatalf("%s: pixel (%d, %d) = %v, want %v", tt.name, x, y, img.At(x, y), want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestWriteImage_Unsupported(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"out.webp", "out.bmp"} {
+		path := filepath.Join(dir, name)
+		if err := WriteImage(path, image.NewRGBA(image.Rect(0, 0, 1, 1)), 0); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s: file was created for an unsupported format", name)
+		}
+	}
+}
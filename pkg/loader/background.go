@@ -0,0 +1,51 @@
+package loader
+
+import (
+	"fmt"
+	"grinder/pkg/math"
+	"grinder/pkg/shading"
+	"image/color"
+)
+
+// BackgroundConfig colors rays that miss the scene: "solid" uses Color,
+// "gradient" blends from Bottom straight down to Top straight up, and "sky"
+// is a procedural daylight sky lit from Sun.
+type BackgroundConfig struct {
+	Type      string        `json:"type"`
+	Color     *color.RGBA   `json:"color,omitempty"`
+	Top       *color.RGBA   `json:"top,omitempty"`
+	Bottom    *color.RGBA   `json:"bottom,omitempty"`
+	Sun       *math.Point3D `json:"sun,omitempty"`       // sky: direction toward the sun (default high in the south-west)
+	Turbidity float64       `json:"turbidity,omitempty"` // sky: haze, default 3
+}
+
+// build returns the background as an environment.
+func (bc BackgroundConfig) build() (shading.Environment, error) {
+	switch bc.Type {
+	case "solid":
+		if bc.Color == nil {
+			return nil, fmt.Errorf("solid background needs a \"color\"")
+		}
+		return shading.UniformEnvironment{Color: rgbToPoint(*bc.Color)}, nil
+	case "gradient":
+		if bc.Top == nil || bc.Bottom == nil {
+			return nil, fmt.Errorf("gradient background needs \"top\" and \"bottom\"")
+		}
+		return shading.GradientEnvironment{Sky: rgbToPoint(*bc.Top), Ground: rgbToPoint(*bc.Bottom)}, nil
+	case "sky":
+		sun := math.Point3D{X: -0.4, Y: 0.6, Z: -0.7}
+		if bc.Sun != nil {
+			sun = *bc.Sun
+		}
+		if sun.Length() == 0 {
+			return nil, fmt.Errorf("sky background \"sun\" must be non-zero")
+		}
+		turbidity := bc.Turbidity
+		if turbidity == 0 {
+			turbidity = 3
+		}
+		return shading.NewSkyEnvironment(sun, turbidity), nil
+	default:
+		return nil, fmt.Errorf("unknown background type: %q", bc.Type)
+	}
+}
@@ -0,0 +1,22 @@
+package loader
+
+import (
+	"grinder/pkg/geometry"
+	gimage "grinder/pkg/image"
+)
+
+// BumpConfig adds a grayscale height map to a plane or quad.
+type BumpConfig struct {
+	File     string  `json:"file"`            // PNG or JPEG, relative to the scene file
+	Strength float64 `json:"strength"`        // normal tilt per texel step from black to white
+	Scale    float64 `json:"scale,omitempty"` // planes: world units per repeat (default 1)
+}
+
+// build loads the height texture for the scene at scenePath.
+func (bc BumpConfig) build(scenePath string) (*geometry.BumpMap, error) {
+	tex, err := gimage.LoadTexture(resolvePath(scenePath, bc.File))
+	if err != nil {
+		return nil, err
+	}
+	return &geometry.BumpMap{Height: tex, Strength: bc.Strength, Scale: bc.Scale}, nil
+}
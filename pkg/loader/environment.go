@@ -0,0 +1,69 @@
+package loader
+
+import (
+	"fmt"
+	gimage "grinder/pkg/image"
+	"grinder/pkg/math"
+	"grinder/pkg/shading"
+	"image/color"
+	"path/filepath"
+	"strings"
+)
+
+// EnvironmentConfig lights the scene from every direction. Either File names
+// a latitude-longitude image (.pfm for HDR, or .png/.jpg), or Sky and Ground
+// give a vertical gradient.
+type EnvironmentConfig struct {
+	File      string      `json:"file,omitempty"` // relative to the scene file
+	Sky       *color.RGBA `json:"sky,omitempty"`
+	Ground    *color.RGBA `json:"ground,omitempty"`
+	Intensity *float64    `json:"intensity,omitempty"` // default 1
+}
+
+// build loads or constructs the environment for the scene at scenePath.
+func (ec EnvironmentConfig) build(scenePath string) (shading.Environment, error) {
+	intensity := 1.0
+	if ec.Intensity != nil {
+		intensity = *ec.Intensity
+	}
+	if ec.File == "" {
+		if ec.Sky == nil || ec.Ground == nil {
+			return nil, fmt.Errorf("needs a \"file\", or both \"sky\" and \"ground\"")
+		}
+		return shading.GradientEnvironment{
+			Sky:    rgbToPoint(*ec.Sky).Mul(intensity),
+			Ground: rgbToPoint(*ec.Ground).Mul(intensity),
+		}, nil
+	}
+
+	path := resolvePath(scenePath, ec.File)
+	if strings.EqualFold(filepath.Ext(path), ".pfm") {
+		w, h, rgb, err := gimage.ReadPFM(path)
+		if err != nil {
+			return nil, err
+		}
+		pixels := make([]math.Point3D, w*h)
+		for i := range pixels {
+			pixels[i] = math.Point3D{X: float64(rgb[3*i]), Y: float64(rgb[3*i+1]), Z: float64(rgb[3*i+2])}
+		}
+		return shading.NewEnvironmentMap(w, h, pixels, intensity), nil
+	}
+	tex, err := gimage.LoadTexture(path)
+	if err != nil {
+		return nil, err
+	}
+	return shading.NewEnvironmentMap(tex.Width, tex.Height, tex.Pix, intensity), nil
+}
+
+// resolvePath makes a file named in a scene relative to the scene file.
+func resolvePath(scenePath, file string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(filepath.Dir(scenePath), file)
+}
+
+// rgbToPoint maps an 8-bit color to [0, 1] per channel.
+func rgbToPoint(c color.RGBA) math.Point3D {
+	return math.Point3D{X: float64(c.R) / 255, Y: float64(c.G) / 255, Z: float64(c.B) / 255}
+}
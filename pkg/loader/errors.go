@@ -0,0 +1,63 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// ErrUnknownShape reports a shape whose type the loader doesn't know.
+type ErrUnknownShape struct {
+	Shape int    // index in the scene's shapes
+	Type  string // as the scene gives it
+}
+
+func (e *ErrUnknownShape) Error() string {
+	return fmt.Sprintf("shape %d: unknown shape type: %s", e.Shape, e.Type)
+}
+
+// ErrInvalidField reports a shape field whose value the shape can't be
+// built from. It wraps ErrInvalidShape.
+type ErrInvalidField struct {
+	Shape  int    // index in the scene's shapes
+	Type   string // the shape's type
+	Field  string // JSON name, dotted below the shape, e.g. "radius" or "transform.scale"
+	Reason string // what is wrong with it, e.g. "must be > 0, got 0"
+}
+
+func (e *ErrInvalidField) Error() string {
+	return fmt.Sprintf("shape %d (%s): %v: field %q %s", e.Shape, e.Type, ErrInvalidShape, e.Field, e.Reason)
+}
+
+func (e *ErrInvalidField) Unwrap() error { return ErrInvalidShape }
+
+// ErrFileNotFound reports a file the scene needs that doesn't exist: the
+// scene file itself, one it includes, or one a field names. It wraps the
+// error from opening it, so it matches fs.ErrNotExist too.
+type ErrFileNotFound struct {
+	Path  string // as opened, resolved against the scene file
+	Shape int    // index in the scene's shapes of the shape naming it, or -1
+	Field string // the field naming it, e.g. "bump" or "environment"; empty for scene files
+	Err   error
+}
+
+func (e *ErrFileNotFound) Error() string {
+	switch {
+	case e.Shape >= 0:
+		return fmt.Sprintf("shape %d: %s: %v", e.Shape, e.Field, e.Err)
+	case e.Field != "":
+		return fmt.Sprintf("%s: %v", e.Field, e.Err)
+	}
+	return fmt.Sprintf("failed to read scene file: %v", e.Err)
+}
+
+func (e *ErrFileNotFound) Unwrap() error { return e.Err }
+
+// notFound returns err as an ErrFileNotFound for path if opening path found
+// nothing there, or nil for any other error.
+func notFound(err error, path string, shape int, field string) error {
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return &ErrFileNotFound{Path: path, Shape: shape, Field: field, Err: err}
+}
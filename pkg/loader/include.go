@@ -0,0 +1,94 @@
+package loader
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readSceneDocument reads a scene file (JSON or YAML) into a generic document
+// and resolves its "include" list. Included files are merged first, in order,
+// then the file itself on top, so the including file wins on conflicts while
+// "shapes" arrays concatenate. Paths are relative to the including file.
+func readSceneDocument(file string, visiting map[string]bool) (map[string]any, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scene file: %w", err)
+	}
+	if visiting[abs] {
+		return nil, fmt.Errorf("include cycle detected at %s", file)
+	}
+	visiting[abs] = true
+	defer delete(visiting, abs)
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if nf := notFound(err, file, -1, ""); nf != nil {
+			return nil, nf
+		}
+		return nil, fmt.Errorf("failed to read scene file: %w", err)
+	}
+	if ext := strings.ToLower(filepath.Ext(file)); ext == ".yaml" || ext == ".yml" {
+		if data, err = yamlToJSON(data); err != nil {
+			return nil, fmt.Errorf("failed to parse scene file %s: %w", file, err)
+		}
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse scene file %s: %w", file, err)
+	}
+
+	var includes []string
+	if raw, ok := doc["include"]; ok {
+		list, ok := raw.([]any)
+		if !ok {
+			return nil, fmt.Errorf("failed to parse scene file %s: \"include\" must be a list of paths", file)
+		}
+		for _, item := range list {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("failed to parse scene file %s: \"include\" must be a list of paths", file)
+			}
+			includes = append(includes, s)
+		}
+		delete(doc, "include")
+	}
+
+	merged := make(map[string]any)
+	for _, inc := range includes {
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(file), inc)
+		}
+		sub, err := readSceneDocument(inc, visiting)
+		if err != nil {
+			return nil, err
+		}
+		mergeSceneDocument(merged, sub, true)
+	}
+	mergeSceneDocument(merged, doc, true)
+	return merged, nil
+}
+
+// mergeSceneDocument overlays src onto dst. Nested objects merge key by key;
+// at the top level "shapes" arrays are appended rather than replaced.
+func mergeSceneDocument(dst, src map[string]any, top bool) {
+	for k, v := range src {
+		if top && k == "shapes" {
+			if base, ok := dst[k].([]any); ok {
+				if more, ok := v.([]any); ok {
+					dst[k] = append(base, more...)
+					continue
+				}
+			}
+		}
+		if sub, ok := v.(map[string]any); ok {
+			if base, ok := dst[k].(map[string]any); ok {
+				mergeSceneDocument(base, sub, false)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
@@ -1,82 +1,334 @@
 package loader
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"grinder/pkg/camera"
 	"grinder/pkg/geometry"
+	gimage "grinder/pkg/image"
 	"grinder/pkg/math"
 	"grinder/pkg/shading"
 	"image/color"
-	"os"
+
+	"gopkg.in/yaml.v3"
 )
 
 type CameraConfig struct {
+	Type    string       `json:"type,omitempty"`    // "perspective" (default), "equirectangular" or "fisheye"
+	Mapping string       `json:"mapping,omitempty"` // fisheye only: "equidistant" (default) or "equisolid"
+	Eye     math.Point3D `json:"eye"`
+	Target  math.Point3D `json:"target"`
+	Up      math.Point3D `json:"up"`
+	Fov     float64      `json:"fov"`
+	Aspect  float64      `json:"aspect"`
+	Near    float64      `json:"near,omitempty"`
+	Far     float64      `json:"far,omitempty"`
+	Roll    float64      `json:"roll,omitempty"` // degrees about the view direction
+	// Motion flies a perspective camera through keyframes over the shutter;
+	// the first one replaces eye and target.
+	Motion []CameraKeyframeConfig `json:"motion,omitempty"`
+}
+
+// CameraKeyframeConfig places the camera at a time in the shutter, from 0 at
+// its start to 1 at its end.
+type CameraKeyframeConfig struct {
+	Time   float64      `json:"time"`
 	Eye    math.Point3D `json:"eye"`
 	Target math.Point3D `json:"target"`
-	Up     math.Point3D `json:"up"`
-	Fov    float64      `json:"fov"`
-	Aspect float64      `json:"aspect"`
-	Near   float64      `json:"near,omitempty"`
-	Far    float64      `json:"far,omitempty"`
 }
 
+// motion returns the camera's keyframed path, or nil without keyframes.
+func (cc CameraConfig) motion() (*camera.Motion, error) {
+	if len(cc.Motion) == 0 {
+		return nil, nil
+	}
+	if cc.Type != "" && cc.Type != "perspective" {
+		return nil, fmt.Errorf("camera motion is only supported on perspective cameras, not %s", cc.Type)
+	}
+	if len(cc.Motion) < 2 {
+		return nil, fmt.Errorf("camera motion needs at least 2 keyframes, got %d", len(cc.Motion))
+	}
+	m := &camera.Motion{}
+	for i, k := range cc.Motion {
+		if i > 0 && k.Time <= cc.Motion[i-1].Time {
+			return nil, fmt.Errorf("camera motion keyframe times must increase, got %g after %g", k.Time, cc.Motion[i-1].Time)
+		}
+		m.Eye.Keyframes = append(m.Eye.Keyframes, math.Keyframe{Time: k.Time, Position: k.Eye})
+		m.Target.Keyframes = append(m.Target.Keyframes, math.Keyframe{Time: k.Time, Position: k.Target})
+	}
+	return m, nil
+}
+
+// The lens used for scenes without a camera block.
+const (
+	autoFrameFov    = 45.0
+	autoFrameAspect = 1.0
+)
+
 type SceneConfig struct {
-	Camera     CameraConfig             `json:"camera"`
-	Shutter    float64                  `json:"shutter,omitempty"` // e.g., 0.5 for 180-degree shutter
-	Light      LightConfig              `json:"light"`
-	Atmosphere shading.AtmosphereConfig `json:"atmosphere"`
-	Shapes     []ShapeConfig            `json:"shapes"`
+	Camera      CameraConfig             `json:"camera"`
+	Shutter     float64                  `json:"shutter,omitempty"` // e.g., 0.5 for 180-degree shutter
+	Light       LightConfig              `json:"light"`
+	Atmosphere  shading.AtmosphereConfig `json:"atmosphere"`
+	Shapes      []ShapeConfig            `json:"shapes"`
+	Include     []string                 `json:"include,omitempty"` // files merged underneath this one, relative to it
+	Environment *EnvironmentConfig       `json:"environment,omitempty"`
+	Background  *BackgroundConfig        `json:"background,omitempty"`
 }
 type LightConfig struct {
 	Position  math.Point3D `json:"position"`
 	Intensity float64      `json:"intensity"`
 	Radius    float64      `json:"radius,omitempty"`
 	Samples   int          `json:"samples,omitempty"` // New field
+	Color     *color.RGBA  `json:"color,omitempty"`   // default white
+	// Falloff is "none" (the default) or "inverseSquare"; Attenuation
+	// overrides it with explicit coefficients.
+	Falloff     string               `json:"falloff,omitempty"`
+	Attenuation *shading.Attenuation `json:"attenuation,omitempty"`
 }
 
 type ShapeConfig struct {
-	Type              string        `json:"type"`
-	Center            math.Point3D  `json:"center,omitempty"`
-	Destination       math.Point3D  `json:"destination,omitempty"` // New: where motion ends
-	Radius            float64       `json:"radius,omitempty"`
-	Point             math.Point3D  `json:"point,omitempty"`
-	Normal            math.Normal3D `json:"normal,omitempty"`
-	Min               math.Point3D  `json:"min,omitempty"`
-	Max               math.Point3D  `json:"max,omitempty"`
-	Height            float64       `json:"height,omitempty"`
-	Density           float64       `json:"density,omitempty"`
-	Color             color.RGBA    `json:"color"`
-	Shininess         *float64      `json:"shininess,omitempty"`
-	SpecularIntensity *float64      `json:"specularIntensity,omitempty"`
-	SpecularColor     *color.RGBA   `json:"specularColor,omitempty"`
-	P00               math.Point3D  `json:"p00,omitempty"`
-	P10               math.Point3D  `json:"p10,omitempty"`
-	P11               math.Point3D  `json:"p11,omitempty"`
-	P01               math.Point3D  `json:"p01,omitempty"`
-	Thickness         float64       `json:"thickness,omitempty"`
-	Iterations        int           `json:"iterations"`
+	Type              string            `json:"type"`
+	Center            math.Point3D      `json:"center,omitzero"`
+	Destination       math.Point3D      `json:"destination,omitzero"` // New: where motion ends
+	Motion            []KeyframeConfig  `json:"motion,omitempty"`     // sphere, box, volume_box, cylinder and cone: keyframed path instead of destination
+	MotionBlur        *float64          `json:"motionBlur,omitempty"` // share of the shutter the shape moves through (default 1, 0 renders it sharp)
+	Bump              *BumpConfig       `json:"bump,omitempty"`       // planes and quads only
+	NormalMap         string            `json:"normalMap,omitempty"`  // quads only: tangent-space normal texture, relative to the scene file
+	Radius            float64           `json:"radius,omitempty"`
+	Point             math.Point3D      `json:"point,omitzero"`
+	Normal            math.Normal3D     `json:"normal,omitzero"`
+	Min               math.Point3D      `json:"min,omitzero"`
+	Max               math.Point3D      `json:"max,omitzero"`
+	Height            float64           `json:"height,omitempty"`
+	Density           float64           `json:"density,omitempty"`           // volume_box only: extinction per unit length
+	Opacity           *float64          `json:"opacity,omitempty"`           // solids only: fraction of light stopped, in (0, 1] (default 1)
+	IOR               float64           `json:"ior,omitempty"`               // translucent solids only: index of refraction, >= 1 (default 1.5)
+	Dispersion        float64           `json:"dispersion,omitempty"`        // translucent solids only: Abbe number, lower spreads colors more (0 = none)
+	Metalness         float64           `json:"metalness,omitempty"`         // solids only: fraction of light mirrored in the path tracer, tinted by specularColor, in [0, 1]
+	Emission          *color.RGBA       `json:"emission,omitempty"`          // solids only: color the shape glows with
+	EmissionIntensity *float64          `json:"emissionIntensity,omitempty"` // emissive only: strength of the glow (default 1)
+	Color             color.RGBA        `json:"color"`
+	Texture           *TextureConfig    `json:"texture,omitempty"` // replaces color with a procedural pattern
+	Shininess         *float64          `json:"shininess,omitempty"`
+	SpecularIntensity *float64          `json:"specularIntensity,omitempty"`
+	SpecularColor     *color.RGBA       `json:"specularColor,omitempty"`
+	AnisotropyX       float64           `json:"anisotropyX,omitempty"` // with anisotropyY: GGX roughness along the tangent, in (0, 1], for a brushed highlight
+	AnisotropyY       float64           `json:"anisotropyY,omitempty"` // GGX roughness across the tangent, in (0, 1]
+	Tangent           math.Point3D      `json:"tangent,omitzero"`      // brushing direction (default: the shape's, e.g. a cylinder's axis)
+	Shading           string            `json:"shading,omitempty"`     // "phong" (default), "toon" for cel shading or "oren-nayar" for rough matte diffuse
+	Bands             int               `json:"bands,omitempty"`       // toon only: flat steps of diffuse light (default 3)
+	Outline           *float64          `json:"outline,omitempty"`     // toon only: n·v below which the silhouette is inked, in [0, 1) (default 0.3, 0 = none)
+	Roughness         float64           `json:"roughness,omitempty"`   // oren-nayar only: facet slope deviation in radians, in (0, π/2] (default 0.5)
+	P00               math.Point3D      `json:"p00,omitzero"`
+	P10               math.Point3D      `json:"p10,omitzero"`
+	P11               math.Point3D      `json:"p11,omitzero"`
+	P01               math.Point3D      `json:"p01,omitzero"`
+	Thickness         float64           `json:"thickness,omitempty"`
+	Iterations        int               `json:"iterations,omitempty"`
+	Transform         *TransformConfig  `json:"transform,omitempty"`
+	Instances         []TransformConfig `json:"instances,omitempty"` // one copy of the shape per transform
 }
 
-// Changed return signature: added a float64 before error to hold the shutter value
-func LoadScene(filepath string) (camera.Camera, []geometry.Shape, *shading.Light, shading.AtmosphereConfig, float64, float64, float64, error) {
-	file, err := os.ReadFile(filepath)
+// KeyframeConfig places a moving shape at a time in the shutter, from 0 at
+// its start to 1 at its end. Position is a sphere's center or a box's min
+// corner.
+type KeyframeConfig struct {
+	Time     float64      `json:"time"`
+	Position math.Point3D `json:"position"`
+}
+
+// motion returns the shape's keyframed path, or nil without keyframes.
+func (sc ShapeConfig) motion() *math.Motion {
+	if len(sc.Motion) == 0 {
+		return nil
+	}
+	keys := make([]math.Keyframe, len(sc.Motion))
+	for i, k := range sc.Motion {
+		keys[i] = math.Keyframe{Time: k.Time, Position: k.Position}
+	}
+	return &math.Motion{Keyframes: keys}
+}
+
+// The cel look of toon shapes without bands or outline set.
+const (
+	defaultToonBands   = 3
+	defaultToonOutline = 0.3
+)
+
+// defaultRoughness is the Oren-Nayar roughness of matte shapes without one
+// set, about that of clay.
+const defaultRoughness = 0.5
+
+// toon wraps shape in the cel shading the config asks for.
+func (sc ShapeConfig) toon(shape geometry.Shape) geometry.Toon {
+	t := geometry.Toon{Shape: shape, Bands: sc.Bands, Outline: defaultToonOutline}
+	if t.Bands == 0 {
+		t.Bands = defaultToonBands
+	}
+	if sc.Outline != nil {
+		t.Outline = *sc.Outline
+	}
+	return t
+}
+
+// velocity returns the shape's displacement over the shutter, from start to
+// Destination. A box or volume_box moves by its Min corner, and Max follows
+// it.
+func (sc ShapeConfig) velocity(start math.Point3D) math.Point3D {
+	if sc.Destination == (math.Point3D{}) {
+		return math.Point3D{}
+	}
+	return sc.Destination.Sub(start)
+}
+
+// TransformConfig places a shape authored in local space. It is applied as
+// scale, then rotate, then translate.
+type TransformConfig struct {
+	Translate math.Point3D  `json:"translate,omitzero"`
+	Rotate    []float64     `json:"rotate,omitempty"` // axis x, y, z and angle in degrees
+	Scale     *math.Point3D `json:"scale,omitempty"`
+}
+
+// Matrix returns the local-to-world transform.
+func (tc TransformConfig) Matrix() math.Mat4 {
+	m := math.Translate4(tc.Translate)
+	if len(tc.Rotate) == 4 {
+		m = m.Mul(math.Rotate4(math.Point3D{X: tc.Rotate[0], Y: tc.Rotate[1], Z: tc.Rotate[2]}, tc.Rotate[3]))
+	}
+	if tc.Scale != nil {
+		m = m.Mul(math.Scale4(*tc.Scale))
+	}
+	return m
+}
+
+// Scene is everything a scene file describes.
+type Scene struct {
+	Camera      camera.Camera
+	Shapes      []geometry.Shape
+	Light       *shading.Light
+	Atmosphere  shading.AtmosphereConfig
+	Near, Far   float64
+	Environment shading.Environment // nil without an "environment" block
+	Background  shading.Environment // nil without a "background" block
+}
+
+// Options controls how a scene file is read. The zero value is what the
+// package-level LoadScene, Load and Parse use.
+type Options struct {
+	// Strict rejects fields the scene format doesn't know about.
+	Strict bool
+}
+
+// LoadScene reads a scene file; the shutter travels on the camera.
+func LoadScene(filepath string) (camera.Camera, []geometry.Shape, *shading.Light, shading.AtmosphereConfig, float64, float64, error) {
+	return Options{}.LoadScene(filepath)
+}
+
+// Load reads a scene file like LoadScene, returning it as a Scene so newer
+// settings such as the environment don't widen LoadScene's results.
+func Load(filepath string) (*Scene, error) {
+	return Options{}.Load(filepath)
+}
+
+// Parse builds a scene from a JSON document such as ReadJSON returns. Files
+// the scene names, such as textures and environment maps, are looked up
+// relative to filepath, which need not exist itself.
+func Parse(file []byte, filepath string) (*Scene, error) {
+	return Options{}.Parse(file, filepath)
+}
+
+// LoadScene is the package-level LoadScene read with o.
+func (o Options) LoadScene(filepath string) (camera.Camera, []geometry.Shape, *shading.Light, shading.AtmosphereConfig, float64, float64, error) {
+	s, err := o.Load(filepath)
+	if err != nil {
+		return nil, nil, nil, shading.AtmosphereConfig{}, 0, 0, err
+	}
+	return s.Camera, s.Shapes, s.Light, s.Atmosphere, s.Near, s.Far, nil
+}
+
+// Load is the package-level Load read with o.
+func (o Options) Load(filepath string) (*Scene, error) {
+	file, err := ReadJSON(filepath)
 	if err != nil {
-		return nil, nil, nil, shading.AtmosphereConfig{}, 0, 0, 0, fmt.Errorf("failed to read scene file: %w", err)
+		return nil, err
 	}
+	return o.Parse(file, filepath)
+}
 
+// ReadJSON reads a scene file, YAML or JSON, with its includes merged in and
+// returns it as a single JSON document that Parse accepts.
+func ReadJSON(filepath string) ([]byte, error) {
+	doc, err := readSceneDocument(filepath, make(map[string]bool))
+	if err != nil {
+		return nil, err
+	}
+	file, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse scene file: %w", err)
+	}
+	return file, nil
+}
+
+// Parse is the package-level Parse read with o.
+func (o Options) Parse(file []byte, filepath string) (*Scene, error) {
+	// The top-level keys tell a missing block from a zero one.
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(file, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse scene file: %w", err)
+	}
 	var config SceneConfig
-	if err := json.Unmarshal(file, &config); err != nil {
-		return nil, nil, nil, shading.AtmosphereConfig{}, 0, 0, 0, fmt.Errorf("failed to parse scene file: %w", err)
+	decoder := json.NewDecoder(bytes.NewReader(file))
+	if o.Strict {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("failed to parse scene file: %w", err)
+	}
+	for i, shapeConfig := range config.Shapes {
+		if err := shapeConfig.validate(i); err != nil {
+			return nil, err
+		}
 	}
 
-	cam := camera.NewLookAtCamera(
-		config.Camera.Eye,
-		config.Camera.Target,
-		config.Camera.Up,
-		config.Camera.Fov,
-		config.Camera.Aspect,
-	)
+	camMotion, err := config.Camera.motion()
+	if err != nil {
+		return nil, err
+	}
+	var cam camera.Camera
+	switch config.Camera.Type {
+	case "", "perspective":
+		eye, target := config.Camera.Eye, config.Camera.Target
+		if camMotion != nil {
+			eye, target = camMotion.Eye.At(0), camMotion.Target.At(0)
+		}
+		pc := camera.NewLookAtCamera(eye, target, config.Camera.Up, config.Camera.Fov, config.Camera.Aspect)
+		pc.Roll(config.Camera.Roll)
+		pc.Motion = camMotion
+		cam = pc
+	case "equirectangular":
+		ec := camera.NewEquirectangularCamera(config.Camera.Eye, config.Camera.Target, config.Camera.Up)
+		ec.Roll(config.Camera.Roll)
+		cam = ec
+	case "fisheye":
+		if config.Camera.Fov <= 0 || config.Camera.Fov > 180 {
+			return nil, fmt.Errorf("fisheye camera fov must be in (0, 180], got %g", config.Camera.Fov)
+		}
+		mapping := camera.Equidistant
+		switch config.Camera.Mapping {
+		case "", "equidistant":
+		case "equisolid":
+			mapping = camera.Equisolid
+		default:
+			return nil, fmt.Errorf("unknown fisheye mapping: %s", config.Camera.Mapping)
+		}
+		fc := camera.NewFisheyeCamera(config.Camera.Eye, config.Camera.Target, config.Camera.Up, config.Camera.Fov, config.Camera.Aspect, mapping)
+		fc.Roll(config.Camera.Roll)
+		cam = fc
+	default:
+		return nil, fmt.Errorf("unknown camera type: %s", config.Camera.Type)
+	}
 
 	samples := config.Light.Samples
 	if samples <= 0 {
@@ -89,9 +341,25 @@ func LoadScene(filepath string) (camera.Camera, []geometry.Shape, *shading.Light
 		Radius:    config.Light.Radius,
 		Samples:   samples,
 	}
+	if config.Light.Color != nil {
+		light.Color = rgbToPoint(*config.Light.Color)
+	}
+	switch config.Light.Falloff {
+	case "", "none":
+	case "inverseSquare":
+		light.Attenuation = shading.InverseSquare
+	default:
+		return nil, fmt.Errorf("unknown light falloff: %q", config.Light.Falloff)
+	}
+	if a := config.Light.Attenuation; a != nil {
+		if a.Constant < 0 || a.Linear < 0 || a.Quadratic < 0 {
+			return nil, fmt.Errorf("light attenuation must be >= 0, got %+v", *a)
+		}
+		light.Attenuation = *a
+	}
 
 	var shapes []geometry.Shape
-	for _, shapeConfig := range config.Shapes {
+	for i, shapeConfig := range config.Shapes {
 		// ... (your existing shininess/specular logic remains the same) ...
 		shininess := 32.0
 		if shapeConfig.Shininess != nil {
@@ -106,82 +374,115 @@ func LoadScene(filepath string) (camera.Camera, []geometry.Shape, *shading.Light
 			specularColor = *shapeConfig.SpecularColor
 		}
 
+		var bump *geometry.BumpMap
+		if shapeConfig.Bump != nil {
+			if bump, err = shapeConfig.Bump.build(filepath); err != nil {
+				if nf := notFound(err, resolvePath(filepath, shapeConfig.Bump.File), i, "bump"); nf != nil {
+					return nil, nf
+				}
+				return nil, fmt.Errorf("shape %d (%s): bump: %w", i, shapeConfig.Type, err)
+			}
+		}
+
+		var normalMap *gimage.Texture
+		if shapeConfig.NormalMap != "" {
+			path := resolvePath(filepath, shapeConfig.NormalMap)
+			if normalMap, err = gimage.LoadTexture(path); err != nil {
+				if nf := notFound(err, path, i, "normalMap"); nf != nil {
+					return nil, nf
+				}
+				return nil, fmt.Errorf("shape %d (%s): normalMap: %w", i, shapeConfig.Type, err)
+			}
+		}
+
+		var shape geometry.Shape
 		switch shapeConfig.Type {
 		case "sphere":
-			velocity := math.Point3D{X: 0, Y: 0, Z: 0}
-			if shapeConfig.Destination != (math.Point3D{}) {
-				velocity = shapeConfig.Destination.Sub(shapeConfig.Center)
+			center, motion := shapeConfig.Center, shapeConfig.motion()
+			if motion != nil {
+				center = motion.At(0)
 			}
-			shapes = append(shapes, geometry.Sphere3D{
-				Center:            shapeConfig.Center,
-				Velocity:          velocity,
+			shape = geometry.Sphere3D{
+				Center:            center,
+				Velocity:          shapeConfig.velocity(shapeConfig.Center),
+				Motion:            motion,
 				Radius:            shapeConfig.Radius,
 				Color:             shapeConfig.Color,
 				Shininess:         shininess,
 				SpecularIntensity: specularIntensity,
 				SpecularColor:     specularColor,
-			})
+			}
 		case "box":
-			velocity := math.Point3D{X: 0, Y: 0, Z: 0}
-			if shapeConfig.Destination != (math.Point3D{}) {
-				// For a box, Destination applies to both Min and Max proportionally.
-				// We'll calculate velocity based on Min for simplicity, assuming Max moves with Min.
-				velocity = shapeConfig.Destination.Sub(shapeConfig.Min)
+			shape = geometry.Box3D{
+				Min:               shapeConfig.Min,
+				Max:               shapeConfig.Max,
+				Velocity:          shapeConfig.velocity(shapeConfig.Min),
+				Motion:            shapeConfig.motion(),
+				Color:             shapeConfig.Color,
+				Shininess:         shininess,
+				SpecularIntensity: specularIntensity,
+				SpecularColor:     specularColor,
 			}
-			shapes = append(shapes, geometry.Box3D{
+		case "volume_box":
+			shape = geometry.VolumeBox{
 				Min:               shapeConfig.Min,
 				Max:               shapeConfig.Max,
-				Velocity:          velocity,
+				Velocity:          shapeConfig.velocity(shapeConfig.Min),
+				Motion:            shapeConfig.motion(),
 				Color:             shapeConfig.Color,
 				Shininess:         shininess,
 				SpecularIntensity: specularIntensity,
 				SpecularColor:     specularColor,
-			})
+				Density:           shapeConfig.Density,
+			}
 		case "cylinder":
-			velocity := math.Point3D{X: 0, Y: 0, Z: 0}
-			if shapeConfig.Destination != (math.Point3D{}) {
-				velocity = shapeConfig.Destination.Sub(shapeConfig.Center)
+			center, motion := shapeConfig.Center, shapeConfig.motion()
+			if motion != nil {
+				center = motion.At(0)
 			}
-			shapes = append(shapes, geometry.Cylinder3D{
-				Center:            shapeConfig.Center,
-				Velocity:          velocity,
+			shape = geometry.Cylinder3D{
+				Center:            center,
+				Velocity:          shapeConfig.velocity(shapeConfig.Center),
+				Motion:            motion,
 				Radius:            shapeConfig.Radius,
 				Height:            shapeConfig.Height,
 				Color:             shapeConfig.Color,
 				Shininess:         shininess,
 				SpecularIntensity: specularIntensity,
 				SpecularColor:     specularColor,
-			})
+			}
 		case "cone":
-			velocity := math.Point3D{X: 0, Y: 0, Z: 0}
-			if shapeConfig.Destination != (math.Point3D{}) {
-				velocity = shapeConfig.Destination.Sub(shapeConfig.Center)
+			center, motion := shapeConfig.Center, shapeConfig.motion()
+			if motion != nil {
+				center = motion.At(0)
 			}
-			shapes = append(shapes, geometry.Cone3D{
-				Center:            shapeConfig.Center,
-				Velocity:          velocity,
+			shape = geometry.Cone3D{
+				Center:            center,
+				Velocity:          shapeConfig.velocity(shapeConfig.Center),
+				Motion:            motion,
 				Radius:            shapeConfig.Radius,
 				Height:            shapeConfig.Height,
 				Color:             shapeConfig.Color,
 				Shininess:         shininess,
 				SpecularIntensity: specularIntensity,
 				SpecularColor:     specularColor,
-			})
+			}
 		case "plane":
-			shapes = append(shapes, geometry.Plane3D{
+			shape = geometry.Plane3D{
 				Point:             shapeConfig.Point,
 				Normal:            shapeConfig.Normal,
 				Color:             shapeConfig.Color,
 				Shininess:         shininess,
 				SpecularIntensity: specularIntensity,
 				SpecularColor:     specularColor,
-			})
+				Bump:              bump,
+			}
 		case "quad":
 			thickness := shapeConfig.Thickness
 			if thickness == 0 {
 				thickness = 0.01 // Default tiny thickness so it's not a zero-volume plane
 			}
-			shapes = append(shapes, &geometry.BilinearQuad{
+			shape = &geometry.BilinearQuad{
 				P00:               shapeConfig.P00,
 				P10:               shapeConfig.P10,
 				P11:               shapeConfig.P11,
@@ -191,7 +492,9 @@ func LoadScene(filepath string) (camera.Camera, []geometry.Shape, *shading.Light
 				Shininess:         shininess,
 				SpecularIntensity: specularIntensity,
 				SpecularColor:     specularColor,
-			})
+				Bump:              bump,
+				NormalMap:         normalMap,
+			}
 		case "sds_box":
 			base := geometry.CreateCubeMesh(shapeConfig.Center, shapeConfig.Radius)
 			// Subdivide
@@ -251,25 +554,134 @@ func LoadScene(filepath string) (camera.Camera, []geometry.Shape, *shading.Light
 				})
 			}
 
-			shapes = append(shapes, &geometry.SDSObject{
+			shape = &geometry.SDSObject{
 				Quads:             meshQuads,
 				AABB:              totalAABB,
 				Color:             shapeConfig.Color,
 				Shininess:         shininess,
 				SpecularIntensity: specularIntensity,
 				SpecularColor:     specularColor,
-			})
+			}
 
 		default:
-			return nil, nil, nil, shading.AtmosphereConfig{}, 0, 0, 0, fmt.Errorf("unknown shape type: %s", shapeConfig.Type)
+			return nil, &ErrUnknownShape{Shape: i, Type: shapeConfig.Type}
+		}
+		if shapeConfig.MotionBlur != nil {
+			shape = geometry.MotionBlurred{Shape: shape, Scale: *shapeConfig.MotionBlur}
+		}
+		if shapeConfig.Texture != nil {
+			if shape.IsVolumetric() {
+				return nil, shapeConfig.invalid(i, "texture", "is only supported on solids; volumes have no surface to texture")
+			}
+			tex, err := shapeConfig.Texture.build()
+			if err != nil {
+				return nil, shapeConfig.invalid(i, "texture", "%v", err)
+			}
+			shape = geometry.Textured{Shape: shape, Texture: tex}
+		}
+		if shapeConfig.AnisotropyX != 0 || shapeConfig.AnisotropyY != 0 {
+			shape = geometry.Anisotropic{Shape: shape, AnisotropyX: shapeConfig.AnisotropyX, AnisotropyY: shapeConfig.AnisotropyY, Tangent: shapeConfig.Tangent}
+		}
+		switch shapeConfig.Shading {
+		case "toon":
+			shape = shapeConfig.toon(shape)
+		case "oren-nayar":
+			roughness := shapeConfig.Roughness
+			if roughness == 0 {
+				roughness = defaultRoughness
+			}
+			shape = geometry.Matte{Shape: shape, Roughness: roughness}
+		}
+		if shapeConfig.Metalness != 0 {
+			shape = geometry.Metal{Shape: shape, Metalness: shapeConfig.Metalness}
+		}
+		if shapeConfig.Emission != nil {
+			intensity := 1.0
+			if shapeConfig.EmissionIntensity != nil {
+				intensity = *shapeConfig.EmissionIntensity
+			}
+			shape = geometry.Emissive{Shape: shape, Color: *shapeConfig.Emission, Intensity: intensity}
+		}
+		if shapeConfig.Opacity != nil {
+			opacity := *shapeConfig.Opacity
+			if opacity <= 0 || opacity > 1 {
+				return nil, shapeConfig.invalid(i, "opacity", "must be in (0, 1], got %v", opacity)
+			}
+			if opacity < 1 {
+				shape = geometry.Translucent{Shape: shape, Opacity: opacity, IOR: shapeConfig.IOR, Dispersion: shapeConfig.Dispersion}
+			}
+		}
+		if shapeConfig.Transform != nil {
+			transformed, ok := geometry.NewTransformedShape(shape, shapeConfig.Transform.Matrix())
+			if !ok {
+				return nil, shapeConfig.invalid(i, "transform", "is singular")
+			}
+			shape = transformed
+		}
+		if len(shapeConfig.Instances) > 0 {
+			transforms := make([]math.Mat4, len(shapeConfig.Instances))
+			for j, tc := range shapeConfig.Instances {
+				transforms[j] = tc.Matrix()
+			}
+			instanced, ok := geometry.NewInstancedShape(shape, transforms)
+			if !ok {
+				return nil, shapeConfig.invalid(i, "instances", "has a singular transform")
+			}
+			shape = instanced
 		}
+		shapes = append(shapes, shape)
+	}
+
+	if _, ok := doc["camera"]; !ok {
+		// No camera block: frame everything with the default lens.
+		cam = camera.AutoFrame(shapes, autoFrameAspect, autoFrameFov)
 	}
 
 	shutter := config.Shutter
 	if shutter == 0 {
 		shutter = 1.0
 	}
+	cam = camera.WithShutter(cam, shutter)
+
+	if err := config.Atmosphere.Validate(); err != nil {
+		return nil, fmt.Errorf("atmosphere: %w", err)
+	}
 
-	// Returning 8 values now: cam, shapes, light, atmosphere, near, far, SHUTTER, err
-	return cam, shapes, light, config.Atmosphere, config.Camera.Near, config.Camera.Far, shutter, nil
+	var env shading.Environment
+	if config.Environment != nil {
+		if env, err = config.Environment.build(filepath); err != nil {
+			if nf := notFound(err, resolvePath(filepath, config.Environment.File), -1, "environment"); nf != nil {
+				return nil, nf
+			}
+			return nil, fmt.Errorf("environment: %w", err)
+		}
+	}
+
+	var background shading.Environment
+	if config.Background != nil {
+		if background, err = config.Background.build(); err != nil {
+			return nil, fmt.Errorf("background: %w", err)
+		}
+	}
+
+	return &Scene{
+		Camera:      cam,
+		Shapes:      shapes,
+		Light:       light,
+		Atmosphere:  config.Atmosphere,
+		Near:        config.Camera.Near,
+		Far:         config.Camera.Far,
+		Environment: env,
+		Background:  background,
+	}, nil
+}
+
+// yamlToJSON converts a YAML scene into JSON so it decodes through the same
+// SceneConfig struct tags (and strict mode) as a JSON scene.
+func yamlToJSON(data []byte) ([]byte, error) {
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
 }
@@ -0,0 +1,628 @@
+package loader
+
+import (
+	"errors"
+	"grinder/pkg/camera"
+	"grinder/pkg/geometry"
+	"grinder/pkg/math"
+	"grinder/pkg/shading"
+	"io/fs"
+	gomath "math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// strict reads scene files rejecting unknown fields, as -strict does.
+var strict = Options{Strict: true}
+
+// writeScene writes a scene with the given shapes JSON and returns its path.
+func writeScene(t *testing.T, shapes string) string {
+	t.Helper()
+	scene := `{
+  "camera": {"eye": {"x": 0, "y": 0, "z": 5}, "target": {"x": 0, "y": 0, "z": 0}, "up": {"x": 0, "y": 1, "z": 0}, "fov": 45, "aspect": 1},
+  "light": {"position": {"x": 5, "y": 5, "z": 5}, "intensity": 1},
+  "shapes": [` + shapes + `]
+}`
+	path := filepath.Join(t.TempDir(), "scene.json")
+	if err := os.WriteFile(path, []byte(scene), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadScene_InvalidShapes(t *testing.T) {
+	tests := []struct {
+		name  string
+		shape string
+		field string
+	}{
+		{"sphere zero radius", `{"type": "sphere", "radius": 0}`, "radius"},
+		{"sphere negative radius", `{"type": "sphere", "radius": -1}`, "radius"},
+		{"box inverted", `{"type": "box", "min": {"x": 1, "y": 0, "z": 0}, "max": {"x": 0, "y": 1, "z": 1}}`, "max"},
+		{"cylinder zero height", `{"type": "cylinder", "radius": 1, "height": 0}`, "height"},
+		{"cylinder zero radius", `{"type": "cylinder", "radius": 0, "height": 1}`, "radius"},
+		{"cone zero height", `{"type": "cone", "radius": 1, "height": 0}`, "height"},
+		{"plane zero normal", `{"type": "plane", "point": {"x": 0, "y": 0, "z": 0}}`, "normal"},
+		{"quad degenerate", `{"type": "quad", "p00": {"x": 0, "y": 0, "z": 0}, "p10": {"x": 1, "y": 0, "z": 0}, "p11": {"x": 2, "y": 0, "z": 0}, "p01": {"x": 3, "y": 0, "z": 0}}`, "p00"},
+		{"transform zero scale", `{"type": "sphere", "radius": 1, "transform": {"scale": {"x": 1, "y": 0, "z": 1}}}`, "transform.scale"},
+		{"transform short rotate", `{"type": "sphere", "radius": 1, "transform": {"rotate": [0, 1, 0]}}`, "transform.rotate"},
+		{"sds_box zero radius", `{"type": "sds_box", "radius": 0, "iterations": 1}`, "radius"},
+		{"bump on a sphere", `{"type": "sphere", "radius": 1, "bump": {"file": "h.png", "strength": 1}}`, "bump"},
+		{"normal map on a box", `{"type": "box", "min": {"x": 0, "y": 0, "z": 0}, "max": {"x": 1, "y": 1, "z": 1}, "normalMap": "n.png"}`, "normalMap"},
+		{"volume_box inverted", `{"type": "volume_box", "min": {"x": 0, "y": 0, "z": 0}, "max": {"x": 1, "y": -1, "z": 1}, "density": 0.5}`, "max"},
+		{"volume_box no density", `{"type": "volume_box", "min": {"x": 0, "y": 0, "z": 0}, "max": {"x": 1, "y": 1, "z": 1}}`, "density"},
+		{"volume_box opacity", `{"type": "volume_box", "min": {"x": 0, "y": 0, "z": 0}, "max": {"x": 1, "y": 1, "z": 1}, "density": 0.5, "opacity": 0.5}`, "opacity"},
+		{"motion on a plane", `{"type": "plane", "point": {"x": 0, "y": 0, "z": 0}, "normal": {"x": 0, "y": 1, "z": 0}, "motion": [{"time": 0}, {"time": 1}]}`, "motion"},
+		{"motion and destination", `{"type": "sphere", "radius": 1, "destination": {"x": 1, "y": 0, "z": 0}, "motion": [{"time": 0}, {"time": 1}]}`, "motion"},
+		{"motion single keyframe", `{"type": "sphere", "radius": 1, "motion": [{"time": 0}]}`, "motion"},
+		{"motion out of order", `{"type": "sphere", "radius": 1, "motion": [{"time": 0.5}, {"time": 0.5}]}`, "motion"},
+		{"anisotropy without its pair", `{"type": "cylinder", "radius": 1, "height": 1, "anisotropyX": 0.3}`, "anisotropyY"},
+		{"anisotropy above 1", `{"type": "cylinder", "radius": 1, "height": 1, "anisotropyX": 1.5, "anisotropyY": 0.1}`, "anisotropyX"},
+		{"tangent without anisotropy", `{"type": "cylinder", "radius": 1, "height": 1, "tangent": {"x": 1, "y": 0, "z": 0}}`, "tangent"},
+		{"unknown shading", `{"type": "sphere", "radius": 1, "shading": "gouraud"}`, "shading"},
+		{"bands without toon", `{"type": "sphere", "radius": 1, "bands": 4}`, "shading"},
+		{"roughness without oren-nayar", `{"type": "sphere", "radius": 1, "roughness": 0.3}`, "shading"},
+		{"roughness past vertical", `{"type": "sphere", "radius": 1, "shading": "oren-nayar", "roughness": 2}`, "roughness"},
+		{"toon outline of 1", `{"type": "sphere", "radius": 1, "shading": "toon", "outline": 1}`, "outline"},
+		{"dispersion on a solid", `{"type": "sphere", "radius": 1, "dispersion": 40}`, "dispersion"},
+		{"negative dispersion", `{"type": "sphere", "radius": 1, "opacity": 0.2, "dispersion": -1}`, "dispersion"},
+		{"ior on a solid", `{"type": "sphere", "radius": 1, "ior": 1.3}`, "ior"},
+		{"ior below 1", `{"type": "sphere", "radius": 1, "opacity": 0.2, "ior": 0.5}`, "ior"},
+		{"metalness above 1", `{"type": "sphere", "radius": 1, "metalness": 2}`, "metalness"},
+		{"metal volume", `{"type": "volume_box", "min": {"x": 0, "y": 0, "z": 0}, "max": {"x": 1, "y": 1, "z": 1}, "density": 0.5, "metalness": 1}`, "metalness"},
+		{"emissive volume", `{"type": "volume_box", "min": {"x": 0, "y": 0, "z": 0}, "max": {"x": 1, "y": 1, "z": 1}, "density": 0.5, "emission": {"r": 255, "g": 0, "b": 0, "a": 255}}`, "emission"},
+		{"emission intensity without emission", `{"type": "sphere", "radius": 1, "emissionIntensity": 2}`, "emissionIntensity"},
+		{"negative emission intensity", `{"type": "sphere", "radius": 1, "emission": {"r": 255, "g": 0, "b": 0, "a": 255}, "emissionIntensity": -1}`, "emissionIntensity"},
+		{"negative motion blur", `{"type": "sphere", "radius": 1, "destination": {"x": 1, "y": 0, "z": 0}, "motionBlur": -1}`, "motionBlur"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valid := `{"type": "sphere", "radius": 1}`
+			path := writeScene(t, valid+", "+tt.shape)
+			_, _, _, _, _, _, err := LoadScene(path)
+			if err == nil {
+				t.Fatal("Expected an error, got nil")
+			}
+			if !errors.Is(err, ErrInvalidShape) {
+				t.Errorf("Expected ErrInvalidShape, got %v", err)
+			}
+			if !strings.Contains(err.Error(), "shape 1") || !strings.Contains(err.Error(), `"`+tt.field+`"`) {
+				t.Errorf("Expected error to name shape 1 and field %q, got %v", tt.field, err)
+			}
+			var fe *ErrInvalidField
+			if !errors.As(err, &fe) {
+				t.Fatalf("Expected an ErrInvalidField, got %T", err)
+			}
+			if fe.Shape != 1 || fe.Field != tt.field {
+				t.Errorf("ErrInvalidField names shape %d field %q, want shape 1 field %q", fe.Shape, fe.Field, tt.field)
+			}
+		})
+	}
+}
+
+func TestLoad_ErrorTypes(t *testing.T) {
+	valid := `{"type": "sphere", "radius": 1}`
+	_, err := Load(writeScene(t, valid+", "+valid+`, {"type": "torus", "radius": 1}`))
+	var us *ErrUnknownShape
+	if !errors.As(err, &us) || us.Shape != 2 || us.Type != "torus" {
+		t.Errorf("unknown shape: got %v, want an ErrUnknownShape for shape 2, a torus", err)
+	}
+
+	_, err = Load(writeScene(t, valid+`, {"type": "sphere", "radius": 1, "opacity": 2}`))
+	var fe *ErrInvalidField
+	if !errors.As(err, &fe) || fe.Shape != 1 || fe.Field != "opacity" {
+		t.Errorf("bad opacity: got %v, want an ErrInvalidField for shape 1's opacity", err)
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing.json")
+	_, err = Load(missing)
+	var nf *ErrFileNotFound
+	if !errors.As(err, &nf) || nf.Path != missing || nf.Shape != -1 || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing scene: got %v, want an ErrFileNotFound for %s", err, missing)
+	}
+
+	path := writeScene(t, valid+`, {"type": "plane", "normal": {"x": 0, "y": 1, "z": 0}, "bump": {"file": "nope.png", "strength": 1}}`)
+	_, err = Load(path)
+	if !errors.As(err, &nf) || nf.Shape != 1 || nf.Field != "bump" || nf.Path != filepath.Join(filepath.Dir(path), "nope.png") {
+		t.Errorf("missing bump map: got %v, want an ErrFileNotFound for shape 1's bump", err)
+	}
+	if errors.As(err, &fe) {
+		t.Errorf("missing bump map: a missing file is no invalid field, got %v", err)
+	}
+}
+
+func TestLoadScene_MotionBlur(t *testing.T) {
+	moving := `"center": {"x": 0, "y": 0, "z": 0}, "destination": {"x": 2, "y": 0, "z": 0}, "radius": 1`
+	path := writeScene(t, `{"type": "sphere", `+moving+`}, {"type": "sphere", `+moving+`, "motionBlur": 0.5}, {"type": "sphere", `+moving+`, "motionBlur": 0}`)
+	_, shapes, _, _, _, _, err := strict.LoadScene(path)
+	if err != nil {
+		t.Fatalf("LoadScene: %v", err)
+	}
+	// The blur scales the shutter, not the path: every sphere still moves by 2.
+	for i, want := range []float64{1, 0.5, 0} {
+		s, ok := geometry.Unwrap(shapes[i]).(geometry.Sphere3D)
+		if !ok {
+			t.Fatalf("shape %d is %T, want a geometry.Sphere3D", i, shapes[i])
+		}
+		if s.Velocity.X != 2 {
+			t.Errorf("shape %d velocity.x = %v, want 2", i, s.Velocity.X)
+		}
+		if got := geometry.MotionBlurOf(shapes[i]); got != want {
+			t.Errorf("shape %d motion blur = %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestLoadScene_MotionKeyframes(t *testing.T) {
+	arc := `"motion": [
+		{"time": 0, "position": {"x": 0, "y": 0, "z": 0}},
+		{"time": 0.5, "position": {"x": 1, "y": 1, "z": 0}},
+		{"time": 1, "position": {"x": 2, "y": 0, "z": 0}}]`
+	path := writeScene(t, `{"type": "sphere", "radius": 0.5, `+arc+`},
+		{"type": "box", "min": {"x": 0, "y": 0, "z": 0}, "max": {"x": 1, "y": 2, "z": 1}, `+arc+`, "motionBlur": 0.5},
+		{"type": "cylinder", "radius": 0.5, "height": 2, `+arc+`}`)
+	_, shapes, _, _, _, _, err := strict.LoadScene(path)
+	if err != nil {
+		t.Fatalf("LoadScene: %v", err)
+	}
+	sphere := shapes[0].(geometry.Sphere3D)
+	for _, tt := range []struct{ t, x, y float64 }{{0, 0, 0}, {0.25, 0.5, 0.5}, {0.5, 1, 1}, {1, 2, 0}} {
+		if got, want := sphere.GetCenterAt(tt.t), (math.Point3D{X: tt.x, Y: tt.y}); got != want {
+			t.Errorf("sphere center at %v = %v, want %v", tt.t, got, want)
+		}
+	}
+	if b := sphere.GetAABB(); b.Min != (math.Point3D{X: -0.5, Y: -0.5, Z: -0.5}) || b.Max != (math.Point3D{X: 2.5, Y: 1.5, Z: 0.5}) {
+		t.Errorf("sphere bounds = %v, want the whole arc", b)
+	}
+	// Motion blur leaves the path alone, and the box keeps its size.
+	box := geometry.Unwrap(shapes[1]).(geometry.Box3D).GetBoxAt(0.5)
+	if box.Min != (math.Point3D{X: 1, Y: 1}) || box.Max != (math.Point3D{X: 2, Y: 3, Z: 1}) {
+		t.Errorf("box at 0.5 = %v-%v, want (1,1,0)-(2,3,1)", box.Min, box.Max)
+	}
+	cyl := shapes[2].(geometry.Cylinder3D)
+	if got := cyl.GetCenterAt(0.5); got != (math.Point3D{X: 1, Y: 1}) {
+		t.Errorf("cylinder base at 0.5 = %v, want (1,1,0)", got)
+	}
+	if b := cyl.GetAABB(); b.Min != (math.Point3D{X: -0.5, Z: -0.5}) || b.Max != (math.Point3D{X: 2.5, Y: 3, Z: 0.5}) {
+		t.Errorf("cylinder bounds = %v, want the whole arc", b)
+	}
+}
+
+func TestLoadScene_AutoFrame(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scene.json")
+	scene := `{
+  "light": {"position": {"x": 5, "y": 5, "z": 5}, "intensity": 1},
+  "shapes": [{"type": "sphere", "center": {"x": 20, "y": 0, "z": 0}, "radius": 2}]
+}`
+	if err := os.WriteFile(path, []byte(scene), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cam, _, _, _, _, _, err := strict.LoadScene(path)
+	if err != nil {
+		t.Fatalf("LoadScene: %v", err)
+	}
+	pc, ok := cam.(*camera.PerspectiveCamera)
+	if !ok {
+		t.Fatalf("camera is %T, want *camera.PerspectiveCamera", cam)
+	}
+	if _, _, z := pc.ScreenPoint(math.Point3D{X: 20, Y: 0, Z: 0}); z <= 0 {
+		t.Errorf("auto-framed camera at %v does not face the sphere", pc.GetEye())
+	}
+}
+
+func TestLoad_Environment(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "scene.json")
+	scene := `{
+  "environment": {"sky": {"r": 0, "g": 0, "b": 255}, "ground": {"r": 0, "g": 255, "b": 0}, "intensity": 0.5},
+  "light": {"position": {"x": 5, "y": 5, "z": 5}, "intensity": 1},
+  "shapes": [{"type": "sphere", "radius": 1}]
+}`
+	if err := os.WriteFile(path, []byte(scene), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := strict.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if s.Environment == nil {
+		t.Fatal("Environment is nil")
+	}
+	if up := s.Environment.Radiance(math.Point3D{Y: 1}); up != (math.Point3D{Z: 0.5}) {
+		t.Errorf("sky radiance = %v, want {0 0 0.5}", up)
+	}
+
+	bad := strings.Replace(scene, `"ground": {"r": 0, "g": 255, "b": 0}, `, "", 1)
+	if err := os.WriteFile(path, []byte(bad), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "environment") {
+		t.Errorf("expected an environment error without a ground color, got %v", err)
+	}
+}
+
+func TestLoad_Atmosphere(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scene.json")
+	scene := `{
+  "atmosphere": {"enabled": true, "atmosphere": {"type": "linear", "color": {"x": 1, "y": 1, "z": 1}, "start": 2, "end": 8}},
+  "light": {"position": {"x": 5, "y": 5, "z": 5}, "intensity": 1},
+  "shapes": [{"type": "sphere", "radius": 1}]
+}`
+	if err := os.WriteFile(path, []byte(scene), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := strict.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if a := s.Atmosphere.Atmosphere; a.Type != "linear" || a.Start != 2 || a.End != 8 {
+		t.Errorf("atmosphere = %+v, want linear fog from 2 to 8", a)
+	}
+
+	bad := strings.Replace(scene, `"end": 8`, `"end": 1`, 1)
+	if err := os.WriteFile(path, []byte(bad), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "atmosphere") {
+		t.Errorf("expected an atmosphere error for end < start, got %v", err)
+	}
+}
+
+// TestLoad_Shutter checks that the scene's shutter ends up on the camera,
+// auto-framed or not, and defaults to the whole frame.
+func TestLoad_Shutter(t *testing.T) {
+	cam := `"camera": {"eye": {"x": 0, "y": 0, "z": 5}, "target": {"x": 0, "y": 0, "z": 0}, "up": {"x": 0, "y": 1, "z": 0}, "fov": 45, "aspect": 1},`
+	for _, tt := range []struct {
+		name, head string
+		want       float64
+	}{
+		{"default", cam, 1},
+		{"half", cam + `"shutter": 0.5,`, 0.5},
+		{"auto-framed", `"shutter": 0.25,`, 0.25},
+	} {
+		path := filepath.Join(t.TempDir(), "scene.json")
+		scene := `{` + tt.head + `
+  "light": {"position": {"x": 5, "y": 5, "z": 5}, "intensity": 1},
+  "shapes": [{"type": "sphere", "radius": 1}]
+}`
+		if err := os.WriteFile(path, []byte(scene), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		s, err := strict.Load(path)
+		if err != nil {
+			t.Fatalf("%s: Load: %v", tt.name, err)
+		}
+		if got := s.Camera.GetShutter(); got != tt.want {
+			t.Errorf("%s: camera shutter = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoad_Anisotropy(t *testing.T) {
+	path := writeScene(t, `{"type": "cylinder", "radius": 1, "height": 2, "anisotropyX": 0.4, "anisotropyY": 0.05,
+      "transform": {"rotate": [0, 0, 1, 90]}}`)
+	s, err := strict.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if ax, ay, ok := geometry.AnisotropyOf(s.Shapes[0]); !ok || ax != 0.4 || ay != 0.05 {
+		t.Errorf("anisotropy = %v, %v, %v; want 0.4, 0.05, true", ax, ay, ok)
+	}
+	// The default tangent follows the cylinder's axis, turned onto -x.
+	if got := geometry.TangentAt(s.Shapes[0], math.Point3D{X: -1, Z: 1}, 0); gomath.Abs(got.X+1) > 1e-9 {
+		t.Errorf("tangent = %v, want along the rotated axis (-1, 0, 0)", got)
+	}
+}
+
+func TestLoad_Toon(t *testing.T) {
+	path := writeScene(t, `{"type": "sphere", "radius": 1, "shading": "toon"},
+    {"type": "sphere", "radius": 1, "shading": "toon", "bands": 5, "outline": 0},
+    {"type": "sphere", "radius": 1, "shading": "phong"}`)
+	s, err := strict.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if bands, outline, ok := geometry.ToonOf(s.Shapes[0]); !ok || bands != 3 || outline != 0.3 {
+		t.Errorf("default toon = %v bands, outline %v, %v; want 3, 0.3, true", bands, outline, ok)
+	}
+	if bands, outline, ok := geometry.ToonOf(s.Shapes[1]); !ok || bands != 5 || outline != 0 {
+		t.Errorf("toon = %v bands, outline %v, %v; want 5, 0, true", bands, outline, ok)
+	}
+	if _, _, ok := geometry.ToonOf(s.Shapes[2]); ok {
+		t.Error("a phong sphere loaded toon shaded")
+	}
+}
+
+func TestLoad_OrenNayar(t *testing.T) {
+	path := writeScene(t, `{"type": "sphere", "radius": 1, "shading": "oren-nayar"},
+    {"type": "sphere", "radius": 1, "shading": "oren-nayar", "roughness": 1.2}`)
+	s, err := strict.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	for i, want := range []float64{0.5, 1.2} {
+		if roughness, ok := geometry.RoughnessOf(s.Shapes[i]); !ok || roughness != want {
+			t.Errorf("shape %d roughness = %v, %v; want %v, true", i, roughness, ok, want)
+		}
+	}
+}
+
+func TestLoad_LightFalloff(t *testing.T) {
+	tests := []struct {
+		light string
+		want  shading.Attenuation
+	}{
+		{`"intensity": 1`, shading.Attenuation{}},
+		{`"intensity": 1, "falloff": "inverseSquare"`, shading.InverseSquare},
+		{`"intensity": 1, "attenuation": {"constant": 1, "linear": 0.5}`, shading.Attenuation{Constant: 1, Linear: 0.5}},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "scene.json")
+		scene := `{"light": {"position": {"x": 5, "y": 5, "z": 5}, ` + tt.light + `}, "shapes": [{"type": "sphere", "radius": 1}]}`
+		if err := os.WriteFile(path, []byte(scene), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		s, err := strict.Load(path)
+		if err != nil {
+			t.Fatalf("%s: Load: %v", tt.light, err)
+		}
+		if s.Light.Attenuation != tt.want {
+			t.Errorf("%s: attenuation = %+v, want %+v", tt.light, s.Light.Attenuation, tt.want)
+		}
+	}
+}
+
+func TestLoad_Opacity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scene.json")
+	write := func(opacity string) {
+		scene := `{"light": {"position": {"x": 5, "y": 5, "z": 5}, "intensity": 1}, "shapes": [{"type": "sphere", "radius": 1, "opacity": ` + opacity + `}]}`
+		if err := os.WriteFile(path, []byte(scene), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("0.25")
+	s, err := strict.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := geometry.OpacityOf(s.Shapes[0]); got != 0.25 {
+		t.Errorf("opacity = %v, want 0.25", got)
+	}
+
+	write(`0.25, "dispersion": 35`)
+	if s, err = strict.Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := geometry.DispersionOf(s.Shapes[0]); got != 35 {
+		t.Errorf("dispersion = %v, want 35", got)
+	}
+
+	write(`0.25, "ior": 1.33`)
+	if s, err = strict.Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := geometry.IOROf(s.Shapes[0]); got != 1.33 {
+		t.Errorf("ior = %v, want 1.33", got)
+	}
+
+	write("1")
+	if s, err = strict.Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if _, ok := s.Shapes[0].(geometry.Sphere3D); !ok {
+		t.Errorf("opacity 1 wrapped the shape as %T", s.Shapes[0])
+	}
+
+	for _, bad := range []string{"0", "1.5"} {
+		write(bad)
+		if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "opacity") {
+			t.Errorf("opacity %s: expected an opacity error, got %v", bad, err)
+		}
+	}
+}
+
+func TestLoad_MetalAndEmission(t *testing.T) {
+	s, err := Load(writeScene(t, `{"type": "sphere", "radius": 1, "metalness": 0.8, "emission": {"r": 255, "g": 51, "b": 0, "a": 255}}`))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := geometry.MetalnessOf(s.Shapes[0]); got != 0.8 {
+		t.Errorf("metalness = %v, want 0.8", got)
+	}
+	if got, ok := geometry.EmissionOf(s.Shapes[0]); !ok || got != (math.Point3D{X: 1, Y: 0.2}) {
+		t.Errorf("emission = %v, %v; want {1 0.2 0} at the default intensity", got, ok)
+	}
+}
+
+func TestLoadScene_Strict(t *testing.T) {
+	path := writeScene(t, `{"type": "sphere", "radius": 1, "radiuss": 2}`)
+	if _, _, _, _, _, _, err := LoadScene(path); err != nil {
+		t.Errorf("Expected unknown field to be ignored by default, got %v", err)
+	}
+	if _, _, _, _, _, _, err := strict.LoadScene(path); err == nil || !strings.Contains(err.Error(), "radiuss") {
+		t.Errorf("Expected strict mode to reject unknown field, got %v", err)
+	}
+}
+
+func TestLoadScene_YAMLMatchesJSON(t *testing.T) {
+	camJ, shapesJ, lightJ, atmosJ, nearJ, farJ, err := LoadScene("../../scenes/shapes.json")
+	if err != nil {
+		t.Fatalf("LoadScene(json) failed: %v", err)
+	}
+	camY, shapesY, lightY, atmosY, nearY, farY, err := strict.LoadScene("../../scenes/shapes.yaml")
+	if err != nil {
+		t.Fatalf("LoadScene(yaml) failed: %v", err)
+	}
+	if !reflect.DeepEqual(shapesJ, shapesY) {
+		t.Errorf("Shapes differ:\njson: %+v\nyaml: %+v", shapesJ, shapesY)
+	}
+	if !reflect.DeepEqual(camJ, camY) || *lightJ != *lightY || atmosJ != atmosY {
+		t.Errorf("Camera, light or atmosphere differ between JSON and YAML")
+	}
+	if nearJ != nearY || farJ != farY {
+		t.Errorf("Near/far differ: json (%v, %v), yaml (%v, %v)", nearJ, farJ, nearY, farY)
+	}
+}
+
+func TestLoadScene_IncludeChain(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"rig/base.json": `{
+  "camera": {"eye": {"x": 0, "y": 0, "z": 5}, "target": {"x": 0, "y": 0, "z": 0}, "up": {"x": 0, "y": 1, "z": 0}, "fov": 45, "aspect": 1, "near": 1, "far": 10},
+  "light": {"position": {"x": 5, "y": 5, "z": 5}, "intensity": 1},
+  "shapes": [{"type": "sphere", "center": {"x": 0, "y": 0, "z": 0}, "radius": 1}]
+}`,
+		"rig/lights.json": `{
+  "include": ["base.json"],
+  "light": {"intensity": 2},
+  "shapes": [{"type": "sphere", "center": {"x": 1, "y": 0, "z": 0}, "radius": 0.5}]
+}`,
+		"scene.json": `{
+  "include": ["rig/lights.json"],
+  "camera": {"far": 20},
+  "shapes": [{"type": "sphere", "center": {"x": -1, "y": 0, "z": 0}, "radius": 0.25}]
+}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, shapes, light, _, near, far, err := strict.LoadScene(filepath.Join(dir, "scene.json"))
+	if err != nil {
+		t.Fatalf("LoadScene: %v", err)
+	}
+	if len(shapes) != 3 {
+		t.Errorf("got %d shapes, want 3 (concatenated across includes)", len(shapes))
+	}
+	if light.Intensity != 2 {
+		t.Errorf("light intensity = %v, want 2 from the middle include", light.Intensity)
+	}
+	if light.Position.X != 5 {
+		t.Errorf("light position.x = %v, want 5 from the base include", light.Position.X)
+	}
+	if near != 1 || far != 20 {
+		t.Errorf("near/far = %v/%v, want 1/20", near, far)
+	}
+}
+
+func TestLoadScene_IncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.json")
+	b := filepath.Join(dir, "b.json")
+	if err := os.WriteFile(a, []byte(`{"include": ["b.json"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte(`{"include": ["a.json"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, _, _, _, _, _, err := LoadScene(a)
+	if err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("expected include cycle error, got %v", err)
+	}
+}
+
+func TestLoad_Texture(t *testing.T) {
+	path := writeScene(t, `{"type": "sphere", "radius": 1, "opacity": 0.5,
+		"texture": {"type": "marble", "color1": {"R": 255, "A": 255}, "color2": {"B": 255, "A": 255}, "frequency": 3}}`)
+	s, err := strict.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	tex, ok := s.Shapes[0].(geometry.Translucent).Shape.(geometry.Textured)
+	if !ok {
+		t.Fatalf("shape = %T, want a textured sphere under the opacity", s.Shapes[0])
+	}
+	if pr := tex.Texture.(geometry.Procedural); pr.Frequency != 3 || pr.Turbulence != 1 {
+		t.Errorf("frequency %v and turbulence %v, want 3 and the default 1", pr.Frequency, pr.Turbulence)
+	}
+
+	for _, bad := range []string{
+		`{"type": "sphere", "radius": 1, "texture": {"type": "granite"}}`,
+		`{"type": "sphere", "radius": 1, "texture": {"type": "wood", "frequency": -1}}`,
+		`{"type": "volume_box", "min": {"x": 0, "y": 0, "z": 0}, "max": {"x": 1, "y": 1, "z": 1}, "density": 0.5, "texture": {"type": "wood"}}`,
+	} {
+		if _, err := Load(writeScene(t, bad)); err == nil || !strings.Contains(err.Error(), "textur") {
+			t.Errorf("%s: expected a texture error, got %v", bad, err)
+		}
+	}
+}
+
+func TestLoad_VolumeBox(t *testing.T) {
+	path := writeScene(t, `{"type": "volume_box", "min": {"x": -1, "y": 0, "z": -1}, "max": {"x": 1, "y": 2, "z": 1},
+		"density": 0.3, "color": {"R": 200, "G": 220, "B": 255, "A": 255}, "destination": {"x": 0, "y": 0, "z": -1}}`)
+	s, err := strict.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !s.Shapes[0].IsVolumetric() {
+		t.Fatalf("shape = %T, want a volume", s.Shapes[0])
+	}
+	vol, ok := s.Shapes[0].(geometry.VolumetricShape)
+	if !ok {
+		t.Fatalf("shape = %T, want a geometry.VolumetricShape", s.Shapes[0])
+	}
+	if got := vol.GetDensity(); got != 0.3 {
+		t.Errorf("density = %v, want 0.3", got)
+	}
+	// The box drifts one unit right over the shutter.
+	if got := vol.DensityAt(math.Point3D{X: 1.5, Y: 1}, 0); got != 0 {
+		t.Errorf("density right of the box at the shutter's start = %v, want 0", got)
+	}
+	if got := vol.DensityAt(math.Point3D{X: 1.5, Y: 1}, 1); got != 0.3 {
+		t.Errorf("density right of the box at the shutter's end = %v, want 0.3", got)
+	}
+}
+
+func TestLoad_CameraMotion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scene.json")
+	scene := `{
+  "camera": {"up": {"x": 0, "y": 1, "z": 0}, "fov": 45, "aspect": 1, "motion": [
+    {"time": 0, "eye": {"x": 0, "y": 0, "z": 5}, "target": {"x": 0, "y": 0, "z": 0}},
+    {"time": 1, "eye": {"x": 5, "y": 0, "z": 0}, "target": {"x": 0, "y": 0, "z": 0}}]},
+  "light": {"position": {"x": 5, "y": 5, "z": 5}, "intensity": 1},
+  "shapes": [{"type": "sphere", "radius": 1}]
+}`
+	if err := os.WriteFile(path, []byte(scene), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := strict.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	pc := s.Camera.(*camera.PerspectiveCamera)
+	if got := pc.GetEye(); got != (math.Point3D{Z: 5}) {
+		t.Errorf("eye = %v, want the first keyframe's (0, 0, 5)", got)
+	}
+	if got := pc.AtTime(1).GetEye(); got != (math.Point3D{X: 5}) {
+		t.Errorf("AtTime(1) eye = %v, want the second keyframe's (5, 0, 0)", got)
+	}
+	if f := pc.AtTime(1).(*camera.PerspectiveCamera).GetForward(); gomath.Abs(f.X+1) > 1e-9 {
+		t.Errorf("AtTime(1) forward = %v, want toward the target along -x", f)
+	}
+
+	for _, bad := range []string{
+		`"type": "equirectangular", "motion": [{"time": 0}, {"time": 1}]`,
+		`"motion": [{"time": 0}]`,
+		`"motion": [{"time": 1}, {"time": 0}]`,
+	} {
+		doc := strings.Replace(scene, `"up": {"x": 0, "y": 1, "z": 0}, "fov": 45, "aspect": 1, "motion": [
+    {"time": 0, "eye": {"x": 0, "y": 0, "z": 5}, "target": {"x": 0, "y": 0, "z": 0}},
+    {"time": 1, "eye": {"x": 5, "y": 0, "z": 0}, "target": {"x": 0, "y": 0, "z": 0}}]`, bad, 1)
+		if err := os.WriteFile(path, []byte(doc), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "camera motion") {
+			t.Errorf("%s: expected a camera motion error, got %v", bad, err)
+		}
+	}
+}
@@ -0,0 +1,457 @@
+package loader
+
+import (
+	"encoding/json"
+	"fmt"
+	"grinder/pkg/camera"
+	"grinder/pkg/geometry"
+	"grinder/pkg/math"
+	"grinder/pkg/shading"
+	"image/color"
+	gomath "math"
+	"os"
+	"path/filepath"
+)
+
+// SaveScene writes a scene to a JSON scene file that LoadScene reads back as
+// an equivalent scene; the shutter travels on the camera, as LoadScene
+// returns it.
+func SaveScene(path string, cam camera.Camera, shapes []geometry.Shape, light *shading.Light, atmos shading.AtmosphereConfig, near, far float64) error {
+	return Save(path, &Scene{Camera: cam, Shapes: shapes, Light: light, Atmosphere: atmos, Near: near, Far: far})
+}
+
+// Save writes s to a JSON scene file like SaveScene, with its environment
+// and background. Files the scene uses, such as bump maps, are named
+// relative to path. Anything the scene format can't describe, such as an
+// environment map, whose file the scene doesn't keep, is an error.
+func Save(path string, s *Scene) error {
+	config, err := Unparse(s, path)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode scene: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write scene file: %w", err)
+	}
+	return nil
+}
+
+// Unparse is the inverse of Parse: it returns the config that builds s.
+// Files the scene uses are named relative to filepath.
+func Unparse(s *Scene, filepath string) (SceneConfig, error) {
+	var config SceneConfig
+	cam, shutter, err := cameraConfig(s.Camera)
+	if err != nil {
+		return SceneConfig{}, fmt.Errorf("camera: %w", err)
+	}
+	cam.Near, cam.Far = s.Near, s.Far
+	config.Camera = cam
+	if shutter != 1 {
+		if shutter == 0 {
+			return SceneConfig{}, fmt.Errorf("camera: a closed shutter reads back as an open one")
+		}
+		config.Shutter = shutter
+	}
+	if s.Light != nil {
+		config.Light = lightConfig(*s.Light)
+	}
+	config.Atmosphere = s.Atmosphere
+	for i, shape := range s.Shapes {
+		sc, err := shapeConfig(shape, filepath)
+		if err != nil {
+			return SceneConfig{}, fmt.Errorf("shape %d (%T): %w", i, geometry.Unwrap(shape), err)
+		}
+		config.Shapes = append(config.Shapes, sc)
+	}
+	if config.Environment, err = environmentConfig(s.Environment); err != nil {
+		return SceneConfig{}, fmt.Errorf("environment: %w", err)
+	}
+	if config.Background, err = backgroundConfig(s.Background); err != nil {
+		return SceneConfig{}, fmt.Errorf("background: %w", err)
+	}
+	return config, nil
+}
+
+// cameraConfig returns the config of cam and its shutter. A camera is saved
+// looking along its forward axis from its eye. A perspective camera keeps
+// the up vector and roll it was built with, which it moves with; other
+// cameras, and one built without them, are saved up their rolled up axis.
+func cameraConfig(cam camera.Camera) (CameraConfig, float64, error) {
+	switch c := cam.(type) {
+	case *camera.PerspectiveCamera:
+		cc := CameraConfig{
+			Eye:    c.Position,
+			Target: c.Position.Add(c.Forward),
+			Up:     c.Up,
+			Fov:    c.GetFov(),
+			Aspect: c.Aspect,
+		}
+		if up, roll := c.Orientation(); up != (math.Point3D{}) {
+			cc.Up, cc.Roll = up, roll
+		}
+		if c.Motion != nil {
+			eye, target := c.Motion.Eye.Keyframes, c.Motion.Target.Keyframes
+			if len(eye) != len(target) {
+				return CameraConfig{}, 0, fmt.Errorf("eye and target motion have %d and %d keyframes", len(eye), len(target))
+			}
+			for i := range eye {
+				if eye[i].Time != target[i].Time {
+					return CameraConfig{}, 0, fmt.Errorf("eye and target keyframe %d are at times %g and %g", i, eye[i].Time, target[i].Time)
+				}
+				cc.Motion = append(cc.Motion, CameraKeyframeConfig{Time: eye[i].Time, Eye: eye[i].Position, Target: target[i].Position})
+			}
+		}
+		return cc, c.Shutter, nil
+	case *camera.EquirectangularCamera:
+		return CameraConfig{Type: "equirectangular", Eye: c.Position, Target: c.Position.Add(c.Forward), Up: c.Up}, c.Shutter, nil
+	case *camera.FisheyeCamera:
+		cc := CameraConfig{Type: "fisheye", Eye: c.Position, Target: c.Position.Add(c.Forward), Up: c.Up, Fov: c.Fov, Aspect: c.Aspect}
+		if c.Mapping == camera.Equisolid {
+			cc.Mapping = "equisolid"
+		}
+		return cc, c.Shutter, nil
+	}
+	return CameraConfig{}, 0, fmt.Errorf("unsupported camera %T", cam)
+}
+
+// lightConfig returns the config of l. Its falloff is saved as explicit
+// attenuation coefficients.
+func lightConfig(l shading.Light) LightConfig {
+	lc := LightConfig{Position: l.Position, Intensity: l.Intensity, Radius: l.Radius, Samples: l.Samples}
+	if l.Color != (math.Point3D{}) {
+		c := pointToRGB(l.Color)
+		lc.Color = &c
+	}
+	if l.Attenuation != (shading.Attenuation{}) {
+		a := l.Attenuation
+		lc.Attenuation = &a
+	}
+	return lc
+}
+
+// shapeConfig returns the config of s, peeling its wrappers in the reverse
+// of the order Parse applies them. A transform around instances is folded
+// into each instance; wrappers in any other order have no config.
+func shapeConfig(s geometry.Shape, scenePath string) (ShapeConfig, error) {
+	var sc ShapeConfig
+	outer := math.Identity4()
+	if ts, ok := s.(*geometry.TransformedShape); ok {
+		if _, ok := ts.Shape.(*geometry.InstancedShape); ok {
+			outer, s = ts.ToWorld, ts.Shape
+		}
+	}
+	if is, ok := s.(*geometry.InstancedShape); ok {
+		for _, inst := range is.Instances() {
+			tc, err := transformConfig(outer.Mul(inst.(*geometry.TransformedShape).ToWorld))
+			if err != nil {
+				return ShapeConfig{}, fmt.Errorf("instance: %w", err)
+			}
+			sc.Instances = append(sc.Instances, tc)
+		}
+		s = is.Base
+	}
+	if ts, ok := s.(*geometry.TransformedShape); ok {
+		tc, err := transformConfig(ts.ToWorld)
+		if err != nil {
+			return ShapeConfig{}, fmt.Errorf("transform: %w", err)
+		}
+		sc.Transform = &tc
+		s = ts.Shape
+	}
+	if t, ok := s.(geometry.Translucent); ok {
+		opacity := t.Opacity
+		sc.Opacity, sc.IOR, sc.Dispersion = &opacity, t.IOR, t.Dispersion
+		s = t.Shape
+	}
+	if e, ok := s.(geometry.Emissive); ok {
+		emission, intensity := e.Color, e.Intensity
+		sc.Emission = &emission
+		if intensity != 1 {
+			sc.EmissionIntensity = &intensity
+		}
+		s = e.Shape
+	}
+	if m, ok := s.(geometry.Metal); ok {
+		sc.Metalness = m.Metalness
+		s = m.Shape
+	}
+	switch v := s.(type) {
+	case geometry.Toon:
+		outline := v.Outline
+		sc.Shading, sc.Bands, sc.Outline = "toon", v.Bands, &outline
+		s = v.Shape
+	case geometry.Matte:
+		// Zero roughness is Lambert's diffuse, which is phong's.
+		if v.Roughness != 0 {
+			sc.Shading, sc.Roughness = "oren-nayar", v.Roughness
+		}
+		s = v.Shape
+	}
+	if a, ok := s.(geometry.Anisotropic); ok {
+		sc.AnisotropyX, sc.AnisotropyY, sc.Tangent = a.AnisotropyX, a.AnisotropyY, a.Tangent
+		s = a.Shape
+	}
+	if t, ok := s.(geometry.Textured); ok {
+		pr, ok := t.Texture.(geometry.Procedural)
+		if !ok {
+			return ShapeConfig{}, fmt.Errorf("unsupported texture %T", t.Texture)
+		}
+		turbulence := pr.Turbulence
+		sc.Texture = &TextureConfig{
+			Type:       pr.Kind,
+			Color1:     pr.Color1,
+			Color2:     pr.Color2,
+			Frequency:  pr.Frequency,
+			Turbulence: &turbulence,
+			Seed:       pr.Noise.Seed(),
+		}
+		s = t.Shape
+	}
+	if m, ok := s.(geometry.MotionBlurred); ok {
+		scale := m.Scale
+		sc.MotionBlur = &scale
+		s = m.Shape
+	}
+	if err := sc.setBase(s, scenePath); err != nil {
+		return ShapeConfig{}, err
+	}
+	return sc, nil
+}
+
+// setBase fills in the type, placement, motion and material of the
+// undecorated shape s.
+func (sc *ShapeConfig) setBase(s geometry.Shape, scenePath string) error {
+	var err error
+	switch v := s.(type) {
+	case geometry.Sphere3D:
+		sc.Type, sc.Center, sc.Radius = "sphere", v.Center, v.Radius
+		sc.setMotion(v.Center, v.Velocity, v.Motion)
+		sc.setMaterial(v.Color, v.Shininess, v.SpecularIntensity, v.SpecularColor)
+	case geometry.Box3D:
+		sc.Type, sc.Min, sc.Max = "box", v.Min, v.Max
+		sc.setMotion(v.Min, v.Velocity, v.Motion)
+		sc.setMaterial(v.Color, v.Shininess, v.SpecularIntensity, v.SpecularColor)
+	case geometry.VolumeBox:
+		sc.Type, sc.Min, sc.Max, sc.Density = "volume_box", v.Min, v.Max, v.Density
+		sc.setMotion(v.Min, v.Velocity, v.Motion)
+		sc.setMaterial(v.Color, v.Shininess, v.SpecularIntensity, v.SpecularColor)
+	case geometry.Cylinder3D:
+		sc.Type, sc.Center, sc.Radius, sc.Height = "cylinder", v.Center, v.Radius, v.Height
+		sc.setMotion(v.Center, v.Velocity, v.Motion)
+		sc.setMaterial(v.Color, v.Shininess, v.SpecularIntensity, v.SpecularColor)
+	case geometry.Cone3D:
+		sc.Type, sc.Center, sc.Radius, sc.Height = "cone", v.Center, v.Radius, v.Height
+		sc.setMotion(v.Center, v.Velocity, v.Motion)
+		sc.setMaterial(v.Color, v.Shininess, v.SpecularIntensity, v.SpecularColor)
+	case geometry.Plane3D:
+		sc.Type, sc.Point, sc.Normal = "plane", v.Point, v.Normal
+		if sc.Bump, err = bumpConfig(v.Bump, scenePath); err != nil {
+			return err
+		}
+		sc.setMaterial(v.Color, v.Shininess, v.SpecularIntensity, v.SpecularColor)
+	case *geometry.BilinearQuad:
+		sc.Type, sc.P00, sc.P10, sc.P11, sc.P01, sc.Thickness = "quad", v.P00, v.P10, v.P11, v.P01, v.Thickness
+		if sc.Bump, err = bumpConfig(v.Bump, scenePath); err != nil {
+			return err
+		}
+		if v.NormalMap != nil {
+			if v.NormalMap.Path == "" {
+				return fmt.Errorf("normalMap: not loaded from a file")
+			}
+			sc.NormalMap = relPath(scenePath, v.NormalMap.Path)
+		}
+		sc.setMaterial(v.Color, v.Shininess, v.SpecularIntensity, v.SpecularColor)
+	case *geometry.SDSObject:
+		return sc.setSDS(v)
+	default:
+		return fmt.Errorf("unsupported shape %T", s)
+	}
+	return nil
+}
+
+// setMotion saves a moving shape's motion from start: its keyframes, and
+// its velocity as a destination. A destination at the origin reads back as
+// none, so that velocity is saved as keyframes instead.
+func (sc *ShapeConfig) setMotion(start, velocity math.Point3D, motion *math.Motion) {
+	if motion != nil {
+		for _, k := range motion.Keyframes {
+			sc.Motion = append(sc.Motion, KeyframeConfig{Time: k.Time, Position: k.Position})
+		}
+	}
+	if velocity == (math.Point3D{}) {
+		return
+	}
+	if sc.Destination = start.Add(velocity); sc.Destination == (math.Point3D{}) && motion == nil {
+		sc.Motion = []KeyframeConfig{{Time: 0, Position: start}, {Time: 1, Position: sc.Destination}}
+	}
+}
+
+// setMaterial saves the shape's color and highlight, with the highlight's
+// defaults written out.
+func (sc *ShapeConfig) setMaterial(c color.RGBA, shininess, specularIntensity float64, specularColor color.RGBA) {
+	sc.Color = c
+	sc.Shininess, sc.SpecularIntensity, sc.SpecularColor = &shininess, &specularIntensity, &specularColor
+}
+
+// setSDS saves a subdivided box by what Parse builds it from: its center,
+// the half-width of the cube it was subdivided from, which subdivision
+// shrinks by the same factor whatever the size, and how often it was
+// subdivided, each time splitting every face in four.
+func (sc *ShapeConfig) setSDS(v *geometry.SDSObject) error {
+	iterations, faces := 0, 6
+	for faces < len(v.Quads) {
+		iterations, faces = iterations+1, faces*4
+	}
+	if faces != len(v.Quads) {
+		return fmt.Errorf("%d faces is no subdivided cube", len(v.Quads))
+	}
+	center := v.AABB.Min.Add(v.AABB.Max).Mul(0.5)
+	unit := geometry.CreateCubeMesh(math.Point3D{}, 1)
+	for i := 0; i < iterations; i++ {
+		unit = unit.Subdivide()
+	}
+	var unitExtent, extent float64
+	for _, p := range unit.Vertices {
+		unitExtent = gomath.Max(unitExtent, p.X)
+	}
+	for _, q := range v.Quads {
+		for _, p := range []math.Point3D{q.P00, q.P10, q.P11, q.P01} {
+			extent = gomath.Max(extent, p.X-center.X)
+		}
+	}
+	sc.Type, sc.Center, sc.Radius, sc.Iterations = "sds_box", center, extent/unitExtent, iterations
+	sc.Thickness = v.Quads[0].Thickness
+	sc.setMaterial(v.Color, v.Shininess, v.SpecularIntensity, v.SpecularColor)
+	return nil
+}
+
+// bumpConfig returns the config of a bump map, or nil for none.
+func bumpConfig(b *geometry.BumpMap, scenePath string) (*BumpConfig, error) {
+	if b == nil {
+		return nil, nil
+	}
+	if b.Height.Path == "" {
+		return nil, fmt.Errorf("bump: not loaded from a file")
+	}
+	return &BumpConfig{File: relPath(scenePath, b.Height.Path), Strength: b.Strength, Scale: b.Scale}, nil
+}
+
+// transformConfig splits an affine m into the scale, rotation and
+// translation TransformConfig applies. A mirror is a negative x scale; a
+// shear has no config.
+func transformConfig(m math.Mat4) (TransformConfig, error) {
+	const eps = 1e-9
+	if m[3] != [4]float64{0, 0, 0, 1} {
+		return TransformConfig{}, fmt.Errorf("not affine")
+	}
+	tc := TransformConfig{Translate: math.Point3D{X: m[0][3], Y: m[1][3], Z: m[2][3]}}
+	col := func(j int) math.Point3D { return math.Point3D{X: m[0][j], Y: m[1][j], Z: m[2][j]} }
+	x, y, z := col(0), col(1), col(2)
+	scale := math.Point3D{X: x.Length(), Y: y.Length(), Z: z.Length()}
+	if x.Cross(y).Dot(z) < 0 {
+		scale.X = -scale.X
+	}
+	x, y, z = x.Mul(1/scale.X), y.Mul(1/scale.Y), z.Mul(1/scale.Z)
+	if gomath.Abs(x.Dot(y)) > eps || gomath.Abs(y.Dot(z)) > eps || gomath.Abs(z.Dot(x)) > eps {
+		return TransformConfig{}, fmt.Errorf("shears can't be saved")
+	}
+	if scale != (math.Point3D{X: 1, Y: 1, Z: 1}) {
+		tc.Scale = &scale
+	}
+
+	// The rotation's columns are x, y and z: its angle is in its trace and
+	// its axis in its antisymmetric part, which vanishes at half a turn,
+	// where the axis is in its symmetric part instead.
+	cos := gomath.Max(-1, gomath.Min(1, (x.X+y.Y+z.Z-1)/2))
+	angle := gomath.Acos(cos)
+	if angle < eps {
+		return tc, nil
+	}
+	axis := math.Point3D{X: y.Z - z.Y, Y: z.X - x.Z, Z: x.Y - y.X}
+	if gomath.Sin(angle) < 1e-6 {
+		// R = 2aaᵀ - I: take a from its largest diagonal entry.
+		r := [3]math.Point3D{x, y, z}
+		diag := [3]float64{x.X, y.Y, z.Z}
+		k := 0
+		for i := 1; i < 3; i++ {
+			if diag[i] > diag[k] {
+				k = i
+			}
+		}
+		ak := gomath.Sqrt((diag[k] + 1) / 2)
+		a := [3]float64{r[k].X / (2 * ak), r[k].Y / (2 * ak), r[k].Z / (2 * ak)}
+		a[k] = ak
+		axis = math.Point3D{X: a[0], Y: a[1], Z: a[2]}
+	}
+	axis = axis.Normalize()
+	tc.Rotate = []float64{axis.X, axis.Y, axis.Z, angle * 180 / gomath.Pi}
+	return tc, nil
+}
+
+// environmentConfig returns the config of env, or nil for none. A gradient
+// brighter than white is saved with an intensity.
+func environmentConfig(env shading.Environment) (*EnvironmentConfig, error) {
+	switch e := env.(type) {
+	case nil:
+		return nil, nil
+	case shading.GradientEnvironment:
+		intensity := gomath.Max(1, gomath.Max(maxChannel(e.Sky), maxChannel(e.Ground)))
+		sky, ground := pointToRGB(e.Sky.Mul(1/intensity)), pointToRGB(e.Ground.Mul(1/intensity))
+		ec := &EnvironmentConfig{Sky: &sky, Ground: &ground}
+		if intensity != 1 {
+			ec.Intensity = &intensity
+		}
+		return ec, nil
+	}
+	return nil, fmt.Errorf("unsupported environment %T", env)
+}
+
+// backgroundConfig returns the config of background, or nil for none.
+func backgroundConfig(background shading.Environment) (*BackgroundConfig, error) {
+	switch b := background.(type) {
+	case nil:
+		return nil, nil
+	case shading.UniformEnvironment:
+		c := pointToRGB(b.Color)
+		return &BackgroundConfig{Type: "solid", Color: &c}, nil
+	case shading.GradientEnvironment:
+		top, bottom := pointToRGB(b.Sky), pointToRGB(b.Ground)
+		return &BackgroundConfig{Type: "gradient", Top: &top, Bottom: &bottom}, nil
+	case shading.SkyEnvironment:
+		sun := b.Sun
+		return &BackgroundConfig{Type: "sky", Sun: &sun, Turbidity: b.Turbidity}, nil
+	}
+	return nil, fmt.Errorf("unsupported background %T", background)
+}
+
+// relPath names file relative to the directory of the scene file at
+// scenePath, as resolvePath reads it back.
+func relPath(scenePath, file string) string {
+	dir, err := filepath.Abs(filepath.Dir(scenePath))
+	if err != nil {
+		return file
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return file
+	}
+	rel, err := filepath.Rel(dir, abs)
+	if err != nil {
+		return abs
+	}
+	return rel
+}
+
+// pointToRGB is the inverse of rgbToPoint, clamping to 8 bits.
+func pointToRGB(p math.Point3D) color.RGBA {
+	c := func(v float64) uint8 { return uint8(gomath.Round(gomath.Max(0, gomath.Min(1, v)) * 255)) }
+	return color.RGBA{R: c(p.X), G: c(p.Y), B: c(p.Z), A: 255}
+}
+
+// maxChannel returns the largest of p's channels.
+func maxChannel(p math.Point3D) float64 {
+	return gomath.Max(p.X, gomath.Max(p.Y, p.Z))
+}
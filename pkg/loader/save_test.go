@@ -0,0 +1,147 @@
+package loader
+
+import (
+	"grinder/pkg/geometry"
+	"grinder/pkg/math"
+	"image"
+	"image/color"
+	"image/png"
+	gomath "math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSave_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "maps"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(dir, "maps", "h.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := image.NewGray(image.Rect(0, 0, 2, 2))
+	img.SetGray(1, 1, color.Gray{Y: 255})
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	path := filepath.Join(dir, "scene.json")
+	scene := `{
+  "camera": {"up": {"x": 0, "y": 1, "z": 0}, "fov": 50, "aspect": 1.5, "roll": 10, "near": 1, "far": 20, "motion": [
+    {"time": 0, "eye": {"x": 0, "y": 1, "z": 5}, "target": {"x": 0, "y": 0, "z": 0}},
+    {"time": 1, "eye": {"x": 1, "y": 1, "z": 5}, "target": {"x": 0, "y": 0, "z": 0}}]},
+  "shutter": 0.5,
+  "light": {"position": {"x": 5, "y": 5, "z": 5}, "intensity": 2, "radius": 0.5, "samples": 4,
+    "color": {"r": 255, "g": 200, "b": 100, "a": 255}, "falloff": "inverseSquare"},
+  "atmosphere": {"enabled": true, "atmosphere": {"density": 0.1, "scattering": 0.05}},
+  "environment": {"sky": {"r": 100, "g": 150, "b": 255, "a": 255}, "ground": {"r": 40, "g": 30, "b": 20, "a": 255}, "intensity": 2},
+  "background": {"type": "sky", "turbidity": 4},
+  "shapes": [
+    {"type": "plane", "point": {"x": 0, "y": -1, "z": 0}, "normal": {"x": 0, "y": 1, "z": 0},
+     "color": {"r": 200, "g": 200, "b": 200, "a": 255}, "bump": {"file": "maps/h.png", "strength": 0.5, "scale": 2}},
+    {"type": "sphere", "center": {"x": 1, "y": 0, "z": 0}, "destination": {"x": 2, "y": 0, "z": 0}, "motionBlur": 0.5,
+     "radius": 0.5, "shininess": 8, "shading": "toon", "bands": 4,
+     "texture": {"type": "marble", "color1": {"r": 0, "g": 0, "b": 0, "a": 255}, "color2": {"r": 255, "g": 255, "b": 255, "a": 255}, "seed": 7}},
+    {"type": "sphere", "center": {"x": 1, "y": 0, "z": 0}, "destination": {"x": 0, "y": 0, "z": 0}, "radius": 0.5},
+    {"type": "box", "min": {"x": -1, "y": 0, "z": 0}, "max": {"x": 0, "y": 1, "z": 1}, "opacity": 0.4, "ior": 1.7, "dispersion": 30,
+     "motion": [{"time": 0, "position": {"x": -1, "y": 0, "z": 0}}, {"time": 1, "position": {"x": -1, "y": 1, "z": 0}}],
+     "transform": {"translate": {"x": 1, "y": 2, "z": 3}, "rotate": [1, 1, 0, 30], "scale": {"x": 2, "y": 1, "z": 0.5}}},
+    {"type": "cylinder", "center": {"x": 0, "y": 0, "z": -2}, "radius": 0.3, "height": 1, "anisotropyX": 0.4, "anisotropyY": 0.05,
+     "instances": [{"translate": {"x": 1, "y": 0, "z": 0}}, {"rotate": [0, 1, 0, 180], "scale": {"x": -1, "y": 1, "z": 1}}]},
+    {"type": "cone", "center": {"x": 2, "y": 0, "z": -2}, "radius": 0.3, "height": 1, "shading": "oren-nayar", "roughness": 0.8,
+     "metalness": 0.6, "specularColor": {"r": 255, "g": 180, "b": 60, "a": 255}, "emission": {"r": 255, "g": 100, "b": 0, "a": 255}, "emissionIntensity": 3},
+    {"type": "quad", "p00": {"x": 0, "y": 0, "z": 0}, "p10": {"x": 1, "y": 0, "z": 0}, "p11": {"x": 1, "y": 1, "z": 0}, "p01": {"x": 0, "y": 1, "z": 0},
+     "normalMap": "maps/h.png"},
+    {"type": "volume_box", "min": {"x": -1, "y": -1, "z": -1}, "max": {"x": 1, "y": 1, "z": 1}, "density": 0.3},
+    {"type": "sds_box", "center": {"x": 0, "y": 2, "z": 0}, "radius": 0.7, "iterations": 2, "thickness": 0.02}
+  ]
+}`
+	if err := os.WriteFile(path, []byte(scene), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	want, err := strict.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	// Saved elsewhere, the maps must be named relative to the new file.
+	if err := os.Mkdir(filepath.Join(dir, "saved"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	saved := filepath.Join(dir, "saved", "scene.json")
+	if err := Save(saved, want); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	got, err := strict.Load(saved)
+	if err != nil {
+		t.Fatalf("Load of the saved scene: %v", err)
+	}
+	if !nearlyEqual(reflect.ValueOf(got), reflect.ValueOf(want)) {
+		t.Errorf("the saved scene loads back as\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestSave_Unsupported(t *testing.T) {
+	s, err := Load(writeScene(t, `{"type": "sphere", "radius": 1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shear := math.Mat4{{1, 1, 0, 0}, {0, 1, 0, 0}, {0, 0, 1, 0}, {0, 0, 0, 1}}
+	sheared, ok := geometry.NewTransformedShape(s.Shapes[0], shear)
+	if !ok {
+		t.Fatal("shear is singular")
+	}
+	s.Shapes[0] = sheared
+	if err := Save(filepath.Join(t.TempDir(), "scene.json"), s); err == nil {
+		t.Error("expected an error saving a sheared shape")
+	}
+}
+
+// nearlyEqual reports whether a and b are deeply equal but for float
+// rounding, such as a transform split into scale, rotation and translation
+// and put back together picks up. File paths compare after cleaning.
+func nearlyEqual(a, b reflect.Value) bool {
+	if a.Kind() != b.Kind() || a.Type() != b.Type() {
+		return false
+	}
+	switch a.Kind() {
+	case reflect.Float32, reflect.Float64:
+		x, y := a.Float(), b.Float()
+		return x == y || gomath.Abs(x-y) <= 1e-9*gomath.Max(1, gomath.Max(gomath.Abs(x), gomath.Abs(y)))
+	case reflect.Pointer, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return nearlyEqual(a.Elem(), b.Elem())
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if !nearlyEqual(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice, reflect.Array:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !nearlyEqual(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.String:
+		return filepath.Clean(a.String()) == filepath.Clean(b.String())
+	case reflect.Bool:
+		return a.Bool() == b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() == b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return a.Uint() == b.Uint()
+	}
+	return false
+}
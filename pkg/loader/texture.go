@@ -0,0 +1,47 @@
+package loader
+
+import (
+	"fmt"
+	"grinder/pkg/geometry"
+	"grinder/pkg/math"
+	"image/color"
+)
+
+// TextureConfig colors a shape with a procedural pattern in its own space,
+// so the pattern moves with the shape's transform.
+type TextureConfig struct {
+	Type       string     `json:"type"` // "marble" or "wood"
+	Color1     color.RGBA `json:"color1"`
+	Color2     color.RGBA `json:"color2"`
+	Frequency  float64    `json:"frequency,omitempty"`  // pattern repeats per unit (default 1)
+	Turbulence *float64   `json:"turbulence,omitempty"` // how far noise bends the pattern (default 1)
+	Seed       uint32     `json:"seed,omitempty"`       // noise seed (default 1)
+}
+
+// build returns the texture the config describes.
+func (tc TextureConfig) build() (geometry.Texture, error) {
+	if tc.Type != geometry.Marble && tc.Type != geometry.Wood {
+		return nil, fmt.Errorf("unknown texture type %q", tc.Type)
+	}
+	if tc.Frequency < 0 {
+		return nil, fmt.Errorf("texture frequency must not be negative, got %v", tc.Frequency)
+	}
+	frequency, turbulence, seed := tc.Frequency, 1.0, tc.Seed
+	if frequency == 0 {
+		frequency = 1
+	}
+	if tc.Turbulence != nil {
+		turbulence = *tc.Turbulence
+	}
+	if seed == 0 {
+		seed = 1
+	}
+	return geometry.Procedural{
+		Kind:       tc.Type,
+		Color1:     tc.Color1,
+		Color2:     tc.Color2,
+		Frequency:  frequency,
+		Turbulence: turbulence,
+		Noise:      math.NewPerlin(seed),
+	}, nil
+}
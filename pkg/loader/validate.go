@@ -0,0 +1,196 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"grinder/pkg/math"
+	gomath "math"
+)
+
+// ErrInvalidShape is wrapped by every shape validation error.
+var ErrInvalidShape = errors.New("invalid shape")
+
+// validate checks the fields each shape type needs before it is built, so
+// nonsense input fails at load time instead of rendering nothing later. i is
+// the shape's index in the scene.
+func (c ShapeConfig) validate(i int) error {
+	invalid := func(field, format string, args ...any) error {
+		return c.invalid(i, field, format, args...)
+	}
+	switch c.Type {
+	case "sphere":
+		if c.Radius <= 0 {
+			return invalid("radius", "must be > 0, got %g", c.Radius)
+		}
+	case "box":
+		if c.Min.X >= c.Max.X || c.Min.Y >= c.Max.Y || c.Min.Z >= c.Max.Z {
+			return invalid("max", "must be greater than min on every axis, got min %v max %v", c.Min, c.Max)
+		}
+	case "volume_box":
+		if c.Min.X >= c.Max.X || c.Min.Y >= c.Max.Y || c.Min.Z >= c.Max.Z {
+			return invalid("max", "must be greater than min on every axis, got min %v max %v", c.Min, c.Max)
+		}
+		if c.Density <= 0 {
+			return invalid("density", "must be > 0, got %g", c.Density)
+		}
+		if c.Opacity != nil {
+			return invalid("opacity", "is only supported on solids; a volume's density sets how much light it stops")
+		}
+	case "cylinder", "cone":
+		if c.Radius <= 0 {
+			return invalid("radius", "must be > 0, got %g", c.Radius)
+		}
+		if c.Height <= 0 {
+			return invalid("height", "must be > 0, got %g", c.Height)
+		}
+	case "plane":
+		if c.Normal == (math.Normal3D{}) {
+			return invalid("normal", "must be non-zero")
+		}
+	case "quad":
+		// Both triangles of the quad must have area, or the patch has no surface.
+		a := c.P10.Sub(c.P00).Cross(c.P01.Sub(c.P00)).Length()
+		b := c.P10.Sub(c.P11).Cross(c.P01.Sub(c.P11)).Length()
+		if a < 1e-12 || b < 1e-12 {
+			return invalid("p00", "quad corners are degenerate (collinear or coincident)")
+		}
+		if c.Thickness < 0 {
+			return invalid("thickness", "must be >= 0, got %g", c.Thickness)
+		}
+	case "sds_box":
+		if c.Radius <= 0 {
+			return invalid("radius", "must be > 0, got %g", c.Radius)
+		}
+		if c.Iterations < 0 {
+			return invalid("iterations", "must be >= 0, got %d", c.Iterations)
+		}
+	}
+	if c.Bump != nil {
+		if c.Type != "plane" && c.Type != "quad" {
+			return invalid("bump", "is only supported on planes and quads")
+		}
+		if c.Bump.File == "" {
+			return invalid("bump", "needs a \"file\"")
+		}
+	}
+	if c.NormalMap != "" && c.Type != "quad" {
+		return invalid("normalMap", "is only supported on quads")
+	}
+	if len(c.Motion) > 0 {
+		if c.Type != "sphere" && c.Type != "box" && c.Type != "volume_box" && c.Type != "cylinder" && c.Type != "cone" {
+			return invalid("motion", "is only supported on spheres, boxes, volume boxes, cylinders and cones")
+		}
+		if c.Destination != (math.Point3D{}) {
+			return invalid("motion", "replaces destination; give one or the other")
+		}
+		if len(c.Motion) < 2 {
+			return invalid("motion", "needs at least 2 keyframes, got %d", len(c.Motion))
+		}
+		for i := 1; i < len(c.Motion); i++ {
+			if c.Motion[i].Time <= c.Motion[i-1].Time {
+				return invalid("motion", "keyframe times must increase, got %g after %g", c.Motion[i].Time, c.Motion[i-1].Time)
+			}
+		}
+	}
+	if c.AnisotropyX != 0 || c.AnisotropyY != 0 {
+		if c.Type == "volume_box" {
+			return invalid("anisotropyX", "is only supported on solids; a volume has no surface to highlight")
+		}
+		if c.AnisotropyX <= 0 || c.AnisotropyX > 1 {
+			return invalid("anisotropyX", "must be in (0, 1], got %g", c.AnisotropyX)
+		}
+		if c.AnisotropyY <= 0 || c.AnisotropyY > 1 {
+			return invalid("anisotropyY", "must be in (0, 1], got %g", c.AnisotropyY)
+		}
+	} else if c.Tangent != (math.Point3D{}) {
+		return invalid("tangent", "needs anisotropyX and anisotropyY")
+	}
+	if c.Shading != "toon" && (c.Bands != 0 || c.Outline != nil) {
+		return invalid("shading", "bands and outline need \"shading\": \"toon\"")
+	}
+	if c.Shading != "oren-nayar" && c.Roughness != 0 {
+		return invalid("shading", "roughness needs \"shading\": \"oren-nayar\"")
+	}
+	switch c.Shading {
+	case "", "phong":
+	case "toon":
+		if c.Bands < 0 {
+			return invalid("bands", "must be >= 1, got %d", c.Bands)
+		}
+		if c.Outline != nil && (*c.Outline < 0 || *c.Outline >= 1) {
+			return invalid("outline", "must be in [0, 1), got %g", *c.Outline)
+		}
+	case "oren-nayar":
+		if c.Roughness < 0 || c.Roughness > gomath.Pi/2 {
+			return invalid("roughness", "must be in (0, π/2], got %g", c.Roughness)
+		}
+	default:
+		return invalid("shading", "must be \"phong\", \"toon\" or \"oren-nayar\", got %q", c.Shading)
+	}
+	if c.Shading != "" && c.Shading != "phong" && c.Type == "volume_box" {
+		return invalid("shading", "is only supported on solids; a volume has no surface to shade")
+	}
+	if c.Dispersion < 0 {
+		return invalid("dispersion", "must be >= 0, got %g", c.Dispersion)
+	}
+	if c.Dispersion > 0 && (c.Opacity == nil || *c.Opacity >= 1) {
+		return invalid("dispersion", "needs an opacity below 1; only light passing through the shape disperses")
+	}
+	if c.IOR != 0 && c.IOR < 1 {
+		return invalid("ior", "must be >= 1, got %g", c.IOR)
+	}
+	if c.IOR != 0 && (c.Opacity == nil || *c.Opacity >= 1) {
+		return invalid("ior", "needs an opacity below 1; only light passing through the shape refracts")
+	}
+	if c.Metalness < 0 || c.Metalness > 1 {
+		return invalid("metalness", "must be in [0, 1], got %g", c.Metalness)
+	}
+	if c.Metalness != 0 && c.Type == "volume_box" {
+		return invalid("metalness", "is only supported on solids; a volume has no surface to reflect")
+	}
+	if c.Emission != nil && c.Type == "volume_box" {
+		return invalid("emission", "is only supported on solids; a volume's glow is not modeled")
+	}
+	if c.EmissionIntensity != nil {
+		if c.Emission == nil {
+			return invalid("emissionIntensity", "needs an \"emission\" color")
+		}
+		if *c.EmissionIntensity < 0 {
+			return invalid("emissionIntensity", "must be >= 0, got %g", *c.EmissionIntensity)
+		}
+	}
+	if c.MotionBlur != nil && *c.MotionBlur < 0 {
+		return invalid("motionBlur", "must be >= 0, got %g", *c.MotionBlur)
+	}
+	if c.Transform != nil {
+		if err := c.Transform.validate("transform", invalid); err != nil {
+			return err
+		}
+	}
+	for i, tc := range c.Instances {
+		if err := tc.validate(fmt.Sprintf("instances[%d]", i), invalid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// invalid returns an ErrInvalidField for field of shape i, the reason
+// formatted from format and args.
+func (c ShapeConfig) invalid(i int, field, format string, args ...any) error {
+	return &ErrInvalidField{Shape: i, Type: c.Type, Field: field, Reason: fmt.Sprintf(format, args...)}
+}
+
+// validate checks a transform's rotate and scale, naming fields under prefix.
+func (tc TransformConfig) validate(prefix string, invalid func(field, format string, args ...any) error) error {
+	if len(tc.Rotate) != 0 && len(tc.Rotate) != 4 {
+		return invalid(prefix+".rotate", "must be [x, y, z, degrees], got %d values", len(tc.Rotate))
+	}
+	if len(tc.Rotate) == 4 && tc.Rotate[0] == 0 && tc.Rotate[1] == 0 && tc.Rotate[2] == 0 {
+		return invalid(prefix+".rotate", "axis must be non-zero")
+	}
+	if s := tc.Scale; s != nil && (s.X == 0 || s.Y == 0 || s.Z == 0) {
+		return invalid(prefix+".scale", "must be non-zero on every axis, got %v", *s)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package math
+
+import "math"
+
+// AABB4 holds four boxes laid out by component, so one ray can be tested
+// against all of them in a single pass.
+type AABB4 struct {
+	MinX, MinY, MinZ [4]float64
+	MaxX, MaxY, MaxZ [4]float64
+}
+
+// Set stores b as box i.
+func (a *AABB4) Set(i int, b AABB3D) {
+	a.MinX[i], a.MinY[i], a.MinZ[i] = b.Min.X, b.Min.Y, b.Min.Z
+	a.MaxX[i], a.MaxY[i], a.MaxZ[i] = b.Max.X, b.Max.Y, b.Max.Z
+}
+
+// IntersectRay tests r against the four boxes. Bit i of mask is set if box
+// i is hit, and then tmin[i] is its entry distance. The arithmetic is the
+// same as AABB3D.IntersectRay, so results match it exactly; only the per-ray
+// setup is shared.
+func (a *AABB4) IntersectRay(r Ray) (tmin [4]float64, mask uint8) {
+	const epsilon = 1e-6
+	flatX := math.Abs(r.Direction.X) < epsilon
+	flatY := math.Abs(r.Direction.Y) < epsilon
+	flatZ := math.Abs(r.Direction.Z) < epsilon
+
+	for i := 0; i < 4; i++ {
+		lo, hi := -math.MaxFloat64, math.MaxFloat64
+		if flatX {
+			if r.Origin.X < a.MinX[i] || r.Origin.X > a.MaxX[i] {
+				continue
+			}
+		} else {
+			t1 := (a.MinX[i] - r.Origin.X) / r.Direction.X
+			t2 := (a.MaxX[i] - r.Origin.X) / r.Direction.X
+			if t1 > t2 {
+				t1, t2 = t2, t1
+			}
+			lo, hi = max(lo, t1), min(hi, t2)
+		}
+		if flatY {
+			if r.Origin.Y < a.MinY[i] || r.Origin.Y > a.MaxY[i] {
+				continue
+			}
+		} else {
+			t1 := (a.MinY[i] - r.Origin.Y) / r.Direction.Y
+			t2 := (a.MaxY[i] - r.Origin.Y) / r.Direction.Y
+			if t1 > t2 {
+				t1, t2 = t2, t1
+			}
+			lo, hi = max(lo, t1), min(hi, t2)
+		}
+		if flatZ {
+			if r.Origin.Z < a.MinZ[i] || r.Origin.Z > a.MaxZ[i] {
+				continue
+			}
+		} else {
+			t1 := (a.MinZ[i] - r.Origin.Z) / r.Direction.Z
+			t2 := (a.MaxZ[i] - r.Origin.Z) / r.Direction.Z
+			if t1 > t2 {
+				t1, t2 = t2, t1
+			}
+			lo, hi = max(lo, t1), min(hi, t2)
+		}
+		if hi >= lo && hi > 0 {
+			tmin[i] = lo
+			mask |= 1 << i
+		}
+	}
+	return tmin, mask
+}
@@ -0,0 +1,90 @@
+package math
+
+import (
+	"math"
+	"testing"
+)
+
+// randomBoxes returns n boxes scattered through [-2, 2]^3, some of them thin.
+func randomBoxes(rng *XorShift32, n int) []AABB3D {
+	boxes := make([]AABB3D, n)
+	for i := range boxes {
+		c := Point3D{X: rng.NextFloat64()*4 - 2, Y: rng.NextFloat64()*4 - 2, Z: rng.NextFloat64()*4 - 2}
+		h := Point3D{X: rng.NextFloat64() * 0.3, Y: rng.NextFloat64() * 0.3, Z: rng.NextFloat64() * 0.3}
+		boxes[i] = AABB3D{Min: c.Sub(h), Max: c.Add(h)}
+	}
+	return boxes
+}
+
+func TestAABB4_IntersectRayMatchesScalar(t *testing.T) {
+	rng := NewXorShift32(7)
+	boxes := randomBoxes(rng, 64)
+	var rays []Ray
+	for i := 0; i < 500; i++ {
+		o := Point3D{X: rng.NextFloat64()*8 - 4, Y: rng.NextFloat64()*8 - 4, Z: rng.NextFloat64()*8 - 4}
+		d := Point3D{X: rng.NextFloat64()*2 - 1, Y: rng.NextFloat64()*2 - 1, Z: rng.NextFloat64()*2 - 1}
+		// Make every third ray axis-parallel on one axis.
+		switch i % 9 {
+		case 0:
+			d.X = 0
+		case 3:
+			d.Y = 0
+		case 6:
+			d.Z = 0
+		}
+		rays = append(rays, Ray{Origin: o, Direction: d.Normalize()})
+	}
+
+	for _, r := range rays {
+		for g := 0; g < len(boxes); g += 4 {
+			var b4 AABB4
+			for i := 0; i < 4; i++ {
+				b4.Set(i, boxes[g+i])
+			}
+			tmin, mask := b4.IntersectRay(r)
+			for i := 0; i < 4; i++ {
+				want, _, hit := boxes[g+i].IntersectRay(r)
+				if got := mask&(1<<i) != 0; got != hit {
+					t.Fatalf("ray %v box %v: 4-wide hit = %v, scalar %v", r, boxes[g+i], got, hit)
+				}
+				if hit && math.Float64bits(tmin[i]) != math.Float64bits(want) {
+					t.Fatalf("ray %v box %v: 4-wide tmin = %v, scalar %v", r, boxes[g+i], tmin[i], want)
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkAABB_IntersectRay64 tests one ray against a dense 64-box leaf,
+// one box at a time and four at a time.
+func BenchmarkAABB_IntersectRay64(b *testing.B) {
+	boxes := randomBoxes(NewXorShift32(7), 64)
+	var packed [16]AABB4
+	for i, box := range boxes {
+		packed[i/4].Set(i%4, box)
+	}
+	r := Ray{Origin: Point3D{Z: 5}, Direction: Point3D{X: 0.1, Y: 0.05, Z: -1}.Normalize()}
+
+	b.Run("scalar", func(b *testing.B) {
+		b.ReportAllocs()
+		hits := 0
+		for i := 0; i < b.N; i++ {
+			for _, box := range boxes {
+				if _, _, ok := box.IntersectRay(r); ok {
+					hits++
+				}
+			}
+		}
+	})
+	b.Run("x4", func(b *testing.B) {
+		b.ReportAllocs()
+		hits := 0
+		for i := 0; i < b.N; i++ {
+			for j := range packed {
+				if _, mask := packed[j].IntersectRay(r); mask != 0 {
+					hits++
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,26 @@
+package math
+
+import "image/color"
+
+// Clamp returns v limited to [lo, hi]. NaN comes back as lo.
+func Clamp(v, lo, hi float64) float64 {
+	if !(v > lo) {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// ClampColor converts c, with channels on the 0-255 scale, to an opaque
+// color. Each channel is clamped to [0, 255] first, so a negative one comes
+// out black instead of wrapping around to bright.
+func ClampColor(c Point3D) color.RGBA {
+	return color.RGBA{
+		R: uint8(Clamp(c.X, 0, 255)),
+		G: uint8(Clamp(c.Y, 0, 255)),
+		B: uint8(Clamp(c.Z, 0, 255)),
+		A: 255,
+	}
+}
@@ -0,0 +1,27 @@
+package math
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestClamp(t *testing.T) {
+	tests := []struct{ v, want float64 }{
+		{-3, 0}, {0.5, 0.5}, {7, 1}, {math.NaN(), 0}, {math.Inf(1), 1},
+	}
+	for _, tt := range tests {
+		if got := Clamp(tt.v, 0, 1); got != tt.want {
+			t.Errorf("Clamp(%v, 0, 1) = %v, want %v", tt.v, got, tt.want)
+		}
+	}
+}
+
+// TestClampColor feeds a negative channel, which a plain uint8 conversion
+// wraps around to bright, and an overbright one.
+func TestClampColor(t *testing.T) {
+	got := ClampColor(Point3D{X: -1, Y: 300, Z: 127.9})
+	if want := (color.RGBA{R: 0, G: 255, B: 127, A: 255}); got != want {
+		t.Errorf("ClampColor = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,129 @@
+package math
+
+import "math"
+
+// Mat4 is a row-major 4x4 affine transform applied to column vectors.
+type Mat4 [4][4]float64
+
+// Identity4 returns the identity transform.
+func Identity4() Mat4 {
+	return Mat4{{1, 0, 0, 0}, {0, 1, 0, 0}, {0, 0, 1, 0}, {0, 0, 0, 1}}
+}
+
+// Translate4 returns a translation by v.
+func Translate4(v Point3D) Mat4 {
+	m := Identity4()
+	m[0][3], m[1][3], m[2][3] = v.X, v.Y, v.Z
+	return m
+}
+
+// Scale4 returns a non-uniform scale by v.
+func Scale4(v Point3D) Mat4 {
+	m := Identity4()
+	m[0][0], m[1][1], m[2][2] = v.X, v.Y, v.Z
+	return m
+}
+
+// Rotate4 returns a rotation of deg degrees about axis (right-handed).
+func Rotate4(axis Point3D, deg float64) Mat4 {
+	a := axis.Normalize()
+	rad := deg * math.Pi / 180
+	s, c := math.Sin(rad), math.Cos(rad)
+	t := 1 - c
+	return Mat4{
+		{t*a.X*a.X + c, t*a.X*a.Y - s*a.Z, t*a.X*a.Z + s*a.Y, 0},
+		{t*a.X*a.Y + s*a.Z, t*a.Y*a.Y + c, t*a.Y*a.Z - s*a.X, 0},
+		{t*a.X*a.Z - s*a.Y, t*a.Y*a.Z + s*a.X, t*a.Z*a.Z + c, 0},
+		{0, 0, 0, 1},
+	}
+}
+
+// Mul returns m * o, i.e. o is applied first.
+func (m Mat4) Mul(o Mat4) Mat4 {
+	var r Mat4
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			for k := 0; k < 4; k++ {
+				r[i][j] += m[i][k] * o[k][j]
+			}
+		}
+	}
+	return r
+}
+
+// Transpose returns the transpose of m.
+func (m Mat4) Transpose() Mat4 {
+	var r Mat4
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			r[i][j] = m[j][i]
+		}
+	}
+	return r
+}
+
+// Inverse returns the inverse of m and false if m is singular.
+func (m Mat4) Inverse() (Mat4, bool) {
+	// Gauss-Jordan elimination with partial pivoting.
+	a := m
+	inv := Identity4()
+	for col := 0; col < 4; col++ {
+		pivot := col
+		for row := col + 1; row < 4; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return Mat4{}, false
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		inv[col], inv[pivot] = inv[pivot], inv[col]
+
+		d := a[col][col]
+		for j := 0; j < 4; j++ {
+			a[col][j] /= d
+			inv[col][j] /= d
+		}
+		for row := 0; row < 4; row++ {
+			if row == col {
+				continue
+			}
+			f := a[row][col]
+			for j := 0; j < 4; j++ {
+				a[row][j] -= f * a[col][j]
+				inv[row][j] -= f * inv[col][j]
+			}
+		}
+	}
+	return inv, true
+}
+
+// TransformPoint applies m to a point, including translation.
+func (m Mat4) TransformPoint(p Point3D) Point3D {
+	return Point3D{
+		X: m[0][0]*p.X + m[0][1]*p.Y + m[0][2]*p.Z + m[0][3],
+		Y: m[1][0]*p.X + m[1][1]*p.Y + m[1][2]*p.Z + m[1][3],
+		Z: m[2][0]*p.X + m[2][1]*p.Y + m[2][2]*p.Z + m[2][3],
+	}
+}
+
+// TransformVector applies m to a direction, ignoring translation.
+func (m Mat4) TransformVector(v Point3D) Point3D {
+	return Point3D{
+		X: m[0][0]*v.X + m[0][1]*v.Y + m[0][2]*v.Z,
+		Y: m[1][0]*v.X + m[1][1]*v.Y + m[1][2]*v.Z,
+		Z: m[2][0]*v.X + m[2][1]*v.Y + m[2][2]*v.Z,
+	}
+}
+
+// TransformAABB returns the bounds of the eight transformed corners of b.
+func (m Mat4) TransformAABB(b AABB3D) AABB3D {
+	corners := b.GetCorners()
+	first := m.TransformPoint(corners[0])
+	out := AABB3D{Min: first, Max: first}
+	for _, c := range corners[1:] {
+		out = out.Expand(m.TransformPoint(c))
+	}
+	return out
+}
@@ -0,0 +1,53 @@
+package math
+
+import (
+	"math"
+	"testing"
+)
+
+func approxPoint(a, b Point3D) bool {
+	const eps = 1e-9
+	return math.Abs(a.X-b.X) < eps && math.Abs(a.Y-b.Y) < eps && math.Abs(a.Z-b.Z) < eps
+}
+
+func TestMat4_TransformPoint(t *testing.T) {
+	// Scale, then rotate 90 degrees about Z, then translate.
+	m := Translate4(Point3D{X: 1, Y: 2, Z: 3}).
+		Mul(Rotate4(Point3D{X: 0, Y: 0, Z: 1}, 90)).
+		Mul(Scale4(Point3D{X: 2, Y: 2, Z: 2}))
+	got := m.TransformPoint(Point3D{X: 1, Y: 0, Z: 0})
+	want := Point3D{X: 1, Y: 4, Z: 3}
+	if !approxPoint(got, want) {
+		t.Errorf("TransformPoint failed: got %v, want %v", got, want)
+	}
+	if v := m.TransformVector(Point3D{X: 1, Y: 0, Z: 0}); !approxPoint(v, Point3D{X: 0, Y: 2, Z: 0}) {
+		t.Errorf("TransformVector should ignore translation, got %v", v)
+	}
+}
+
+func TestMat4_Inverse(t *testing.T) {
+	m := Translate4(Point3D{X: -4, Y: 0.5, Z: 7}).
+		Mul(Rotate4(Point3D{X: 1, Y: 1, Z: 0}, 33)).
+		Mul(Scale4(Point3D{X: 1, Y: 3, Z: 0.5}))
+	inv, ok := m.Inverse()
+	if !ok {
+		t.Fatal("Inverse reported singular for an invertible matrix")
+	}
+	p := Point3D{X: 0.3, Y: -2, Z: 5}
+	if got := inv.TransformPoint(m.TransformPoint(p)); !approxPoint(got, p) {
+		t.Errorf("Inverse round trip failed: got %v, want %v", got, p)
+	}
+	if _, ok := Scale4(Point3D{X: 1, Y: 0, Z: 1}).Inverse(); ok {
+		t.Error("Inverse should fail for a zero scale")
+	}
+}
+
+func TestMat4_TransformAABB(t *testing.T) {
+	box := AABB3D{Min: Point3D{X: -1, Y: -1, Z: -1}, Max: Point3D{X: 1, Y: 1, Z: 1}}
+	got := Rotate4(Point3D{X: 0, Y: 0, Z: 1}, 45).TransformAABB(box)
+	r := math.Sqrt2
+	want := AABB3D{Min: Point3D{X: -r, Y: -r, Z: -1}, Max: Point3D{X: r, Y: r, Z: 1}}
+	if !approxPoint(got.Min, want.Min) || !approxPoint(got.Max, want.Max) {
+		t.Errorf("TransformAABB failed: got %v, want %v", got, want)
+	}
+}
@@ -17,3 +17,23 @@ func Morton3D(x, y, z float64) uint32 {
 	uz := uint32(z * 1023.0)
 	return (ExpandBits(ux) << 2) | (ExpandBits(uy) << 1) | ExpandBits(uz)
 }
+
+// ExpandBits64 spreads 21 bits to 63 bits by inserting 2 zeros between each bit.
+func ExpandBits64(v uint64) uint64 {
+	v &= 0x1FFFFF
+	v = (v | (v << 32)) & 0x1F00000000FFFF
+	v = (v | (v << 16)) & 0x1F0000FF0000FF
+	v = (v | (v << 8)) & 0x100F00F00F00F00F
+	v = (v | (v << 4)) & 0x10C30C30C30C30C3
+	v = (v | (v << 2)) & 0x1249249249249249
+	return v
+}
+
+// Morton3D64 computes a 63-bit Morton code for a 3D point in [0, 1] range,
+// with 21 bits (2097151 steps) per axis instead of Morton3D's 10.
+func Morton3D64(x, y, z float64) uint64 {
+	ux := uint64(x * 2097151.0)
+	uy := uint64(y * 2097151.0)
+	uz := uint64(z * 2097151.0)
+	return (ExpandBits64(ux) << 2) | (ExpandBits64(uy) << 1) | ExpandBits64(uz)
+}
@@ -0,0 +1,36 @@
+package math
+
+import "testing"
+
+func TestExpandBits64(t *testing.T) {
+	// Every input bit i must land on output bit 3i.
+	for i := 0; i < 21; i++ {
+		if got, want := ExpandBits64(1<<i), uint64(1)<<(3*i); got != want {
+			t.Errorf("ExpandBits64(1<<%d) = %#x, want %#x", i, got, want)
+		}
+	}
+	if got := ExpandBits64(1 << 21); got != 0 {
+		t.Errorf("ExpandBits64 kept bit 21: %#x", got)
+	}
+	// The low 10 bits spread the same way as the 32-bit version.
+	for _, v := range []uint32{0, 1, 0x155, 0x2AA, 0x3FF} {
+		if got, want := ExpandBits64(uint64(v)), uint64(ExpandBits(v)); got != want {
+			t.Errorf("ExpandBits64(%#x) = %#x, want %#x", v, got, want)
+		}
+	}
+}
+
+func TestMorton3D64_SeparatesNearbyPoints(t *testing.T) {
+	a := Point3D{X: 0.5, Y: 0.25, Z: 0.75}
+	b := Point3D{X: 0.5 + 1e-4, Y: 0.25, Z: 0.75}
+	if Morton3D(a.X, a.Y, a.Z) != Morton3D(b.X, b.Y, b.Z) {
+		t.Fatal("expected the 32-bit codes of the test points to collide")
+	}
+	if Morton3D64(a.X, a.Y, a.Z) == Morton3D64(b.X, b.Y, b.Z) {
+		t.Error("Morton3D64 gave the same code to distinct nearby points")
+	}
+	// Codes still order points along the curve: the corners bound everything.
+	if lo, hi := Morton3D64(0, 0, 0), Morton3D64(1, 1, 1); lo != 0 || hi != 1<<63-1 {
+		t.Errorf("corner codes = %#x, %#x, want 0 and %#x", lo, hi, uint64(1<<63-1))
+	}
+}
@@ -0,0 +1,42 @@
+package math
+
+import "sort"
+
+// Keyframe is where a moving object is at Time, from 0 at the start of the
+// shutter to 1 at its end.
+type Keyframe struct {
+	Time     float64
+	Position Point3D
+}
+
+// Motion moves an object along straight segments between its keyframes,
+// which are sorted by time. Before the first keyframe and after the last
+// the object rests there.
+type Motion struct {
+	Keyframes []Keyframe
+}
+
+// At returns the position at time t.
+func (m *Motion) At(t float64) Point3D {
+	k := m.Keyframes
+	i := sort.Search(len(k), func(i int) bool { return k[i].Time > t })
+	if i == 0 {
+		return k[0].Position
+	}
+	if i == len(k) {
+		return k[len(k)-1].Position
+	}
+	a, b := k[i-1], k[i]
+	f := (t - a.Time) / (b.Time - a.Time)
+	return a.Position.Add(b.Position.Sub(a.Position).Mul(f))
+}
+
+// Bounds returns the box around every keyframe position, which holds the
+// whole path since it runs straight between them.
+func (m *Motion) Bounds() AABB3D {
+	b := AABB3D{Min: m.Keyframes[0].Position, Max: m.Keyframes[0].Position}
+	for _, k := range m.Keyframes[1:] {
+		b = b.Expand(k.Position)
+	}
+	return b
+}
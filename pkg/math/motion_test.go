@@ -0,0 +1,29 @@
+package math
+
+import "testing"
+
+func TestMotion_At(t *testing.T) {
+	m := &Motion{Keyframes: []Keyframe{
+		{Time: 0.25, Position: Point3D{X: 1}},
+		{Time: 0.5, Position: Point3D{X: 3}},
+		{Time: 1, Position: Point3D{X: 3, Y: 2}},
+	}}
+	for _, tt := range []struct {
+		t    float64
+		want Point3D
+	}{
+		{0, Point3D{X: 1}},
+		{0.25, Point3D{X: 1}},
+		{0.375, Point3D{X: 2}},
+		{0.5, Point3D{X: 3}},
+		{0.75, Point3D{X: 3, Y: 1}},
+		{2, Point3D{X: 3, Y: 2}},
+	} {
+		if got := m.At(tt.t); got != tt.want {
+			t.Errorf("At(%v) = %v, want %v", tt.t, got, tt.want)
+		}
+	}
+	if b := m.Bounds(); b.Min != (Point3D{X: 1}) || b.Max != (Point3D{X: 3, Y: 2}) {
+		t.Errorf("Bounds() = %v, want (1,0,0)-(3,2,0)", b)
+	}
+}
@@ -0,0 +1,112 @@
+package math
+
+import "math"
+
+// Perlin is Ken Perlin's improved gradient noise ("Improving Noise", 2002)
+// over a seeded permutation table. The noise is smooth, repeats every 256
+// units along each axis and is zero at every integer lattice point.
+type Perlin struct {
+	perm [512]uint8 // the permutation twice, so lookups need no wrapping
+	seed uint32
+}
+
+// NewPerlin shuffles a permutation table with seed; the same seed always
+// gives the same noise.
+func NewPerlin(seed uint32) *Perlin {
+	p := Perlin{seed: seed}
+	for i := 0; i < 256; i++ {
+		p.perm[i] = uint8(i)
+	}
+	prng := NewXorShift32(seed)
+	for i := 255; i > 0; i-- {
+		j := prng.Next() % uint32(i+1)
+		p.perm[i], p.perm[j] = p.perm[j], p.perm[i]
+	}
+	copy(p.perm[256:], p.perm[:256])
+	return &p
+}
+
+// Seed returns the seed the table was shuffled with.
+func (p *Perlin) Seed() uint32 { return p.seed }
+
+// defaultPerlin backs the package-level Noise3D and Fbm.
+var defaultPerlin = NewPerlin(1)
+
+// Noise3D returns the default table's noise at (x, y, z), in [-1, 1].
+func Noise3D(x, y, z float64) float64 { return defaultPerlin.Noise3D(x, y, z) }
+
+// Fbm returns the default table's fractal sum at (x, y, z); see Perlin.Fbm.
+func Fbm(x, y, z float64, octaves int, lacunarity, gain float64) float64 {
+	return defaultPerlin.Fbm(x, y, z, octaves, lacunarity, gain)
+}
+
+// Noise3D returns the noise at (x, y, z), in [-1, 1].
+func (p *Perlin) Noise3D(x, y, z float64) float64 {
+	fx, fy, fz := math.Floor(x), math.Floor(y), math.Floor(z)
+	xi, yi, zi := int(fx)&255, int(fy)&255, int(fz)&255
+	x, y, z = x-fx, y-fy, z-fz
+	u, v, w := fade(x), fade(y), fade(z)
+
+	a := int(p.perm[xi]) + yi
+	aa, ab := int(p.perm[a])+zi, int(p.perm[a+1])+zi
+	b := int(p.perm[xi+1]) + yi
+	ba, bb := int(p.perm[b])+zi, int(p.perm[b+1])+zi
+
+	n := lerp(w,
+		lerp(v,
+			lerp(u, grad(p.perm[aa], x, y, z), grad(p.perm[ba], x-1, y, z)),
+			lerp(u, grad(p.perm[ab], x, y-1, z), grad(p.perm[bb], x-1, y-1, z))),
+		lerp(v,
+			lerp(u, grad(p.perm[aa+1], x, y, z-1), grad(p.perm[ba+1], x-1, y, z-1)),
+			lerp(u, grad(p.perm[ab+1], x, y-1, z-1), grad(p.perm[bb+1], x-1, y-1, z-1))))
+	// The twelve edge gradients can push a corner of the cube just past 1.
+	return math.Max(-1, math.Min(1, n))
+}
+
+// Fbm sums octaves of noise, each at lacunarity times the frequency and
+// gain times the amplitude of the one before, for fractal detail such as
+// clouds or marble veins. The sum is divided by the total amplitude so it
+// stays in [-1, 1].
+func (p *Perlin) Fbm(x, y, z float64, octaves int, lacunarity, gain float64) float64 {
+	var sum, norm float64
+	amp, freq := 1.0, 1.0
+	for i := 0; i < octaves; i++ {
+		sum += amp * p.Noise3D(x*freq, y*freq, z*freq)
+		norm += amp
+		amp *= gain
+		freq *= lacunarity
+	}
+	if norm == 0 {
+		return 0
+	}
+	return sum / norm
+}
+
+// fade is the quintic 6t^5 - 15t^4 + 10t^3, whose first and second
+// derivatives vanish at 0 and 1 so cells join without creases.
+func fade(t float64) float64 { return t * t * t * (t*(t*6-15) + 10) }
+
+func lerp(t, a, b float64) float64 { return a + t*(b-a) }
+
+// grad dots (x, y, z) with one of the twelve cube-edge directions picked by
+// the hash.
+func grad(hash uint8, x, y, z float64) float64 {
+	h := hash & 15
+	u := y
+	if h < 8 {
+		u = x
+	}
+	v := z
+	if h < 4 {
+		v = y
+	} else if h == 12 || h == 14 {
+		v = x
+	}
+	if h&1 != 0 {
+		u = -u
+	}
+	if h&2 != 0 {
+		v = -v
+	}
+	return u + v
+}
@@ -0,0 +1,69 @@
+package math
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNoise3D_ZeroOnLattice(t *testing.T) {
+	p := NewPerlin(42)
+	for x := -3; x <= 3; x++ {
+		for y := -3; y <= 3; y++ {
+			for z := -3; z <= 3; z++ {
+				if n := p.Noise3D(float64(x), float64(y), float64(z)); n != 0 {
+					t.Fatalf("Noise3D(%d, %d, %d) = %v, want 0", x, y, z, n)
+				}
+			}
+		}
+	}
+}
+
+func TestNoise3D_Continuous(t *testing.T) {
+	const h = 1e-4
+	prng := NewXorShift32(3)
+	for i := 0; i < 1000; i++ {
+		x, y, z := 20*prng.NextFloat64()-10, 20*prng.NextFloat64()-10, 20*prng.NextFloat64()-10
+		n := Noise3D(x, y, z)
+		if n < -1 || n > 1 {
+			t.Fatalf("Noise3D(%v, %v, %v) = %v, outside [-1, 1]", x, y, z, n)
+		}
+		// The gradient is bounded, so a tiny step can only move it a little.
+		if d := math.Abs(Noise3D(x+h, y+h, z+h) - n); d > 10*h {
+			t.Fatalf("Noise3D jumps by %v over a step of %v at (%v, %v, %v)", d, h, x, y, z)
+		}
+	}
+}
+
+func TestNoise3D_Seeded(t *testing.T) {
+	a, b, c := NewPerlin(7), NewPerlin(7), NewPerlin(8)
+	differ := false
+	for i := 0; i < 100; i++ {
+		x, y, z := float64(i)*0.37, float64(i)*0.11+0.5, float64(i)*0.23+0.25
+		if a.Noise3D(x, y, z) != b.Noise3D(x, y, z) {
+			t.Fatalf("two tables with seed 7 differ at (%v, %v, %v)", x, y, z)
+		}
+		if a.Noise3D(x, y, z) != c.Noise3D(x, y, z) {
+			differ = true
+		}
+	}
+	if !differ {
+		t.Error("seeds 7 and 8 give the same noise")
+	}
+}
+
+func TestFbm(t *testing.T) {
+	p := NewPerlin(5)
+	// One octave is the noise itself.
+	if got, want := p.Fbm(1.3, 2.7, 0.4, 1, 2, 0.5), p.Noise3D(1.3, 2.7, 0.4); got != want {
+		t.Errorf("one-octave Fbm = %v, want Noise3D's %v", got, want)
+	}
+	for i := 0; i < 200; i++ {
+		x := float64(i) * 0.173
+		if n := p.Fbm(x, 0.5*x, 0.3, 6, 2, 0.5); n < -1 || n > 1 {
+			t.Fatalf("Fbm(%v) = %v, outside [-1, 1]", x, n)
+		}
+	}
+	if got := p.Fbm(1, 2, 3, 0, 2, 0.5); got != 0 {
+		t.Errorf("zero-octave Fbm = %v, want 0", got)
+	}
+}
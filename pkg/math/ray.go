@@ -4,4 +4,7 @@ package math
 type Ray struct {
 	Origin    Point3D
 	Direction Point3D
+	// Time is the shutter time the ray samples, in [0, shutter]. Secondary
+	// rays inherit it so a whole path sees the scene at one instant.
+	Time float64
 }
@@ -0,0 +1,207 @@
+package math
+
+import (
+	"math"
+	"sync"
+)
+
+// MultiJittered returns sample s of an m x n correlated multi-jittered pattern
+// (Kensler, "Correlated Multi-Jittered Sampling", 2013). Like a jittered grid
+// it puts one sample in each of the m x n cells, but it also puts exactly one
+// sample in each of the m*n columns and rows, so edges aligned with either
+// axis are sampled evenly too. pattern selects one of many such patterns.
+func MultiJittered(s, m, n int, pattern uint32) (x, y float64) {
+	sx := int(permute(uint32(s%m), uint32(m), pattern*0xa511e9b3))
+	sy := int(permute(uint32(s/m), uint32(n), pattern*0x63d83595))
+	jx := hashFloat(uint32(s), pattern*0xa399d265)
+	jy := hashFloat(uint32(s), pattern*0x711ad6a5)
+	x = (float64(s%m) + (float64(sy)+jx)/float64(n)) / float64(m)
+	y = (float64(s/m) + (float64(sx)+jy)/float64(m)) / float64(n)
+	return x, y
+}
+
+// permute maps i to a pseudo-random position in [0, l), a different
+// permutation for each p. The hash is a bijection on the smallest power of two
+// covering l, and values past l are hashed again until they fall inside.
+func permute(i, l, p uint32) uint32 {
+	w := l - 1
+	w |= w >> 1
+	w |= w >> 2
+	w |= w >> 4
+	w |= w >> 8
+	w |= w >> 16
+	for {
+		i ^= p
+		i *= 0xe170893d
+		i ^= p >> 16
+		i ^= (i & w) >> 4
+		i ^= p >> 8
+		i *= 0x0929eb3f
+		i ^= p >> 23
+		i ^= (i & w) >> 1
+		i *= 1 | p>>27
+		i *= 0x6935fa69
+		i ^= (i & w) >> 11
+		i *= 0x74dcb303
+		i ^= (i & w) >> 2
+		i *= 0x9e501cc3
+		i ^= (i & w) >> 2
+		i *= 0xc860a3df
+		i &= w
+		i ^= i >> 5
+		if i < l {
+			break
+		}
+	}
+	return (i + p) % l
+}
+
+// hashFloat hashes i with seed p to a float in [0, 1).
+func hashFloat(i, p uint32) float64 {
+	i ^= p
+	i ^= i >> 17
+	i ^= i >> 10
+	i *= 0xb36534e5
+	i ^= i >> 12
+	i ^= i >> 21
+	i *= 0x93fc4795
+	i ^= 0xdf6e307f
+	i ^= i >> 17
+	i *= 1 | p>>18
+	return float64(i) / 4294967296.0
+}
+
+// BlueNoiseSize is the side of the tile BlueNoise repeats over.
+const BlueNoiseSize = 32
+
+var (
+	blueNoiseOnce sync.Once
+	blueNoiseTile [BlueNoiseSize * BlueNoiseSize]float64
+)
+
+// BlueNoise returns the value of a tiling blue-noise dither mask at (x, y),
+// in [0, 1). Every value occurs once per tile and neighbouring pixels tend to
+// differ strongly, so per-pixel offsets taken from it leave sampling error as
+// fine-grained noise instead of blotches.
+func BlueNoise(x, y int) float64 {
+	blueNoiseOnce.Do(buildBlueNoise)
+	x, y = ((x%BlueNoiseSize)+BlueNoiseSize)%BlueNoiseSize, ((y%BlueNoiseSize)+BlueNoiseSize)%BlueNoiseSize
+	return blueNoiseTile[y*BlueNoiseSize+x]
+}
+
+// buildBlueNoise ranks the tile's pixels with Ulichney's void-and-cluster
+// method: points are added one at a time in the emptiest remaining spot, as
+// measured by a toroidal Gaussian energy, and the order they were added in
+// becomes the dither value.
+func buildBlueNoise() {
+	const size = BlueNoiseSize
+	const n = size * size
+	const sigma = 1.5
+
+	// kernel[dy*size+dx] is the energy a point contributes at offset (dx, dy).
+	var kernel [n]float64
+	for dy := 0; dy < size; dy++ {
+		for dx := 0; dx < size; dx++ {
+			ddx, ddy := float64(min(dx, size-dx)), float64(min(dy, size-dy))
+			kernel[dy*size+dx] = math.Exp(-(ddx*ddx + ddy*ddy) / (2 * sigma * sigma))
+		}
+	}
+	var energy [n]float64
+	var filled [n]bool
+	splat := func(i int, sign float64) {
+		x0, y0 := i%size, i/size
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				energy[y*size+x] += sign * kernel[((y-y0+size)%size)*size+(x-x0+size)%size]
+			}
+		}
+	}
+	extreme := func(want bool, better func(a, b float64) bool) int {
+		best := -1
+		for i := 0; i < n; i++ {
+			if filled[i] == want && (best < 0 || better(energy[i], energy[best])) {
+				best = i
+			}
+		}
+		return best
+	}
+	voidIdx := func() int { return extreme(false, func(a, b float64) bool { return a < b }) }
+	clusterIdx := func() int { return extreme(true, func(a, b float64) bool { return a > b }) }
+
+	// Seed with a sparse random pattern, then even it out by repeatedly moving
+	// the tightest cluster into the largest void until that stops changing.
+	prng := NewXorShift32(0x9e3779b9)
+	initial := n / 10
+	for placed := 0; placed < initial; {
+		i := int(prng.Next() % n)
+		if !filled[i] {
+			filled[i] = true
+			splat(i, 1)
+			placed++
+		}
+	}
+	for iter := 0; iter < n; iter++ {
+		c := clusterIdx()
+		filled[c] = false
+		splat(c, -1)
+		v := voidIdx()
+		filled[v] = true
+		splat(v, 1)
+		if v == c {
+			break
+		}
+	}
+
+	var rank [n]int
+	seed, seedEnergy := filled, energy
+	// Rank the seed points by removing the tightest cluster each time.
+	for r := initial - 1; r >= 0; r-- {
+		c := clusterIdx()
+		filled[c] = false
+		splat(c, -1)
+		rank[c] = r
+	}
+	// Then fill the rest of the tile, largest void first.
+	filled, energy = seed, seedEnergy
+	for r := initial; r < n; r++ {
+		v := voidIdx()
+		filled[v] = true
+		splat(v, 1)
+		rank[v] = r
+	}
+	for i, r := range rank {
+		blueNoiseTile[i] = (float64(r) + 0.5) / n
+	}
+}
+
+// CosineHemisphere maps u1, u2 in [0, 1) to a cosine-weighted direction about
+// the unit normal n, through the unit disk (Shirley-Chiu concentric mapping)
+// projected up onto the hemisphere. Its PDF is cos(theta)/pi. Stratified
+// u1, u2 give stratified directions.
+func CosineHemisphere(n Point3D, u1, u2 float64) Point3D {
+	u1, u2 = 2*u1-1, 2*u2-1
+
+	var r, phi float64
+	switch {
+	case u1 == 0 && u2 == 0:
+		r, phi = 0, 0
+	case math.Abs(u1) > math.Abs(u2):
+		r, phi = u1, (math.Pi/4)*(u2/u1)
+	default:
+		r, phi = u2, math.Pi/2-(math.Pi/4)*(u1/u2)
+	}
+	x := r * math.Cos(phi)
+	y := r * math.Sin(phi)
+	z := math.Sqrt(math.Max(0, 1-x*x-y*y))
+
+	var up Point3D
+	if math.Abs(n.Y) < 0.9 {
+		up = Point3D{X: 0, Y: 1, Z: 0}
+	} else {
+		up = Point3D{X: 1, Y: 0, Z: 0}
+	}
+	tangent := n.Cross(up).Normalize()
+	bitangent := n.Cross(tangent).Normalize()
+
+	return tangent.Mul(x).Add(bitangent.Mul(y)).Add(n.Mul(z)).Normalize()
+}
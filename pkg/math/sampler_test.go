@@ -0,0 +1,89 @@
+package math
+
+import "testing"
+
+// edgeVariance returns the variance of the estimated lit fraction of the unit
+// square behind a fixed diagonal shadow edge, over many independent trials of
+// n samples drawn by sample.
+func edgeVariance(n, trials int, sample func(trial, i int) (float64, float64)) float64 {
+	lit := func(u, v float64) bool { return u+0.35*v < 0.6 }
+	var sum, sumSq float64
+	for t := 0; t < trials; t++ {
+		hits := 0
+		for i := 0; i < n; i++ {
+			if lit(sample(t, i)) {
+				hits++
+			}
+		}
+		f := float64(hits) / float64(n)
+		sum += f
+		sumSq += f * f
+	}
+	mean := sum / float64(trials)
+	return sumSq/float64(trials) - mean*mean
+}
+
+func TestMultiJittered_LowerVariance(t *testing.T) {
+	const grid, trials = 3, 4000
+	prng := NewXorShift32(7)
+	random := edgeVariance(grid*grid, trials, func(_, _ int) (float64, float64) {
+		return prng.NextFloat64(), prng.NextFloat64()
+	})
+	jittered := edgeVariance(grid*grid, trials, func(_, i int) (float64, float64) {
+		return (float64(i%grid) + prng.NextFloat64()) / grid, (float64(i/grid) + prng.NextFloat64()) / grid
+	})
+	mj := edgeVariance(grid*grid, trials, func(trial, i int) (float64, float64) {
+		return MultiJittered(i, grid, grid, uint32(trial+1))
+	})
+	if !(mj < jittered && jittered < random) {
+		t.Errorf("variance: multi-jittered %.5f, jittered %.5f, random %.5f; want strictly decreasing from random", mj, jittered, random)
+	}
+}
+
+func TestMultiJittered_Stratified(t *testing.T) {
+	const m, n = 4, 3
+	cells := map[[2]int]bool{}
+	cols, rows := map[int]bool{}, map[int]bool{}
+	for s := 0; s < m*n; s++ {
+		x, y := MultiJittered(s, m, n, 12345)
+		if x < 0 || x >= 1 || y < 0 || y >= 1 {
+			t.Fatalf("sample %d = (%v, %v) outside the unit square", s, x, y)
+		}
+		cells[[2]int{int(x * m), int(y * n)}] = true
+		cols[int(x*m*n)] = true
+		rows[int(y*m*n)] = true
+	}
+	if len(cells) != m*n || len(cols) != m*n || len(rows) != m*n {
+		t.Errorf("got %d cells, %d columns, %d rows occupied; want %d of each", len(cells), len(cols), len(rows), m*n)
+	}
+}
+
+func TestBlueNoise(t *testing.T) {
+	seen := map[float64]bool{}
+	var diff float64
+	for y := 0; y < BlueNoiseSize; y++ {
+		for x := 0; x < BlueNoiseSize; x++ {
+			v := BlueNoise(x, y)
+			seen[v] = true
+			diff += abs(v - BlueNoise(x+1, y))
+		}
+	}
+	if len(seen) != BlueNoiseSize*BlueNoiseSize {
+		t.Errorf("tile has %d distinct values, want %d", len(seen), BlueNoiseSize*BlueNoiseSize)
+	}
+	if BlueNoise(-1, 3) != BlueNoise(BlueNoiseSize-1, 3+BlueNoiseSize) {
+		t.Error("tile does not wrap")
+	}
+	// White noise averages 1/3 between neighbours; blue noise has little
+	// low-frequency content, so neighbours differ more.
+	if mean := diff / (BlueNoiseSize * BlueNoiseSize); mean < 0.38 {
+		t.Errorf("mean neighbour difference %.3f, want well above white noise's 0.333", mean)
+	}
+}
+
+func abs(x float64) float64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
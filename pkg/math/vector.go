@@ -3,7 +3,11 @@ package math
 import "math"
 
 // Point3D represents a point in 3D space.
-type Point3D struct{ X, Y, Z float64 }
+type Point3D struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
 
 // Intersects checks if two AABBs overlap.
 func (a AABB3D) Intersects(b AABB3D) bool {
@@ -21,7 +25,11 @@ func (aabb AABB3D) GetCorners() [8]Point3D {
 }
 
 // Normal3D represents a normal vector in 3D space.
-type Normal3D struct{ X, Y, Z float64 }
+type Normal3D struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
 
 // Normalize returns a unit normal.
 func (n Normal3D) Normalize() Normal3D {
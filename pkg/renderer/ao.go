@@ -0,0 +1,160 @@
+package renderer
+
+import (
+	"bufio"
+	"fmt"
+	"grinder/pkg/math"
+	"grinder/pkg/shading"
+	gomath "math"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// defaultAOSamples is how many rays gather an atom's ambient occlusion when
+// BakeEngine.AOSamples is zero. They are stratified on a square grid.
+const defaultAOSamples = 16
+
+// bakedLeaf is a BLAS leaf of an uncompressed baked file: where its atoms
+// start and how many there are.
+type bakedLeaf struct {
+	offset int64
+	count  int
+}
+
+// allLeaves returns every BLAS leaf of an uncompressed scene, shape by shape.
+func (s *BakedScene) allLeaves() []bakedLeaf {
+	var out []bakedLeaf
+	all := func(lo, hi [3]float32) bool { return true }
+	s.walkNodes(all, func(node BLASNode) bool {
+		out = append(out, bakedLeaf{node.AtomOffset, int(node.AtomCount)})
+		return true
+	})
+	return out
+}
+
+// bakeAO traces every atom's ambient occlusion through the uncompressed
+// baked file at path and writes it into the atoms' AO bytes, leaf by leaf
+// on every CPU.
+func (e *BakeEngine) bakeAO(path string) error {
+	fmt.Printf("Baking ambient occlusion over radius %g...\n", e.AORadius)
+	scene, err := LoadBakedScene(path)
+	if err != nil {
+		return err
+	}
+	defer scene.Close()
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	samples := e.AOSamples
+	if samples <= 0 {
+		samples = defaultAOSamples
+	}
+	grid := max(1, int(gomath.Sqrt(float64(samples))))
+
+	leaves := scene.allLeaves()
+	jobs := make(chan int)
+	// Keep the first error; workers drain the remaining leaves regardless.
+	errs := make(chan error, 1)
+	fail := func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, 64*AtomSize)
+			for i := range jobs {
+				leaf := leaves[i]
+				atoms := buf[:leaf.count*AtomSize]
+				if _, err := f.ReadAt(atoms, leaf.offset); err != nil {
+					fail(err)
+					continue
+				}
+				for k := 0; k < leaf.count; k++ {
+					a := decodeBakedAtom(atoms[k*AtomSize:])
+					atoms[k*AtomSize+aoOffset] = scene.occlusion(a, e.AORadius, grid, uint32(i*64+k))
+				}
+				if _, err := f.WriteAt(atoms, leaf.offset); err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+	for i := range leaves {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// occlusion returns the share of grid×grid cosine-weighted rays from atom a
+// that travel radius without hitting an atom, scaled to 0-255. pattern
+// decorrelates the strata of neighbouring atoms.
+func (s *BakedScene) occlusion(a BakedAtom, radius float64, grid int, pattern uint32) uint8 {
+	pos := math.Point3D{X: float64(a.Pos[0]), Y: float64(a.Pos[1]), Z: float64(a.Pos[2])}
+	n := OctDecode(a.Normal)
+	// Start clear of the atom and its neighbours, as the tracer's rays do.
+	origin := pos.Add(n.Mul(shading.ShadowBias(pos, 2*float64(a.HalfExtent))))
+	open := 0
+	for i := 0; i < grid*grid; i++ {
+		u1, u2 := math.MultiJittered(i, grid, grid, pattern)
+		ray := math.Ray{Origin: origin, Direction: math.CosineHemisphere(n, u1, u2)}
+		hit, b := s.Intersect(ray)
+		if !hit {
+			open++
+			continue
+		}
+		if hitP := (math.Point3D{X: float64(b.Pos[0]), Y: float64(b.Pos[1]), Z: float64(b.Pos[2])}); hitP.Sub(origin).Length() > radius {
+			open++
+		}
+	}
+	return uint8(gomath.Round(255 * float64(open) / float64(grid*grid)))
+}
+
+// dumpAtoms writes every atom of the uncompressed baked file at path to
+// rawFile as a raw Pass A stream, so it can be indexed again.
+func dumpAtoms(path, rawFile string) error {
+	scene, err := LoadBakedScene(path)
+	if err != nil {
+		return err
+	}
+	defer scene.Close()
+	out, err := os.Create(rawFile)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	buf := make([]byte, 64*AtomSize)
+	for _, leaf := range scene.allLeaves() {
+		atoms, ok := scene.leafAtoms(BLASNode{AtomOffset: leaf.offset, AtomCount: int32(leaf.count)}, buf)
+		if !ok {
+			out.Close()
+			return fmt.Errorf("%s: leaf at %d out of range", path, leaf.offset)
+		}
+		w.Write(atoms)
+	}
+	if err := w.Flush(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// AtomAO returns atom a's ambient occlusion as a factor in [0, 1], or 1 when
+// the scene baked none.
+func (s *BakedScene) AtomAO(a BakedAtom) float64 {
+	if s.Header.AO != 1 {
+		return 1
+	}
+	return float64(a.AO) / 255
+}
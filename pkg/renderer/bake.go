@@ -1,6 +1,7 @@
 package renderer
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/binary"
 	"fmt"
@@ -10,10 +11,11 @@ import (
 	"grinder/pkg/shading"
 	"io"
 	gomath "math"
+	"math/bits"
 	"os"
-	"sort"
-	"unsafe"
+	"sync"
 
+	"github.com/klauspost/compress/zstd"
 	"golang.org/x/exp/mmap"
 )
 
@@ -26,7 +28,7 @@ type BakedAtom struct {
 	MaterialID uint8
 	LightDir   uint32
 	LightColor [3]uint8
-	Padding    uint8
+	AO         uint8 // Ambient occlusion, 255 = fully open; only set when Header.AO is 1
 }
 
 // TLASNode represents a node in the Top-Level Acceleration Structure.
@@ -58,6 +60,34 @@ type CameraData struct {
 	Far    float32
 }
 
+// A baked file holds a Header, then each shape's leaf atoms followed by its
+// BLAS nodes, then the TLAS. A compressed bake stores each leaf's atoms as
+// one zstd block and adds an AtomBlock table after the TLAS; the scene
+// document, if recorded, comes last.
+//
+// bakedVersion changes with every change to that layout, so the loader
+// rejects bakes it would misread rather than decoding them wrongly.
+// TestHeader_Layout pins the header size to the version.
+const (
+	bakedMagic   = "SDSB"
+	bakedVersion = 9
+	maxMaterials = 256 // one per possible BakedAtom.MaterialID
+)
+
+// BakedMaterial holds the shading parameters of one MaterialID. The atom's
+// own Albedo is multiplied by Tint at shade time.
+type BakedMaterial struct {
+	Tint      [3]float32
+	Roughness float32 // 0 = mirror, 1 = fully diffuse
+	Metalness float32
+	IOR       float32
+	Emission  [3]float32
+	Opacity   float32 // fraction of light stopped by shadow rays; 0 marks an unused slot
+	// Dispersion is the Abbe number of translucent glass, spreading IOR
+	// over the color channels; 0 disperses nothing.
+	Dispersion float32
+}
+
 // Header is the file header for the baked scene.
 type Header struct {
 	Magic      [4]byte
@@ -67,6 +97,32 @@ type Header struct {
 	BakeCamera CameraData
 	VoxelSize  float32
 	Epsilon    float32
+	Compressed uint32 // 1 = leaf atom blocks are zstd-compressed
+	BlockCount uint32 // Number of entries in the AtomBlock table
+	BlockTable int64  // Absolute file offset to the AtomBlock table, 0 if uncompressed
+	Materials  [maxMaterials]BakedMaterial
+	SceneMin   [3]float32 // Bounds of every atom including its half extent
+	SceneMax   [3]float32
+	// ViewIndependent is 1 when Pass A subdivided the scene's bounds in
+	// world space rather than the bake camera's view.
+	ViewIndependent uint32
+	// AO is 1 when every atom carries its ambient occlusion, gathered over
+	// AORadius, in BakedAtom.AO.
+	AO       uint32
+	AORadius float32
+	// SceneJSON is the absolute file offset of the zstd-compressed scene
+	// document the bake was made from, SceneJSONSize its compressed length.
+	// Both are 0 when the bake didn't record it.
+	SceneJSON     int64
+	SceneJSONSize int64
+}
+
+// AtomBlock describes one zstd-compressed BLAS leaf. The leaf's AtomOffset
+// points at Offset, and RawSize is the decompressed length in bytes.
+type AtomBlock struct {
+	Offset  int64
+	Size    int32
+	RawSize int32
 }
 
 type blasResult struct {
@@ -112,8 +168,75 @@ func sign(f float64) float64 {
 	return -1
 }
 
-func (a *BakedAtom) Write(w io.Writer) error { return binary.Write(w, binary.LittleEndian, a) }
-func (a *BakedAtom) Read(r io.Reader) error  { return binary.Read(r, binary.LittleEndian, a) }
+// bakeMaterial derives a shape's baked material. Shapes carry Phong
+// parameters, so roughness comes from the shininess exponent through the
+// usual Blinn-Phong to Beckmann mapping. Metals take their specular color as
+// tint, as far as they are metal; everything else is read off the shape's
+// decorators.
+func bakeMaterial(s geometry.Shape) BakedMaterial {
+	metalness := geometry.MetalnessOf(s)
+	spec := s.GetSpecularColor()
+	m := BakedMaterial{
+		Roughness:  float32(gomath.Min(1, gomath.Sqrt(2/(gomath.Max(0, s.GetShininess())+2)))),
+		Metalness:  float32(metalness),
+		IOR:        float32(geometry.IOROf(s)),
+		Opacity:    float32(geometry.OpacityOf(s)),
+		Dispersion: float32(geometry.DispersionOf(s)),
+	}
+	for c, v := range [3]uint8{spec.R, spec.G, spec.B} {
+		m.Tint[c] = float32(1 + metalness*(float64(v)/255-1))
+	}
+	if e, ok := geometry.EmissionOf(s); ok {
+		m.Emission = [3]float32{float32(e.X), float32(e.Y), float32(e.Z)}
+	}
+	return m
+}
+
+// AtomSize is the size in bytes of a BakedAtom in a baked file. Leaf
+// offsets and sizes are counted in it, so it must follow the struct:
+// TestAtomSize checks binary.Size(BakedAtom{}) against it.
+const AtomSize = 32
+
+// nodeSize is the size in bytes of a TLASNode or a BLASNode in a baked
+// file, in which child indices are counted. TestNodeSize checks it against
+// both structs.
+const nodeSize = 48
+
+// aoOffset is the byte offset of BakedAtom.AO within an encoded atom, where
+// bakeAO rewrites it in place. TestAtomSize checks it against the encoding.
+const aoOffset = 31
+
+// Write encodes a to w as binary.Write would, without its reflection.
+func (a *BakedAtom) Write(w io.Writer) error {
+	var buf [AtomSize]byte
+	_, err := w.Write(appendBakedAtom(buf[:0], a))
+	return err
+}
+
+func (a *BakedAtom) Read(r io.Reader) error { return binary.Read(r, binary.LittleEndian, a) }
+
+// appendBakedAtom appends a's little-endian encoding, laid out as
+// binary.Write lays out a BakedAtom, to dst. decodeBakedAtom reads it back.
+func appendBakedAtom(dst []byte, a *BakedAtom) []byte {
+	le := binary.LittleEndian
+	for _, p := range a.Pos {
+		dst = le.AppendUint32(dst, gomath.Float32bits(p))
+	}
+	dst = le.AppendUint32(dst, gomath.Float32bits(a.HalfExtent))
+	dst = le.AppendUint32(dst, a.Normal)
+	dst = append(dst, a.Albedo[0], a.Albedo[1], a.Albedo[2], a.MaterialID)
+	dst = le.AppendUint32(dst, a.LightDir)
+	return append(dst, a.LightColor[0], a.LightColor[1], a.LightColor[2], a.AO)
+}
+
+// appendBakedAtoms appends the encodings of atoms to dst, to write them in
+// one call.
+func appendBakedAtoms(dst []byte, atoms []BakedAtom) []byte {
+	for i := range atoms {
+		dst = appendBakedAtom(dst, &atoms[i])
+	}
+	return dst
+}
 
 type BakeEngine struct {
 	Camera   camera.Camera
@@ -124,22 +247,53 @@ type BakeEngine struct {
 	MinSize  float64
 	Near     float64
 	Far      float64
-	Shutter  float64
 	shapeIDs map[geometry.Shape]uint8
 
 	CamTarget math.Point3D
 	CamUp     math.Point3D
 	CamFov    float64
+
+	// Compress writes each BLAS leaf's atoms as a separate zstd block.
+	Compress bool
+	// PixelSize turns on the distance-aware bake. A voxel stops subdividing
+	// once it spans at most PixelSize pixels of the Width×Height bake view,
+	// so distant geometry bakes coarser atoms, or once it is MinSize across
+	// in world units. Zero keeps MinSize as a width in screen units.
+	PixelSize float64
+	// ViewIndependent subdivides the scene's bounds in world space instead
+	// of the camera's view, so surfaces the bake camera can't see are baked
+	// too. Voxels stop at MinSize in world units.
+	ViewIndependent bool
+	// Time is the shape time Pass A bakes, from 0 at the start of their
+	// motion to 1 at its end.
+	Time float64
+	// SortBudget caps the bytes of atoms held in RAM per sort run in Pass B.
+	// Zero uses defaultSortBudget.
+	SortBudget int64
+	// AORadius, if positive, has Pass B bake each atom's ambient occlusion:
+	// the share of AOSamples rays that leave it without hitting another atom
+	// within AORadius. Zero AOSamples uses defaultAOSamples.
+	AORadius  float64
+	AOSamples int
+	// SceneJSON, if set, is stored in the baked file so the scene's light,
+	// atmosphere and camera can be rebuilt from it (see BakedScene.SceneJSON).
+	SceneJSON []byte
 }
 
-func NewBakeEngine(cam camera.Camera, shapes []geometry.Shape, light shading.Light, width, height int, minSize, near, far, shutter float64, target, up math.Point3D, fov float64) *BakeEngine {
+func NewBakeEngine(cam camera.Camera, shapes []geometry.Shape, light shading.Light, width, height int, minSize, near, far float64, target, up math.Point3D, fov float64) *BakeEngine {
 	shapeIDs := make(map[geometry.Shape]uint8)
 	for i, s := range shapes {
 		shapeIDs[s] = uint8(i)
+		// The BVH holds instances rather than the instanced shape itself.
+		if is, ok := s.(*geometry.InstancedShape); ok {
+			for _, inst := range is.Instances() {
+				shapeIDs[inst] = uint8(i)
+			}
+		}
 	}
 	return &BakeEngine{
 		Camera: cam, Shapes: shapes, Light: light, Width: width, Height: height,
-		MinSize: minSize, Near: near, Far: far, Shutter: shutter,
+		MinSize: minSize, Near: near, Far: far,
 		shapeIDs: shapeIDs, CamTarget: target, CamUp: up, CamFov: fov,
 	}
 }
@@ -151,42 +305,204 @@ func (e *BakeEngine) Bake(tempFile string, finalFile string) error {
 		return err
 	}
 	defer f.Close()
-	initialAABB := math.AABB3D{Min: math.Point3D{X: 0, Y: 0, Z: e.Near}, Max: math.Point3D{X: 1, Y: 1, Z: e.Far}}
-	bvh := geometry.NewBVH(e.Shapes)
-	atomCount := int64(0)
-	e.subdivideBake(initialAABB, f, bvh, &atomCount)
+	w := bufio.NewWriterSize(f, bakeWriteBuffer)
+	var counts atomCounts
+	e.passA(w, &counts)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	atomCount := counts.total()
 	fmt.Printf("Pass A complete. Baked %d atoms.\n", atomCount)
 	return e.Indexer(tempFile, finalFile, atomCount)
 }
 
-func (e *BakeEngine) Indexer(tempFile string, finalFile string, totalAtoms int64) error {
-	fmt.Printf("Starting Pass B (The Indexer)... writing to %s\n", finalFile)
-	f, err := os.Open(tempFile)
+// DryRun runs Pass A without writing any atoms and returns how many the
+// bake would produce and the size of the uncompressed baked file.
+func (e *BakeEngine) DryRun() (atoms, size int64) {
+	var counts atomCounts
+	e.passA(nil, &counts)
+	return counts.total(), counts.bakedSize()
+}
+
+// BakeAtoms runs Pass A in memory and returns the raw atoms, such as one
+// frame of a baked sequence.
+func (e *BakeEngine) BakeAtoms() ([]BakedAtom, error) {
+	var buf bytes.Buffer
+	var counts atomCounts
+	e.passA(&buf, &counts)
+	atoms := make([]BakedAtom, counts.total())
+	if err := binary.Read(&buf, binary.LittleEndian, atoms); err != nil {
+		return nil, err
+	}
+	return atoms, nil
+}
+
+// IndexAtoms runs Pass B over atoms from BakeAtoms or a baked sequence,
+// writing them to tempFile first.
+func (e *BakeEngine) IndexAtoms(atoms []BakedAtom, tempFile, finalFile string) error {
+	f, err := os.Create(tempFile)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	atomsByShape := make(map[uint8][]BakedAtom)
-	for {
-		var atom BakedAtom
-		if err := atom.Read(f); err != nil {
-			if err == io.EOF {
-				break
-			}
-			return err
+	w := bufio.NewWriterSize(f, bakeWriteBuffer)
+	buf := make([]byte, 0, 1024*AtomSize)
+	for i := 0; i < len(atoms); i += 1024 {
+		w.Write(appendBakedAtoms(buf[:0], atoms[i:min(i+1024, len(atoms))]))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return e.Indexer(tempFile, finalFile, int64(len(atoms)))
+}
+
+// passA bakes the scene's atoms to w, in screen or world space.
+func (e *BakeEngine) passA(w io.Writer, counts *atomCounts) {
+	bvh := geometry.NewBVH(e.Shapes)
+	if e.ViewIndependent {
+		e.subdivideWorld(e.worldAABB(), w, bvh, counts)
+		return
+	}
+	e.subdivideBake(e.bakeAABB(), w, bvh, counts)
+}
+
+// bakeAABB is the screen-space volume Pass A subdivides.
+func (e *BakeEngine) bakeAABB() math.AABB3D {
+	return math.AABB3D{Min: math.Point3D{X: 0, Y: 0, Z: e.Near}, Max: math.Point3D{X: 1, Y: 1, Z: e.Far}}
+}
+
+// worldAABB is the cube a view-independent Pass A subdivides: the bounds
+// of the scene's finite shapes, padded by MinSize. Infinite planes are
+// baked clipped to it. A scene of only planes falls back to the camera's
+// view volume.
+func (e *BakeEngine) worldAABB() math.AABB3D {
+	var bounds math.AABB3D
+	found := false
+	for _, s := range e.Shapes {
+		b := s.GetAABB()
+		if !finiteAABB(b) {
+			continue
+		}
+		if !found {
+			bounds, found = b, true
+			continue
+		}
+		bounds = bounds.Expand(b.Min).Expand(b.Max)
+	}
+	if !found {
+		bounds = e.computeAABBWorld(e.bakeAABB())
+	}
+	// A cube keeps the voxels cubic.
+	c, size := bounds.Center(), bounds.Max.Sub(bounds.Min)
+	half := gomath.Max(size.X, gomath.Max(size.Y, size.Z))/2 + e.MinSize
+	r := math.Point3D{X: half, Y: half, Z: half}
+	return math.AABB3D{Min: c.Sub(r), Max: c.Add(r)}
+}
+
+func finiteAABB(b math.AABB3D) bool {
+	for _, v := range []float64{b.Min.X, b.Min.Y, b.Min.Z, b.Max.X, b.Max.Y, b.Max.Z} {
+		if gomath.IsInf(v, 0) || gomath.IsNaN(v) {
+			return false
 		}
-		atomsByShape[atom.MaterialID] = append(atomsByShape[atom.MaterialID], atom)
 	}
-	out, err := os.Create(finalFile)
+	return true
+}
+
+// atomCounts tallies the atoms Pass A bakes per MaterialID.
+type atomCounts [maxMaterials]int64
+
+func (c *atomCounts) total() int64 {
+	var n int64
+	for _, k := range c {
+		n += k
+	}
+	return n
+}
+
+// bakedSize returns the size of the uncompressed file the Indexer writes
+// for these atoms: the header, the atoms, each shape's BLAS and the TLAS
+// over the shapes.
+func (c *atomCounts) bakedSize() int64 {
+	size := int64(binary.Size(Header{}))
+	var shapes int64
+	for _, k := range c {
+		if k == 0 {
+			continue
+		}
+		shapes++
+		size += k*AtomSize + int64(len(buildBLAS(int(k))))*nodeSize
+	}
+	if shapes > 0 {
+		size += (2*shapes - 1) * nodeSize
+	}
+	return size
+}
+
+// Indexer runs Pass B: it sorts the raw atoms in tempFile per shape, builds
+// their BLAS and the TLAS over them into finalFile, and bakes ambient
+// occlusion when AORadius is set.
+func (e *BakeEngine) Indexer(tempFile string, finalFile string, totalAtoms int64) error {
+	if e.AORadius <= 0 {
+		return e.index(tempFile, finalFile, totalAtoms)
+	}
+	// Occlusion is traced through the built scene and patched into its
+	// atoms, which compressed leaves can't take in place: index plainly
+	// first, then index the occluded atoms again to compress them.
+	plain := *e
+	plain.Compress = false
+	if err := plain.index(tempFile, finalFile, totalAtoms); err != nil {
+		return err
+	}
+	if err := e.bakeAO(finalFile); err != nil {
+		return err
+	}
+	if !e.Compress {
+		return nil
+	}
+	if err := dumpAtoms(finalFile, tempFile); err != nil {
+		return err
+	}
+	return e.index(tempFile, finalFile, totalAtoms)
+}
+
+func (e *BakeEngine) index(tempFile string, finalFile string, totalAtoms int64) error {
+	fmt.Printf("Starting Pass B (The Indexer)... writing to %s\n", finalFile)
+	// Pass B.1: split the raw stream per shape so no pass holds every atom.
+	partitions, err := e.partitionAtoms(tempFile)
+	if err != nil {
+		return err
+	}
+	defer removePartitions(partitions)
+	f, err := os.Create(finalFile)
 	if err != nil {
 		return err
 	}
-	defer out.Close()
+	defer f.Close()
+	// Everything is written through one buffer, counting the offsets the
+	// nodes point at instead of seeking for them; only the header, whose
+	// offsets are known last, is rewritten in place.
+	out := &countingWriter{w: bufio.NewWriterSize(f, bakeWriteBuffer)}
 	header := Header{
-		Magic: [4]byte{'S', 'D', 'S', 'B'}, Version: 1, AtomCount: totalAtoms,
+		Version: bakedVersion, AtomCount: totalAtoms,
 		VoxelSize: float32(e.MinSize),
 		Epsilon:   float32(e.MinSize * 1.5),
 	}
+	copy(header.Magic[:], bakedMagic)
+	if e.ViewIndependent {
+		header.ViewIndependent = 1
+	}
+	if e.AORadius > 0 {
+		header.AO, header.AORadius = 1, float32(e.AORadius)
+	}
+	for i, shape := range e.Shapes {
+		if i == maxMaterials {
+			break
+		}
+		header.Materials[i] = bakeMaterial(shape)
+	}
 	eye := e.Camera.GetEye()
 	header.BakeCamera = CameraData{
 		Eye:    [3]float32{float32(eye.X), float32(eye.Y), float32(eye.Z)},
@@ -197,101 +513,161 @@ func (e *BakeEngine) Indexer(tempFile string, finalFile string, totalAtoms int64
 	}
 	binary.Write(out, binary.LittleEndian, header)
 
+	var enc *zstd.Encoder
+	if e.Compress {
+		enc, err = zstd.NewWriter(nil)
+		if err != nil {
+			return err
+		}
+		defer enc.Close()
+		header.Compressed = 1
+	}
+	var blocks []AtomBlock
+	var rawBytes, packedBytes int64
+
 	var blasResults []blasResult
-	for shapeID, atoms := range atomsByShape {
-		fmt.Printf("Building BLAS for Shape %d (%d atoms)...\n", shapeID, len(atoms))
-		nodes, sortedAtoms := e.buildBLAS(atoms)
-		atomStartOffset, _ := out.Seek(0, io.SeekCurrent)
-		for _, a := range sortedAtoms {
-			a.Write(out)
-		}
-		blasStartOffset, _ := out.Seek(0, io.SeekCurrent)
+	for _, part := range partitions {
+		fmt.Printf("Building BLAS for Shape %d (%d atoms)...\n", part.id, part.count)
+		// Pass B.2: Morton-sort the partition in bounded runs and stream the
+		// merged result straight into the BLAS leaves.
+		merger, err := e.sortPartition(part)
+		if err != nil {
+			return err
+		}
+		nodes := buildBLAS(int(part.count))
+		atomStartOffset := out.n
+		leaf := make([]BakedAtom, 0, 64)
+		raw := make([]byte, 0, 64*AtomSize)
 		for i := range nodes {
-			if nodes[i].AtomCount > 0 {
-				nodes[i].AtomOffset = atomStartOffset + int64(nodes[i].AtomOffset)
+			if nodes[i].AtomCount == 0 {
+				continue
+			}
+			leaf = leaf[:0]
+			for k := 0; k < int(nodes[i].AtomCount); k++ {
+				a, err := merger.Next()
+				if err != nil {
+					merger.Close()
+					return err
+				}
+				leaf = append(leaf, a)
+			}
+			nodes[i].Min, nodes[i].Max = atomBounds(leaf)
+			if enc != nil {
+				// One zstd block per leaf so the loader can decompress leaves independently.
+				raw = appendBakedAtoms(raw[:0], leaf)
+				packed := enc.EncodeAll(raw, nil)
+				blockOffset := out.n
+				out.Write(packed)
+				nodes[i].AtomOffset = blockOffset
+				blocks = append(blocks, AtomBlock{Offset: blockOffset, Size: int32(len(packed)), RawSize: int32(len(raw))})
+				rawBytes += int64(len(raw))
+				packedBytes += int64(len(packed))
+			} else {
+				raw = appendBakedAtoms(raw[:0], leaf)
+				out.Write(raw)
+				nodes[i].AtomOffset = atomStartOffset + nodes[i].AtomOffset
 			}
 		}
-		for _, n := range nodes {
-			binary.Write(out, binary.LittleEndian, n)
-		}
+		merger.Close()
+		fitBLASBounds(nodes)
+		blasStartOffset := out.n
+		binary.Write(out, binary.LittleEndian, nodes)
 		shapeAABB := math.AABB3D{
 			Min: math.Point3D{X: float64(nodes[0].Min[0]), Y: float64(nodes[0].Min[1]), Z: float64(nodes[0].Min[2])},
 			Max: math.Point3D{X: float64(nodes[0].Max[0]), Y: float64(nodes[0].Max[1]), Z: float64(nodes[0].Max[2])},
 		}
-		blasResults = append(blasResults, blasResult{shapeID: shapeID, rootOffset: blasStartOffset, aabb: shapeAABB})
+		blasResults = append(blasResults, blasResult{shapeID: part.id, rootOffset: blasStartOffset, aabb: shapeAABB})
+	}
+	if len(blasResults) > 0 {
+		bounds := blasResults[0].aabb
+		for _, br := range blasResults[1:] {
+			bounds = bounds.Expand(br.aabb.Min).Expand(br.aabb.Max)
+		}
+		// BLAS bounds already hold the atom boxes; the pad keeps the depth
+		// planes fitted to them clear of rounding.
+		pad := e.MinSize
+		header.SceneMin = [3]float32{float32(bounds.Min.X - pad), float32(bounds.Min.Y - pad), float32(bounds.Min.Z - pad)}
+		header.SceneMax = [3]float32{float32(bounds.Max.X + pad), float32(bounds.Max.Y + pad), float32(bounds.Max.Z + pad)}
 	}
 	tlasNodes := e.buildTLAS(blasResults)
-	tlasStartOffset, _ := out.Seek(0, io.SeekCurrent)
-	for _, n := range tlasNodes {
-		binary.Write(out, binary.LittleEndian, n)
+	header.TLASRoot = out.n
+	binary.Write(out, binary.LittleEndian, tlasNodes)
+	if enc != nil {
+		header.BlockTable = out.n
+		header.BlockCount = uint32(len(blocks))
+		binary.Write(out, binary.LittleEndian, blocks)
+	}
+	if len(e.SceneJSON) > 0 {
+		if header.SceneJSON, header.SceneJSONSize, err = writeSceneJSON(out, e.SceneJSON); err != nil {
+			return err
+		}
+	}
+	if err := out.w.Flush(); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := binary.Write(f, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	if enc != nil && packedBytes > 0 {
+		fmt.Printf("Compressed %d atom bytes into %d (%.2fx) across %d blocks.\n", rawBytes, packedBytes, float64(rawBytes)/float64(packedBytes), len(blocks))
 	}
-	header.TLASRoot = tlasStartOffset
-	out.Seek(0, io.SeekStart)
-	binary.Write(out, binary.LittleEndian, header)
 	fmt.Printf("Pass B complete. Final scene written to %s\n", finalFile)
 	return nil
 }
 
-func (e *BakeEngine) buildBLAS(atoms []BakedAtom) ([]BLASNode, []BakedAtom) {
-	if len(atoms) == 0 {
-		return nil, nil
-	}
-	minP, maxP := atoms[0].Pos, atoms[0].Pos
-	for _, a := range atoms {
-		for i := 0; i < 3; i++ {
-			if a.Pos[i] < minP[i] {
-				minP[i] = a.Pos[i]
-			}
-			if a.Pos[i] > maxP[i] {
-				maxP[i] = a.Pos[i]
-			}
-		}
-	}
-	sceneAABB := math.AABB3D{Min: math.Point3D{X: float64(minP[0]), Y: float64(minP[1]), Z: float64(minP[2])}, Max: math.Point3D{X: float64(maxP[0]), Y: float64(maxP[1]), Z: float64(maxP[2])}}
-	diag := sceneAABB.Max.Sub(sceneAABB.Min)
-	type atomWithCode struct {
-		atom BakedAtom
-		code uint32
+// writeSceneJSON appends the zstd-compressed scene document to out and
+// returns where it starts and its compressed length.
+func writeSceneJSON(out *countingWriter, doc []byte) (offset, size int64, err error) {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		return 0, 0, err
 	}
-	codedAtoms := make([]atomWithCode, len(atoms))
-	for i, a := range atoms {
-		nx, ny, nz := 0.5, 0.5, 0.5
-		if diag.X > 0 {
-			nx = (float64(a.Pos[0]) - sceneAABB.Min.X) / diag.X
-		}
-		if diag.Y > 0 {
-			ny = (float64(a.Pos[1]) - sceneAABB.Min.Y) / diag.Y
-		}
-		if diag.Z > 0 {
-			nz = (float64(a.Pos[2]) - sceneAABB.Min.Z) / diag.Z
-		}
-		codedAtoms[i] = atomWithCode{atom: a, code: math.Morton3D(nx, ny, nz)}
+	defer enc.Close()
+	packed := enc.EncodeAll(doc, nil)
+	offset = out.n
+	if _, err := out.Write(packed); err != nil {
+		return 0, 0, err
 	}
-	sort.Slice(codedAtoms, func(i, j int) bool { return codedAtoms[i].code < codedAtoms[j].code })
-	sortedAtoms := make([]BakedAtom, len(atoms))
-	for i, ca := range codedAtoms {
-		sortedAtoms[i] = ca.atom
+	return offset, int64(len(packed)), nil
+}
+
+// bakeWriteBuffer is the size of the buffers bake files are written
+// through, so millions of small atom and node writes make few syscalls.
+const bakeWriteBuffer = 1 << 20
+
+// countingWriter buffers writes to a file and counts the bytes written, so
+// the offset of each write is known without seeking, which would need the
+// buffer flushed first. The buffer keeps the first error, which Flush
+// returns.
+type countingWriter struct {
+	w *bufio.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// buildBLAS lays out the BLAS for count Morton-sorted atoms. Leaves hold at
+// most 64 atoms and appear in pre-order in the same order as their atoms, so
+// the caller can stream sorted atoms into them and then call fitBLASBounds.
+func buildBLAS(count int) []BLASNode {
+	if count == 0 {
+		return nil
 	}
 	var nodes []BLASNode
 	var build func(start, end int) int32
 	build = func(start, end int) int32 {
 		nodeIdx := int32(len(nodes))
 		nodes = append(nodes, BLASNode{Left: -1, Right: -1})
-		curMin, curMax := sortedAtoms[start].Pos, sortedAtoms[start].Pos
-		for i := start + 1; i < end; i++ {
-			for j := 0; j < 3; j++ {
-				if sortedAtoms[i].Pos[j] < curMin[j] {
-					curMin[j] = sortedAtoms[i].Pos[j]
-				}
-				if sortedAtoms[i].Pos[j] > curMax[j] {
-					curMax[j] = sortedAtoms[i].Pos[j]
-				}
-			}
-		}
-		nodes[nodeIdx].Min, nodes[nodeIdx].Max = curMin, curMax
 		count := end - start
 		if count <= 64 {
-			nodes[nodeIdx].AtomOffset = int64(start) * 32 // This is relative to atomStartOffset
+			nodes[nodeIdx].AtomOffset = int64(start) * AtomSize // This is relative to atomStartOffset
 			nodes[nodeIdx].AtomCount = int32(count)
 			return nodeIdx
 		}
@@ -300,8 +676,41 @@ func (e *BakeEngine) buildBLAS(atoms []BakedAtom) ([]BLASNode, []BakedAtom) {
 		nodes[nodeIdx].Left, nodes[nodeIdx].Right = l, r
 		return nodeIdx
 	}
-	build(0, len(sortedAtoms))
-	return nodes, sortedAtoms
+	build(0, count)
+	return nodes
+}
+
+// fitBLASBounds fills internal node bounds from their children. Children
+// always follow their parent in pre-order, so a reverse sweep is bottom-up.
+func fitBLASBounds(nodes []BLASNode) {
+	for i := len(nodes) - 1; i >= 0; i-- {
+		if nodes[i].AtomCount > 0 {
+			continue
+		}
+		l, r := nodes[nodes[i].Left], nodes[nodes[i].Right]
+		for j := 0; j < 3; j++ {
+			nodes[i].Min[j] = min(l.Min[j], r.Min[j])
+			nodes[i].Max[j] = max(l.Max[j], r.Max[j])
+		}
+	}
+}
+
+// atomBounds returns the bounds of the atoms' boxes as Intersect tests
+// them. Bounding only the centers lets a ray between two rows of atoms miss
+// the leaf while still crossing their boxes.
+func atomBounds(atoms []BakedAtom) (minP, maxP [3]float32) {
+	for i, a := range atoms {
+		r := a.HalfExtent * atomFatten
+		for j := 0; j < 3; j++ {
+			if i == 0 {
+				minP[j], maxP[j] = a.Pos[j]-r, a.Pos[j]+r
+				continue
+			}
+			minP[j] = min(minP[j], a.Pos[j]-r)
+			maxP[j] = max(maxP[j], a.Pos[j]+r)
+		}
+	}
+	return minP, maxP
 }
 
 func (e *BakeEngine) buildTLAS(blasInfos []blasResult) []TLASNode {
@@ -334,73 +743,130 @@ func (e *BakeEngine) buildTLAS(blasInfos []blasResult) []TLASNode {
 }
 
 func (e *BakeEngine) computeAABBWorld(aabb math.AABB3D) math.AABB3D {
-	corners := aabb.GetCorners()
-	first := true
-	var res math.AABB3D
-	for _, c := range corners {
-		p := e.Camera.Project(c.X, c.Y, c.Z)
-		if first {
-			res = math.AABB3D{Min: p, Max: p}
-			first = false
-		} else {
-			res = res.Expand(p)
-		}
+	return camera.Bounds(e.Camera, aabb)
+}
+
+// isLeaf reports whether subdivideBake should stop at aabb and bake atoms.
+// Cells are split in screen space, so a cell's width in pixels is its
+// projected size at any depth: a far cell of the same pixel width is wider
+// in the world and bakes a coarser atom.
+func (e *BakeEngine) isLeaf(aabb math.AABB3D) bool {
+	width := aabb.Max.X - aabb.Min.X
+	if e.PixelSize <= 0 {
+		return width < e.MinSize
 	}
-	return res
+	if width*float64(e.Width) <= e.PixelSize {
+		return true
+	}
+	// Close to the camera, stop at MinSize in the world instead.
+	cy, cz := (aabb.Min.Y+aabb.Max.Y)/2, (aabb.Min.Z+aabb.Max.Z)/2
+	return e.Camera.Project(aabb.Max.X, cy, cz).Sub(e.Camera.Project(aabb.Min.X, cy, cz)).Length() < e.MinSize
 }
 
-func (e *BakeEngine) subdivideBake(aabb math.AABB3D, w io.Writer, bvh *geometry.BVH, atomCount *int64) {
-	worldAABB := e.computeAABBWorld(aabb)
-	shapes := bvh.IntersectsShapes(worldAABB)
+// subdivideWorld is subdivideBake for a view-independent bake: aabb is a
+// world-space cell, split into octants until it is MinSize across.
+func (e *BakeEngine) subdivideWorld(aabb math.AABB3D, w io.Writer, bvh *geometry.BVH, counts *atomCounts) {
+	shapes := bvh.IntersectsShapes(aabb)
 	if len(shapes) == 0 {
 		return
 	}
-	if (aabb.Max.X - aabb.Min.X) < e.MinSize {
-		// Surface Pruning: discard if entirely inside a single solid shape.
-		// !IsVolumetric() identifies solid geometry (vs participating media),
-		// allowing us to hollow out the interior and keep only the shell.
-		if len(shapes) == 1 && !shapes[0].IsVolumetric() {
-			allInside := true
-			for _, c := range aabb.GetCorners() {
-				worldC := e.Camera.Project(c.X, c.Y, c.Z)
-				if !shapes[0].Contains(worldC, 0) {
-					allInside = false
-					break
-				}
-			}
-			if allInside {
-				return
+	if aabb.Max.X-aabb.Min.X < e.MinSize {
+		center := aabb.Center()
+		e.bakeCell(shapes, aabb.GetCorners(), center, aabb.Max.Sub(center).Length(), w, counts)
+		return
+	}
+	c := aabb.Center()
+	xs, ys, zs := [3]float64{aabb.Min.X, c.X, aabb.Max.X}, [3]float64{aabb.Min.Y, c.Y, aabb.Max.Y}, [3]float64{aabb.Min.Z, c.Z, aabb.Max.Z}
+	for zi := 0; zi < 2; zi++ {
+		for xi := 0; xi < 2; xi++ {
+			for yi := 0; yi < 2; yi++ {
+				e.subdivideWorld(math.AABB3D{Min: math.Point3D{X: xs[xi], Y: ys[yi], Z: zs[zi]}, Max: math.Point3D{X: xs[xi+1], Y: ys[yi+1], Z: zs[zi+1]}}, w, bvh, counts)
 			}
 		}
+	}
+}
 
-		center := aabb.Center()
-		worldP := e.Camera.Project(center.X, center.Y, center.Z)
-		for _, s := range shapes {
-			if s.Contains(worldP, 0) {
-				id, ok := e.shapeIDs[s]
-				if !ok {
-					continue
-				}
-				albedo, normal := s.GetColor(), s.NormalAtPoint(worldP, 0)
-				lightDir := e.Light.Position.Sub(worldP).Normalize()
-				//checkP := worldP.Add(normal.ToVector().Mul(1e-4))
-				//attenuation := shading.CalculateShadowAttenuation(checkP, e.Light.Position, e.Shapes, e.Light.Radius, 0)
-				//lIntensity := e.Light.Intensity * attenuation
-			lIntensity := e.Light.Intensity // we dont ever want to bake approximated shadows.
-			pCorner := e.Camera.Project(aabb.Max.X, aabb.Max.Y, aabb.Max.Z)
-			halfExtent := pCorner.Sub(worldP).Length()
+// bakeCell writes an atom at worldP for each of shapes that contains it or
+// whose surface crosses the cell. The cell has the given world-space
+// corners, and halfExtent reaches from worldP to the farthest of them.
+func (e *BakeEngine) bakeCell(shapes []geometry.Shape, corners [8]math.Point3D, worldP math.Point3D, halfExtent float64, w io.Writer, counts *atomCounts) {
+	for _, s := range shapes {
+		// Surface Pruning: skip a solid shape the cell is entirely inside,
+		// whichever other shapes share the cell. !IsVolumetric() identifies
+		// solid geometry (vs participating media), allowing us to hollow out
+		// the interior and keep only the shell, which glass needs to let
+		// rays through.
+		if !s.IsVolumetric() && e.fills(s, corners) {
+			continue
+		}
+		if s.Contains(worldP, e.Time) || e.straddles(s, corners) {
+			id, ok := e.shapeIDs[s]
+			if !ok {
+				continue
+			}
+			albedo, normal := s.GetColorAt(worldP, e.Time), s.NormalAtPoint(worldP, e.Time)
+			lightDir := e.Light.Position.Sub(worldP).Normalize()
+			//checkP := worldP.Add(normal.ToVector().Mul(1e-4))
+			//attenuation := shading.CalculateShadowAttenuation(checkP, e.Light.Position, e.Shapes, e.Light.Radius, 0)
+			//lIntensity := e.Light.Intensity * attenuation
+			lCol := e.Light.Radiance().Mul(e.Light.Falloff(e.Light.Position.Sub(worldP).Length())) // we dont ever want to bake approximated shadows.
+			lc := math.ClampColor(lCol.Mul(255))
 			atom := BakedAtom{
 				Pos:        [3]float32{float32(worldP.X), float32(worldP.Y), float32(worldP.Z)},
 				HalfExtent: float32(halfExtent),
 				Normal:     OctEncode(normal.ToVector()),
 				Albedo:     [3]uint8{albedo.R, albedo.G, albedo.B}, MaterialID: id,
 				LightDir:   OctEncode(lightDir),
-				LightColor: [3]uint8{uint8(gomath.Min(255, 255*lIntensity)), uint8(gomath.Min(255, 255*lIntensity)), uint8(gomath.Min(255, 255*lIntensity))},
+				LightColor: [3]uint8{lc.R, lc.G, lc.B},
 			}
-			atom.Write(w)
-			*atomCount++
+			if w != nil {
+				atom.Write(w)
 			}
+			counts[id]++
+		}
+	}
+}
+
+// fills reports whether every corner of the cell is inside s.
+func (e *BakeEngine) fills(s geometry.Shape, corners [8]math.Point3D) bool {
+	for _, c := range corners {
+		if !s.Contains(c, e.Time) {
+			return false
 		}
+	}
+	return true
+}
+
+// straddles reports whether the surface of s crosses the cell with the given
+// corners. Such a cell bakes an atom even if its center is outside s;
+// otherwise a ray could pass it and then a fully inside, pruned cell.
+func (e *BakeEngine) straddles(s geometry.Shape, corners [8]math.Point3D) bool {
+	in := 0
+	for _, c := range corners {
+		if s.Contains(c, e.Time) {
+			in++
+		}
+	}
+	return in > 0 && in < len(corners)
+}
+
+// subdivideBake writes the atoms of the shape surfaces inside aabb to w and
+// tallies them in counts. A nil w only counts them.
+func (e *BakeEngine) subdivideBake(aabb math.AABB3D, w io.Writer, bvh *geometry.BVH, counts *atomCounts) {
+	worldAABB := e.computeAABBWorld(aabb)
+	shapes := bvh.IntersectsShapes(worldAABB)
+	if len(shapes) == 0 {
+		return
+	}
+	if e.isLeaf(aabb) {
+		var corners [8]math.Point3D
+		for i, c := range aabb.GetCorners() {
+			corners[i] = e.Camera.Project(c.X, c.Y, c.Z)
+		}
+		center := aabb.Center()
+		worldP := e.Camera.Project(center.X, center.Y, center.Z)
+		pCorner := e.Camera.Project(aabb.Max.X, aabb.Max.Y, aabb.Max.Z)
+		e.bakeCell(shapes, corners, worldP, pCorner.Sub(worldP).Length(), w, counts)
 		return
 	}
 	mx, my, mz := (aabb.Min.X+aabb.Max.X)/2, (aabb.Min.Y+aabb.Max.Y)/2, (aabb.Min.Z+aabb.Max.Z)/2
@@ -408,43 +874,83 @@ func (e *BakeEngine) subdivideBake(aabb math.AABB3D, w io.Writer, bvh *geometry.
 	for zi := 0; zi < 2; zi++ {
 		for xi := 0; xi < 2; xi++ {
 			for yi := 0; yi < 2; yi++ {
-				e.subdivideBake(math.AABB3D{Min: math.Point3D{X: xs[xi], Y: ys[yi], Z: zs[zi]}, Max: math.Point3D{X: xs[xi+1], Y: ys[yi+1], Z: zs[zi+1]}}, w, bvh, atomCount)
+				e.subdivideBake(math.AABB3D{Min: math.Point3D{X: xs[xi], Y: ys[yi], Z: zs[zi]}, Max: math.Point3D{X: xs[xi+1], Y: ys[yi+1], Z: zs[zi+1]}}, w, bvh, counts)
 			}
 		}
 	}
 }
 
-func (e *BakeEngine) Verify(bakedFile string) error {
-	scene, err := LoadBakedScene(bakedFile)
+type BakedScene struct {
+	Header Header
+	Data   []byte         // Whole file for in-memory scenes, nil when memory-mapped
+	reader *mmap.ReaderAt // Set instead of Data for files at or above the memory limit
+	size   int64
+
+	// Compressed scenes only: the block table keyed by leaf AtomOffset, and
+	// the decompressed leaves, filled lazily on first access.
+	blocks map[int64]AtomBlock
+	dec    *zstd.Decoder
+	leaves sync.Map // int64 -> []byte
+
+	// Stats, if set, counts the nodes and atoms every query tests.
+	Stats *Stats
+}
+
+// FitDepthPlanes returns the tightest near/far range that still covers the
+// whole scene as seen from eye, with the same 10% margin as
+// Renderer.FitDepthPlanes. It returns false for an empty bake.
+func (h Header) FitDepthPlanes(eye math.Point3D) (near, far float64, ok bool) {
+	if h.AtomCount == 0 {
+		return 0, 0, false
+	}
+	lo := math.Point3D{X: float64(h.SceneMin[0]), Y: float64(h.SceneMin[1]), Z: float64(h.SceneMin[2])}
+	hi := math.Point3D{X: float64(h.SceneMax[0]), Y: float64(h.SceneMax[1]), Z: float64(h.SceneMax[2])}
+	// Closest point of the box to the eye; zero distance when inside it.
+	closest := math.Point3D{
+		X: gomath.Max(lo.X, gomath.Min(eye.X, hi.X)),
+		Y: gomath.Max(lo.Y, gomath.Min(eye.Y, hi.Y)),
+		Z: gomath.Max(lo.Z, gomath.Min(eye.Z, hi.Z)),
+	}
+	maxDist := 0.0
+	for _, c := range (math.AABB3D{Min: lo, Max: hi}).GetCorners() {
+		maxDist = gomath.Max(maxDist, c.Sub(eye).Length())
+	}
+	return gomath.Max(0.1, closest.Sub(eye).Length()*0.9), maxDist * 1.1, true
+}
+
+// SceneJSON returns the scene document the bake was made from, or nil if
+// the bake didn't record one.
+func (s *BakedScene) SceneJSON() ([]byte, error) {
+	if s.Header.SceneJSONSize == 0 {
+		return nil, nil
+	}
+	packed, err := s.bytesAt(s.Header.SceneJSON, make([]byte, s.Header.SceneJSONSize))
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to read scene document: %w", err)
 	}
-	defer scene.Close()
-	fmt.Printf("Verifying baked scene %s...\nAtoms: %d, TLASRoot offset: %d\n", bakedFile, scene.Header.AtomCount, scene.Header.TLASRoot)
-	for y := 0.4; y <= 0.6; y += 0.05 {
-		for x := 0.4; x <= 0.6; x += 0.05 {
-			pNear, pFar := e.Camera.Project(x, y, e.Near), e.Camera.Project(x, y, e.Far)
-			ray := math.Ray{Origin: pNear, Direction: pFar.Sub(pNear).Normalize()}
-			hit, atom := scene.Intersect(ray)
-			if hit {
-				fmt.Printf("Ray at (%.2f, %.2f): HIT shape %d at (%.2f, %.2f, %.2f)\n", x, y, atom.MaterialID, atom.Pos[0], atom.Pos[1], atom.Pos[2])
-			} else {
-				fmt.Printf("Ray at (%.2f, %.2f): MISS\n", x, y)
-			}
-		}
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	defer dec.Close()
+	doc, err := dec.DecodeAll(packed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress scene document: %w", err)
+	}
+	return doc, nil
 }
 
-type BakedScene struct {
-	Header Header
-	Data   []byte
-	closer io.Closer
+// Material returns the material table entry for an atom's MaterialID.
+func (s *BakedScene) Material(id uint8) BakedMaterial {
+	return s.Header.Materials[id]
 }
 
 func (s *BakedScene) Close() error {
-	if s.closer != nil {
-		return s.closer.Close()
+	if s.dec != nil {
+		s.dec.Close()
+	}
+	if s.reader != nil {
+		return s.reader.Close()
 	}
 	return nil
 }
@@ -467,48 +973,167 @@ func LoadBakedScene(filename string, memLimit ...int64) (*BakedScene, error) {
 	}
 	size := info.Size()
 
-	var data []byte
-	var closer io.Closer
-
+	scene := &BakedScene{size: size}
 	if size < limit {
-		data, err = os.ReadFile(filename)
+		scene.Data, err = os.ReadFile(filename)
 		if err != nil {
 			return nil, err
 		}
+		scene.size = int64(len(scene.Data))
 	} else {
 		r, err := mmap.Open(filename)
 		if err != nil {
 			return nil, err
 		}
-		closer = r
-		// Use unsafe to access the unexported data []byte field of mmap.ReaderAt.
-		// This provides the requested consistent []byte access portably.
-		data = *(*[]byte)(unsafe.Pointer(r))
+		scene.reader = r
+		scene.size = int64(r.Len())
 	}
 
-	if len(data) < 84 {
-		if closer != nil {
-			closer.Close()
-		}
-		return nil, fmt.Errorf("file too small")
+	headerSize := binary.Size(Header{})
+	if scene.size < int64(headerSize) {
+		scene.Close()
+		return nil, fmt.Errorf("%s: file too small for a baked scene header (%d bytes)", filename, scene.size)
 	}
 
+	data, err := scene.bytesAt(0, make([]byte, headerSize))
+	if err != nil {
+		scene.Close()
+		return nil, fmt.Errorf("%s: failed to read header: %w", filename, err)
+	}
 	var header Header
 	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &header); err != nil {
-		if closer != nil {
-			closer.Close()
-		}
+		scene.Close()
 		return nil, err
 	}
-	return &BakedScene{Header: header, Data: data, closer: closer}, nil
+	if err := header.validate(scene.size); err != nil {
+		scene.Close()
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	scene.Header = header
+	if header.Compressed == 1 {
+		if err := scene.loadBlockTable(); err != nil {
+			scene.Close()
+			return nil, err
+		}
+	}
+	return scene, nil
+}
+
+// validate checks that the header belongs to a baked scene this loader
+// understands and that the TLAS root lies inside a file of the given size.
+func (h Header) validate(size int64) error {
+	if string(h.Magic[:]) != bakedMagic {
+		return fmt.Errorf("bad magic %q, not a baked scene", h.Magic[:])
+	}
+	if h.Version != bakedVersion {
+		return fmt.Errorf("unsupported baked scene version %d (want %d)", h.Version, bakedVersion)
+	}
+	if h.SceneJSONSize < 0 || h.SceneJSONSize > 0 && (h.SceneJSON < int64(binary.Size(Header{})) || h.SceneJSON+h.SceneJSONSize > size) {
+		return fmt.Errorf("scene document at %d (%d bytes) out of range for %d byte file", h.SceneJSON, h.SceneJSONSize, size)
+	}
+	if h.AtomCount == 0 && h.TLASRoot == size-h.SceneJSONSize {
+		return nil // Empty bake: no TLAS nodes were written.
+	}
+	if h.TLASRoot < int64(binary.Size(Header{})) || h.TLASRoot+nodeSize > size {
+		return fmt.Errorf("TLAS root offset %d out of range for %d byte file", h.TLASRoot, size)
+	}
+	return nil
+}
+
+// loadBlockTable reads the AtomBlock table of a compressed scene. The blocks
+// themselves stay on disk (or in the mmap) until a ray first reaches them.
+func (s *BakedScene) loadBlockTable() error {
+	entrySize := int64(binary.Size(AtomBlock{}))
+	start, count := s.Header.BlockTable, int64(s.Header.BlockCount)
+	if start < 0 || start+count*entrySize > s.size {
+		return fmt.Errorf("block table out of range")
+	}
+	data, err := s.bytesAt(start, make([]byte, count*entrySize))
+	if err != nil {
+		return fmt.Errorf("failed to read block table: %w", err)
+	}
+	table := bytes.NewReader(data)
+	s.blocks = make(map[int64]AtomBlock, count)
+	for i := int64(0); i < count; i++ {
+		var b AtomBlock
+		if err := binary.Read(table, binary.LittleEndian, &b); err != nil {
+			return err
+		}
+		s.blocks[b.Offset] = b
+	}
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		return err
+	}
+	s.dec = dec
+	return nil
 }
 
+// bytesAt returns len(buf) bytes of the file starting at offset. In-memory
+// scenes return a sub-slice of Data; mapped scenes copy into buf via ReadAt
+// and fail if it comes up short, rather than hand back a partly stale buf.
+// The caller is responsible for bounds checking against s.size.
+func (s *BakedScene) bytesAt(offset int64, buf []byte) ([]byte, error) {
+	if s.Data != nil {
+		return s.Data[offset : offset+int64(len(buf))], nil
+	}
+	if n, err := s.reader.ReadAt(buf, offset); n < len(buf) {
+		return nil, fmt.Errorf("read %d of %d bytes at offset %d: %w", n, len(buf), offset, err)
+	}
+	return buf, nil
+}
+
+// leafAtoms returns the raw atom bytes of a BLAS leaf, decompressing and
+// caching the leaf's block on first access when the scene is compressed.
+// Mapped, uncompressed leaves are read into buf when it is large enough.
+func (s *BakedScene) leafAtoms(node BLASNode, buf []byte) ([]byte, bool) {
+	size := int64(node.AtomCount) * AtomSize
+	if s.blocks == nil {
+		if node.AtomOffset < 0 || node.AtomOffset+size > s.size {
+			return nil, false
+		}
+		if int64(len(buf)) < size {
+			buf = make([]byte, size)
+		}
+		atoms, err := s.bytesAt(node.AtomOffset, buf[:size])
+		return atoms, err == nil
+	}
+	if cached, ok := s.leaves.Load(node.AtomOffset); ok {
+		return cached.([]byte), true
+	}
+	b, ok := s.blocks[node.AtomOffset]
+	if !ok || b.Offset+int64(b.Size) > s.size {
+		return nil, false
+	}
+	packed, err := s.bytesAt(b.Offset, make([]byte, b.Size))
+	if err != nil {
+		return nil, false
+	}
+	raw, err := s.dec.DecodeAll(packed, make([]byte, 0, b.RawSize))
+	if err != nil || int64(len(raw)) < size {
+		return nil, false
+	}
+	actual, _ := s.leaves.LoadOrStore(node.AtomOffset, raw)
+	return actual.([]byte), true
+}
+
+// Intersect returns the nearest atom hit by ray. Baked atoms are static (any
+// motion blur was resolved at bake time), so ray.Time is ignored.
 func (s *BakedScene) Intersect(ray math.Ray) (bool, BakedAtom) {
-	return s.intersectTLAS(s.Header.TLASRoot, ray)
+	var tc traceCount
+	hit, atom := s.intersect(ray, &tc)
+	s.Stats.addTrace(tc)
+	return hit, atom
 }
 
-func (s *BakedScene) getTLASNode(offset int64) TLASNode {
-	data := s.Data[offset:]
+// getTLASNode decodes the TLAS node at offset, reporting false if it
+// couldn't be read.
+func (s *BakedScene) getTLASNode(offset int64) (TLASNode, bool) {
+	var buf [nodeSize]byte
+	data, err := s.bytesAt(offset, buf[:])
+	if err != nil {
+		return TLASNode{}, false
+	}
 	return TLASNode{
 		Min: [3]float32{
 			gomath.Float32frombits(binary.LittleEndian.Uint32(data[0:4])),
@@ -525,11 +1150,17 @@ func (s *BakedScene) getTLASNode(offset int64) TLASNode {
 		Left:       int32(binary.LittleEndian.Uint32(data[36:40])),
 		Right:      int32(binary.LittleEndian.Uint32(data[40:44])),
 		Padding:    int32(binary.LittleEndian.Uint32(data[44:48])),
-	}
+	}, true
 }
 
-func (s *BakedScene) getBLASNode(offset int64) BLASNode {
-	data := s.Data[offset:]
+// getBLASNode decodes the BLAS node at offset, reporting false if it
+// couldn't be read.
+func (s *BakedScene) getBLASNode(offset int64) (BLASNode, bool) {
+	var buf [nodeSize]byte
+	data, err := s.bytesAt(offset, buf[:])
+	if err != nil {
+		return BLASNode{}, false
+	}
 	return BLASNode{
 		Min: [3]float32{
 			gomath.Float32frombits(binary.LittleEndian.Uint32(data[0:4])),
@@ -546,11 +1177,10 @@ func (s *BakedScene) getBLASNode(offset int64) BLASNode {
 		Left:       int32(binary.LittleEndian.Uint32(data[36:40])),
 		Right:      int32(binary.LittleEndian.Uint32(data[40:44])),
 		Padding:    int32(binary.LittleEndian.Uint32(data[44:48])),
-	}
+	}, true
 }
 
-func (s *BakedScene) getBakedAtom(offset int64) BakedAtom {
-	data := s.Data[offset:]
+func decodeBakedAtom(data []byte) BakedAtom {
 	return BakedAtom{
 		Pos: [3]float32{
 			gomath.Float32frombits(binary.LittleEndian.Uint32(data[0:4])),
@@ -563,180 +1193,181 @@ func (s *BakedScene) getBakedAtom(offset int64) BakedAtom {
 		MaterialID: data[23],
 		LightDir:   binary.LittleEndian.Uint32(data[24:28]),
 		LightColor: [3]uint8{data[28], data[29], data[30]},
-		Padding:    data[31],
+		AO:         data[31],
 	}
 }
 
-func (s *BakedScene) intersectTLAS(offset int64, ray math.Ray) (bool, BakedAtom) {
-	if offset < 0 || offset+48 > int64(len(s.Data)) {
-		return false, BakedAtom{}
-	}
-	node := s.getTLASNode(offset)
-	aabb := math.AABB3D{Min: math.Point3D{X: float64(node.Min[0]), Y: float64(node.Min[1]), Z: float64(node.Min[2])}, Max: math.Point3D{X: float64(node.Max[0]), Y: float64(node.Max[1]), Z: float64(node.Max[2])}}
-	if _, _, ok := aabb.IntersectRay(ray); !ok {
-		return false, BakedAtom{}
-	}
-	if node.IsLeaf == 1 {
-		return s.intersectBLAS(node.BLASOffset, node.BLASOffset, ray)
-	}
-	var hitL, hitR bool
-	var atomL, atomR BakedAtom
-	if node.Left != -1 {
-		hitL, atomL = s.intersectTLAS(s.Header.TLASRoot+int64(node.Left)*48, ray)
-	}
-	if node.Right != -1 {
-		hitR, atomR = s.intersectTLAS(s.Header.TLASRoot+int64(node.Right)*48, ray)
+// walkNodes walks the TLAS and the BLAS of each shape it reaches, depth
+// first and left before right. enter gets the bounds of every node read and
+// says whether to descend into it; leaf gets every BLAS leaf entered and
+// returns false to stop the walk. Nodes outside the file or that can't be
+// read are skipped.
+func (s *BakedScene) walkNodes(enter func(lo, hi [3]float32) bool, leaf func(BLASNode) bool) {
+	var blas func(base, offset int64) bool
+	blas = func(base, offset int64) bool {
+		if offset < 0 || offset+nodeSize > s.size {
+			return true
+		}
+		node, ok := s.getBLASNode(offset)
+		if !ok || !enter(node.Min, node.Max) {
+			return true
+		}
+		if node.AtomCount > 0 {
+			return leaf(node)
+		}
+		if node.Left != -1 && !blas(base, base+int64(node.Left)*nodeSize) {
+			return false
+		}
+		return node.Right == -1 || blas(base, base+int64(node.Right)*nodeSize)
 	}
-	if hitL && hitR {
-		dL := math.Point3D{X: float64(atomL.Pos[0]), Y: float64(atomL.Pos[1]), Z: float64(atomL.Pos[2])}.Sub(ray.Origin).LengthSquared()
-		dR := math.Point3D{X: float64(atomR.Pos[0]), Y: float64(atomR.Pos[1]), Z: float64(atomR.Pos[2])}.Sub(ray.Origin).LengthSquared()
-		if dL < dR {
-			return true, atomL
-		} else {
-			return true, atomR
+	var tlas func(offset int64) bool
+	tlas = func(offset int64) bool {
+		if offset < 0 || offset+nodeSize > s.size {
+			return true
 		}
+		node, ok := s.getTLASNode(offset)
+		if !ok || !enter(node.Min, node.Max) {
+			return true
+		}
+		if node.IsLeaf == 1 {
+			return blas(node.BLASOffset, node.BLASOffset)
+		}
+		if node.Left != -1 && !tlas(s.Header.TLASRoot+int64(node.Left)*nodeSize) {
+			return false
+		}
+		return node.Right == -1 || tlas(s.Header.TLASRoot+int64(node.Right)*nodeSize)
 	}
-	if hitL {
-		return true, atomL
+	if s.Header.AtomCount > 0 {
+		tlas(s.Header.TLASRoot)
 	}
-	return hitR, atomR
 }
 
-func (s *BakedScene) intersectBLAS(baseOffset int64, offset int64, ray math.Ray) (bool, BakedAtom) {
-	if offset < 0 || offset+48 > int64(len(s.Data)) {
-		return false, BakedAtom{}
+// nodeBox returns a node's bounds as an AABB3D.
+func nodeBox(lo, hi [3]float32) math.AABB3D {
+	return math.AABB3D{
+		Min: math.Point3D{X: float64(lo[0]), Y: float64(lo[1]), Z: float64(lo[2])},
+		Max: math.Point3D{X: float64(hi[0]), Y: float64(hi[1]), Z: float64(hi[2])},
 	}
-	node := s.getBLASNode(offset)
-	aabb := math.AABB3D{Min: math.Point3D{X: float64(node.Min[0]), Y: float64(node.Min[1]), Z: float64(node.Min[2])}, Max: math.Point3D{X: float64(node.Max[0]), Y: float64(node.Max[1]), Z: float64(node.Max[2])}}
-	if _, _, ok := aabb.IntersectRay(ray); !ok {
-		return false, BakedAtom{}
+}
+
+// intersect returns the nearest atom hit by ray: the nearest by entry
+// distance within a leaf, and across leaves the one whose center is
+// nearest the ray's origin.
+func (s *BakedScene) intersect(ray math.Ray, tc *traceCount) (bool, BakedAtom) {
+	var buf [64 * AtomSize]byte
+	var nearest BakedAtom
+	found, nearestDist := false, 0.0
+	enter := func(lo, hi [3]float32) bool {
+		tc.nodes++
+		_, _, ok := nodeBox(lo, hi).IntersectRay(ray)
+		return ok
 	}
-	if node.AtomCount > 0 {
-		if node.AtomOffset < 0 || node.AtomOffset+int64(node.AtomCount)*32 > int64(len(s.Data)) {
-			return false, BakedAtom{}
+	s.walkNodes(enter, func(node BLASNode) bool {
+		atoms, ok := s.leafAtoms(node, buf[:])
+		if !ok {
+			return true
 		}
-		var nearest BakedAtom
-		found, minDist := false, 1e18
-		for i := 0; i < int(node.AtomCount); i++ {
-			atomOffset := node.AtomOffset + int64(i)*32
-			// Lazy Decoding: extract only Pos and HalfExtent (first 16 bytes) for the AABB check.
-			atomData := s.Data[atomOffset:]
-			posX := gomath.Float32frombits(binary.LittleEndian.Uint32(atomData[0:4]))
-			posY := gomath.Float32frombits(binary.LittleEndian.Uint32(atomData[4:8]))
-			posZ := gomath.Float32frombits(binary.LittleEndian.Uint32(atomData[8:12]))
-			halfExtent := gomath.Float32frombits(binary.LittleEndian.Uint32(atomData[12:16]))
-
-			// Fatten the AABB slightly to close cracks between atoms.
-			fatExtent := halfExtent * 1.01
-			atomAABB := math.AABB3D{
-				Min: math.Point3D{X: float64(posX - fatExtent), Y: float64(posY - fatExtent), Z: float64(posZ - fatExtent)},
-				Max: math.Point3D{X: float64(posX + fatExtent), Y: float64(posY + fatExtent), Z: float64(posZ + fatExtent)},
-			}
-			if tmin, _, ok := atomAABB.IntersectRay(ray); ok {
-				if tmin < minDist {
-					minDist = tmin
-					nearest = s.getBakedAtom(atomOffset)
-					found = true
+		var leafNearest BakedAtom
+		hit, minDist := false, 1e18
+		var boxes math.AABB4
+		for first := 0; first < int(node.AtomCount); first += 4 {
+			live := packAtomBoxes(atoms, first, int(node.AtomCount), &boxes)
+			tc.atoms += int64(bits.OnesCount8(live))
+			tmin, mask := boxes.IntersectRay(ray)
+			mask &= live
+			for i := 0; mask != 0; i, mask = i+1, mask>>1 {
+				if mask&1 != 0 && tmin[i] < minDist {
+					minDist = tmin[i]
+					leafNearest = decodeBakedAtom(atoms[(first+i)*AtomSize:])
+					hit = true
 				}
 			}
 		}
-		return found, nearest
-	}
-	var hitL, hitR bool
-	var atomL, atomR BakedAtom
-	if node.Left != -1 {
-		hitL, atomL = s.intersectBLAS(baseOffset, baseOffset+int64(node.Left)*48, ray)
-	}
-	if node.Right != -1 {
-		hitR, atomR = s.intersectBLAS(baseOffset, baseOffset+int64(node.Right)*48, ray)
-	}
-	if hitL && hitR {
-		dL := math.Point3D{X: float64(atomL.Pos[0]), Y: float64(atomL.Pos[1]), Z: float64(atomL.Pos[2])}.Sub(ray.Origin).LengthSquared()
-		dR := math.Point3D{X: float64(atomR.Pos[0]), Y: float64(atomR.Pos[1]), Z: float64(atomR.Pos[2])}.Sub(ray.Origin).LengthSquared()
-		if dL < dR {
-			return true, atomL
-		} else {
-			return true, atomR
+		if !hit {
+			return true
 		}
-	}
-	if hitL {
-		return true, atomL
-	}
-	return hitR, atomR
+		// Ties go to the later leaf.
+		d := math.Point3D{X: float64(leafNearest.Pos[0]), Y: float64(leafNearest.Pos[1]), Z: float64(leafNearest.Pos[2])}.Sub(ray.Origin).LengthSquared()
+		if !found || d <= nearestDist {
+			nearest, nearestDist, found = leafNearest, d, true
+		}
+		return true
+	})
+	return found, nearest
 }
 
-func (s *BakedScene) IntersectP(ray math.Ray) bool {
-	return s.intersectTLASP(s.Header.TLASRoot, ray)
+// atomFatten grows each atom's box slightly to close cracks between atoms.
+const atomFatten = 1.01
+
+// Bounds returns the atom's box as Intersect tests it, grown by atomFatten.
+func (a *BakedAtom) Bounds() math.AABB3D {
+	r := float64(a.HalfExtent * atomFatten)
+	c := math.Point3D{X: float64(a.Pos[0]), Y: float64(a.Pos[1]), Z: float64(a.Pos[2])}
+	return math.AABB3D{Min: c.Sub(math.Point3D{X: r, Y: r, Z: r}), Max: c.Add(math.Point3D{X: r, Y: r, Z: r})}
 }
 
-func (s *BakedScene) intersectTLASP(offset int64, ray math.Ray) bool {
-	if offset < 0 || offset+48 > int64(len(s.Data)) {
-		return false
-	}
-	node := s.getTLASNode(offset)
-	aabb := math.AABB3D{Min: math.Point3D{X: float64(node.Min[0]), Y: float64(node.Min[1]), Z: float64(node.Min[2])}, Max: math.Point3D{X: float64(node.Max[0]), Y: float64(node.Max[1]), Z: float64(node.Max[2])}}
-	if _, _, ok := aabb.IntersectRay(ray); !ok {
-		return false
-	}
-	if node.IsLeaf == 1 {
-		return s.intersectBLASP(node.BLASOffset, node.BLASOffset, ray)
-	}
-	if node.Left != -1 {
-		if s.intersectTLASP(s.Header.TLASRoot+int64(node.Left)*48, ray) {
-			return true
-		}
-	}
-	if node.Right != -1 {
-		if s.intersectTLASP(s.Header.TLASRoot+int64(node.Right)*48, ray) {
-			return true
-		}
+// packAtomBoxes loads the boxes of leaf atoms first..first+3 (of count) into
+// b and returns the mask of lanes holding a real atom. Only Pos and
+// HalfExtent, the first 16 bytes of each atom, are decoded.
+func packAtomBoxes(atoms []byte, first, count int, b *math.AABB4) uint8 {
+	var live uint8
+	for i := 0; i < 4 && first+i < count; i++ {
+		atomData := atoms[(first+i)*AtomSize:]
+		posX := gomath.Float32frombits(binary.LittleEndian.Uint32(atomData[0:4]))
+		posY := gomath.Float32frombits(binary.LittleEndian.Uint32(atomData[4:8]))
+		posZ := gomath.Float32frombits(binary.LittleEndian.Uint32(atomData[8:12]))
+		halfExtent := gomath.Float32frombits(binary.LittleEndian.Uint32(atomData[12:16]))
+
+		fatExtent := halfExtent * atomFatten
+		b.Set(i, math.AABB3D{
+			Min: math.Point3D{X: float64(posX - fatExtent), Y: float64(posY - fatExtent), Z: float64(posZ - fatExtent)},
+			Max: math.Point3D{X: float64(posX + fatExtent), Y: float64(posY + fatExtent), Z: float64(posZ + fatExtent)},
+		})
+		live |= 1 << i
 	}
-	return false
+	return live
 }
 
-func (s *BakedScene) intersectBLASP(baseOffset int64, offset int64, ray math.Ray) bool {
-	if offset < 0 || offset+48 > int64(len(s.Data)) {
-		return false
-	}
-	node := s.getBLASNode(offset)
-	aabb := math.AABB3D{Min: math.Point3D{X: float64(node.Min[0]), Y: float64(node.Min[1]), Z: float64(node.Min[2])}, Max: math.Point3D{X: float64(node.Max[0]), Y: float64(node.Max[1]), Z: float64(node.Max[2])}}
-	if _, _, ok := aabb.IntersectRay(ray); !ok {
-		return false
-	}
-	if node.AtomCount > 0 {
-		if node.AtomOffset < 0 || node.AtomOffset+int64(node.AtomCount)*32 > int64(len(s.Data)) {
-			return false
-		}
-		for i := 0; i < int(node.AtomCount); i++ {
-			atomOffset := node.AtomOffset + int64(i)*32
-			// Lazy Decoding: extract only Pos and HalfExtent (first 16 bytes) for the AABB check.
-			atomData := s.Data[atomOffset:]
-			posX := gomath.Float32frombits(binary.LittleEndian.Uint32(atomData[0:4]))
-			posY := gomath.Float32frombits(binary.LittleEndian.Uint32(atomData[4:8]))
-			posZ := gomath.Float32frombits(binary.LittleEndian.Uint32(atomData[8:12]))
-			halfExtent := gomath.Float32frombits(binary.LittleEndian.Uint32(atomData[12:16]))
-
-			// Fatten the AABB slightly to close cracks between atoms.
-			fatExtent := halfExtent * 1.01
-			atomAABB := math.AABB3D{
-				Min: math.Point3D{X: float64(posX - fatExtent), Y: float64(posY - fatExtent), Z: float64(posZ - fatExtent)},
-				Max: math.Point3D{X: float64(posX + fatExtent), Y: float64(posY + fatExtent), Z: float64(posZ + fatExtent)},
-			}
-			if _, _, ok := atomAABB.IntersectRay(ray); ok {
-				return true
-			}
-		}
-		return false
+// IntersectP reports whether ray hits any atom nearer than tMax along it,
+// for shadow rays: tMax is the distance to the light, so atoms past it
+// don't shadow. It stops at the first such atom rather than searching on
+// for the nearest, so it is cheaper than Intersect.
+func (s *BakedScene) IntersectP(ray math.Ray, tMax float64) bool {
+	var tc traceCount
+	hit := s.intersectP(ray, tMax, &tc)
+	s.Stats.addTrace(tc)
+	return hit
+}
+
+// intersectP reports whether ray hits any atom nearer than tMax, stopping
+// the walk at the first.
+func (s *BakedScene) intersectP(ray math.Ray, tMax float64, tc *traceCount) bool {
+	var buf [64 * AtomSize]byte
+	blocked := false
+	enter := func(lo, hi [3]float32) bool {
+		tc.nodes++
+		tmin, _, ok := nodeBox(lo, hi).IntersectRay(ray)
+		return ok && tmin <= tMax
 	}
-	if node.Left != -1 {
-		if s.intersectBLASP(baseOffset, baseOffset+int64(node.Left)*48, ray) {
+	s.walkNodes(enter, func(node BLASNode) bool {
+		atoms, ok := s.leafAtoms(node, buf[:])
+		if !ok {
 			return true
 		}
-	}
-	if node.Right != -1 {
-		if s.intersectBLASP(baseOffset, baseOffset+int64(node.Right)*48, ray) {
-			return true
+		var boxes math.AABB4
+		for first := 0; first < int(node.AtomCount); first += 4 {
+			live := packAtomBoxes(atoms, first, int(node.AtomCount), &boxes)
+			tc.atoms += int64(bits.OnesCount8(live))
+			tmin, mask := boxes.IntersectRay(ray)
+			mask &= live
+			for i := 0; mask != 0; i, mask = i+1, mask>>1 {
+				if mask&1 != 0 && tmin[i] <= tMax {
+					blocked = true
+					return false
+				}
+			}
 		}
-	}
-	return false
+		return true
+	})
+	return blocked
 }
@@ -0,0 +1,912 @@
+package renderer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"grinder/pkg/camera"
+	"grinder/pkg/geometry"
+	"grinder/pkg/math"
+	"grinder/pkg/shading"
+	"image/color"
+	gomath "math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestBakeEngine returns an engine for a single sphere in front of the camera.
+func newTestBakeEngine() *BakeEngine {
+	eye := math.Point3D{X: 0, Y: 0, Z: 5}
+	target := math.Point3D{X: 0, Y: 0, Z: 0}
+	up := math.Point3D{X: 0, Y: 1, Z: 0}
+	cam := camera.NewLookAtCamera(eye, target, up, 45, 1)
+	shapes := []geometry.Shape{
+		geometry.Sphere3D{Center: target, Radius: 1, Color: color.RGBA{R: 255, A: 255}},
+	}
+	light := shading.Light{Position: math.Point3D{X: 5, Y: 5, Z: 5}, Intensity: 1}
+	return NewBakeEngine(cam, shapes, light, 64, 64, 0.05, 3, 7, target, up, 45)
+}
+
+// bakeTestScene bakes the test sphere and returns the engine and the path of
+// the final baked file.
+func bakeTestScene(t testing.TB) (*BakeEngine, string) {
+	t.Helper()
+	dir := t.TempDir()
+	engine := newTestBakeEngine()
+	final := filepath.Join(dir, "final.bin")
+	if err := engine.Bake(filepath.Join(dir, "temp.bin"), final); err != nil {
+		t.Fatalf("Bake failed: %v", err)
+	}
+	return engine, final
+}
+
+// TestAtomSize checks that a BakedAtom serializes to AtomSize bytes, the
+// same ones whether binary.Write or appendBakedAtom encodes it, with its AO
+// at aoOffset, and that decodeBakedAtom reads them back.
+func TestAtomSize(t *testing.T) {
+	if got := binary.Size(BakedAtom{}); got != AtomSize {
+		t.Fatalf("binary.Size(BakedAtom{}) = %d, want AtomSize = %d", got, AtomSize)
+	}
+	a := BakedAtom{
+		Pos: [3]float32{1, -2, 3.5}, HalfExtent: 0.25, Normal: 0xdeadbeef,
+		Albedo: [3]uint8{1, 2, 3}, MaterialID: 4, LightDir: 0x01020304,
+		LightColor: [3]uint8{5, 6, 7}, AO: 8,
+	}
+	var want bytes.Buffer
+	binary.Write(&want, binary.LittleEndian, a)
+	got := appendBakedAtom(nil, &a)
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("appendBakedAtom = %x, binary.Write = %x", got, want.Bytes())
+	}
+	if back := decodeBakedAtom(got); back != a {
+		t.Errorf("decodeBakedAtom = %+v, want %+v", back, a)
+	}
+	if got[aoOffset] != a.AO {
+		t.Errorf("byte %d (aoOffset) = %d, want the AO %d", aoOffset, got[aoOffset], a.AO)
+	}
+}
+
+// TestNodeSize checks that TLAS and BLAS nodes serialize to nodeSize bytes.
+func TestNodeSize(t *testing.T) {
+	if got := binary.Size(TLASNode{}); got != nodeSize {
+		t.Errorf("binary.Size(TLASNode{}) = %d, want nodeSize = %d", got, nodeSize)
+	}
+	if got := binary.Size(BLASNode{}); got != nodeSize {
+		t.Errorf("binary.Size(BLASNode{}) = %d, want nodeSize = %d", got, nodeSize)
+	}
+}
+
+func TestLoadBakedScene_Valid(t *testing.T) {
+	engine, final := bakeTestScene(t)
+	scene, err := LoadBakedScene(final)
+	if err != nil {
+		t.Fatalf("LoadBakedScene failed: %v", err)
+	}
+	defer scene.Close()
+
+	pNear, pFar := engine.Camera.Project(0.45, 0.45, engine.Near), engine.Camera.Project(0.45, 0.45, engine.Far)
+	ray := math.Ray{Origin: pNear, Direction: pFar.Sub(pNear).Normalize()}
+	if hit, _ := scene.Intersect(ray); !hit {
+		t.Errorf("Expected ray to hit the baked sphere")
+	}
+}
+
+func TestLoadBakedScene_Truncated(t *testing.T) {
+	_, final := bakeTestScene(t)
+	data, err := os.ReadFile(final)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Header only: the TLAS root now points past the end of the file.
+	truncated := filepath.Join(t.TempDir(), "truncated.bin")
+	if err := os.WriteFile(truncated, data[:len(data)/2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadBakedScene(truncated); err == nil || !strings.Contains(err.Error(), "TLAS root") {
+		t.Errorf("Expected TLAS root range error, got %v", err)
+	}
+
+	// Shorter than the header itself.
+	tiny := filepath.Join(t.TempDir(), "tiny.bin")
+	if err := os.WriteFile(tiny, data[:10], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadBakedScene(tiny); err == nil || !strings.Contains(err.Error(), "too small") {
+		t.Errorf("Expected file too small error, got %v", err)
+	}
+}
+
+func TestLoadBakedScene_BadMagic(t *testing.T) {
+	_, final := bakeTestScene(t)
+	data, err := os.ReadFile(final)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(data, "XXXX")
+	corrupt := filepath.Join(t.TempDir(), "corrupt.bin")
+	if err := os.WriteFile(corrupt, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadBakedScene(corrupt); err == nil || !strings.Contains(err.Error(), "bad magic") {
+		t.Errorf("Expected bad magic error, got %v", err)
+	}
+}
+
+func TestLoadBakedScene_BadVersion(t *testing.T) {
+	_, final := bakeTestScene(t)
+	data, err := os.ReadFile(final)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[4] = bakedVersion + 1
+	newer := filepath.Join(t.TempDir(), "newer.bin")
+	if err := os.WriteFile(newer, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadBakedScene(newer); err == nil || !strings.Contains(err.Error(), "version") {
+		t.Errorf("Expected unsupported version error, got %v", err)
+	}
+}
+
+func TestLoadBakedScene_Mapped(t *testing.T) {
+	engine, final := bakeTestScene(t)
+	inMemory, err := LoadBakedScene(final)
+	if err != nil {
+		t.Fatalf("LoadBakedScene failed: %v", err)
+	}
+	defer inMemory.Close()
+
+	// A 1 byte limit forces every file through the mmap path.
+	mapped, err := LoadBakedScene(final, 1)
+	if err != nil {
+		t.Fatalf("LoadBakedScene (mapped) failed: %v", err)
+	}
+	defer mapped.Close()
+	if mapped.Data != nil {
+		t.Fatal("Expected mapped scene to have no in-memory Data")
+	}
+
+	hits := 0
+	for y := 0.3; y <= 0.7; y += 0.05 {
+		for x := 0.3; x <= 0.7; x += 0.05 {
+			pNear, pFar := engine.Camera.Project(x, y, engine.Near), engine.Camera.Project(x, y, engine.Far)
+			ray := math.Ray{Origin: pNear, Direction: pFar.Sub(pNear).Normalize()}
+			hitA, atomA := inMemory.Intersect(ray)
+			hitB, atomB := mapped.Intersect(ray)
+			if hitA != hitB || atomA != atomB {
+				t.Errorf("Ray at (%.2f, %.2f): in-memory (%v, %v) != mapped (%v, %v)", x, y, hitA, atomA, hitB, atomB)
+			}
+			if hitB {
+				hits++
+			}
+			if mapped.IntersectP(ray, gomath.Inf(1)) != hitB {
+				t.Errorf("Ray at (%.2f, %.2f): IntersectP disagrees with Intersect", x, y)
+			}
+		}
+	}
+	if hits == 0 {
+		t.Error("Expected some rays to hit the mapped scene")
+	}
+}
+
+// TestBakedScene_IntersectP casts shadow rays at lights around the baked
+// sphere: the sphere blocks a light beyond it, but neither a light beside it
+// nor one short of it, with the sphere behind the light.
+func TestBakedScene_IntersectP(t *testing.T) {
+	_, final := bakeTestScene(t)
+	scene, err := LoadBakedScene(final)
+	if err != nil {
+		t.Fatalf("LoadBakedScene failed: %v", err)
+	}
+	defer scene.Close()
+
+	tests := []struct {
+		name        string
+		from, light math.Point3D
+		blocked     bool
+	}{
+		{"sphere between", math.Point3D{X: 0, Y: 0, Z: -3}, math.Point3D{X: 0, Y: 0, Z: 5}, true},
+		{"sphere beside", math.Point3D{X: 3, Y: 0, Z: -3}, math.Point3D{X: 0, Y: 0, Z: 5}, false},
+		{"sphere behind the light", math.Point3D{X: 0, Y: 0, Z: -5}, math.Point3D{X: 0, Y: 0, Z: -2}, false},
+	}
+	for _, tt := range tests {
+		toLight := tt.light.Sub(tt.from)
+		ray := math.Ray{Origin: tt.from, Direction: toLight.Normalize()}
+		if got := scene.IntersectP(ray, toLight.Length()); got != tt.blocked {
+			t.Errorf("%s: IntersectP = %v, want %v", tt.name, got, tt.blocked)
+		}
+	}
+	// Unbounded, the same ray does hit the sphere behind the light.
+	ray := math.Ray{Origin: math.Point3D{X: 0, Y: 0, Z: -5}, Direction: math.Point3D{X: 0, Y: 0, Z: 1}}
+	if !scene.IntersectP(ray, gomath.Inf(1)) {
+		t.Error("IntersectP with no far limit missed the sphere")
+	}
+}
+
+// TestLoadBakedScene_Compressed bakes the test scene plain and compressed:
+// the compressed file must be smaller, decompress no leaf until a ray
+// reaches it, and give every ray the same hit as the plain one, loaded into
+// memory or mapped.
+func TestLoadBakedScene_Compressed(t *testing.T) {
+	engine, plainFile := bakeTestScene(t)
+	dir := t.TempDir()
+	compressedFile := filepath.Join(dir, "compressed.bin")
+	engine.Compress = true
+	if err := engine.Bake(filepath.Join(dir, "temp.bin"), compressedFile); err != nil {
+		t.Fatalf("Bake (compressed) failed: %v", err)
+	}
+	plainInfo, _ := os.Stat(plainFile)
+	compressedInfo, _ := os.Stat(compressedFile)
+	if compressedInfo.Size() >= plainInfo.Size() {
+		t.Errorf("compressed bake is %d bytes, plain %d", compressedInfo.Size(), plainInfo.Size())
+	}
+
+	plain, err := LoadBakedScene(plainFile)
+	if err != nil {
+		t.Fatalf("LoadBakedScene failed: %v", err)
+	}
+	defer plain.Close()
+	for _, memLimit := range []int64{1 << 40, 1} {
+		compressed, err := LoadBakedScene(compressedFile, memLimit)
+		if err != nil {
+			t.Fatalf("LoadBakedScene (compressed, limit %d) failed: %v", memLimit, err)
+		}
+		defer compressed.Close()
+		if compressed.Header.Compressed != 1 || compressed.Header.BlockCount == 0 {
+			t.Fatalf("header records Compressed = %d with %d blocks", compressed.Header.Compressed, compressed.Header.BlockCount)
+		}
+		decoded := func() (n int) {
+			compressed.leaves.Range(func(_, _ any) bool { n++; return true })
+			return n
+		}
+		if n := decoded(); n != 0 {
+			t.Errorf("%d leaves decompressed before any ray", n)
+		}
+
+		hits := 0
+		for y := 0.3; y <= 0.7; y += 0.05 {
+			for x := 0.3; x <= 0.7; x += 0.05 {
+				pNear, pFar := engine.Camera.Project(x, y, engine.Near), engine.Camera.Project(x, y, engine.Far)
+				ray := math.Ray{Origin: pNear, Direction: pFar.Sub(pNear).Normalize()}
+				hitA, atomA := plain.Intersect(ray)
+				hitB, atomB := compressed.Intersect(ray)
+				if hitA != hitB || atomA != atomB {
+					t.Errorf("limit %d, ray at (%.2f, %.2f): plain (%v, %v) != compressed (%v, %v)", memLimit, x, y, hitA, atomA, hitB, atomB)
+				}
+				if compressed.IntersectP(ray, gomath.Inf(1)) != hitA {
+					t.Errorf("limit %d, ray at (%.2f, %.2f): compressed IntersectP disagrees with plain Intersect", memLimit, x, y)
+				}
+				if hitA {
+					hits++
+				}
+			}
+		}
+		if hits == 0 {
+			t.Error("Expected some rays to hit the scene")
+		}
+		if n := decoded(); n == 0 || n > int(compressed.Header.BlockCount) {
+			t.Errorf("%d leaves decompressed of %d blocks", n, compressed.Header.BlockCount)
+		}
+	}
+}
+
+// TestHeader_Layout fails when the header changes size without the format
+// version changing with it: bump bakedVersion and update both numbers here.
+func TestHeader_Layout(t *testing.T) {
+	const version, size = 9, 11416
+	if bakedVersion != version || binary.Size(Header{}) != size {
+		t.Errorf("header is version %d, %d bytes; pinned as version %d, %d bytes", bakedVersion, binary.Size(Header{}), version, size)
+	}
+}
+
+// TestLoadBakedScene_MappedShortRead checks that a read running past the
+// end of a mapped file fails rather than decoding a zeroed buffer, and that
+// a ray reaching such a node misses.
+func TestLoadBakedScene_MappedShortRead(t *testing.T) {
+	_, final := bakeTestScene(t)
+	mapped, err := LoadBakedScene(final, 1)
+	if err != nil {
+		t.Fatalf("LoadBakedScene (mapped) failed: %v", err)
+	}
+	defer mapped.Close()
+
+	end := mapped.size
+	if _, err := mapped.bytesAt(end-8, make([]byte, 48)); err == nil {
+		t.Error("bytesAt past the end of the file returned no error")
+	}
+	// Pretend the file is longer than it is, with the root past its end.
+	mapped.size += 1024
+	mapped.Header.TLASRoot = end - 8
+	ray := math.Ray{Origin: math.Point3D{Z: 5}, Direction: math.Point3D{Z: -1}}
+	if hit, _ := mapped.Intersect(ray); hit {
+		t.Error("Intersect hit through a node that couldn't be read")
+	}
+	if mapped.IntersectP(ray, gomath.Inf(1)) {
+		t.Error("IntersectP hit through a node that couldn't be read")
+	}
+}
+
+func TestIndexer_SmallSortBudget(t *testing.T) {
+	dir := t.TempDir()
+	engine := newTestBakeEngine()
+	inMemory := filepath.Join(dir, "in_memory.bin")
+	if err := engine.Bake(filepath.Join(dir, "temp.bin"), inMemory); err != nil {
+		t.Fatalf("Bake failed: %v", err)
+	}
+
+	// 50 atoms per run forces the partition through many runs and a k-way merge.
+	engine.SortBudget = 50 * AtomSize
+	external := filepath.Join(dir, "external.bin")
+	if err := engine.Bake(filepath.Join(dir, "temp.bin"), external); err != nil {
+		t.Fatalf("Bake with small sort budget failed: %v", err)
+	}
+
+	a, err := os.ReadFile(inMemory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(external)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scene, err := LoadBakedScene(external)
+	if err != nil {
+		t.Fatalf("LoadBakedScene failed: %v", err)
+	}
+	defer scene.Close()
+	if scene.Header.AtomCount <= 50 {
+		t.Fatalf("Expected more atoms than the sort budget, got %d", scene.Header.AtomCount)
+	}
+	if !bytes.Equal(a, b) {
+		t.Error("Expected external sort to produce a byte-identical baked file")
+	}
+
+	leftovers, _ := filepath.Glob(filepath.Join(dir, "temp.bin.*"))
+	if len(leftovers) != 0 {
+		t.Errorf("Expected partition and run files to be removed, found %v", leftovers)
+	}
+}
+
+// TestIndexer_ErrorRemovesPartitions fails Pass B once while partitioning,
+// on a Pass A file cut off mid-atom, and once after it, on a final file
+// that can't be created: neither may leave partition files behind.
+func TestIndexer_ErrorRemovesPartitions(t *testing.T) {
+	engine := newTestBakeEngine()
+	atoms := []BakedAtom{{MaterialID: 0}, {MaterialID: 1}, {MaterialID: 0}}
+
+	dir := t.TempDir()
+	temp := filepath.Join(dir, "temp.bin")
+	var raw []byte
+	raw = appendBakedAtoms(raw, atoms)
+	if err := os.WriteFile(temp, raw[:len(raw)-5], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Indexer(temp, filepath.Join(dir, "final.bin"), int64(len(atoms))); err == nil {
+		t.Error("Expected an error indexing a truncated Pass A file")
+	}
+	if leftovers, _ := filepath.Glob(temp + ".*"); len(leftovers) != 0 {
+		t.Errorf("Expected partition files to be removed after a partitioning error, found %v", leftovers)
+	}
+
+	missing := filepath.Join(dir, "missing", "final.bin")
+	if err := engine.IndexAtoms(atoms, temp, missing); err == nil {
+		t.Error("Expected an error writing to a missing directory")
+	}
+	if leftovers, _ := filepath.Glob(temp + ".*"); len(leftovers) != 0 {
+		t.Errorf("Expected partition files to be removed after a write error, found %v", leftovers)
+	}
+}
+
+// TestBakeEngine_DryRun checks the dry run's atom count and file size
+// against a real bake of a scene with more than one shape.
+func TestBakeEngine_DryRun(t *testing.T) {
+	eye, target, up := math.Point3D{Z: 5}, math.Point3D{}, math.Point3D{Y: 1}
+	cam := camera.NewLookAtCamera(eye, target, up, 45, 1)
+	shapes := []geometry.Shape{
+		geometry.Sphere3D{Center: target, Radius: 1, Color: color.RGBA{R: 255, A: 255}},
+		geometry.Sphere3D{Center: math.Point3D{X: 1.2, Y: 0.8}, Radius: 0.5, Color: color.RGBA{G: 255, A: 255}},
+	}
+	light := shading.Light{Position: math.Point3D{X: 5, Y: 5, Z: 5}, Intensity: 1}
+	engine := NewBakeEngine(cam, shapes, light, 64, 64, 0.05, 3, 7, target, up, 45)
+	atoms, size := engine.DryRun()
+
+	dir := t.TempDir()
+	final := filepath.Join(dir, "final.bin")
+	if err := engine.Bake(filepath.Join(dir, "temp.bin"), final); err != nil {
+		t.Fatalf("Bake failed: %v", err)
+	}
+	scene, err := LoadBakedScene(final)
+	if err != nil {
+		t.Fatalf("LoadBakedScene failed: %v", err)
+	}
+	defer scene.Close()
+	if atoms == 0 || atoms != scene.Header.AtomCount {
+		t.Errorf("DryRun counted %d atoms, the bake wrote %d", atoms, scene.Header.AtomCount)
+	}
+	info, err := os.Stat(final)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != info.Size() {
+		t.Errorf("DryRun estimated %d bytes, the bake wrote %d", size, info.Size())
+	}
+}
+
+// TestBakeEngine_HollowBesideOtherShapes bakes a glass sphere resting on a
+// plane. Cells inside the sphere also overlap the plane's bounds, but must
+// still be pruned, so a ray from the sphere's center only finds the shell.
+func TestBakeEngine_HollowBesideOtherShapes(t *testing.T) {
+	eye, target, up := math.Point3D{Z: 5}, math.Point3D{}, math.Point3D{Y: 1}
+	cam := camera.NewLookAtCamera(eye, target, up, 45, 1)
+	glass := geometry.Translucent{Shape: geometry.Sphere3D{Radius: 1, Color: color.RGBA{R: 255, G: 255, B: 255, A: 255}}, Opacity: 0.1, Dispersion: 30}
+	shapes := []geometry.Shape{
+		glass,
+		geometry.Plane3D{Point: math.Point3D{Y: -1}, Normal: math.Normal3D{Y: 1}, Color: color.RGBA{G: 255, A: 255}},
+	}
+	engine := NewBakeEngine(cam, shapes, shading.Light{}, 64, 64, 0.05, 3, 7, target, up, 45)
+	dir := t.TempDir()
+	final := filepath.Join(dir, "final.bin")
+	if err := engine.Bake(filepath.Join(dir, "temp.bin"), final); err != nil {
+		t.Fatalf("Bake failed: %v", err)
+	}
+	scene, err := LoadBakedScene(final)
+	if err != nil {
+		t.Fatalf("LoadBakedScene failed: %v", err)
+	}
+	defer scene.Close()
+
+	if m := scene.Material(0); m.Dispersion != 30 || m.Opacity != 0.1 {
+		t.Errorf("glass material = %+v, want opacity 0.1 and dispersion 30", m)
+	}
+	for _, d := range []math.Point3D{{Z: 1}, {X: 1}, {Y: -1}, {X: 0.6, Y: -0.8}} {
+		hit, atom := scene.Intersect(math.Ray{Direction: d})
+		if !hit {
+			t.Errorf("ray from the center along %v left the sphere without hitting its shell", d)
+			continue
+		}
+		if r := (math.Point3D{X: float64(atom.Pos[0]), Y: float64(atom.Pos[1]), Z: float64(atom.Pos[2])}).Length(); r < 0.7 {
+			t.Errorf("ray from the center along %v hit an atom %v from it, inside the shell", d, r)
+		}
+	}
+}
+
+// TestBakeEngine_PixelSize bakes the same sphere near and far from the
+// camera with the distance-aware stop: the far one must bake fewer, coarser
+// atoms.
+func TestBakeEngine_PixelSize(t *testing.T) {
+	eye, target, up := math.Point3D{}, math.Point3D{Z: -1}, math.Point3D{Y: 1}
+	cam := camera.NewLookAtCamera(eye, target, up, 45, 1)
+	light := shading.Light{Position: math.Point3D{Y: 5}, Intensity: 1}
+	bake := func(dist float64) (int64, float32) {
+		sphere := geometry.Sphere3D{Center: math.Point3D{Z: -dist}, Radius: 1, Color: color.RGBA{R: 255, A: 255}}
+		engine := NewBakeEngine(cam, []geometry.Shape{sphere}, light, 128, 128, 0.05, 2, 24, target, up, 45)
+		engine.PixelSize = 4
+		var buf bytes.Buffer
+		var counts atomCounts
+		engine.subdivideBake(engine.bakeAABB(), &buf, geometry.NewBVH(engine.Shapes), &counts)
+		var largest float32
+		for buf.Len() > 0 {
+			var a BakedAtom
+			if err := a.Read(&buf); err != nil {
+				t.Fatal(err)
+			}
+			largest = max(largest, a.HalfExtent)
+		}
+		return counts.total(), largest
+	}
+	nearAtoms, nearExtent := bake(4)
+	farAtoms, farExtent := bake(20)
+	if farAtoms == 0 || farAtoms >= nearAtoms {
+		t.Errorf("far sphere baked %d atoms, near sphere %d; want fewer but some", farAtoms, nearAtoms)
+	}
+	if farExtent <= nearExtent {
+		t.Errorf("far sphere's largest atom half extent %v, near sphere's %v; want coarser", farExtent, nearExtent)
+	}
+}
+
+// TestBakeEngine_ViewIndependent bakes a sphere in view of a camera on +Z
+// and a second one off to its side, then looks at the second one from +X,
+// turned 90 degrees from the bake camera. Only a view-independent bake has
+// it.
+func TestBakeEngine_ViewIndependent(t *testing.T) {
+	eye, target, up := math.Point3D{Z: 5}, math.Point3D{}, math.Point3D{Y: 1}
+	cam := camera.NewLookAtCamera(eye, target, up, 45, 1)
+	side := geometry.Sphere3D{Center: math.Point3D{X: 3}, Radius: 0.5, Color: color.RGBA{G: 255, A: 255}}
+	shapes := []geometry.Shape{
+		geometry.Sphere3D{Center: target, Radius: 1, Color: color.RGBA{R: 255, A: 255}},
+		side,
+	}
+	light := shading.Light{Position: math.Point3D{X: 5, Y: 5, Z: 5}, Intensity: 1}
+
+	// sideHits bakes the scene and counts the rays from +X through the side
+	// sphere's silhouette, within 0.9 of its radius, that hit it.
+	sideHits := func(viewIndependent bool) (hits, rays int) {
+		engine := NewBakeEngine(cam, shapes, light, 64, 64, 0.05, 3, 7, target, up, 45)
+		engine.ViewIndependent = viewIndependent
+		dir := t.TempDir()
+		final := filepath.Join(dir, "final.bin")
+		if err := engine.Bake(filepath.Join(dir, "temp.bin"), final); err != nil {
+			t.Fatalf("Bake failed: %v", err)
+		}
+		scene, err := LoadBakedScene(final)
+		if err != nil {
+			t.Fatalf("LoadBakedScene failed: %v", err)
+		}
+		defer scene.Close()
+		if got := scene.Header.ViewIndependent == 1; got != viewIndependent {
+			t.Errorf("Header.ViewIndependent = %d with ViewIndependent %v", scene.Header.ViewIndependent, viewIndependent)
+		}
+
+		eye := math.Point3D{X: 8}
+		for y := -0.4; y <= 0.4; y += 0.05 {
+			for z := -0.4; z <= 0.4; z += 0.05 {
+				if y*y+z*z > 0.45*0.45 {
+					continue
+				}
+				rays++
+				p := side.Center.Add(math.Point3D{Y: y, Z: z})
+				ray := math.Ray{Origin: eye, Direction: p.Sub(eye).Normalize()}
+				if hit, atom := scene.Intersect(ray); hit && atom.MaterialID == 1 {
+					hits++
+				}
+			}
+		}
+		return hits, rays
+	}
+	if hits, rays := sideHits(true); hits != rays {
+		t.Errorf("view-independent bake: %d of %d side rays hit the side sphere, want all", hits, rays)
+	}
+	if hits, _ := sideHits(false); hits != 0 {
+		t.Errorf("camera-space bake: %d side rays hit a sphere out of the bake camera's view", hits)
+	}
+}
+
+// TestBakeEngine_Time bakes a moving sphere at the start and the end of its
+// motion: the atoms must follow it.
+func TestBakeEngine_Time(t *testing.T) {
+	eye, target, up := math.Point3D{Z: 8}, math.Point3D{}, math.Point3D{Y: 1}
+	cam := camera.NewLookAtCamera(eye, target, up, 45, 1)
+	sphere := geometry.Sphere3D{Center: math.Point3D{X: -1}, Velocity: math.Point3D{X: 2}, Radius: 0.5, Color: color.RGBA{R: 255, A: 255}}
+	light := shading.Light{Position: math.Point3D{Y: 5}, Intensity: 1}
+	for _, tt := range []struct{ time, wantX float64 }{{0, -1}, {1, 1}} {
+		engine := NewBakeEngine(cam, []geometry.Shape{sphere}, light, 64, 64, 0.02, 6, 10, target, up, 45)
+		engine.Time = tt.time
+		var buf bytes.Buffer
+		var counts atomCounts
+		engine.passA(&buf, &counts)
+		var sumX float64
+		for buf.Len() > 0 {
+			var a BakedAtom
+			if err := a.Read(&buf); err != nil {
+				t.Fatal(err)
+			}
+			sumX += float64(a.Pos[0])
+		}
+		n := counts.total()
+		if n == 0 {
+			t.Fatalf("time %v: no atoms baked", tt.time)
+		}
+		if meanX := sumX / float64(n); gomath.Abs(meanX-tt.wantX) > 0.1 {
+			t.Errorf("time %v: atoms centered on x=%.3f, want %v", tt.time, meanX, tt.wantX)
+		}
+	}
+}
+
+func TestShapePartition_WideMortonCodes(t *testing.T) {
+	p := &shapePartition{min: [3]float32{0, 0, 0}, max: [3]float32{1, 1, 1}, count: 1000}
+	a := BakedAtom{Pos: [3]float32{0.5, 0.5, 0.5}}
+	b := BakedAtom{Pos: [3]float32{0.5002, 0.5, 0.5}}
+	if p.mortonCode(a) != p.mortonCode(b) {
+		t.Fatal("expected nearby atoms to share a 30-bit code in a small partition")
+	}
+	p.count = wideMortonAtoms + 1
+	if p.mortonCode(a) == p.mortonCode(b) {
+		t.Error("expected a dense partition to separate nearby atoms")
+	}
+}
+
+// angleDeg returns the angle between two unit vectors in degrees.
+func angleDeg(a, b math.Point3D) float64 {
+	return gomath.Acos(gomath.Max(-1, gomath.Min(1, a.Dot(b)))) * 180 / gomath.Pi
+}
+
+func TestOctEncode_RoundTrip(t *testing.T) {
+	const maxErr = 0.01 // degrees; 16 bits per axis is far better than the 1 degree budget
+
+	var normals []math.Point3D
+	// Axes, the Z=0 equator and the octahedron's fold seams.
+	for _, n := range []math.Point3D{
+		{X: 1}, {X: -1}, {Y: 1}, {Y: -1}, {Z: 1}, {Z: -1},
+		{X: 1, Y: 1}, {X: -1, Y: 1}, {X: 1, Y: -1}, {X: -1, Y: -1},
+		{X: 1, Z: 1e-9}, {X: 1, Z: -1e-9}, {Y: -1, Z: -1e-9},
+		{X: 1, Y: 1, Z: -1}, {X: -1, Y: -1, Z: -1}, {X: 1e-6, Y: 1e-6, Z: -1},
+	} {
+		normals = append(normals, n.Normalize())
+	}
+	for i := 0; i < 360; i++ {
+		a := float64(i) * gomath.Pi / 180
+		for _, z := range []float64{0, 1e-4, -1e-4} {
+			normals = append(normals, math.Point3D{X: gomath.Cos(a), Y: gomath.Sin(a), Z: z}.Normalize())
+		}
+	}
+	prng := math.NewXorShift32(42)
+	for len(normals) < 5000 {
+		p := math.Point3D{X: prng.NextFloat64()*2 - 1, Y: prng.NextFloat64()*2 - 1, Z: prng.NextFloat64()*2 - 1}
+		if l := p.Length(); l > 0.1 && l <= 1 {
+			normals = append(normals, p.Normalize())
+		}
+	}
+
+	worst := 0.0
+	for _, n := range normals {
+		got := OctDecode(OctEncode(n))
+		if e := angleDeg(n, got); e > worst {
+			worst = e
+			if e > maxErr {
+				t.Errorf("OctDecode(OctEncode(%v)) = %v, error %.4f degrees", n, got, e)
+			}
+		}
+	}
+	t.Logf("worst round-trip error %.5f degrees over %d normals", worst, len(normals))
+}
+
+func TestBakedScene_Material(t *testing.T) {
+	_, final := bakeTestScene(t)
+	scene, err := LoadBakedScene(final)
+	if err != nil {
+		t.Fatalf("LoadBakedScene failed: %v", err)
+	}
+	defer scene.Close()
+
+	m := scene.Material(0)
+	if m.Tint != [3]float32{1, 1, 1} || m.IOR != 1.5 {
+		t.Errorf("Material(0) = %+v, want white tint and IOR 1.5", m)
+	}
+	// The test sphere has shininess 0, which maps to a fully rough surface.
+	if m.Roughness != 1 {
+		t.Errorf("Material(0).Roughness = %v, want 1", m.Roughness)
+	}
+	if unused := scene.Material(1); unused != (BakedMaterial{}) {
+		t.Errorf("Material(1) should be empty for a one-shape scene, got %+v", unused)
+	}
+}
+
+// TestBakedScene_MaterialRoundTrip bakes a gold metal sphere beside a
+// glowing glass one and checks that the atoms each ray hits carry their
+// shape's metalness, tint, emission and IOR.
+func TestBakedScene_MaterialRoundTrip(t *testing.T) {
+	gold := color.RGBA{R: 255, G: 204, B: 0, A: 255}
+	metal := geometry.Metal{Shape: geometry.Sphere3D{Center: math.Point3D{X: -1.2}, Radius: 1, Shininess: 198, SpecularColor: gold}, Metalness: 0.5}
+	lamp := geometry.Translucent{
+		Shape:   geometry.Emissive{Shape: geometry.Sphere3D{Center: math.Point3D{X: 1.2}, Radius: 1}, Color: color.RGBA{R: 255, G: 51, A: 255}, Intensity: 4},
+		Opacity: 0.5,
+		IOR:     1.33,
+	}
+	base := newTestBakeEngine()
+	engine := NewBakeEngine(base.Camera, []geometry.Shape{metal, lamp}, base.Light, 64, 64, 0.05, 3, 7, math.Point3D{}, math.Point3D{Y: 1}, 45)
+	dir := t.TempDir()
+	final := filepath.Join(dir, "final.bin")
+	if err := engine.Bake(filepath.Join(dir, "temp.bin"), final); err != nil {
+		t.Fatalf("Bake failed: %v", err)
+	}
+	scene, err := LoadBakedScene(final)
+	if err != nil {
+		t.Fatalf("LoadBakedScene failed: %v", err)
+	}
+	defer scene.Close()
+
+	tests := []struct {
+		name string
+		x    float64
+		want BakedMaterial
+	}{
+		{"metal", -1.2, BakedMaterial{Tint: [3]float32{1, 0.9, 0.5}, Roughness: 0.1, Metalness: 0.5, IOR: 1.5, Opacity: 1}},
+		{"emissive glass", 1.2, BakedMaterial{Tint: [3]float32{1, 1, 1}, Roughness: 1, IOR: 1.33, Emission: [3]float32{4, 0.8, 0}, Opacity: 0.5}},
+	}
+	for _, tt := range tests {
+		ray := math.Ray{Origin: math.Point3D{X: tt.x, Z: 5}, Direction: math.Point3D{Z: -1}}
+		hit, atom := scene.Intersect(ray)
+		if !hit {
+			t.Errorf("%s: ray missed the sphere", tt.name)
+			continue
+		}
+		got := scene.Material(atom.MaterialID)
+		if !nearMaterial(got, tt.want) {
+			t.Errorf("%s: Material(%d) = %+v, want %+v", tt.name, atom.MaterialID, got, tt.want)
+		}
+	}
+}
+
+// nearMaterial reports whether a and b match to float32 rounding.
+func nearMaterial(a, b BakedMaterial) bool {
+	near := func(x, y float32) bool { return gomath.Abs(float64(x-y)) < 1e-6 }
+	for c := range 3 {
+		if !near(a.Tint[c], b.Tint[c]) || !near(a.Emission[c], b.Emission[c]) {
+			return false
+		}
+	}
+	return near(a.Roughness, b.Roughness) && near(a.Metalness, b.Metalness) && near(a.IOR, b.IOR) &&
+		near(a.Opacity, b.Opacity) && near(a.Dispersion, b.Dispersion)
+}
+
+func TestHeader_FitDepthPlanes(t *testing.T) {
+	engine, final := bakeTestScene(t)
+	scene, err := LoadBakedScene(final)
+	if err != nil {
+		t.Fatalf("LoadBakedScene failed: %v", err)
+	}
+	defer scene.Close()
+
+	// The unit sphere sits 5 units from the eye.
+	near, far, ok := scene.Header.FitDepthPlanes(engine.Camera.GetEye())
+	if !ok {
+		t.Fatal("FitDepthPlanes reported an empty scene")
+	}
+	if near < 3 || near > 4 {
+		t.Errorf("near = %v, want just in front of the sphere (~3.6)", near)
+	}
+	if far < 6 || far > 8 {
+		t.Errorf("far = %v, want just behind the sphere", far)
+	}
+}
+
+// BenchmarkBakedScene_Intersect traces a 32x32 grid of camera rays through
+// the baked test sphere, about half of which hit it.
+func BenchmarkBakedScene_Intersect(b *testing.B) {
+	engine, final := bakeTestScene(b)
+	scene, err := LoadBakedScene(final)
+	if err != nil {
+		b.Fatalf("LoadBakedScene failed: %v", err)
+	}
+	defer scene.Close()
+
+	const grid = 32
+	rays := make([]math.Ray, 0, grid*grid)
+	for y := 0; y < grid; y++ {
+		for x := 0; x < grid; x++ {
+			sx, sy := (float64(x)+0.5)/grid, (float64(y)+0.5)/grid
+			pNear, pFar := engine.Camera.Project(sx, sy, engine.Near), engine.Camera.Project(sx, sy, engine.Far)
+			rays = append(rays, math.Ray{Origin: pNear, Direction: pFar.Sub(pNear).Normalize()})
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		scene.Intersect(rays[i%len(rays)])
+	}
+}
+
+// BenchmarkIndexer runs Pass B over a pre-baked row of eight spheres.
+func BenchmarkIndexer(b *testing.B) {
+	eye, target, up := math.Point3D{Z: 8}, math.Point3D{}, math.Point3D{Y: 1}
+	cam := camera.NewLookAtCamera(eye, target, up, 45, 1)
+	var shapes []geometry.Shape
+	for i := 0; i < 8; i++ {
+		shapes = append(shapes, geometry.Sphere3D{Center: math.Point3D{X: float64(i) - 3.5}, Radius: 0.45, Color: color.RGBA{R: 255, A: 255}})
+	}
+	light := shading.Light{Position: math.Point3D{X: 5, Y: 5, Z: 5}, Intensity: 1}
+	engine := NewBakeEngine(cam, shapes, light, 64, 64, 0.002, 6, 10, target, up, 45)
+
+	dir := b.TempDir()
+	temp, final := filepath.Join(dir, "temp.bin"), filepath.Join(dir, "final.bin")
+	f, err := os.Create(temp)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var counts atomCounts
+	engine.subdivideBake(engine.bakeAABB(), f, geometry.NewBVH(shapes), &counts)
+	f.Close()
+	atoms := counts.total()
+	stdout := os.Stdout
+	os.Stdout, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	defer func() { os.Stdout = stdout }()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := engine.Indexer(temp, final, atoms); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(atoms), "atoms")
+}
+
+// millionAtoms returns a million atoms of four shapes scattered through a
+// unit cube, the size of bake whose writes buffering pays off for.
+func millionAtoms() []BakedAtom {
+	rng := math.NewXorShift32(1)
+	unit := func() float32 { return float32(rng.Next()) / float32(1<<32) }
+	atoms := make([]BakedAtom, 1<<20)
+	for i := range atoms {
+		atoms[i] = BakedAtom{
+			Pos:        [3]float32{unit(), unit(), unit()},
+			HalfExtent: 0.001,
+			Normal:     rng.Next(),
+			Albedo:     [3]uint8{uint8(i), uint8(i >> 8), uint8(i >> 16)},
+			MaterialID: uint8(i % 4),
+			LightDir:   rng.Next(),
+			LightColor: [3]uint8{255, 255, 255},
+			AO:         255,
+		}
+	}
+	return atoms
+}
+
+// BenchmarkIndexAtoms_Million writes a million atoms through Pass B,
+// reporting the throughput of the baked file written.
+func BenchmarkIndexAtoms_Million(b *testing.B) {
+	engine := newTestBakeEngine()
+	for i := 1; i < 4; i++ {
+		engine.Shapes = append(engine.Shapes, engine.Shapes[0])
+	}
+	atoms := millionAtoms()
+	dir := b.TempDir()
+	temp, final := filepath.Join(dir, "temp.bin"), filepath.Join(dir, "final.bin")
+	stdout := os.Stdout
+	os.Stdout, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	defer func() { os.Stdout = stdout }()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := engine.IndexAtoms(atoms, temp, final); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	if info, err := os.Stat(final); err == nil {
+		b.SetBytes(info.Size())
+	}
+}
+
+// TestBakeEngine_AO bakes two touching spheres with ambient occlusion, plain
+// and compressed: atoms in the crevice between them must come out darker
+// than atoms on their open outer sides, the same either way.
+func TestBakeEngine_AO(t *testing.T) {
+	eye, target, up := math.Point3D{Z: 6}, math.Point3D{}, math.Point3D{Y: 1}
+	cam := camera.NewLookAtCamera(eye, target, up, 45, 1)
+	shapes := []geometry.Shape{
+		geometry.Sphere3D{Center: math.Point3D{X: -1}, Radius: 1, Color: color.RGBA{R: 255, A: 255}},
+		geometry.Sphere3D{Center: math.Point3D{X: 1}, Radius: 1, Color: color.RGBA{G: 255, A: 255}},
+	}
+	light := shading.Light{Position: math.Point3D{X: 5, Y: 5, Z: 5}, Intensity: 1}
+
+	for _, compress := range []bool{false, true} {
+		engine := NewBakeEngine(cam, shapes, light, 64, 64, 0.02, 3, 9, target, up, 45)
+		engine.AORadius, engine.Compress = 1, compress
+		dir := t.TempDir()
+		final := filepath.Join(dir, "final.bin")
+		if err := engine.Bake(filepath.Join(dir, "temp.bin"), final); err != nil {
+			t.Fatalf("Bake failed: %v", err)
+		}
+		scene, err := LoadBakedScene(final)
+		if err != nil {
+			t.Fatalf("LoadBakedScene failed: %v", err)
+		}
+		if scene.Header.AO != 1 || scene.Header.AORadius != 1 {
+			t.Errorf("compress %v: header AO %d radius %v, want 1 and 1", compress, scene.Header.AO, scene.Header.AORadius)
+		}
+
+		// Average the occlusion near the contact point and on the outer sides.
+		var crevice, open, nCrevice, nOpen float64
+		for _, y := range []float64{-0.1, 0, 0.1} {
+			for _, x := range []float64{-0.15, -0.1, 0.1, 0.15, -1.9, 1.9} {
+				ray := math.Ray{Origin: math.Point3D{X: x, Y: y, Z: 6}, Direction: math.Point3D{Z: -1}}
+				hit, atom := scene.Intersect(ray)
+				if !hit {
+					t.Fatalf("compress %v: ray at (%v, %v) missed", compress, x, y)
+				}
+				if gomath.Abs(x) < 1 {
+					crevice, nCrevice = crevice+scene.AtomAO(atom), nCrevice+1
+				} else {
+					open, nOpen = open+scene.AtomAO(atom), nOpen+1
+				}
+			}
+		}
+		crevice, open = crevice/nCrevice, open/nOpen
+		if crevice > 0.7 || open < 0.9 {
+			t.Errorf("compress %v: crevice AO %.2f, open AO %.2f; want the crevice clearly darker and the open side near 1", compress, crevice, open)
+		}
+		scene.Close()
+	}
+}
@@ -0,0 +1,166 @@
+package renderer
+
+import (
+	"fmt"
+	"grinder/pkg/camera"
+	"grinder/pkg/geometry"
+	"grinder/pkg/math"
+	"image"
+	"image/color"
+	gomath "math"
+)
+
+// DebugMode replaces shading with a diagnostic view.
+type DebugMode string
+
+const (
+	DebugNone    DebugMode = ""
+	DebugBVH     DebugMode = "bvh"     // shaded image with BVH node boxes drawn on top (see DrawBVH)
+	DebugAtoms   DebugMode = "atoms"   // flat color per scene shape that won the pixel
+	DebugNormals DebugMode = "normals" // SurfaceData.N mapped from [-1, 1] to RGB
+)
+
+// ParseDebugMode validates a -debug flag value.
+func ParseDebugMode(s string) (DebugMode, error) {
+	switch m := DebugMode(s); m {
+	case DebugNone, DebugBVH, DebugAtoms, DebugNormals:
+		return m, nil
+	}
+	return DebugNone, fmt.Errorf("unknown debug mode %q (want bvh, atoms or normals)", s)
+}
+
+// debugColor returns the diagnostic color of a hit pixel for the atoms and
+// normals modes.
+func (r *Renderer) debugColor(s SurfaceData) color.RGBA {
+	if r.Debug == DebugNormals {
+		n := s.N.Normalize()
+		return math.ClampColor(n.ToVector().Mul(0.5).Add(math.Point3D{X: 0.5, Y: 0.5, Z: 0.5}).Mul(255))
+	}
+	return paletteColor(r.shapeIndex(s.S))
+}
+
+// shapeIndex finds the scene shape s came from, mapping instances back to
+// their InstancedShape. It returns -1 if s is not in the scene.
+func (r *Renderer) shapeIndex(s geometry.Shape) int {
+	for i, shape := range r.Shapes {
+		if shape == s {
+			return i
+		}
+		if is, ok := shape.(*geometry.InstancedShape); ok {
+			for _, inst := range is.Instances() {
+				if inst == s {
+					return i
+				}
+			}
+		}
+	}
+	return -1
+}
+
+// paletteColor spreads indices around the hue circle so neighbours differ.
+func paletteColor(i int) color.RGBA {
+	if i < 0 {
+		return color.RGBA{255, 0, 255, 255}
+	}
+	h := gomath.Mod(float64(i)*0.618033988749895, 1) * 6
+	x := 1 - gomath.Abs(gomath.Mod(h, 2)-1)
+	var r, g, b float64
+	switch int(h) {
+	case 0:
+		r, g = 1, x
+	case 1:
+		r, g = x, 1
+	case 2:
+		g, b = 1, x
+	case 3:
+		g, b = x, 1
+	case 4:
+		r, b = x, 1
+	default:
+		r, b = 1, x
+	}
+	return color.RGBA{uint8(55 + 200*r), uint8(55 + 200*g), uint8(55 + 200*b), 255}
+}
+
+// aabbEdges lists the corner pairs of AABB3D.GetCorners that form box edges.
+var aabbEdges = [12][2]int{
+	{0, 1}, {2, 3}, {4, 5}, {6, 7},
+	{0, 2}, {1, 3}, {4, 6}, {5, 7},
+	{0, 4}, {1, 5}, {2, 6}, {3, 7},
+}
+
+// DrawBVH draws the projected edges of every BVH node box over img, colored
+// by tree depth. Edges with an endpoint behind the camera are skipped.
+func DrawBVH(img *image.RGBA, cam *camera.PerspectiveCamera, bvh *geometry.BVH) {
+	if bvh == nil {
+		return
+	}
+	w, h := float64(img.Bounds().Dx()), float64(img.Bounds().Dy())
+	var walk func(n *geometry.BVHNode, depth int)
+	walk = func(n *geometry.BVHNode, depth int) {
+		if n == nil {
+			return
+		}
+		col := paletteColor(depth)
+		corners := n.AABB.GetCorners()
+		var pts [8]image.Point
+		var front [8]bool
+		for i, c := range corners {
+			sx, sy, z := cam.ScreenPoint(c)
+			pts[i] = image.Pt(int(sx*w), int(sy*h))
+			front[i] = z > 0
+		}
+		for _, e := range aabbEdges {
+			if front[e[0]] && front[e[1]] {
+				drawLine(img, pts[e[0]], pts[e[1]], col)
+			}
+		}
+		walk(n.Left, depth+1)
+		walk(n.Right, depth+1)
+	}
+	walk(bvh.Root, 0)
+}
+
+// drawLine rasterizes a clipped Bresenham line.
+func drawLine(img *image.RGBA, a, b image.Point, col color.RGBA) {
+	// Huge projected coordinates come from corners just in front of the eye;
+	// bail out rather than walk millions of off-screen steps.
+	const limit = 1 << 15
+	if abs(a.X) > limit || abs(a.Y) > limit || abs(b.X) > limit || abs(b.Y) > limit {
+		return
+	}
+	dx, dy := abs(b.X-a.X), -abs(b.Y-a.Y)
+	sx, sy := 1, 1
+	if a.X > b.X {
+		sx = -1
+	}
+	if a.Y > b.Y {
+		sy = -1
+	}
+	err := dx + dy
+	bounds := img.Bounds()
+	for {
+		if (image.Point{a.X, a.Y}).In(bounds) {
+			img.SetRGBA(a.X, a.Y, col)
+		}
+		if a == b {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			a.X += sx
+		}
+		if e2 <= dx {
+			err += dx
+			a.Y += sy
+		}
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
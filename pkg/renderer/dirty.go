@@ -0,0 +1,99 @@
+package renderer
+
+import (
+	"grinder/pkg/camera"
+	"grinder/pkg/geometry"
+	"grinder/pkg/math"
+	"image"
+	gomath "math"
+)
+
+// ScreenRect returns the pixels of r's image that box can cover. Only a
+// perspective camera maps boxes to convex screen regions; for other
+// cameras, and for boxes that are unbounded or reach behind the eye, it is
+// the whole image.
+func (r *Renderer) ScreenRect(box math.AABB3D) image.Rectangle {
+	pc, ok := r.Camera.(*camera.PerspectiveCamera)
+	if !ok {
+		return r.bounds()
+	}
+	corners := box.GetCorners()
+	return r.screenHull(pc, corners[:], nil)
+}
+
+// ShapeRect returns the pixels of r's image that shape s can change: those
+// it covers, and those it can shadow from any point of r's light. Moving a
+// shape only changes pixels in the ShapeRect of its old and new places.
+func (r *Renderer) ShapeRect(s geometry.Shape) image.Rectangle {
+	pc, ok := r.Camera.(*camera.PerspectiveCamera)
+	if !ok {
+		return r.bounds()
+	}
+	box := s.GetAABB()
+	lr := math.Point3D{X: r.Light.Radius, Y: r.Light.Radius, Z: r.Light.Radius}
+	light := math.AABB3D{Min: r.Light.Position.Sub(lr), Max: r.Light.Position.Add(lr)}
+	// The shadow is the box swept away from the light, within the cone of
+	// directions from points of the light to points of the box; their
+	// corners span it.
+	var dirs []math.Point3D
+	for _, c := range box.GetCorners() {
+		for _, l := range light.GetCorners() {
+			dirs = append(dirs, c.Sub(l))
+		}
+	}
+	corners := box.GetCorners()
+	return r.screenHull(pc, corners[:], dirs)
+}
+
+// LightRect returns the pixels of r's image that moving r's light can
+// change. Its light shades every surface, so that is every pixel a shape
+// can cover, and every pixel at all when the atmosphere scatters it.
+func (r *Renderer) LightRect() image.Rectangle {
+	if r.Atmosphere.Atmosphere.Scattering > 0 {
+		return r.bounds()
+	}
+	var rect image.Rectangle
+	for _, s := range r.Shapes {
+		rect = rect.Union(r.ScreenRect(s.GetAABB()))
+	}
+	return rect
+}
+
+// screenHull returns the pixels the convex hull of points and of the
+// directions dirs from them, followed out to infinity, covers: the bounds
+// of the points' projections and of the directions' vanishing points,
+// padded by a pixel for jitter. It is the whole image when any of them
+// lies behind the eye or is infinite.
+func (r *Renderer) screenHull(pc *camera.PerspectiveCamera, points, dirs []math.Point3D) image.Rectangle {
+	minX, minY, maxX, maxY := gomath.Inf(1), gomath.Inf(1), gomath.Inf(-1), gomath.Inf(-1)
+	add := func(p math.Point3D) bool {
+		sx, sy, z := pc.ScreenPoint(p)
+		if z <= 0 || gomath.IsInf(sx, 0) || gomath.IsNaN(sx) || gomath.IsNaN(sy) {
+			return false
+		}
+		minX, maxX = gomath.Min(minX, sx), gomath.Max(maxX, sx)
+		minY, maxY = gomath.Min(minY, sy), gomath.Max(maxY, sy)
+		return true
+	}
+	for _, p := range points {
+		if gomath.IsInf(p.X, 0) || gomath.IsInf(p.Y, 0) || gomath.IsInf(p.Z, 0) || !add(p) {
+			return r.bounds()
+		}
+	}
+	eye := pc.GetEye()
+	for _, d := range dirs {
+		// Where a direction vanishes on screen is where the ray from the
+		// eye along it lands.
+		if d.Dot(pc.GetForward()) <= 0 || !add(eye.Add(d)) {
+			return r.bounds()
+		}
+	}
+	w, h := float64(r.Width), float64(r.Height)
+	rect := image.Rect(int(gomath.Floor(minX*w))-1, int(gomath.Floor(minY*h))-1, int(gomath.Ceil(maxX*w))+1, int(gomath.Ceil(maxY*h))+1)
+	return rect.Intersect(r.bounds())
+}
+
+// bounds returns the whole of r's image.
+func (r *Renderer) bounds() image.Rectangle {
+	return image.Rect(0, 0, r.Width, r.Height)
+}
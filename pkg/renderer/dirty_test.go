@@ -0,0 +1,85 @@
+package renderer
+
+import (
+	"bytes"
+	"grinder/pkg/camera"
+	"grinder/pkg/geometry"
+	"grinder/pkg/math"
+	"grinder/pkg/shading"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// newDirtyRenderer returns a renderer for two spheres over a floor, lit
+// from above and behind the camera so the shadows fall away from it.
+func newDirtyRenderer(moved geometry.Shape) *Renderer {
+	cam := camera.NewLookAtCamera(math.Point3D{Y: 1, Z: 5}, math.Point3D{}, math.Point3D{Y: 1}, 45, 1)
+	shapes := []geometry.Shape{
+		geometry.Sphere3D{Center: math.Point3D{X: -1}, Radius: 0.5, Color: color.RGBA{R: 200, G: 60, B: 60, A: 255}},
+		moved,
+		geometry.Plane3D{Point: math.Point3D{Y: -1}, Normal: math.Normal3D{Y: 1}, Color: color.RGBA{R: 120, G: 120, B: 120, A: 255}},
+	}
+	light := shading.Light{Position: math.Point3D{Y: 6, Z: 6}, Intensity: 1, Radius: 0.3, Samples: 4}
+	return NewRenderer(cam, shapes, light, 96, 96, 0.02, 3, 9, shading.AtmosphereConfig{})
+}
+
+// TestShapeRect_Rerender moves a sphere and re-renders only the tiles its
+// old and new ShapeRect touch over the old image: that must match a full
+// render of the moved scene.
+func TestShapeRect_Rerender(t *testing.T) {
+	from := geometry.Sphere3D{Center: math.Point3D{X: 1}, Radius: 0.4, Color: color.RGBA{R: 60, G: 60, B: 200, A: 255}}
+	to := from
+	to.Center = math.Point3D{X: 1.3, Y: 0.2}
+	img := renderTiled(newDirtyRenderer(from))
+	r := newDirtyRenderer(to)
+	want := renderTiled(r)
+
+	dirty := r.ShapeRect(from).Union(r.ShapeRect(to))
+	if dirty.Empty() || dirty == r.bounds() {
+		t.Fatalf("ShapeRect union = %v, want part of %v", dirty, r.bounds())
+	}
+	const tile = 32
+	for y := 0; y < r.Height; y += tile {
+		for x := 0; x < r.Width; x += tile {
+			rect := image.Rect(x, y, x+tile, y+tile)
+			if !rect.Overlaps(dirty) {
+				continue
+			}
+			part := r.RenderDeterministic(ScreenBounds{MinX: x, MinY: y, MaxX: x + tile, MaxY: y + tile})
+			draw.Draw(img, rect, part, image.Point{}, draw.Src)
+		}
+	}
+	if !bytes.Equal(img.Pix, want.Pix) {
+		t.Error("re-rendering the dirty tiles differs from a full render")
+	}
+}
+
+func TestScreenRect(t *testing.T) {
+	r := newDirtyRenderer(geometry.Sphere3D{Radius: 0.1})
+	// The view center is the look-at target.
+	got := r.ScreenRect(math.AABB3D{Min: math.Point3D{X: -0.1, Y: -0.1, Z: -0.1}, Max: math.Point3D{X: 0.1, Y: 0.1, Z: 0.1}})
+	if !image.Pt(48, 48).In(got) || got.Dx() > 16 || got.Dy() > 16 {
+		t.Errorf("ScreenRect(box at the target) = %v, want a few pixels around (48, 48)", got)
+	}
+	behind := math.AABB3D{Min: math.Point3D{Z: 5}, Max: math.Point3D{X: 1, Y: 1, Z: 7}}
+	if got := r.ScreenRect(behind); got != r.bounds() {
+		t.Errorf("ScreenRect(box around the eye) = %v, want the whole image", got)
+	}
+}
+
+func TestLightRect(t *testing.T) {
+	r := newDirtyRenderer(geometry.Sphere3D{Radius: 0.1})
+	if got := r.LightRect(); got != r.bounds() {
+		t.Errorf("LightRect over a floor = %v, want the whole image", got)
+	}
+	r.Shapes = r.Shapes[:2]
+	if got := r.LightRect(); got == r.bounds() || !image.Pt(48, 48).In(got) {
+		t.Errorf("LightRect of two spheres = %v, want part of the image around them", got)
+	}
+	r.Atmosphere.Atmosphere.Scattering = 0.1
+	if got := r.LightRect(); got != r.bounds() {
+		t.Errorf("LightRect in a scattering atmosphere = %v, want the whole image", got)
+	}
+}
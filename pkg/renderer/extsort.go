@@ -0,0 +1,301 @@
+package renderer
+
+import (
+	"bufio"
+	"container/heap"
+	"fmt"
+	"grinder/pkg/math"
+	"io"
+	"os"
+	"sort"
+)
+
+// defaultSortBudget bounds the atoms held in RAM by one sort run in Pass B.
+const defaultSortBudget = 256 * 1024 * 1024
+
+// shapePartition is one shape's slice of the raw atom stream, spilled to its
+// own temp file in Pass B.1 together with the bounds needed for Morton codes.
+type shapePartition struct {
+	id       uint8
+	path     string
+	count    int64
+	min, max [3]float32
+}
+
+// partitionAtoms streams the Pass A temp file once, splitting atoms into
+// per-shape files. Partitions are returned in ascending shape ID order. On
+// error, the partition files already created are removed.
+func (e *BakeEngine) partitionAtoms(tempFile string) (result []*shapePartition, err error) {
+	f, err := os.Open(tempFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	in := bufio.NewReader(f)
+
+	type partitionWriter struct {
+		f *os.File
+		w *bufio.Writer
+	}
+	parts := make(map[uint8]*shapePartition)
+	writers := make(map[uint8]*partitionWriter)
+	defer func() {
+		for _, pw := range writers {
+			pw.f.Close()
+		}
+		if err != nil {
+			for _, p := range parts {
+				os.Remove(p.path)
+			}
+		}
+	}()
+
+	for {
+		var atom BakedAtom
+		if err := atom.Read(in); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		p, ok := parts[atom.MaterialID]
+		if !ok {
+			p = &shapePartition{id: atom.MaterialID, path: fmt.Sprintf("%s.shape%d", tempFile, atom.MaterialID), min: atom.Pos, max: atom.Pos}
+			pf, err := os.Create(p.path)
+			if err != nil {
+				return nil, err
+			}
+			parts[atom.MaterialID] = p
+			writers[atom.MaterialID] = &partitionWriter{f: pf, w: bufio.NewWriter(pf)}
+		}
+		for i := 0; i < 3; i++ {
+			if atom.Pos[i] < p.min[i] {
+				p.min[i] = atom.Pos[i]
+			}
+			if atom.Pos[i] > p.max[i] {
+				p.max[i] = atom.Pos[i]
+			}
+		}
+		if err := atom.Write(writers[atom.MaterialID].w); err != nil {
+			return nil, err
+		}
+		p.count++
+	}
+	for _, pw := range writers {
+		if err := pw.w.Flush(); err != nil {
+			return nil, err
+		}
+	}
+
+	result = make([]*shapePartition, 0, len(parts))
+	for _, p := range parts {
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].id < result[j].id })
+	return result, nil
+}
+
+// removePartitions removes the partition files left on disk. Each is removed
+// as its merger closes, so after a successful Pass B there are none left;
+// this catches those an earlier error return skipped.
+func removePartitions(parts []*shapePartition) {
+	for _, p := range parts {
+		os.Remove(p.path)
+	}
+}
+
+// wideMortonAtoms is the partition size above which atoms are sorted by
+// 64-bit Morton codes. With 10 bits per axis a dense shape puts many atoms
+// in each grid cell; they all share a code, keep their bake order, and the
+// BLAS leaves cut from them grow oversized bounds.
+const wideMortonAtoms = 1 << 18
+
+// mortonCode returns the sort key of an atom within its shape's bounds.
+func (p *shapePartition) mortonCode(a BakedAtom) uint64 {
+	var n [3]float64
+	for i := 0; i < 3; i++ {
+		n[i] = 0.5
+		if d := float64(p.max[i]) - float64(p.min[i]); d > 0 {
+			n[i] = (float64(a.Pos[i]) - float64(p.min[i])) / d
+		}
+	}
+	if p.count > wideMortonAtoms {
+		return math.Morton3D64(n[0], n[1], n[2])
+	}
+	return uint64(math.Morton3D(n[0], n[1], n[2]))
+}
+
+// keyedAtom pairs an atom with its Morton code for sorting.
+type keyedAtom struct {
+	code uint64
+	atom BakedAtom
+}
+
+// sortPartition is Pass B.2: it cuts the partition into runs of at most
+// budget bytes, sorts each run in memory and spills it, then returns a merger
+// that yields the whole partition in Morton order.
+func (e *BakeEngine) sortPartition(p *shapePartition) (*atomMerger, error) {
+	budget := e.SortBudget
+	if budget <= 0 {
+		budget = defaultSortBudget
+	}
+	runAtoms := int(budget / AtomSize)
+	if runAtoms < 1 {
+		runAtoms = 1
+	}
+
+	f, err := os.Open(p.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	in := bufio.NewReader(f)
+
+	m := &atomMerger{part: p}
+	// Each atom's code is computed once as it's read, not on every comparison.
+	run := make([]keyedAtom, 0, min(int64(runAtoms), p.count))
+	flush := func() error {
+		// Stable so equal codes keep their Pass A order across runs.
+		sort.SliceStable(run, func(i, j int) bool { return run[i].code < run[j].code })
+		path := fmt.Sprintf("%s.run%d", p.path, len(m.runs))
+		rf, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		m.runs = append(m.runs, path)
+		w := bufio.NewWriter(rf)
+		for i := range run {
+			if err := run[i].atom.Write(w); err != nil {
+				rf.Close()
+				return err
+			}
+		}
+		if err := w.Flush(); err != nil {
+			rf.Close()
+			return err
+		}
+		run = run[:0]
+		return rf.Close()
+	}
+	for {
+		var atom BakedAtom
+		if err := atom.Read(in); err != nil {
+			if err == io.EOF {
+				break
+			}
+			m.Close()
+			return nil, err
+		}
+		run = append(run, keyedAtom{code: p.mortonCode(atom), atom: atom})
+		if len(run) == runAtoms {
+			if err := flush(); err != nil {
+				m.Close()
+				return nil, err
+			}
+		}
+	}
+	if len(run) > 0 {
+		if err := flush(); err != nil {
+			m.Close()
+			return nil, err
+		}
+	}
+	if err := m.open(); err != nil {
+		m.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// runCursor is the head of one sorted run during the k-way merge.
+type runCursor struct {
+	f    *os.File
+	r    *bufio.Reader
+	atom BakedAtom
+	code uint64
+	run  int
+}
+
+type runHeap []*runCursor
+
+func (h runHeap) Len() int { return len(h) }
+func (h runHeap) Less(i, j int) bool {
+	if h[i].code != h[j].code {
+		return h[i].code < h[j].code
+	}
+	return h[i].run < h[j].run
+}
+func (h runHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x any)   { *h = append(*h, x.(*runCursor)) }
+func (h *runHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// atomMerger k-way merges the sorted runs of a partition. Ties are broken by
+// run index, so the output matches a single stable sort of the partition.
+type atomMerger struct {
+	part    *shapePartition
+	runs    []string
+	cursors []*runCursor
+	heap    runHeap
+}
+
+func (m *atomMerger) open() error {
+	for i, path := range m.runs {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		c := &runCursor{f: f, r: bufio.NewReader(f), run: i}
+		m.cursors = append(m.cursors, c)
+		if err := m.advance(c); err != nil {
+			if err == io.EOF {
+				continue
+			}
+			return err
+		}
+		m.heap = append(m.heap, c)
+	}
+	heap.Init(&m.heap)
+	return nil
+}
+
+func (m *atomMerger) advance(c *runCursor) error {
+	if err := c.atom.Read(c.r); err != nil {
+		return err
+	}
+	c.code = m.part.mortonCode(c.atom)
+	return nil
+}
+
+// Next returns the next atom in Morton order, or io.EOF when all runs are drained.
+func (m *atomMerger) Next() (BakedAtom, error) {
+	if len(m.heap) == 0 {
+		return BakedAtom{}, io.EOF
+	}
+	c := m.heap[0]
+	atom := c.atom
+	if err := m.advance(c); err != nil {
+		if err != io.EOF {
+			return BakedAtom{}, err
+		}
+		heap.Pop(&m.heap)
+	} else {
+		heap.Fix(&m.heap, 0)
+	}
+	return atom, nil
+}
+
+// Close releases the run files and removes them along with the partition.
+func (m *atomMerger) Close() error {
+	for _, c := range m.cursors {
+		c.f.Close()
+	}
+	for _, path := range m.runs {
+		os.Remove(path)
+	}
+	return os.Remove(m.part.path)
+}
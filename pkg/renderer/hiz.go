@@ -0,0 +1,219 @@
+package renderer
+
+import (
+	"grinder/pkg/camera"
+	"grinder/pkg/geometry"
+	"grinder/pkg/math"
+	gomath "math"
+)
+
+// hiZCell is the width, in pixels, of the blocks the depth pre-pass probes:
+// the resolution of the coarse depth buffer it fills.
+const hiZCell = 8
+
+// hiZ is a hierarchical depth buffer over a tile. Level 0 holds, per pixel,
+// a depth the pre-pass proved the pixel's nearest hit lies in front of, or
+// +Inf where it proved nothing; each level above holds the largest of the
+// 2x2 texels below it, so one texel answers for a whole screen block.
+type hiZ struct {
+	bounds        ScreenBounds
+	width, height int // of the full image, to map octants to pixels
+	levels        []hiZLevel
+}
+
+// hiZLevel is one level of a hiZ, w x h texels in row-major order.
+type hiZLevel struct {
+	w, h  int
+	depth []float64
+}
+
+// newHiZ returns a hiZ over bounds of a width x height image that proves
+// nothing yet.
+func newHiZ(bounds ScreenBounds, width, height int) *hiZ {
+	w, h := bounds.MaxX-bounds.MinX, bounds.MaxY-bounds.MinY
+	depth := make([]float64, w*h)
+	for i := range depth {
+		depth[i] = gomath.Inf(1)
+	}
+	return &hiZ{bounds: bounds, width: width, height: height, levels: []hiZLevel{{w, h, depth}}}
+}
+
+// mark records that the pixels x0..x1, y0..y1 (inclusive, in image
+// coordinates) all hit something no deeper than z.
+func (hz *hiZ) mark(x0, y0, x1, y1 int, z float64) {
+	l := hz.levels[0]
+	for y := max(y0, hz.bounds.MinY); y <= min(y1, hz.bounds.MaxY-1); y++ {
+		row := l.depth[(y-hz.bounds.MinY)*l.w:]
+		for x := max(x0, hz.bounds.MinX); x <= min(x1, hz.bounds.MaxX-1); x++ {
+			row[x-hz.bounds.MinX] = gomath.Min(row[x-hz.bounds.MinX], z)
+		}
+	}
+}
+
+// build reduces level 0 into the levels above it, down to a single texel.
+func (hz *hiZ) build() {
+	hz.levels = hz.levels[:1]
+	for l := hz.levels[0]; l.w > 1 || l.h > 1; {
+		up := hiZLevel{w: (l.w + 1) / 2, h: (l.h + 1) / 2}
+		up.depth = make([]float64, up.w*up.h)
+		for y := 0; y < up.h; y++ {
+			for x := 0; x < up.w; x++ {
+				d := gomath.Inf(-1)
+				for _, p := range [4][2]int{{2 * x, 2 * y}, {2*x + 1, 2 * y}, {2 * x, 2*y + 1}, {2*x + 1, 2*y + 1}} {
+					if p[0] < l.w && p[1] < l.h {
+						d = gomath.Max(d, l.depth[p[1]*l.w+p[0]])
+					}
+				}
+				up.depth[y*up.w+x] = d
+			}
+		}
+		hz.levels = append(hz.levels, up)
+		l = up
+	}
+}
+
+// hides reports whether every pixel aabb covers within bounds is proven to
+// hit something no deeper than aabb's near face. It reads the coarsest
+// level at which those pixels span at most 2x2 texels, whose texels cover
+// them and possibly more, so it can miss some hidden octants but never
+// hides a visible one. A nil hiZ hides nothing.
+func (hz *hiZ) hides(aabb math.AABB3D, bounds ScreenBounds) bool {
+	if hz == nil {
+		return false
+	}
+	x0, y0, x1, y1 := pixelRange(aabb, bounds, hz.width, hz.height)
+	if x0 > x1 || y0 > y1 {
+		return false
+	}
+	x0, x1 = x0-hz.bounds.MinX, x1-hz.bounds.MinX
+	y0, y1 = y0-hz.bounds.MinY, y1-hz.bounds.MinY
+	k := 0
+	for k < len(hz.levels)-1 && (x1>>k-x0>>k > 1 || y1>>k-y0>>k > 1) {
+		k++
+	}
+	l := hz.levels[k]
+	for y := y0 >> k; y <= y1>>k; y++ {
+		for x := x0 >> k; x <= x1>>k; x++ {
+			if l.depth[y*l.w+x] > aabb.Min.Z {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// pixelRange returns the pixels, clipped to bounds, that dicing aabb
+// visits in a width x height image.
+func pixelRange(aabb math.AABB3D, bounds ScreenBounds, width, height int) (x0, y0, x1, y1 int) {
+	x0 = max(int(aabb.Min.X*float64(width)), bounds.MinX)
+	y0 = max(int(aabb.Min.Y*float64(height)), bounds.MinY)
+	x1 = min(int(aabb.Max.X*float64(width)), bounds.MaxX-1)
+	y1 = min(int(aabb.Max.Y*float64(height)), bounds.MaxY-1)
+	return x0, y0, x1, y1
+}
+
+// depthPrepass fills a hiZ for the tile aabb before it is diced. Dicing
+// splits every octant alike down to leaves under MinSize wide, so the
+// leaves cut every pixel's depth range into the same slabs, and each slab
+// samples each pixel at least once somewhere within its jitter. The
+// pre-pass walks blocks of hiZCell x hiZCell pixels from the near plane,
+// slab by slab, until one lies wholly inside a static convex shape: dicing
+// then finds that shape by the slab's far face on every pixel of the block,
+// whatever lies behind it. Only a perspective camera maps slabs to convex
+// frustum slices, whose eight corners then decide; with other cameras, or
+// with no such shapes in the tile, it returns nil.
+func (r *Renderer) depthPrepass(aabb math.AABB3D, bounds ScreenBounds, shapes []geometry.Shape) *hiZ {
+	if _, ok := r.Camera.(*camera.PerspectiveCamera); !ok {
+		return nil
+	}
+	var occluders []geometry.Shape
+	for _, s := range shapes {
+		if staticConvex(s) {
+			occluders = append(occluders, s)
+		}
+	}
+	if len(occluders) == 0 {
+		return nil
+	}
+
+	slabs := 1
+	for w := aabb.Max.X - aabb.Min.X; w >= r.MinSize; w /= 2 {
+		slabs *= 2
+	}
+	dz := (aabb.Max.Z - aabb.Min.Z) / float64(slabs)
+	w, h := float64(r.Width), float64(r.Height)
+
+	hz := newHiZ(bounds, r.Width, r.Height)
+	var near []geometry.Shape
+	for y0 := bounds.MinY; y0 < bounds.MaxY; y0 += hiZCell {
+		for x0 := bounds.MinX; x0 < bounds.MaxX; x0 += hiZCell {
+			x1, y1 := min(x0+hiZCell, bounds.MaxX), min(y0+hiZCell, bounds.MaxY)
+			// Every ray of the block's pixels, jitter included.
+			block := math.AABB3D{
+				Min: math.Point3D{X: (float64(x0) - 0.5) / w, Y: (float64(y0) - 0.5) / h, Z: aabb.Min.Z},
+				Max: math.Point3D{X: (float64(x1) - 0.5) / w, Y: (float64(y1) - 0.5) / h, Z: aabb.Max.Z},
+			}
+			near = near[:0]
+			world := camera.Bounds(r.Camera, block)
+			for _, s := range occluders {
+				if s.GetAABB().Intersects(world) {
+					near = append(near, s)
+				}
+			}
+			if len(near) == 0 {
+				continue
+			}
+			for k := 0; k < slabs; k++ {
+				slab := block
+				slab.Min.Z, slab.Max.Z = aabb.Min.Z+float64(k)*dz, aabb.Min.Z+float64(k+1)*dz
+				if insideAny(r.Camera, slab, near) {
+					hz.mark(x0, y0, x1-1, y1-1, slab.Max.Z)
+					break
+				}
+			}
+		}
+	}
+	hz.build()
+	return hz
+}
+
+// insideAny reports whether the frustum slice cam maps the screen box to
+// lies wholly inside one of shapes, all convex, at time 0.
+func insideAny(cam camera.Camera, box math.AABB3D, shapes []geometry.Shape) bool {
+	var corners [8]math.Point3D
+	for i, c := range box.GetCorners() {
+		corners[i] = cam.Project(c.X, c.Y, c.Z)
+	}
+	for _, s := range shapes {
+		inside := true
+		for _, c := range corners {
+			if !s.Contains(c, 0) {
+				inside = false
+				break
+			}
+		}
+		if inside {
+			return true
+		}
+	}
+	return false
+}
+
+// staticConvex reports whether s is a convex solid that stays put over the
+// shutter, so any convex region whose corners it contains lies wholly
+// inside it at every sample time. A plane counts: it is a half-space.
+func staticConvex(s geometry.Shape) bool {
+	switch v := geometry.Unwrap(s).(type) {
+	case geometry.Plane3D:
+		return true
+	case geometry.Sphere3D:
+		return v.Velocity == (math.Point3D{}) && v.Motion == nil
+	case geometry.Box3D:
+		return v.Velocity == (math.Point3D{}) && v.Motion == nil
+	case geometry.Cylinder3D:
+		return v.Velocity == (math.Point3D{}) && v.Motion == nil
+	case geometry.Cone3D:
+		return v.Velocity == (math.Point3D{}) && v.Motion == nil
+	}
+	return false
+}
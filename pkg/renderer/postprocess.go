@@ -0,0 +1,20 @@
+package renderer
+
+import (
+	gimage "grinder/pkg/image"
+	"image"
+)
+
+// Downsample box-filters img by an integer factor, averaging each
+// factor x factor block into one output pixel. Used to resolve supersampled
+// renders back to the target resolution. Rows and columns past the last
+// whole block are dropped.
+func Downsample(img *image.RGBA, factor int) *image.RGBA {
+	if factor <= 1 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx()/factor, b.Dy()/factor
+	whole := img.SubImage(image.Rect(b.Min.X, b.Min.Y, b.Min.X+w*factor, b.Min.Y+h*factor)).(*image.RGBA)
+	return gimage.Resize(whole, w, h, gimage.Box)
+}
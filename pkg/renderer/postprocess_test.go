@@ -0,0 +1,47 @@
+package renderer
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// TestDownsample checks that each output pixel is the rounded average of
+// its factor x factor block, with a partial block at the edge dropped, on a
+// source whose bounds don't start at the origin.
+func TestDownsample(t *testing.T) {
+	for _, factor := range []int{2, 3} {
+		src := image.NewRGBA(image.Rect(5, 7, 5+4*factor+factor-1, 7+3*factor+1))
+		b := src.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				src.SetRGBA(x, y, color.RGBA{R: uint8(x * 17), G: uint8(y * 29), B: uint8(x * y), A: 255})
+			}
+		}
+		out := Downsample(src, factor)
+		if got := out.Bounds(); got != image.Rect(0, 0, 4, 3) {
+			t.Fatalf("factor %d: bounds = %v, want 4x3", factor, got)
+		}
+		for y := 0; y < 3; y++ {
+			for x := 0; x < 4; x++ {
+				var sum [3]int
+				for sy := 0; sy < factor; sy++ {
+					for sx := 0; sx < factor; sx++ {
+						c := src.RGBAAt(b.Min.X+x*factor+sx, b.Min.Y+y*factor+sy)
+						sum[0] += int(c.R)
+						sum[1] += int(c.G)
+						sum[2] += int(c.B)
+					}
+				}
+				n := factor * factor
+				want := color.RGBA{R: uint8((sum[0] + n/2) / n), G: uint8((sum[1] + n/2) / n), B: uint8((sum[2] + n/2) / n), A: 255}
+				if got := out.RGBAAt(x, y); got != want {
+					t.Errorf("factor %d, pixel (%d, %d) = %v, want %v", factor, x, y, got, want)
+				}
+			}
+		}
+	}
+	if src := image.NewRGBA(image.Rect(0, 0, 2, 2)); Downsample(src, 1) != src {
+		t.Error("factor 1 should return the image itself")
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"image/color"
 	gomath "math"
 	"sort"
+	"sync"
+	"time"
 )
 
 // ScreenBounds defines the rectangular region of the screen to be rendered.
@@ -24,6 +26,7 @@ type SurfaceData struct {
 	TSample       float64 // <--- Ensure this is here!
 	Depth         float64
 	Hit           bool
+	Coverage      float64 // Fraction of sub-pixel samples that hit S (AntiAlias only)
 	VolumeSamples []VolumeSample
 }
 
@@ -32,10 +35,12 @@ type VolumeSample struct {
 	Shape    geometry.VolumetricShape
 	Interval float64 // The length of the ray segment within the volume
 	Depth    float64 // The z-depth of the sample
+	Density  float64 // The volume's density at the sample point
 }
 
 // Renderer is a configurable rendering engine.
-// Culling/early out is being held off until later when we have more features as its very tricky to get right and breaks with new feature additions.
+// Dicing skips octants already hidden behind solid hits (see occluded);
+// set NoEarlyOut to dice everything if a new feature needs it.
 type Renderer struct {
 	Camera     camera.Camera
 	Shapes     []geometry.Shape
@@ -48,11 +53,35 @@ type Renderer struct {
 	Near       float64
 	Far        float64
 	Atmosphere shading.AtmosphereConfig
-	Shutter    float64 // Add this!
+	AntiAlias  bool // Blend silhouettes toward what lies behind them by sub-pixel coverage
+	Debug      DebugMode
+	Sampler    LightSampler // How soft-shadow samples cover the light
+	// Environment, if set, replaces the flat ambient term with image-based
+	// light sampled along each surface normal.
+	Environment shading.Environment
+	// Background, if set, colors pixels that hit nothing by their view
+	// direction instead of the flat default.
+	Background shading.Environment
+	// NoEarlyOut disables skipping octants that are hidden behind surfaces
+	// already found nearer the camera.
+	NoEarlyOut bool
+	// DepthPrepass, with the early out on, first fills a coarse
+	// hierarchical depth buffer from the solid shapes in each tile (see
+	// depthPrepass), so octants behind them are skipped before any dicing
+	// reaches the surfaces in front.
+	DepthPrepass bool
+	// SplitWorkers, if above 1, dices the four screen quadrants of each tile
+	// on up to that many goroutines. It helps when there are fewer tiles
+	// than CPUs.
+	SplitWorkers int
+	// Stats, if set, collects timing and work counts; see CollectStats.
+	Stats *Stats
+
+	deterministic bool // set by RenderDeterministic
 }
 
 // NewRenderer creates a new renderer with the given configuration.
-func NewRenderer(cam camera.Camera, shapes []geometry.Shape, light shading.Light, width, height int, minSize, near, far float64, atmos shading.AtmosphereConfig, shutter float64) *Renderer {
+func NewRenderer(cam camera.Camera, shapes []geometry.Shape, light shading.Light, width, height int, minSize, near, far float64, atmos shading.AtmosphereConfig) *Renderer {
 	if near == 0 {
 		near = 0.1
 	}
@@ -66,7 +95,6 @@ func NewRenderer(cam camera.Camera, shapes []geometry.Shape, light shading.Light
 
 	return &Renderer{
 		Camera:     cam,
-		Shutter:    shutter,
 		Atmosphere: atmos,
 		Shapes:     allShapes,
 		BVH:        bvh,
@@ -121,37 +149,48 @@ func (r *Renderer) FitDepthPlanes() { // this should fix banding on ill fitting
 }
 
 func (r *Renderer) computeTileAABB(bounds ScreenBounds) math.AABB3D {
-	sx := []float64{float64(bounds.MinX) / float64(r.Width), float64(bounds.MaxX) / float64(r.Width)}
-	sy := []float64{float64(bounds.MinY) / float64(r.Height), float64(bounds.MaxY) / float64(r.Height)}
-	sz := []float64{r.Near, r.Far}
-
-	first := true
-	var result math.AABB3D
-	for _, z := range sz {
-		for _, y := range sy {
-			for _, x := range sx {
-				p := r.Camera.Project(x, y, z)
-				if first {
-					result = math.AABB3D{Min: p, Max: p}
-					first = false
-				} else {
-					result = result.Expand(p)
-				}
-			}
-		}
+	return camera.Bounds(r.Camera, math.AABB3D{
+		Min: math.Point3D{X: float64(bounds.MinX) / float64(r.Width), Y: float64(bounds.MinY) / float64(r.Height), Z: r.Near},
+		Max: math.Point3D{X: float64(bounds.MaxX) / float64(r.Width), Y: float64(bounds.MaxY) / float64(r.Height), Z: r.Far},
+	})
+}
+
+// CollectStats starts counting the renderer's work, including the BVH nodes
+// its queries visit, into a new Stats and returns it.
+func (r *Renderer) CollectStats() *Stats {
+	r.Stats = &Stats{}
+	r.BVH.Visits = &r.Stats.NodeVisits
+	return r.Stats
+}
+
+// RenderDeterministic renders like Render but with every jitter replaced by
+// its stratum centre and time fixed at t=0, so the output depends only on the
+// scene and the tile bounds. Golden-image tests use it to check geometry
+// independently of sampling noise.
+func (r *Renderer) RenderDeterministic(bounds ScreenBounds) *image.RGBA {
+	d := *r
+	d.deterministic = true
+	return d.Render(bounds)
+}
+
+// sample returns the next jitter value in [0, 1), or 0.5 in deterministic mode.
+func (r *Renderer) sample(prng *math.XorShift32) float64 {
+	if r.deterministic {
+		return 0.5
 	}
-	return result
+	return prng.NextFloat64()
 }
 
 func (r *Renderer) Render(bounds ScreenBounds) *image.RGBA {
+	start := time.Now()
+	var shadowRays int64
 	tileWidth := bounds.MaxX - bounds.MinX
 	tileHeight := bounds.MaxY - bounds.MinY
 	img := image.NewRGBA(image.Rect(0, 0, tileWidth, tileHeight))
 
-	surfaceBuffer := make([][]SurfaceData, tileHeight)
-	for i := range surfaceBuffer {
-		surfaceBuffer[i] = make([]SurfaceData, tileWidth)
-	}
+	tile := getSurfaceTile(tileWidth, tileHeight)
+	defer putSurfaceTile(tile)
+	surfaceBuffer := tile.rows
 
 	// Pass 1: Dicing/Subdivision
 	initialAABB := math.AABB3D{
@@ -168,7 +207,17 @@ func (r *Renderer) Render(bounds ScreenBounds) *image.RGBA {
 		return distI > distJ
 	})
 
-	r.subdivide(initialAABB, bounds, surfaceBuffer, primaryShapes, r.Shapes)
+	// Volumes need samples behind solids too, so they turn the early out off.
+	earlyOut := !r.NoEarlyOut && !hasVolumes(primaryShapes)
+	var hz *hiZ
+	if earlyOut && r.DepthPrepass {
+		hz = r.depthPrepass(initialAABB, bounds, primaryShapes)
+	}
+	if r.SplitWorkers > 1 && initialAABB.Max.X-initialAABB.Min.X >= r.MinSize {
+		r.subdivideQuadrants(initialAABB, bounds, surfaceBuffer, primaryShapes, earlyOut, hz)
+	} else {
+		r.subdivide(initialAABB, bounds, surfaceBuffer, primaryShapes, r.Shapes, earlyOut, hz)
+	}
 
 	// Pass 2: Shading with Stratified Light Sampling
 	prng := math.NewXorShift32(uint32(bounds.MinX*r.Width + bounds.MinY))
@@ -177,95 +226,155 @@ func (r *Renderer) Render(bounds ScreenBounds) *image.RGBA {
 	for y := 0; y < tileHeight; y++ {
 		for x := 0; x < tileWidth; x++ {
 			surface := surfaceBuffer[y][x]
+			if surface.Hit && (r.Debug == DebugAtoms || r.Debug == DebugNormals) {
+				img.Set(x, y, r.debugColor(surface))
+				continue
+			}
 
 			// 1. Determine the background color (either a solid surface or the scene background)
 			var bgColor color.RGBA
 			if surface.Hit {
-				var rTotal, gTotal, bTotal float64
-				gridSize := int(gomath.Sqrt(float64(r.Light.Samples)))
-				if gridSize < 1 {
-					gridSize = 1
-				}
-				totalSamples := float64(gridSize * gridSize)
-
-				lightVec := r.Light.Position.Sub(surface.P)
-				lightDir := lightVec.Normalize()
-
-				var up math.Point3D
-				if gomath.Abs(lightDir.Y) < 0.9 {
-					up = math.Point3D{X: 0, Y: 1, Z: 0}
-				} else {
-					up = math.Point3D{X: 1, Y: 0, Z: 0}
-				}
-				right := lightDir.Cross(up).Normalize()
-				vUp := lightDir.Cross(right).Normalize()
-
-				for gy := 0; gy < gridSize; gy++ {
-					for gx := 0; gx < gridSize; gx++ {
-						sx := (float64(bounds.MinX+x) + prng.NextFloat64()) / float64(r.Width)
-						sy := (float64(bounds.MinY+y) + prng.NextFloat64()) / float64(r.Height)
-						worldP := r.Camera.Project(sx, sy, surface.Depth)
-
-						var jitteredLight shading.Light
-						if r.Light.Radius > 0 {
-							u := (float64(gx) + prng.NextFloat64()) / float64(gridSize)
-							v := (float64(gy) + prng.NextFloat64()) / float64(gridSize)
-							offU := (u*2 - 1) * r.Light.Radius
-							offV := (v*2 - 1) * r.Light.Radius
-							jitteredPos := r.Light.Position.Add(right.Mul(offU)).Add(vUp.Mul(offV))
-
-							jitteredLight = shading.Light{
-								Position:  jitteredPos,
-								Intensity: r.Light.Intensity,
-								Radius:    r.Light.Radius,
-							}
-						} else {
-							jitteredLight = r.Light
-						}
-
-						shadedColor := shading.ShadedColor(worldP, surface.N, r.Camera.GetEye(), jitteredLight, surface.S, r.Shapes, surface.TSample)
-						rTotal += float64(shadedColor.R)
-						gTotal += float64(shadedColor.G)
-						bTotal += float64(shadedColor.B)
+				var rays int64
+				bgColor, rays = r.shade(surface, bounds.MinX+x, bounds.MinY+y, prng)
+				shadowRays += rays
+				if r.AntiAlias && surface.Coverage < 1 {
+					// The uncovered part of the pixel sees past the
+					// silhouette: another surface if there is one there.
+					background := r.applyAtmosphere(r.background(bounds.MinX+x, bounds.MinY+y), bounds.MinX+x, bounds.MinY+y, r.Far)
+					if behind, ok := r.behind(surface, bounds.MinX+x, bounds.MinY+y); ok {
+						background, rays = r.shade(behind, bounds.MinX+x, bounds.MinY+y, prng)
+						shadowRays += rays
 					}
+					bgColor = lerpRGBA(bgColor, background, 1-surface.Coverage)
 				}
-
-				surfaceColor := color.RGBA{
-					R: uint8(rTotal / totalSamples),
-					G: uint8(gTotal / totalSamples),
-					B: uint8(bTotal / totalSamples),
-					A: 255,
-				}
-				bgColor = shading.ApplyAtmosphere(surfaceColor, surface.Depth, r.Atmosphere)
 			} else {
-				bgColor = shading.ApplyAtmosphere(r.bgColor, r.Far, r.Atmosphere)
+				bgColor = r.applyAtmosphere(r.background(bounds.MinX+x, bounds.MinY+y), bounds.MinX+x, bounds.MinY+y, r.Far)
 			}
 
 			// 2. Composite Volumetric Samples
-			finalColor := bgColor
-			if len(surface.VolumeSamples) > 0 {
-				for _, sample := range surface.VolumeSamples {
-					// Only composite samples that are in front of the solid surface
-					if !surface.Hit || sample.Depth < surface.Depth {
-						volColor := sample.Shape.GetColor()
-						density := sample.Shape.GetDensity()
-						blendFactor := gomath.Min(1.0, density*sample.Interval)
-
-						finalColor.R = uint8(float64(finalColor.R)*(1-blendFactor) + float64(volColor.R)*blendFactor)
-						finalColor.G = uint8(float64(finalColor.G)*(1-blendFactor) + float64(volColor.G)*blendFactor)
-						finalColor.B = uint8(float64(finalColor.B)*(1-blendFactor) + float64(volColor.B)*blendFactor)
-					}
-				}
+			img.Set(x, y, compositeVolumes(bgColor, surface))
+		}
+	}
+	if r.Stats != nil {
+		r.Stats.PrimaryRays.Add(int64(tileWidth * tileHeight))
+		r.Stats.ShadowRays.Add(shadowRays)
+		r.Stats.AddTile(time.Since(start))
+	}
+	return img
+}
+
+// shade lights surface, the hit seen through pixel (px, py), with the
+// stratified light samples and fogs it by its depth. It returns the color
+// and how many shadow rays it cast.
+func (r *Renderer) shade(surface SurfaceData, px, py int, prng *math.XorShift32) (color.RGBA, int64) {
+	var shadowRays int64
+	var total math.Point3D
+	gridSize := int(gomath.Sqrt(float64(r.Light.Samples)))
+	if gridSize < 1 {
+		gridSize = 1
+	}
+	totalSamples := float64(gridSize * gridSize)
+	// Shading samples are spread over the pixel, so its footprint
+	// is how far they may stray from the surface.
+	footprint := r.pixelFootprint(px, py, surface.Depth)
+
+	lightVec := r.Light.Position.Sub(surface.P)
+	lightDir := lightVec.Normalize()
+
+	var up math.Point3D
+	if gomath.Abs(lightDir.Y) < 0.9 {
+		up = math.Point3D{X: 0, Y: 1, Z: 0}
+	} else {
+		up = math.Point3D{X: 1, Y: 0, Z: 0}
+	}
+	right := lightDir.Cross(up).Normalize()
+	vUp := lightDir.Cross(right).Normalize()
+
+	// Spread the light samples less where the occluder is close,
+	// so contact shadows stay crisp (see shading.PenumbraScale).
+	spread := r.Light.Radius
+	if spread > 0 {
+		checkP := surface.P.Add(surface.N.ToVector().Mul(shading.ShadowBias(surface.P, footprint)))
+		occluders := shading.ShadowOccluders(checkP, r.Light, surface.S, r.BVH)
+		shadowRays++
+		spread *= shading.PenumbraScale(checkP, r.Light.Position, occluders, r.Light.Radius, surface.TSample)
+	}
+
+	for gy := 0; gy < gridSize; gy++ {
+		for gx := 0; gx < gridSize; gx++ {
+			sx := (float64(px) + r.sample(prng)) / float64(r.Width)
+			sy := (float64(py) + r.sample(prng)) / float64(r.Height)
+			worldP := r.Camera.Project(sx, sy, surface.Depth)
+
+			jitteredLight := r.Light
+			if r.Light.Radius > 0 {
+				u, v := r.lightSample(gx, gy, gridSize, px, py, prng)
+				offU := (u*2 - 1) * spread
+				offV := (v*2 - 1) * spread
+				jitteredPos := r.Light.Position.Add(right.Mul(offU)).Add(vUp.Mul(offV))
+
+				// Each grid cell's sample stands for its own patch of
+				// the light, which the shadow test spreads over.
+				jitteredLight.Position = jitteredPos
+				jitteredLight.Radius = r.Light.Radius / float64(gridSize)
 			}
 
-			img.Set(x, y, finalColor)
+			// Sum unrounded, so the average keeps the light
+			// samples' fractions and soft shadows don't band.
+			shadowRays++
+			total = total.Add(shading.ShadedRadiance(worldP, surface.N, r.Camera.GetEye(), jitteredLight, surface.S, r.BVH, surface.TSample, r.Environment, footprint))
 		}
 	}
-	return img
+
+	surfaceColor := math.ClampColor(total.Mul(1 / totalSamples))
+	return r.applyAtmosphere(surfaceColor, px, py, surface.Depth), shadowRays
+}
+
+// surfaceTile is a tile's worth of SurfaceData, one row slice per scanline
+// over a single backing array.
+type surfaceTile struct {
+	size [2]int // width, height; the pool key
+	rows [][]SurfaceData
+}
+
+// surfacePools holds a *sync.Pool of *surfaceTile per [width, height], so
+// progressive and multi-frame renders reuse tile buffers instead of
+// reallocating them for every tile.
+var surfacePools sync.Map
+
+// getSurfaceTile returns an empty width x height tile buffer.
+func getSurfaceTile(width, height int) *surfaceTile {
+	size := [2]int{width, height}
+	p, _ := surfacePools.LoadOrStore(size, &sync.Pool{New: func() any {
+		cells := make([]SurfaceData, width*height)
+		rows := make([][]SurfaceData, height)
+		for i := range rows {
+			rows[i] = cells[i*width : (i+1)*width]
+		}
+		return &surfaceTile{size: size, rows: rows}
+	}})
+	return p.(*sync.Pool).Get().(*surfaceTile)
+}
+
+// putSurfaceTile clears t and returns it to its pool. Volume sample slices
+// keep their capacity for the next tile.
+func putSurfaceTile(t *surfaceTile) {
+	for _, row := range t.rows {
+		for i := range row {
+			samples := row[i].VolumeSamples
+			clear(samples)
+			row[i] = SurfaceData{VolumeSamples: samples[:0]}
+		}
+	}
+	p, _ := surfacePools.Load(t.size)
+	p.(*sync.Pool).Put(t)
 }
 
 // subdivide is the core recursive rendering function (Pass 1: Dicing).
-func (r *Renderer) subdivide(aabb math.AABB3D, bounds ScreenBounds, surfaceBuffer [][]SurfaceData, primaryShapes []geometry.Shape, fullScene []geometry.Shape) {
+// With earlyOut, octants hidden behind hits already in surfaceBuffer, or
+// behind the depths the pre-pass proved in hz, are skipped; the near half of
+// each split is diced first so they fill in.
+func (r *Renderer) subdivide(aabb math.AABB3D, bounds ScreenBounds, surfaceBuffer [][]SurfaceData, primaryShapes []geometry.Shape, fullScene []geometry.Shape, earlyOut bool, hz *hiZ) {
 	// Don't cull recursively. The primaryShapes list is the definitive set for this tile.
 	if len(primaryShapes) == 0 {
 		return
@@ -283,14 +392,17 @@ func (r *Renderer) subdivide(aabb math.AABB3D, bounds ScreenBounds, surfaceBuffe
 			for px := minX; px <= maxX; px++ {
 				if px >= bounds.MinX && px < bounds.MaxX && py >= bounds.MinY && py < bounds.MaxY {
 					tileX, tileY := px-bounds.MinX, py-bounds.MinY
-					jitterX := (prng.NextFloat64() - 0.5) / float64(r.Width)
-					jitterY := (prng.NextFloat64() - 0.5) / float64(r.Height)
+					jitterX := (r.sample(prng) - 0.5) / float64(r.Width)
+					jitterY := (r.sample(prng) - 0.5) / float64(r.Height)
 					sx, sy := (float64(px)/float64(r.Width))+jitterX, (float64(py)/float64(r.Height))+jitterY
 					interval := (aabb.Max.Z - aabb.Min.Z) / 7.0
 					// Inside the px/py loops, before you iterate over shapes:
 					pixelNoise := float64((px*127+py*431)%1000) / 1000.0
 					// Every pixel gets a consistent time sample for the whole depth stack
-					tSampleForPixel := gomath.Mod(prng.NextFloat64()+pixelNoise, 1.0) * r.Shutter
+					tSampleForPixel := gomath.Mod(r.sample(prng)+pixelNoise, 1.0) * r.Camera.GetShutter()
+					if r.deterministic {
+						tSampleForPixel = 0
+					}
 					//sx, sy := float64(px)/float64(r.Width), float64(py)/float64(r.Height)
 
 					// Fine-grind search: find the actual surface within this depth slice
@@ -300,9 +412,12 @@ func (r *Renderer) subdivide(aabb math.AABB3D, bounds ScreenBounds, surfaceBuffe
 						// to get the speed-up you wanted, since it's blurred anyway.
 						steps := 1
 						isMoving := false
-						if sphere, ok := s.(geometry.Sphere3D); ok {
+						// The time along s's own path; a shape with a
+						// motionBlur below 1 moves through less of the shutter.
+						shapeT := geometry.ShapeTime(s, tSampleForPixel)
+						if sphere, ok := geometry.Unwrap(s).(geometry.Sphere3D); ok && geometry.MotionBlurOf(s) > 0 {
 							// Use a small epsilon to check for actual motion
-							if sphere.Velocity.Length() > 0.001 {
+							if sphere.Velocity.Length() > 0.001 || sphere.Motion != nil {
 								isMoving = true
 							}
 						}
@@ -315,37 +430,32 @@ func (r *Renderer) subdivide(aabb math.AABB3D, bounds ScreenBounds, surfaceBuffe
 							// This is where you get the speed boost!
 							steps = 2
 						}
-						if s.IsVolumetric() {
-							// interval := (aabb.Max.Z - aabb.Min.Z) / 7.0
-							// // Inside the px/py loops, before you iterate over shapes:
-							// pixelNoise := float64((px*127+py*431)%1000) / 1000.0
-							// // Every pixel gets a consistent time sample for the whole depth stack
-							// tSampleForPixel := gomath.Mod(prng.NextFloat64()+pixelNoise, 1.0) * r.Shutter
+						if vol, ok := geometry.VolumeOf(s); ok {
 							for i := 0; i < steps; i++ {
-								tSample := gomath.Mod(prng.NextFloat64()+pixelNoise, 1.0) * r.Shutter
+								tSample := geometry.ShapeTime(s, gomath.Mod(r.sample(prng)+pixelNoise, 1.0)*r.Camera.GetShutter())
+								if r.deterministic {
+									tSample = 0
+								}
 								// Use the consistent pixel time
 								zThickness := aabb.Max.Z - aabb.Min.Z
-								zJitter := prng.NextFloat64() * (zThickness / float64(steps))
+								zJitter := r.sample(prng) * (zThickness / float64(steps))
 								zSample := aabb.Min.Z + (zThickness * (float64(i) / float64(steps))) + zJitter
 
 								worldP := r.Camera.Project(sx, sy, zSample)
 								if s.Contains(worldP, tSample) {
 									surfaceBuffer[tileY][tileX].VolumeSamples = append(surfaceBuffer[tileY][tileX].VolumeSamples, VolumeSample{
-										Shape:    s.(geometry.VolumetricShape),
+										Shape:    vol,
 										Interval: interval,
 										Depth:    zSample,
+										Density:  vol.DensityAt(worldP, tSample),
 									})
 								}
 							}
 						} else {
-							// // Inside the px/py loops, before you iterate over shapes:
-							// pixelNoise := float64((px*127+py*431)%1000) / 1000.0
-							// // Every pixel gets a consistent time sample for the whole depth stack
-							// tSampleForPixel := gomath.Mod(prng.NextFloat64()+pixelNoise, 1.0) * r.Shutter
 							for i := 0; i < steps; i++ {
 								// Use the consistent pixel time
 								zThickness := aabb.Max.Z - aabb.Min.Z
-								zJitter := prng.NextFloat64() * (zThickness / float64(steps))
+								zJitter := r.sample(prng) * (zThickness / float64(steps))
 								zSample := aabb.Min.Z + (zThickness * (float64(i) / float64(steps))) + zJitter
 
 								worldP := r.Camera.Project(sx, sy, zSample)
@@ -357,15 +467,24 @@ func (r *Renderer) subdivide(aabb math.AABB3D, bounds ScreenBounds, surfaceBuffe
 								//worldP := r.Camera.Project(sx, sy, zSample)
 
 								// 2. TEMPORAL CHECK: Use the new time-aware Contains
-								if s.Contains(worldP, tSampleForPixel) {
+								if s.Contains(worldP, shapeT) {
 									// Apply thinning for moving objects
-									if isMoving && prng.NextFloat64() > 0.2 {
+									if isMoving && !r.deterministic && prng.NextFloat64() > 0.2 {
 										continue
 									}
+									// The plane fills the whole half-space below it;
+									// find where the ray actually crosses it.
+									// Shapes with an analytic ray test get their exact
+									// crossing too, for crisp silhouettes.
+									if pl, ok := geometry.Unwrap(s).(geometry.Plane3D); ok {
+										zSample, worldP = r.planeHit(pl, sx, sy, zSample, zThickness)
+									} else if ri, ok := geometry.Unwrap(s).(rayIntersecter); ok {
+										zSample, worldP = r.rayHit(s, ri, sx, sy, zSample, zThickness, shapeT)
+									}
 
 									// ASSIGN EVERYTHING
 									surfaceBuffer[tileY][tileX].P = worldP
-									surfaceBuffer[tileY][tileX].N = s.NormalAtPoint(worldP, tSampleForPixel)
+									surfaceBuffer[tileY][tileX].N = s.NormalAtPoint(worldP, shapeT)
 									surfaceBuffer[tileY][tileX].S = s
 									surfaceBuffer[tileY][tileX].Depth = zSample
 									surfaceBuffer[tileY][tileX].Hit = true
@@ -374,6 +493,10 @@ func (r *Renderer) subdivide(aabb math.AABB3D, bounds ScreenBounds, surfaceBuffe
 									// so the shadow pass knows "when" to check for occluders.
 									surfaceBuffer[tileY][tileX].TSample = tSampleForPixel
 
+									if r.AntiAlias {
+										surfaceBuffer[tileY][tileX].Coverage = r.pixelCoverage(s, px, py, aabb, steps, shapeT, prng)
+									}
+
 									break
 								}
 							}
@@ -394,11 +517,295 @@ func (r *Renderer) subdivide(aabb math.AABB3D, bounds ScreenBounds, surfaceBuffe
 	for zi := 0; zi < 2; zi++ {
 		for xi := 0; xi < 2; xi++ {
 			for yi := 0; yi < 2; yi++ {
-				r.subdivide(math.AABB3D{
+				child := math.AABB3D{
 					Min: math.Point3D{X: xs[xi], Y: ys[yi], Z: zs[zi]},
 					Max: math.Point3D{X: xs[xi+1], Y: ys[yi+1], Z: zs[zi+1]},
-				}, bounds, surfaceBuffer, primaryShapes, fullScene)
+				}
+				if earlyOut && (hz.hides(child, bounds) || r.occluded(child, bounds, surfaceBuffer)) {
+					continue
+				}
+				r.subdivide(child, bounds, surfaceBuffer, primaryShapes, fullScene, earlyOut, hz)
+			}
+		}
+	}
+}
+
+// subdivideQuadrants runs the first split of subdivide with each screen
+// quadrant on its own goroutine, at most SplitWorkers at a time. Leaves on
+// either side of a split both reach the pixel column (and row) on it, so
+// each quadrant dices into its own sub-view of surfaceBuffer, clipped to the
+// pixels it owns, and no two goroutines write the same pixel.
+func (r *Renderer) subdivideQuadrants(aabb math.AABB3D, bounds ScreenBounds, surfaceBuffer [][]SurfaceData, primaryShapes []geometry.Shape, earlyOut bool, hz *hiZ) {
+	mx, my, mz := (aabb.Min.X+aabb.Max.X)/2, (aabb.Min.Y+aabb.Max.Y)/2, (aabb.Min.Z+aabb.Max.Z)/2
+	xs := [3]float64{aabb.Min.X, mx, aabb.Max.X}
+	ys := [3]float64{aabb.Min.Y, my, aabb.Max.Y}
+	zs := [3]float64{aabb.Min.Z, mz, aabb.Max.Z}
+	cx := min(max(int(mx*float64(r.Width)), bounds.MinX), bounds.MaxX)
+	cy := min(max(int(my*float64(r.Height)), bounds.MinY), bounds.MaxY)
+	pxs := [3]int{bounds.MinX, cx, bounds.MaxX}
+	pys := [3]int{bounds.MinY, cy, bounds.MaxY}
+
+	sem := make(chan struct{}, r.SplitWorkers)
+	var wg sync.WaitGroup
+	for xi := 0; xi < 2; xi++ {
+		for yi := 0; yi < 2; yi++ {
+			qb := ScreenBounds{MinX: pxs[xi], MinY: pys[yi], MaxX: pxs[xi+1], MaxY: pys[yi+1]}
+			if qb.MinX == qb.MaxX || qb.MinY == qb.MaxY {
+				continue
+			}
+			view := make([][]SurfaceData, qb.MaxY-qb.MinY)
+			for j := range view {
+				view[j] = surfaceBuffer[qb.MinY-bounds.MinY+j][qb.MinX-bounds.MinX : qb.MaxX-bounds.MinX]
+			}
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(xi, yi int) {
+				defer func() { <-sem; wg.Done() }()
+				// Near half first, as in subdivide.
+				for zi := 0; zi < 2; zi++ {
+					child := math.AABB3D{
+						Min: math.Point3D{X: xs[xi], Y: ys[yi], Z: zs[zi]},
+						Max: math.Point3D{X: xs[xi+1], Y: ys[yi+1], Z: zs[zi+1]},
+					}
+					if earlyOut && (hz.hides(child, qb) || r.occluded(child, qb, view)) {
+						continue
+					}
+					r.subdivide(child, qb, view, primaryShapes, r.Shapes, earlyOut, hz)
+				}
+			}(xi, yi)
+		}
+	}
+	wg.Wait()
+}
+
+// pixelFootprint returns the world-space width of pixel (px, py) at depth z.
+func (r *Renderer) pixelFootprint(px, py int, z float64) float64 {
+	sx, sy := (float64(px)+0.5)/float64(r.Width), (float64(py)+0.5)/float64(r.Height)
+	return r.Camera.Project(sx+1/float64(r.Width), sy, z).Sub(r.Camera.Project(sx, sy, z)).Length()
+}
+
+// planeHit moves a depth sample z that landed under pl back along the pixel
+// ray to where the ray crosses the plane, returning the new depth and point.
+// Project is affine in depth, so the plane's signed distance is too, and the
+// sample plus one dz nearer pin down the crossing exactly. Samples on rays
+// that don't cross from above, or whose crossing is in front of the near
+// plane, are left alone.
+func (r *Renderer) planeHit(pl geometry.Plane3D, sx, sy, z, dz float64) (float64, math.Point3D) {
+	p1 := r.Camera.Project(sx, sy, z)
+	d1 := pl.SignedDistance(p1)
+	d0 := pl.SignedDistance(r.Camera.Project(sx, sy, z-dz))
+	if d0 <= d1 {
+		return z, p1
+	}
+	zHit := z + d1*dz/(d0-d1)
+	if zHit < r.Near || zHit > z {
+		return z, p1
+	}
+	return zHit, r.Camera.Project(sx, sy, zHit)
+}
+
+// rayIntersecter is a shape that can find where a ray enters it.
+type rayIntersecter interface {
+	IntersectRay(r math.Ray) (float64, bool)
+}
+
+// rayHit moves a depth sample z that landed inside s back along the pixel
+// ray to where the ray enters it, searching the dz of depth in front of z.
+// Samples whose entry lies further back, because the ray was already inside
+// s there, or in front of the near plane, are left alone.
+func (r *Renderer) rayHit(s geometry.Shape, ri rayIntersecter, sx, sy, z, dz, t float64) (float64, math.Point3D) {
+	p1 := r.Camera.Project(sx, sy, z)
+	p0 := r.Camera.Project(sx, sy, z-dz)
+	if s.Contains(p0, t) {
+		return z, p1
+	}
+	// With the direction spanning the search, tHit is a fraction of dz.
+	tHit, ok := ri.IntersectRay(math.Ray{Origin: p0, Direction: p1.Sub(p0), Time: t})
+	if !ok || tHit > 1 {
+		return z, p1
+	}
+	zHit := z - dz + tHit*dz
+	if zHit < r.Near {
+		return z, p1
+	}
+	return zHit, r.Camera.Project(sx, sy, zHit)
+}
+
+// occluded reports whether every pixel aabb covers in the tile already has
+// a hit no deeper than aabb's near face. The painterly depth test would
+// reject every sample in such an octant, and each leaf seeds its own jitter,
+// so skipping it leaves the image unchanged.
+func (r *Renderer) occluded(aabb math.AABB3D, bounds ScreenBounds, surfaceBuffer [][]SurfaceData) bool {
+	minX, minY, maxX, maxY := pixelRange(aabb, bounds, r.Width, r.Height)
+	for py := minY; py <= maxY; py++ {
+		for px := minX; px <= maxX; px++ {
+			surface := &surfaceBuffer[py-bounds.MinY][px-bounds.MinX]
+			if !surface.Hit || surface.Depth > aabb.Min.Z {
+				return false
 			}
 		}
 	}
+	return true
+}
+
+// hasVolumes reports whether any of shapes is volumetric.
+func hasVolumes(shapes []geometry.Shape) bool {
+	for _, s := range shapes {
+		if _, ok := geometry.VolumeOf(s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// coverageSlices caps the slices pixelCoverage and behind walk past the hit
+// leaf, so shapes that reach the far plane, like planes, cost no more than
+// ones close behind the hit.
+const coverageSlices = 16
+
+// pixelCoverage estimates how much of pixel (px, py) the shape covers. Each
+// of the 2x2 stratified sub-pixel samples walks from the hit slice toward the
+// back of the shape, finely within the slice and at most coverageSlices
+// slices beyond it, and counts as covered if any depth sample is inside s.
+// The walk ends at the far corner of the shape's bounds within the pixel.
+func (r *Renderer) pixelCoverage(s geometry.Shape, px, py int, aabb math.AABB3D, steps int, t float64, prng *math.XorShift32) float64 {
+	const grid = 2
+	zThickness := aabb.Max.Z - aabb.Min.Z
+	limit := r.Far
+	if box, ok := clipAABB(s.GetAABB(), r.computeTileAABB(ScreenBounds{MinX: px - 1, MinY: py - 1, MaxX: px + 1, MaxY: py + 1})); ok {
+		eye := r.Camera.GetEye()
+		farthest := 0.0
+		for _, c := range box.GetCorners() {
+			farthest = gomath.Max(farthest, c.Sub(eye).Length())
+		}
+		limit = gomath.Min(limit, farthest)
+	}
+	coarse := gomath.Max(zThickness, (limit-aabb.Max.Z)/coverageSlices)
+	covered := 0
+	for j := 0; j < grid*grid; j++ {
+		offX := (float64(j%grid)+r.sample(prng))/grid - 0.5
+		offY := (float64(j/grid)+r.sample(prng))/grid - 0.5
+		sx := (float64(px) + offX) / float64(r.Width)
+		sy := (float64(py) + offY) / float64(r.Height)
+		step := zThickness / float64(steps)
+		for z := aabb.Min.Z + r.sample(prng)*step; z <= limit; z += step {
+			if s.Contains(r.Camera.Project(sx, sy, z), t) {
+				covered++
+				break
+			}
+			if z > aabb.Max.Z {
+				step = coarse
+			}
+		}
+	}
+	return float64(covered) / float64(grid*grid)
+}
+
+// behind finds the solid surface past surface.S along the center ray of
+// pixel (px, py): what the part of a silhouette pixel that S leaves
+// uncovered sees. It walks coverageSlices slices from surface's depth to the
+// far plane, skipping points inside S, and snaps planes and shapes with a ray
+// test onto their crossing. ok is false if nothing is there.
+func (r *Renderer) behind(surface SurfaceData, px, py int) (hit SurfaceData, ok bool) {
+	sx := (float64(px) + 0.5) / float64(r.Width)
+	sy := (float64(py) + 0.5) / float64(r.Height)
+	t := surface.TSample
+	dz := (r.Far - surface.Depth) / coverageSlices
+	if dz <= 0 {
+		return SurfaceData{}, false
+	}
+	segment := math.AABB3D{Min: r.Camera.Project(sx, sy, surface.Depth), Max: r.Camera.Project(sx, sy, surface.Depth)}
+	segment = segment.Expand(r.Camera.Project(sx, sy, r.Far))
+	candidates := r.BVH.IntersectsShapes(segment)
+	for i := 1; i <= coverageSlices; i++ {
+		z := surface.Depth + float64(i)*dz
+		p := r.Camera.Project(sx, sy, z)
+		if surface.S.Contains(p, geometry.ShapeTime(surface.S, t)) {
+			continue
+		}
+		for _, s := range candidates {
+			st := geometry.ShapeTime(s, t)
+			if s.IsVolumetric() || !s.Contains(p, st) {
+				continue
+			}
+			if pl, ok := geometry.Unwrap(s).(geometry.Plane3D); ok {
+				z, p = r.planeHit(pl, sx, sy, z, dz)
+			} else if ri, ok := geometry.Unwrap(s).(rayIntersecter); ok {
+				z, p = r.rayHit(s, ri, sx, sy, z, dz, st)
+			}
+			return SurfaceData{P: p, N: s.NormalAtPoint(p, st), S: s, TSample: t, Depth: z, Hit: true}, true
+		}
+	}
+	return SurfaceData{}, false
+}
+
+// clipAABB returns the overlap of a and b, and false if they don't overlap.
+func clipAABB(a, b math.AABB3D) (math.AABB3D, bool) {
+	c := math.AABB3D{
+		Min: math.Point3D{X: gomath.Max(a.Min.X, b.Min.X), Y: gomath.Max(a.Min.Y, b.Min.Y), Z: gomath.Max(a.Min.Z, b.Min.Z)},
+		Max: math.Point3D{X: gomath.Min(a.Max.X, b.Max.X), Y: gomath.Min(a.Max.Y, b.Max.Y), Z: gomath.Min(a.Max.Z, b.Max.Z)},
+	}
+	return c, c.Min.X <= c.Max.X && c.Min.Y <= c.Max.Y && c.Min.Z <= c.Max.Z
+}
+
+// applyAtmosphere fogs color c seen through pixel (px, py) at the given
+// depth. Scattering media are lit by the scene light; otherwise the cheap
+// distance blend is used.
+func (r *Renderer) applyAtmosphere(c color.RGBA, px, py int, depth float64) color.RGBA {
+	if r.Atmosphere.Atmosphere.Scattering <= 0 {
+		return shading.ApplyAtmosphere(c, depth, r.Atmosphere)
+	}
+	sx := (float64(px) + 0.5) / float64(r.Width)
+	sy := (float64(py) + 0.5) / float64(r.Height)
+	return shading.ApplyLitAtmosphere(c, r.Camera.GetEye(), r.Camera.Project(sx, sy, depth), r.Light, r.Atmosphere)
+}
+
+// background returns the scene background seen through the center of pixel
+// (px, py).
+func (r *Renderer) background(px, py int) color.RGBA {
+	if r.Background == nil {
+		return r.bgColor
+	}
+	sx := (float64(px) + 0.5) / float64(r.Width)
+	sy := (float64(py) + 0.5) / float64(r.Height)
+	c := r.Background.Radiance(r.Camera.Project(sx, sy, 1).Sub(r.Camera.GetEye()))
+	return math.ClampColor(c.Mul(255))
+}
+
+// compositeVolumes lays the surface's volume samples in front of the
+// surface over bg. Samples are sorted front to back and accumulated with
+// premultiplied "over": each adds its color weighted by its opacity and by the
+// transmittance left in front of it, so overlapping volumes blend the same
+// way whatever order they were diced in.
+func compositeVolumes(bg color.RGBA, surface SurfaceData) color.RGBA {
+	if len(surface.VolumeSamples) == 0 {
+		return bg
+	}
+	sort.SliceStable(surface.VolumeSamples, func(i, j int) bool {
+		return surface.VolumeSamples[i].Depth < surface.VolumeSamples[j].Depth
+	})
+	var sum math.Point3D
+	transmittance := 1.0
+	for _, sample := range surface.VolumeSamples {
+		// Only composite samples that are in front of the solid surface
+		if surface.Hit && sample.Depth >= surface.Depth {
+			break
+		}
+		alpha := gomath.Min(1.0, sample.Density*sample.Interval)
+		c := sample.Shape.GetColor()
+		sum = sum.Add(math.Point3D{X: float64(c.R), Y: float64(c.G), Z: float64(c.B)}.Mul(transmittance * alpha))
+		transmittance *= 1 - alpha
+	}
+	c := math.ClampColor(sum.Add(math.Point3D{X: float64(bg.R), Y: float64(bg.G), Z: float64(bg.B)}.Mul(transmittance)))
+	c.A = bg.A
+	return c
+}
+
+// lerpRGBA blends a toward b by f in [0, 1].
+func lerpRGBA(a, b color.RGBA, f float64) color.RGBA {
+	return math.ClampColor(math.Point3D{
+		X: float64(a.R)*(1-f) + float64(b.R)*f,
+		Y: float64(a.G)*(1-f) + float64(b.G)*f,
+		Z: float64(a.B)*(1-f) + float64(b.B)*f,
+	})
 }
@@ -0,0 +1,554 @@
+package renderer
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"grinder/pkg/camera"
+	"grinder/pkg/geometry"
+	"grinder/pkg/loader"
+	"grinder/pkg/math"
+	"grinder/pkg/shading"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	gomath "math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// newTestRenderer returns a small renderer for a moving sphere over a plane
+// lit by an area light, so every source of jitter is exercised.
+func newTestRenderer(width, height int) *Renderer {
+	eye := math.Point3D{X: 0, Y: 1, Z: 5}
+	target := math.Point3D{X: 0, Y: 0, Z: 0}
+	cam := camera.NewLookAtCamera(eye, target, math.Point3D{X: 0, Y: 1, Z: 0}, 45, 1)
+	shapes := []geometry.Shape{
+		geometry.Sphere3D{Center: target, Velocity: math.Point3D{X: 0.3}, Radius: 1, Color: color.RGBA{R: 200, G: 60, B: 60, A: 255}},
+		geometry.Plane3D{Point: math.Point3D{Y: -1}, Normal: math.Normal3D{Y: 1}, Color: color.RGBA{R: 120, G: 120, B: 120, A: 255}},
+	}
+	light := shading.Light{Position: math.Point3D{X: 4, Y: 6, Z: 4}, Intensity: 1, Radius: 0.5, Samples: 4}
+	r := NewRenderer(cam, shapes, light, width, height, 0.02, 3, 8, shading.AtmosphereConfig{})
+	return r
+}
+
+func TestRenderDeterministic_Stable(t *testing.T) {
+	bounds := ScreenBounds{MinX: 0, MinY: 0, MaxX: 48, MaxY: 48}
+	a := newTestRenderer(48, 48).RenderDeterministic(bounds)
+	b := newTestRenderer(48, 48).RenderDeterministic(bounds)
+	if !bytes.Equal(a.Pix, b.Pix) {
+		t.Fatal("RenderDeterministic produced different images for the same scene")
+	}
+
+	// The sphere must still be found without temporal thinning.
+	if c := a.RGBAAt(24, 24); c.R <= c.G {
+		t.Errorf("expected the sphere's red at the image centre, got %v", c)
+	}
+}
+
+var update = flag.Bool("update", false, "rewrite golden images in testdata")
+
+// renderTiled renders the whole frame in 32px tiles on separate goroutines,
+// the way cmd/render does.
+func renderTiled(r *Renderer) *image.RGBA {
+	const tile = 32
+	img := image.NewRGBA(image.Rect(0, 0, r.Width, r.Height))
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for y := 0; y < r.Height; y += tile {
+		for x := 0; x < r.Width; x += tile {
+			wg.Add(1)
+			go func(x, y int) {
+				defer wg.Done()
+				t := r.RenderDeterministic(ScreenBounds{MinX: x, MinY: y, MaxX: x + tile, MaxY: y + tile})
+				mu.Lock()
+				draw.Draw(img, image.Rect(x, y, x+tile, y+tile), t, image.Point{}, draw.Src)
+				mu.Unlock()
+			}(x, y)
+		}
+	}
+	wg.Wait()
+	return img
+}
+
+func TestRender(t *testing.T) {
+	cam, scene, light, atmos, near, far, err := loader.LoadScene("../../scenes/shapes.json")
+	if err != nil {
+		t.Fatalf("LoadScene failed: %v", err)
+	}
+	rndr := NewRenderer(cam, scene, *light, 128, 128, 0.016, near, far, atmos)
+	rndr.FitDepthPlanes()
+	got := renderTiled(rndr)
+
+	golden := filepath.Join("testdata", "shapes_golden.png")
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Create(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := png.Encode(f, got); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	f, err := os.Open(golden)
+	if err != nil {
+		t.Fatalf("missing golden image (run with -update): %v", err)
+	}
+	defer f.Close()
+	decoded, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := image.NewRGBA(decoded.Bounds())
+	draw.Draw(want, want.Bounds(), decoded, image.Point{}, draw.Src)
+	if want.Bounds() != got.Bounds() {
+		t.Fatalf("golden is %v, render is %v", want.Bounds(), got.Bounds())
+	}
+
+	// Allow off-by-a-few rounding from floating point differences between
+	// platforms, but not geometry changes.
+	bad := 0
+	for i := range got.Pix {
+		d := int(got.Pix[i]) - int(want.Pix[i])
+		if d < -4 || d > 4 {
+			bad++
+		}
+	}
+	if bad > len(got.Pix)/1000 {
+		t.Errorf("%d channel values differ from %s by more than 4", bad, golden)
+	}
+}
+
+// TestCompositeVolumes overlaps a red and a blue volume: the blend must not
+// depend on the order the samples were recorded, the nearer volume must tint
+// the result more, and samples behind the surface must be ignored.
+func TestCompositeVolumes(t *testing.T) {
+	red := geometry.VolumeBox{Color: color.RGBA{R: 255, A: 255}, Density: 0.5}
+	blue := geometry.VolumeBox{Color: color.RGBA{B: 255, A: 255}, Density: 0.5}
+	bg := color.RGBA{R: 40, G: 40, B: 40, A: 255}
+	front := VolumeSample{Shape: red, Interval: 1, Depth: 2, Density: 0.5}
+	back := VolumeSample{Shape: blue, Interval: 1, Depth: 3, Density: 0.5}
+
+	a := compositeVolumes(bg, SurfaceData{VolumeSamples: []VolumeSample{front, back}})
+	b := compositeVolumes(bg, SurfaceData{VolumeSamples: []VolumeSample{back, front}})
+	if a != b {
+		t.Errorf("composite depends on sample order: %v vs %v", a, b)
+	}
+	if a.R <= a.B {
+		t.Errorf("the nearer red volume should dominate, got %v", a)
+	}
+
+	hidden := compositeVolumes(bg, SurfaceData{Hit: true, Depth: 2.5, VolumeSamples: []VolumeSample{back, front}})
+	want := compositeVolumes(bg, SurfaceData{VolumeSamples: []VolumeSample{front}})
+	if hidden != want {
+		t.Errorf("volume behind the surface was composited: got %v, want %v", hidden, want)
+	}
+}
+
+// TestRender_TransformedVolume loads a fog box moved by a transform and
+// the same box written where it ends up: both must render as fog, the same
+// image, rather than the transformed one as an opaque solid.
+func TestRender_TransformedVolume(t *testing.T) {
+	const scene = `{
+  "camera": {"eye": {"x": 0, "y": 0, "z": 6}, "target": {"x": 0, "y": 0, "z": 0}, "up": {"x": 0, "y": 1, "z": 0}, "fov": 45, "aspect": 1},
+  "light": {"position": {"x": 3, "y": 5, "z": 5}, "intensity": 1},
+  "shapes": [{"type": "volume_box", "min": %s, "max": %s, "density": 0.4,
+    "color": {"r": 200, "g": 220, "b": 255, "a": 255}%s}]
+}`
+	dir := t.TempDir()
+	render := func(name, min, max, transform string) *image.RGBA {
+		t.Helper()
+		path := filepath.Join(dir, name+".json")
+		if err := os.WriteFile(path, []byte(fmt.Sprintf(scene, min, max, transform)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		sc, err := loader.Options{Strict: true}.Load(path)
+		if err != nil {
+			t.Fatalf("%s: Load: %v", name, err)
+		}
+		if _, ok := geometry.VolumeOf(sc.Shapes[0]); !ok {
+			t.Fatalf("%s: loaded %T, not a volume", name, sc.Shapes[0])
+		}
+		r := NewRenderer(sc.Camera, sc.Shapes, *sc.Light, 48, 48, 0.02, 2, 10, sc.Atmosphere)
+		return r.RenderDeterministic(ScreenBounds{MaxX: 48, MaxY: 48})
+	}
+	moved := render("moved", `{"x": -1, "y": -1, "z": -1}`, `{"x": 1, "y": 1, "z": 1}`,
+		`, "transform": {"translate": {"x": 0.5, "y": 0.25, "z": 0}}`)
+	placed := render("placed", `{"x": -0.5, "y": -0.75, "z": -1}`, `{"x": 1.5, "y": 1.25, "z": 1}`, "")
+
+	differ := 0
+	for i := 0; i < len(moved.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			if d := int(moved.Pix[i+c]) - int(placed.Pix[i+c]); d > 8 || d < -8 {
+				differ++
+				break
+			}
+		}
+	}
+	// Samples right on the box's faces may land either side of them.
+	if differ > len(moved.Pix)/4/50 {
+		t.Errorf("%d of %d pixels differ between the transformed and the placed fog box", differ, len(moved.Pix)/4)
+	}
+}
+
+// TestRender_BackgroundGradient renders an empty scene over a vertical
+// gradient: every column must brighten steadily from bottom to top.
+func TestRender_BackgroundGradient(t *testing.T) {
+	cam := camera.NewLookAtCamera(math.Point3D{Z: 5}, math.Point3D{}, math.Point3D{Y: 1}, 60, 1)
+	r := NewRenderer(cam, nil, shading.Light{}, 32, 32, 0.02, 1, 10, shading.AtmosphereConfig{})
+	r.Background = shading.GradientEnvironment{Sky: math.Point3D{X: 1, Y: 1, Z: 1}, Ground: math.Point3D{}}
+	img := r.Render(ScreenBounds{MinX: 0, MinY: 0, MaxX: 32, MaxY: 32})
+	for x := 0; x < 32; x += 8 {
+		for y := 1; y < 32; y++ {
+			above := img.RGBAAt(x, y-1).R
+			here := img.RGBAAt(x, y).R
+			if here > above || above-here > 8 {
+				t.Fatalf("column %d: row %d is %d after %d, want a small step down", x, y, here, above)
+			}
+		}
+	}
+	if top, bottom := img.RGBAAt(16, 0).R, img.RGBAAt(16, 31).R; top <= bottom+60 {
+		t.Errorf("top %d should be much brighter than bottom %d", top, bottom)
+	}
+}
+
+// BenchmarkRender_Frames renders whole 128x128 frames of the test scene in
+// 32px tiles, as a progressive preview does frame after frame.
+func BenchmarkRender_Frames(b *testing.B) {
+	r := newTestRenderer(128, 128)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		renderTiled(r)
+	}
+}
+
+// newOccluderRenderer returns a renderer for a large box right in front of
+// the camera, hiding most of a row of spheres behind it.
+func newOccluderRenderer(width, height int) *Renderer {
+	eye := math.Point3D{Z: 6}
+	cam := camera.NewLookAtCamera(eye, math.Point3D{}, math.Point3D{Y: 1}, 45, 1)
+	shapes := []geometry.Shape{
+		geometry.Box3D{Min: math.Point3D{X: -1.2, Y: -1.2, Z: 2}, Max: math.Point3D{X: 1.2, Y: 1.2, Z: 2.5}, Color: color.RGBA{R: 60, G: 120, B: 200, A: 255}},
+	}
+	for i := 0; i < 5; i++ {
+		shapes = append(shapes, geometry.Sphere3D{Center: math.Point3D{X: float64(i) - 2, Z: -2}, Radius: 0.6, Color: color.RGBA{R: 200, G: 200, B: 60, A: 255}})
+	}
+	light := shading.Light{Position: math.Point3D{X: 3, Y: 4, Z: 6}, Intensity: 1}
+	r := NewRenderer(cam, shapes, light, width, height, 0.02, 1, 12, shading.AtmosphereConfig{})
+	r.FitDepthPlanes()
+	return r
+}
+
+// TestRender_EarlyOutUnchanged checks that skipping hidden octants doesn't
+// change the image.
+func TestRender_EarlyOutUnchanged(t *testing.T) {
+	r := newOccluderRenderer(64, 64)
+	bounds := ScreenBounds{MaxX: 64, MaxY: 64}
+	fast := r.RenderDeterministic(bounds)
+	r.NoEarlyOut = true
+	full := r.RenderDeterministic(bounds)
+	if !bytes.Equal(fast.Pix, full.Pix) {
+		t.Error("early out changed the rendered image")
+	}
+}
+
+func BenchmarkRender_Occluder(b *testing.B) {
+	for _, noEarlyOut := range []bool{false, true} {
+		name := "earlyOut"
+		if noEarlyOut {
+			name = "full"
+		}
+		b.Run(name, func(b *testing.B) {
+			r := newOccluderRenderer(128, 128)
+			r.NoEarlyOut = noEarlyOut
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				renderTiled(r)
+			}
+		})
+	}
+}
+
+// newWallRenderer returns a renderer for a wall filling most of the view in
+// front of a grid of spheres, nearly all of them hidden.
+func newWallRenderer(width, height int) *Renderer {
+	eye := math.Point3D{Z: 6}
+	cam := camera.NewLookAtCamera(eye, math.Point3D{}, math.Point3D{Y: 1}, 45, 1)
+	shapes := []geometry.Shape{
+		geometry.Box3D{Min: math.Point3D{X: -2, Y: -2, Z: 1}, Max: math.Point3D{X: 2, Y: 2, Z: 1.5}, Color: color.RGBA{R: 60, G: 120, B: 200, A: 255}},
+	}
+	for i := 0; i < 8; i++ {
+		for j := 0; j < 8; j++ {
+			center := math.Point3D{X: float64(i) - 3.5, Y: float64(j) - 3.5, Z: -3}
+			shapes = append(shapes, geometry.Sphere3D{Center: center, Radius: 0.4, Color: color.RGBA{R: 200, G: 200, B: 60, A: 255}})
+		}
+	}
+	light := shading.Light{Position: math.Point3D{X: 3, Y: 4, Z: 6}, Intensity: 1}
+	r := NewRenderer(cam, shapes, light, width, height, 0.02, 1, 12, shading.AtmosphereConfig{})
+	r.FitDepthPlanes()
+	return r
+}
+
+// TestRender_DepthPrepassUnchanged checks that the pre-pass only skips
+// octants the early out would have found hidden anyway, and that it does
+// find the spheres behind the wall.
+func TestRender_DepthPrepassUnchanged(t *testing.T) {
+	r := newWallRenderer(64, 64)
+	bounds := ScreenBounds{MaxX: 64, MaxY: 64}
+	plain := r.RenderDeterministic(bounds)
+	r.DepthPrepass = true
+	if culled := r.RenderDeterministic(bounds); !bytes.Equal(plain.Pix, culled.Pix) {
+		t.Error("depth pre-pass changed the rendered image")
+	}
+	r.SplitWorkers = 4
+	if culled := r.RenderDeterministic(bounds); !bytes.Equal(plain.Pix, culled.Pix) {
+		t.Error("depth pre-pass changed the image diced in quadrants")
+	}
+
+	initial := math.AABB3D{Min: math.Point3D{Z: r.Near}, Max: math.Point3D{X: 1, Y: 1, Z: r.Far}}
+	hz := r.depthPrepass(initial, bounds, r.BVH.IntersectsShapes(r.computeTileAABB(bounds)))
+	_, _, z := r.Camera.(*camera.PerspectiveCamera).ScreenPoint(math.Point3D{Z: -3})
+	if !hz.hides(math.AABB3D{Min: math.Point3D{X: 0.45, Y: 0.45, Z: z}, Max: math.Point3D{X: 0.55, Y: 0.55, Z: z + 1}}, bounds) {
+		t.Error("the pre-pass didn't hide the spheres behind the middle of the wall")
+	}
+}
+
+// TestStaticConvex checks that only shapes that stay put count as hi-Z
+// occluders: a cylinder or cone on keyframes moves as surely as a sphere or
+// box does, so it must not write depth for where it stood at time 0.
+func TestStaticConvex(t *testing.T) {
+	path := &math.Motion{Keyframes: []math.Keyframe{
+		{Time: 0, Position: math.Point3D{}},
+		{Time: 1, Position: math.Point3D{X: 2}},
+	}}
+	for _, tt := range []struct {
+		name string
+		s    geometry.Shape
+		want bool
+	}{
+		{"still cylinder", geometry.Cylinder3D{Radius: 1, Height: 1}, true},
+		{"keyframed cylinder", geometry.Cylinder3D{Radius: 1, Height: 1, Motion: path}, false},
+		{"keyframed cone", geometry.Cone3D{Radius: 1, Height: 1, Motion: path}, false},
+		{"keyframed sphere", geometry.Sphere3D{Radius: 1, Motion: path}, false},
+		{"keyframed box", geometry.Box3D{Max: math.Point3D{X: 1, Y: 1, Z: 1}, Motion: path}, false},
+		{"moving cylinder", geometry.Cylinder3D{Radius: 1, Height: 1, Velocity: math.Point3D{X: 2}}, false},
+	} {
+		if got := staticConvex(tt.s); got != tt.want {
+			t.Errorf("staticConvex(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func BenchmarkRender_DepthPrepass(b *testing.B) {
+	for _, prepass := range []bool{false, true} {
+		name := "earlyOut"
+		if prepass {
+			name = "prepass"
+		}
+		b.Run(name, func(b *testing.B) {
+			r := newWallRenderer(128, 128)
+			r.DepthPrepass = prepass
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				renderTiled(r)
+			}
+		})
+	}
+}
+
+// TestRender_SplitWorkers checks that dicing a tile's quadrants in parallel
+// renders the same image as dicing it serially.
+func TestRender_SplitWorkers(t *testing.T) {
+	bounds := ScreenBounds{MaxX: 64, MaxY: 64}
+	serial := newTestRenderer(64, 64).RenderDeterministic(bounds)
+	r := newTestRenderer(64, 64)
+	r.SplitWorkers = 4
+	parallel := r.RenderDeterministic(bounds)
+	if !bytes.Equal(serial.Pix, parallel.Pix) {
+		t.Error("SplitWorkers changed the rendered image")
+	}
+}
+
+// BenchmarkRender_SingleTile renders a 128x128 frame as one tile, where only
+// SplitWorkers can bring more than one core to bear.
+func BenchmarkRender_SingleTile(b *testing.B) {
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			r := newTestRenderer(128, 128)
+			r.SplitWorkers = workers
+			bounds := ScreenBounds{MaxX: 128, MaxY: 128}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r.RenderDeterministic(bounds)
+			}
+		})
+	}
+}
+
+// TestRenderer_PlaneHit checks that a dicing sample under a plane is moved to
+// the depth where its pixel ray crosses the plane.
+func TestRenderer_PlaneHit(t *testing.T) {
+	r := newTestRenderer(64, 64)
+	floor := geometry.Plane3D{Point: math.Point3D{Y: -1}, Normal: math.Normal3D{Y: 1}}
+	eye := r.Camera.GetEye()
+	sx, sy := 0.5, 0.9
+	dir := r.Camera.Project(sx, sy, 1).Sub(eye)
+	want := floor.Point.Sub(eye).DotNormal(floor.Normal) / dir.DotNormal(floor.Normal)
+
+	const dz = 0.05
+	z, p := r.planeHit(floor, sx, sy, want+0.3*dz, dz)
+	if gomath.Abs(z-want) > 1e-9 {
+		t.Errorf("depth = %v, want %v", z, want)
+	}
+	if d := floor.SignedDistance(p); gomath.Abs(d) > 1e-9 {
+		t.Errorf("hit point %v is %v off the plane", p, d)
+	}
+
+	// A sample still above the plane is left where it is.
+	if z, _ := r.planeHit(floor, sx, sy, want-2*dz, dz); z != want-2*dz {
+		t.Errorf("sample above the plane moved to %v", z)
+	}
+}
+
+func TestRenderer_RayHit(t *testing.T) {
+	r := newTestRenderer(64, 64)
+	cone := geometry.Cone3D{Center: math.Point3D{Y: -1}, Radius: 1, Height: 2}
+	eye := r.Camera.GetEye()
+	sx, sy := 0.5, 0.5
+	want, ok := cone.IntersectRay(math.Ray{Origin: eye, Direction: r.Camera.Project(sx, sy, 1).Sub(eye)})
+	if !ok {
+		t.Fatal("the center pixel's ray misses the cone")
+	}
+
+	const dz = 0.05
+	z, p := r.rayHit(cone, cone, sx, sy, want+0.3*dz, dz, 0)
+	if gomath.Abs(z-want) > 1e-9 {
+		t.Errorf("depth = %v, want %v", z, want)
+	}
+	if p.Sub(r.Camera.Project(sx, sy, want)).Length() > 1e-9 {
+		t.Errorf("hit point %v is off the ray's entry", p)
+	}
+
+	// A sample whose search window starts inside the cone is left alone.
+	if z, _ := r.rayHit(cone, cone, sx, sy, want+1.5*dz, dz, 0); z != want+1.5*dz {
+		t.Errorf("sample deep inside the cone moved to %v", z)
+	}
+}
+
+// TestRender_AntiAliasBehind renders a red sphere against a green wall with
+// and without -aa: every pixel the blending changes must take in the wall
+// behind the silhouette, not the dark background behind the wall.
+func TestRender_AntiAliasBehind(t *testing.T) {
+	cam := camera.NewLookAtCamera(math.Point3D{Z: 6}, math.Point3D{}, math.Point3D{Y: 1}, 45, 1)
+	shapes := []geometry.Shape{
+		geometry.Sphere3D{Radius: 1, Color: color.RGBA{R: 120, A: 255}},
+		geometry.Box3D{Min: math.Point3D{X: -10, Y: -10, Z: -4}, Max: math.Point3D{X: 10, Y: 10, Z: -3}, Color: color.RGBA{G: 120, A: 255}},
+	}
+	r := NewRenderer(cam, shapes, shading.Light{Position: math.Point3D{Z: 6}, Intensity: 1}, 48, 48, 0.02, 1, 12, shading.AtmosphereConfig{})
+	// Even sky light all round, so the wall is at least as bright as its
+	// color wherever it shows.
+	r.Environment = shading.UniformEnvironment{Color: math.Point3D{X: 1, Y: 1, Z: 1}}
+	bounds := ScreenBounds{MaxX: 48, MaxY: 48}
+	aliased := r.RenderDeterministic(bounds)
+	r.AntiAlias = true
+	smooth := r.RenderDeterministic(bounds)
+
+	// Coverage comes in quarters, so the wall makes up at least a quarter
+	// of a blended pixel: G >= 30. The background would give at most 22.
+	changed := 0
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 48; x++ {
+			a, c := aliased.RGBAAt(x, y), smooth.RGBAAt(x, y)
+			if a == c {
+				continue
+			}
+			changed++
+			if c.G < 28 {
+				t.Errorf("pixel (%d, %d) = %v, was %v: blended toward the background behind the wall", x, y, c, a)
+			}
+		}
+	}
+	if changed == 0 {
+		t.Error("-aa changed no pixel")
+	}
+}
+
+func TestRender_MotionBlurSharp(t *testing.T) {
+	cam := camera.NewLookAtCamera(math.Point3D{Z: 8}, math.Point3D{}, math.Point3D{Y: 1}, 45, 1)
+	// Two spheres on the same path; the red one is sharp and stays where
+	// the path starts.
+	red := geometry.Sphere3D{Center: math.Point3D{X: -1.5, Y: 1}, Velocity: math.Point3D{X: 3}, Radius: 0.4, Color: color.RGBA{R: 255, A: 255}}
+	blue := geometry.Sphere3D{Center: math.Point3D{X: -1.5, Y: -1}, Velocity: math.Point3D{X: 3}, Radius: 0.4, Color: color.RGBA{B: 255, A: 255}}
+	shapes := []geometry.Shape{geometry.MotionBlurred{Shape: red, Scale: 0}, blue}
+	const size = 64
+	r := NewRenderer(cam, shapes, shading.Light{Position: math.Point3D{Z: 8}, Intensity: 1}, size, size, 0.02, 1, 12, shading.AtmosphereConfig{})
+	img := r.Render(ScreenBounds{MaxX: size, MaxY: size})
+
+	// hits counts the pixels along the row through y whose dominant channel
+	// is ch, between world x from and to.
+	hits := func(y, from, to float64, ch func(color.RGBA) (uint8, uint8)) int {
+		sx0, sy, _ := cam.ScreenPoint(math.Point3D{X: from, Y: y})
+		sx1, _, _ := cam.ScreenPoint(math.Point3D{X: to, Y: y})
+		n := 0
+		for px := int(sx0 * size); px <= int(sx1*size); px++ {
+			if c, other := ch(img.RGBAAt(px, int(sy*size))); c > 100 && c > 2*other {
+				n++
+			}
+		}
+		return n
+	}
+	redOf := func(c color.RGBA) (uint8, uint8) { return c.R, c.B }
+	blueOf := func(c color.RGBA) (uint8, uint8) { return c.B, c.R }
+
+	if n := hits(1, -1.7, -1.3, redOf); n == 0 {
+		t.Error("the sharp sphere is missing where its path starts")
+	}
+	if n := hits(1, 0.5, 1.5, redOf); n != 0 {
+		t.Errorf("the sharp sphere smears along its path: %d red pixels near its end", n)
+	}
+	if n := hits(-1, 0.5, 1.5, blueOf); n == 0 {
+		t.Error("the blurred sphere does not reach the end of its path")
+	}
+}
+
+// countingShape counts its Contains calls.
+type countingShape struct {
+	geometry.Shape
+	calls *int
+}
+
+func (c countingShape) Inner() geometry.Shape { return c.Shape }
+
+func (c countingShape) Contains(p math.Point3D, t float64) bool {
+	*c.calls++
+	return c.Shape.Contains(p, t)
+}
+
+// TestRenderer_PixelCoverageBounded checks that measuring coverage of an
+// infinite plane from a thin leaf walks a bounded number of slices to the
+// far plane rather than one leaf thickness at a time.
+func TestRenderer_PixelCoverageBounded(t *testing.T) {
+	r := newTestRenderer(32, 32)
+	r.Far = 1000
+	var calls int
+	floor := countingShape{Shape: geometry.Plane3D{Point: math.Point3D{Y: -1}, Normal: math.Normal3D{Y: 1}}, calls: &calls}
+	// Row 0 looks above the horizon, so no sample ever meets the floor.
+	leaf := math.AABB3D{Min: math.Point3D{X: 16.0 / 32, Z: 3}, Max: math.Point3D{X: 17.0 / 32, Y: 1.0 / 32, Z: 3.01}}
+	const steps = 8
+	if got := r.pixelCoverage(floor, 16, 0, leaf, steps, 0, math.NewXorShift32(1)); got != 0 {
+		t.Errorf("coverage above the horizon = %v, want 0", got)
+	}
+	if most := 4 * (steps + coverageSlices + 2); calls > most {
+		t.Errorf("pixelCoverage tested %d points, want at most %d", calls, most)
+	}
+}
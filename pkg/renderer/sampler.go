@@ -0,0 +1,48 @@
+package renderer
+
+import (
+	"fmt"
+	"grinder/pkg/math"
+)
+
+// LightSampler chooses how soft-shadow samples are spread over the light.
+type LightSampler string
+
+const (
+	SamplerJittered      LightSampler = ""          // one random point per grid cell, independently per pixel
+	SamplerMultiJittered LightSampler = "mj"        // correlated multi-jittered: also stratified along each axis
+	SamplerBlueNoise     LightSampler = "bluenoise" // one multi-jittered pattern shifted per pixel by a blue-noise mask
+)
+
+// ParseLightSampler validates a -sampler flag value.
+func ParseLightSampler(s string) (LightSampler, error) {
+	switch m := LightSampler(s); m {
+	case SamplerJittered, SamplerMultiJittered, SamplerBlueNoise:
+		return m, nil
+	case "jittered":
+		return SamplerJittered, nil
+	}
+	return SamplerJittered, fmt.Errorf("unknown light sampler %q (want jittered, mj or bluenoise)", s)
+}
+
+// lightSample returns the position in [0, 1)^2 of light sample (gx, gy) of
+// a grid x grid pattern for pixel (px, py).
+func (r *Renderer) lightSample(gx, gy, grid, px, py int, prng *math.XorShift32) (u, v float64) {
+	if r.deterministic {
+		return (float64(gx) + 0.5) / float64(grid), (float64(gy) + 0.5) / float64(grid)
+	}
+	s := gy*grid + gx
+	switch r.Sampler {
+	case SamplerMultiJittered:
+		// Every sample of a pixel must come from the same pattern.
+		return math.MultiJittered(s, grid, grid, uint32(px*73856093^py*19349663)|1)
+	case SamplerBlueNoise:
+		// The same pattern everywhere, toroidally shifted: neighbouring pixels
+		// get very different shifts, so their errors don't line up into blotches.
+		u, v = math.MultiJittered(s, grid, grid, 1)
+		u += math.BlueNoise(px, py)
+		v += math.BlueNoise(px+math.BlueNoiseSize/2, py+math.BlueNoiseSize/3)
+		return u - float64(int(u)), v - float64(int(v))
+	}
+	return (float64(gx) + prng.NextFloat64()) / float64(grid), (float64(gy) + prng.NextFloat64()) / float64(grid)
+}
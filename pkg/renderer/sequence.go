@@ -0,0 +1,266 @@
+package renderer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	gomath "math"
+	"os"
+)
+
+// A baked sequence holds the raw atoms of every frame of an animation. Most
+// frames store only their difference from the frame before: the indices of
+// the previous frame's atoms that are gone, then the atoms that are new.
+// Every keyEvery-th frame stores all its atoms, so reading a frame never
+// replays more than keyEvery-1 deltas.
+//
+// File layout: SequenceHeader, the frames one after another, then the
+// frame table of SequenceFrame entries that SequenceHeader.FrameTable
+// points at.
+
+const (
+	sequenceMagic   = "SDSQ"
+	sequenceVersion = 1
+)
+
+// SequenceHeader is the file header of a baked sequence.
+type SequenceHeader struct {
+	Magic      [4]byte
+	Version    uint32
+	FrameCount uint32
+	KeyEvery   uint32
+	Tolerance  float32 // atoms this close, of one material, count as unchanged
+	Padding    uint32
+	FrameTable int64 // Absolute file offset to the frame table
+}
+
+// SequenceFrame describes one stored frame. A keyframe has no removed
+// indices and every atom of the frame as Added.
+type SequenceFrame struct {
+	Offset  int64
+	Key     uint32 // 1 = keyframe
+	Removed uint32 // Number of uint32 indices into the previous frame
+	Added   uint32 // Number of BakedAtoms after the indices
+	Padding uint32
+}
+
+// Size returns the bytes the frame takes in the file.
+func (f SequenceFrame) Size() int64 {
+	return int64(f.Removed)*4 + int64(f.Added)*AtomSize
+}
+
+// SequenceWriter writes a baked sequence frame by frame, holding only the
+// previous frame's atoms.
+type SequenceWriter struct {
+	w         io.WriteSeeker
+	header    SequenceHeader
+	frames    []SequenceFrame
+	prev      []BakedAtom
+	offset    int64
+	tolerance float32
+}
+
+// NewSequenceWriter starts a sequence on w. Every keyEvery-th frame is a
+// keyframe; atoms of one material whose positions round to the same
+// tolerance cell are treated as unchanged between frames.
+func NewSequenceWriter(w io.WriteSeeker, keyEvery int, tolerance float32) (*SequenceWriter, error) {
+	if keyEvery < 1 {
+		return nil, fmt.Errorf("keyframe interval %d, want at least 1", keyEvery)
+	}
+	if !(tolerance > 0) {
+		return nil, fmt.Errorf("tolerance %v, want it positive", tolerance)
+	}
+	sw := &SequenceWriter{w: w, tolerance: tolerance}
+	copy(sw.header.Magic[:], sequenceMagic)
+	sw.header.Version = sequenceVersion
+	sw.header.KeyEvery = uint32(keyEvery)
+	sw.header.Tolerance = tolerance
+	if err := binary.Write(w, binary.LittleEndian, sw.header); err != nil {
+		return nil, err
+	}
+	sw.offset = int64(binary.Size(sw.header))
+	return sw, nil
+}
+
+// atomKey identifies an atom across frames: its material and its position
+// rounded to the tolerance.
+type atomKey struct {
+	x, y, z int64
+	id      uint8
+}
+
+func keyOf(a BakedAtom, tolerance float32) atomKey {
+	q := func(v float32) int64 { return int64(gomath.Round(float64(v / tolerance))) }
+	return atomKey{q(a.Pos[0]), q(a.Pos[1]), q(a.Pos[2]), a.MaterialID}
+}
+
+// WriteFrame appends the next frame, given all its atoms.
+func (sw *SequenceWriter) WriteFrame(atoms []BakedAtom) error {
+	frame := SequenceFrame{Offset: sw.offset}
+	var removed []uint32
+	var added []BakedAtom
+	if len(sw.frames)%int(sw.header.KeyEvery) == 0 {
+		frame.Key = 1
+		added = atoms
+	} else {
+		removed, added = diffAtoms(sw.prev, atoms, sw.tolerance)
+	}
+	frame.Removed, frame.Added = uint32(len(removed)), uint32(len(added))
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, removed)
+	for i := range added {
+		added[i].Write(&buf)
+	}
+	if _, err := sw.w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	sw.offset += int64(buf.Len())
+	sw.frames = append(sw.frames, frame)
+	// Keep what a reader will rebuild, so deltas chain off it exactly.
+	if frame.Key == 1 {
+		sw.prev = append(sw.prev[:0], atoms...)
+	} else {
+		sw.prev = applyDelta(sw.prev, removed, added)
+	}
+	return nil
+}
+
+// Frames returns the frames written so far.
+func (sw *SequenceWriter) Frames() []SequenceFrame { return sw.frames }
+
+// Close writes the frame table and the final header. It doesn't close the
+// underlying writer.
+func (sw *SequenceWriter) Close() error {
+	sw.header.FrameCount = uint32(len(sw.frames))
+	sw.header.FrameTable = sw.offset
+	if err := binary.Write(sw.w, binary.LittleEndian, sw.frames); err != nil {
+		return err
+	}
+	if _, err := sw.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return binary.Write(sw.w, binary.LittleEndian, sw.header)
+}
+
+// diffAtoms returns the indices of prev's atoms missing from cur and the
+// atoms of cur missing from prev.
+func diffAtoms(prev, cur []BakedAtom, tolerance float32) (removed []uint32, added []BakedAtom) {
+	unmatched := make(map[atomKey][]uint32, len(prev))
+	for i, a := range prev {
+		k := keyOf(a, tolerance)
+		unmatched[k] = append(unmatched[k], uint32(i))
+	}
+	for _, a := range cur {
+		k := keyOf(a, tolerance)
+		if idx := unmatched[k]; len(idx) > 0 {
+			unmatched[k] = idx[1:]
+			continue
+		}
+		added = append(added, a)
+	}
+	for _, idx := range unmatched {
+		removed = append(removed, idx...)
+	}
+	return removed, added
+}
+
+// applyDelta rebuilds a frame from the one before it: prev without the
+// removed indices, in order, followed by the added atoms.
+func applyDelta(prev []BakedAtom, removed []uint32, added []BakedAtom) []BakedAtom {
+	gone := make([]bool, len(prev))
+	for _, i := range removed {
+		gone[i] = true
+	}
+	out := make([]BakedAtom, 0, len(prev)-len(removed)+len(added))
+	for i, a := range prev {
+		if !gone[i] {
+			out = append(out, a)
+		}
+	}
+	return append(out, added...)
+}
+
+// BakedSequence is an open baked sequence file.
+type BakedSequence struct {
+	Header SequenceHeader
+	Frames []SequenceFrame
+	f      *os.File
+}
+
+// LoadSequence opens a baked sequence and reads its frame table.
+func LoadSequence(filename string) (*BakedSequence, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	s := &BakedSequence{f: f}
+	if err := binary.Read(f, binary.LittleEndian, &s.Header); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: reading sequence header: %w", filename, err)
+	}
+	if string(s.Header.Magic[:]) != sequenceMagic {
+		f.Close()
+		return nil, fmt.Errorf("%s: bad magic %q, not a baked sequence", filename, s.Header.Magic[:])
+	}
+	if s.Header.Version != sequenceVersion {
+		f.Close()
+		return nil, fmt.Errorf("%s: unsupported baked sequence version %d (want %d)", filename, s.Header.Version, sequenceVersion)
+	}
+	s.Frames = make([]SequenceFrame, s.Header.FrameCount)
+	table := io.NewSectionReader(f, s.Header.FrameTable, int64(binary.Size(s.Frames)))
+	if err := binary.Read(table, binary.LittleEndian, s.Frames); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: reading frame table: %w", filename, err)
+	}
+	return s, nil
+}
+
+// Close closes the sequence file.
+func (s *BakedSequence) Close() error { return s.f.Close() }
+
+// Frame rebuilds every atom of frame i from the keyframe before it.
+func (s *BakedSequence) Frame(i int) ([]BakedAtom, error) {
+	if i < 0 || i >= len(s.Frames) {
+		return nil, fmt.Errorf("frame %d out of range [0, %d)", i, len(s.Frames))
+	}
+	key := i
+	for s.Frames[key].Key != 1 {
+		if key == 0 {
+			return nil, fmt.Errorf("frame %d has no keyframe before it", i)
+		}
+		key--
+	}
+	var atoms []BakedAtom
+	for k := key; k <= i; k++ {
+		removed, added, err := s.readFrame(s.Frames[k])
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %w", k, err)
+		}
+		if s.Frames[k].Key == 1 {
+			atoms = added
+			continue
+		}
+		for _, r := range removed {
+			if int(r) >= len(atoms) {
+				return nil, fmt.Errorf("frame %d: removed index %d out of range for %d atoms", k, r, len(atoms))
+			}
+		}
+		atoms = applyDelta(atoms, removed, added)
+	}
+	return atoms, nil
+}
+
+func (s *BakedSequence) readFrame(f SequenceFrame) ([]uint32, []BakedAtom, error) {
+	r := io.NewSectionReader(s.f, f.Offset, f.Size())
+	removed := make([]uint32, f.Removed)
+	if err := binary.Read(r, binary.LittleEndian, removed); err != nil {
+		return nil, nil, err
+	}
+	added := make([]BakedAtom, f.Added)
+	if err := binary.Read(r, binary.LittleEndian, added); err != nil {
+		return nil, nil, err
+	}
+	return removed, added, nil
+}
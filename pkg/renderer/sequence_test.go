@@ -0,0 +1,112 @@
+package renderer
+
+import (
+	"grinder/pkg/camera"
+	"grinder/pkg/geometry"
+	"grinder/pkg/math"
+	"grinder/pkg/shading"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// sequenceTestFrames bakes a large still sphere and a small moving one at
+// each of times.
+func sequenceTestFrames(t *testing.T, times ...float64) [][]BakedAtom {
+	eye, target, up := math.Point3D{Z: 8}, math.Point3D{}, math.Point3D{Y: 1}
+	cam := camera.NewLookAtCamera(eye, target, up, 45, 1)
+	shapes := []geometry.Shape{
+		geometry.Sphere3D{Center: math.Point3D{X: -0.5}, Radius: 1.5, Color: color.RGBA{R: 255, A: 255}},
+		geometry.Sphere3D{Center: math.Point3D{X: 1.5, Y: 1}, Velocity: math.Point3D{Y: -2}, Radius: 0.3, Color: color.RGBA{G: 255, A: 255}},
+	}
+	light := shading.Light{Position: math.Point3D{Y: 5}, Intensity: 1}
+	engine := NewBakeEngine(cam, shapes, light, 64, 64, 0.02, 6, 10, target, up, 45)
+	var frames [][]BakedAtom
+	for _, tm := range times {
+		engine.Time = tm
+		atoms, err := engine.BakeAtoms()
+		if err != nil {
+			t.Fatalf("BakeAtoms at t=%v failed: %v", tm, err)
+		}
+		frames = append(frames, atoms)
+	}
+	return frames
+}
+
+// sameAtoms reports whether a and b hold the same atoms in any order.
+func sameAtoms(a, b []BakedAtom) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	count := make(map[BakedAtom]int, len(a))
+	for _, x := range a {
+		count[x]++
+	}
+	for _, x := range b {
+		if count[x] == 0 {
+			return false
+		}
+		count[x]--
+	}
+	return true
+}
+
+func TestSequence_RoundTrip(t *testing.T) {
+	frames := sequenceTestFrames(t, 0, 0.5, 1)
+	path := filepath.Join(t.TempDir(), "anim.seq")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sw, err := NewSequenceWriter(f, 2, 1e-4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, atoms := range frames {
+		if err := sw.WriteFrame(atoms); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	seq, err := LoadSequence(path)
+	if err != nil {
+		t.Fatalf("LoadSequence failed: %v", err)
+	}
+	defer seq.Close()
+	if len(seq.Frames) != 3 {
+		t.Fatalf("%d frames, want 3", len(seq.Frames))
+	}
+	for i, wantKey := range []uint32{1, 0, 1} {
+		if seq.Frames[i].Key != wantKey {
+			t.Errorf("frame %d Key = %d, want %d", i, seq.Frames[i].Key, wantKey)
+		}
+	}
+	// Only the small sphere moves, so the delta is a fraction of a frame.
+	if full, delta := seq.Frames[0].Size(), seq.Frames[1].Size(); delta*4 > full {
+		t.Errorf("delta frame is %d bytes against %d for a full frame, want under a quarter", delta, full)
+	}
+	for i, want := range frames {
+		got, err := seq.Frame(i)
+		if err != nil {
+			t.Fatalf("Frame(%d) failed: %v", i, err)
+		}
+		if !sameAtoms(got, want) {
+			t.Errorf("Frame(%d) rebuilt %d atoms that differ from the %d baked", i, len(got), len(want))
+		}
+	}
+	if _, err := seq.Frame(3); err == nil {
+		t.Error("Frame(3) past the end succeeded")
+	}
+}
+
+func TestLoadSequence_BadMagic(t *testing.T) {
+	_, final := bakeTestScene(t)
+	if _, err := LoadSequence(final); err == nil {
+		t.Error("LoadSequence accepted a baked scene")
+	}
+}
@@ -0,0 +1,80 @@
+package renderer
+
+import (
+	"grinder/pkg/math"
+	gomath "math"
+)
+
+// smoothReach is how far Smooth looks for neighbours, in hit atom sizes.
+// It takes in the ring of neighbours around the hit atom with a third of
+// its weight, and weighs two atoms equally where a ray passes between them,
+// so attributes vary continuously across atom boundaries.
+const smoothReach = 1.5
+
+// Smooth blends the albedo and normal of atom, hit by ray, with those of
+// its neighbours of the same material, weighted by a tent falling to zero
+// smoothReach atom sizes from the hit point. Neighbours facing away from the
+// hit are skipped, so the two sides of a thin surface don't mix. It costs a
+// BLAS query per hit, so callers enable it by choice.
+func (s *BakedScene) Smooth(atom BakedAtom, ray math.Ray) BakedAtom {
+	center := math.Point3D{X: float64(atom.Pos[0]), Y: float64(atom.Pos[1]), Z: float64(atom.Pos[2])}
+	p := ray.Origin.Add(ray.Direction.Mul(center.Sub(ray.Origin).Dot(ray.Direction)))
+	n := OctDecode(atom.Normal)
+	reach := smoothReach * 2 * float64(atom.HalfExtent)
+	if reach <= 0 {
+		return atom
+	}
+
+	var albedo, normal math.Point3D
+	var total float64
+	box := math.AABB3D{Min: p.Sub(math.Point3D{X: reach, Y: reach, Z: reach}), Max: p.Add(math.Point3D{X: reach, Y: reach, Z: reach})}
+	s.eachAtomIn(box, func(b BakedAtom) {
+		if b.MaterialID != atom.MaterialID {
+			return
+		}
+		bn := OctDecode(b.Normal)
+		if bn.Dot(n) <= 0 {
+			return
+		}
+		d := math.Point3D{X: float64(b.Pos[0]), Y: float64(b.Pos[1]), Z: float64(b.Pos[2])}.Sub(p).Length()
+		w := 1 - d/reach
+		if w <= 0 {
+			return
+		}
+		albedo = albedo.Add(math.Point3D{X: float64(b.Albedo[0]), Y: float64(b.Albedo[1]), Z: float64(b.Albedo[2])}.Mul(w))
+		normal = normal.Add(bn.Mul(w))
+		total += w
+	})
+	if total == 0 {
+		return atom
+	}
+	albedo = albedo.Mul(1 / total)
+	atom.Albedo = [3]uint8{uint8(gomath.Round(albedo.X)), uint8(gomath.Round(albedo.Y)), uint8(gomath.Round(albedo.Z))}
+	if normal.Length() > 0 {
+		atom.Normal = OctEncode(normal.Normalize())
+	}
+	return atom
+}
+
+// eachAtomIn calls fn for every atom whose center lies in box.
+func (s *BakedScene) eachAtomIn(box math.AABB3D, fn func(BakedAtom)) {
+	overlaps := func(lo, hi [3]float32) bool {
+		return float64(lo[0]) <= box.Max.X && float64(hi[0]) >= box.Min.X &&
+			float64(lo[1]) <= box.Max.Y && float64(hi[1]) >= box.Min.Y &&
+			float64(lo[2]) <= box.Max.Z && float64(hi[2]) >= box.Min.Z
+	}
+	var buf [64 * AtomSize]byte
+	s.walkNodes(overlaps, func(node BLASNode) bool {
+		atoms, ok := s.leafAtoms(node, buf[:])
+		if !ok {
+			return true
+		}
+		for k := 0; k < int(node.AtomCount); k++ {
+			a := decodeBakedAtom(atoms[k*AtomSize:])
+			if overlaps(a.Pos, a.Pos) {
+				fn(a)
+			}
+		}
+		return true
+	})
+}
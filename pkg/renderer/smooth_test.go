@@ -0,0 +1,54 @@
+package renderer
+
+import (
+	"grinder/pkg/math"
+	gomath "math"
+	"testing"
+)
+
+// TestBakedScene_Smooth sweeps rays across the baked test sphere. The
+// smoothed normals must follow the true sphere more closely than the raw
+// atom normals, and jump less from one ray to the next.
+func TestBakedScene_Smooth(t *testing.T) {
+	_, final := bakeTestScene(t)
+	scene, err := LoadBakedScene(final)
+	if err != nil {
+		t.Fatalf("LoadBakedScene failed: %v", err)
+	}
+	defer scene.Close()
+
+	// sweep returns the mean angle between the hit normals and the sphere's,
+	// and the largest angle between consecutive hits.
+	sweep := func(smooth bool) (meanErr, maxStep float64) {
+		var prev math.Point3D
+		n := 0
+		for i := 0; i <= 200; i++ {
+			x := -0.6 + 1.2*float64(i)/200
+			ray := math.Ray{Origin: math.Point3D{X: x, Y: 0.2, Z: 5}, Direction: math.Point3D{Z: -1}}
+			hit, atom := scene.Intersect(ray)
+			if !hit {
+				t.Fatalf("ray at x=%v missed the sphere", x)
+			}
+			if smooth {
+				atom = scene.Smooth(atom, ray)
+			}
+			got := OctDecode(atom.Normal)
+			want := math.Point3D{X: x, Y: 0.2, Z: gomath.Sqrt(1 - x*x - 0.04)}
+			meanErr += gomath.Acos(gomath.Min(1, got.Dot(want)))
+			if i > 0 {
+				maxStep = gomath.Max(maxStep, gomath.Acos(gomath.Min(1, got.Dot(prev))))
+			}
+			prev = got
+			n++
+		}
+		return meanErr / float64(n), maxStep
+	}
+	rawErr, rawStep := sweep(false)
+	smoothErr, smoothStep := sweep(true)
+	if smoothErr >= rawErr {
+		t.Errorf("smoothed normals are %.4f rad off the sphere on average, raw ones %.4f", smoothErr, rawErr)
+	}
+	if smoothStep >= rawStep {
+		t.Errorf("smoothed normals jump up to %.4f rad between rays, raw ones %.4f", smoothStep, rawStep)
+	}
+}
@@ -0,0 +1,71 @@
+package renderer
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats counts where a render spends its work, for -stats. Workers count
+// into locals and add them here once per tile or query, so the counters
+// stay off the hot path. All methods are safe for concurrent use and do
+// nothing on a nil *Stats.
+type Stats struct {
+	PrimaryRays atomic.Int64 // pixels diced, or camera rays traced
+	ShadowRays  atomic.Int64
+	NodeVisits  atomic.Int64 // BVH, TLAS and BLAS nodes whose box was tested
+	AtomTests   atomic.Int64 // baked atoms tested against a ray
+
+	mu                        sync.Mutex
+	tiles                     int
+	tileMin, tileMax, tileSum time.Duration
+}
+
+// AddTile records the time one tile took.
+func (s *Stats) AddTile(d time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tiles == 0 || d < s.tileMin {
+		s.tileMin = d
+	}
+	s.tileMax = max(s.tileMax, d)
+	s.tileSum += d
+	s.tiles++
+}
+
+// traceCount is what one baked-scene query visited.
+type traceCount struct{ nodes, atoms int64 }
+
+func (s *Stats) addTrace(tc traceCount) {
+	if s == nil {
+		return
+	}
+	s.NodeVisits.Add(tc.nodes)
+	s.AtomTests.Add(tc.atoms)
+}
+
+// Report writes the counters and tile times, with wall as the total time.
+func (s *Stats) Report(w io.Writer, wall time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	tiles, tileMin, tileMax, tileSum := s.tiles, s.tileMin, s.tileMax, s.tileSum
+	s.mu.Unlock()
+	var tileAvg time.Duration
+	if tiles > 0 {
+		tileAvg = tileSum / time.Duration(tiles)
+	}
+	fmt.Fprintf(w, "wall time:    %v\n", wall.Round(time.Millisecond))
+	fmt.Fprintf(w, "tiles:        %d (min %v, max %v, avg %v)\n", tiles,
+		tileMin.Round(time.Microsecond), tileMax.Round(time.Microsecond), tileAvg.Round(time.Microsecond))
+	fmt.Fprintf(w, "primary rays: %d\n", s.PrimaryRays.Load())
+	fmt.Fprintf(w, "shadow rays:  %d\n", s.ShadowRays.Load())
+	fmt.Fprintf(w, "node visits:  %d\n", s.NodeVisits.Load())
+	fmt.Fprintf(w, "atoms tested: %d\n", s.AtomTests.Load())
+}
@@ -0,0 +1,78 @@
+package renderer
+
+import (
+	"bytes"
+	"grinder/pkg/math"
+	gomath "math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRenderer_Stats renders a frame in four tiles with statistics on: one
+// tile time each, one primary ray per pixel, and four light samples per lit
+// pixel must show up, and the output must not change.
+func TestRenderer_Stats(t *testing.T) {
+	r := newTestRenderer(32, 32)
+	stats := r.CollectStats()
+	for _, b := range []ScreenBounds{{0, 0, 16, 16}, {16, 0, 32, 16}, {0, 16, 16, 32}, {16, 16, 32, 32}} {
+		img := r.RenderDeterministic(b)
+		plain := newTestRenderer(32, 32).RenderDeterministic(b)
+		if !bytes.Equal(img.Pix, plain.Pix) {
+			t.Fatalf("tile %v differs with statistics on", b)
+		}
+	}
+
+	if got := stats.PrimaryRays.Load(); got != 32*32 {
+		t.Errorf("primary rays = %d, want %d", got, 32*32)
+	}
+	if got := stats.ShadowRays.Load(); got < 4*32*32/2 {
+		t.Errorf("shadow rays = %d, want four per lit pixel", got)
+	}
+	if stats.NodeVisits.Load() == 0 {
+		t.Errorf("no BVH node visits counted")
+	}
+	if stats.tiles != 4 || stats.tileMin > stats.tileMax || stats.tileMin <= 0 {
+		t.Errorf("%d tiles from %v to %v, want 4 with min <= max", stats.tiles, stats.tileMin, stats.tileMax)
+	}
+
+	var out strings.Builder
+	stats.Report(&out, time.Second)
+	for _, want := range []string{"wall time:    1s", "tiles:        4", "primary rays: 1024"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("report lacks %q:\n%s", want, out.String())
+		}
+	}
+	var none *Stats
+	out.Reset()
+	none.Report(&out, time.Second)
+	if out.Len() != 0 {
+		t.Errorf("a nil Stats reported:\n%s", out.String())
+	}
+}
+
+// TestBakedScene_Stats checks that both baked-scene queries count the nodes
+// and atoms they test, and that a nil Stats is fine.
+func TestBakedScene_Stats(t *testing.T) {
+	engine, final := bakeTestScene(t)
+	scene, err := LoadBakedScene(final)
+	if err != nil {
+		t.Fatalf("LoadBakedScene failed: %v", err)
+	}
+	defer scene.Close()
+
+	pNear, pFar := engine.Camera.Project(0.45, 0.45, engine.Near), engine.Camera.Project(0.45, 0.45, engine.Far)
+	ray := math.Ray{Origin: pNear, Direction: pFar.Sub(pNear).Normalize()}
+	scene.Intersect(ray)
+
+	scene.Stats = &Stats{}
+	scene.Intersect(ray)
+	nodes, atoms := scene.Stats.NodeVisits.Load(), scene.Stats.AtomTests.Load()
+	if nodes == 0 || atoms == 0 {
+		t.Fatalf("Intersect counted %d nodes and %d atoms, want some of each", nodes, atoms)
+	}
+	scene.IntersectP(ray, gomath.Inf(1))
+	if scene.Stats.NodeVisits.Load() == nodes || scene.Stats.AtomTests.Load() == atoms {
+		t.Errorf("IntersectP added no counts")
+	}
+}
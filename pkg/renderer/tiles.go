@@ -0,0 +1,76 @@
+package renderer
+
+import (
+	"image"
+	"image/draw"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// tileSize is the side in pixels of the tiles Tiles splits a frame into.
+const tileSize = 64
+
+// tileOverdraw is how many pixels past its edges each tile is rendered, so
+// the dicing at a tile's border sees its neighbours.
+const tileOverdraw = 1
+
+// Tiles returns the tiles of the frame that overlap region, clipped to the
+// frame, with the ones nearest its middle, usually what you're looking at,
+// first.
+func (r *Renderer) Tiles(region image.Rectangle) []image.Rectangle {
+	frame := image.Rect(0, 0, r.Width, r.Height)
+	var tiles []image.Rectangle
+	for y := 0; y < r.Height; y += tileSize {
+		for x := 0; x < r.Width; x += tileSize {
+			tile := image.Rect(x, y, x+tileSize, y+tileSize).Intersect(frame)
+			if tile.Overlaps(region) {
+				tiles = append(tiles, tile)
+			}
+		}
+	}
+	cx, cy := r.Width/2, r.Height/2
+	dist := func(t image.Rectangle) int {
+		dx, dy := (t.Min.X+t.Max.X)/2-cx, (t.Min.Y+t.Max.Y)/2-cy
+		return dx*dx + dy*dy
+	}
+	sort.SliceStable(tiles, func(i, j int) bool { return dist(tiles[i]) < dist(tiles[j]) })
+	return tiles
+}
+
+// RenderTiles renders tiles into dst on one worker per CPU and blocks until
+// every one is done. Each tile is drawn under mu as soon as it finishes,
+// and then done, if non-nil, is called. Tiles still queued when stale, if
+// non-nil, reports true are skipped; RenderTiles returns false then.
+func (r *Renderer) RenderTiles(dst *image.RGBA, mu *sync.Mutex, tiles []image.Rectangle, stale func() bool, done func()) bool {
+	jobs := make(chan image.Rectangle, len(tiles))
+	for _, tile := range tiles {
+		jobs <- tile
+	}
+	close(jobs)
+
+	var wg sync.WaitGroup
+	wg.Add(runtime.NumCPU())
+	for i := 0; i < runtime.NumCPU(); i++ {
+		go func() {
+			defer wg.Done()
+			for tile := range jobs {
+				if stale != nil && stale() {
+					continue
+				}
+				tileImg := r.Render(ScreenBounds{
+					MinX: tile.Min.X - tileOverdraw, MinY: tile.Min.Y - tileOverdraw,
+					MaxX: tile.Max.X + tileOverdraw, MaxY: tile.Max.Y + tileOverdraw,
+				})
+				mu.Lock()
+				draw.Draw(dst, tile, tileImg, image.Point{tileOverdraw, tileOverdraw}, draw.Src)
+				mu.Unlock()
+				if done != nil {
+					done()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return stale == nil || !stale()
+}
@@ -0,0 +1,54 @@
+package renderer
+
+import (
+	"image"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTiles(t *testing.T) {
+	r := newTestRenderer(130, 70)
+	tiles := r.Tiles(image.Rect(0, 0, 130, 70))
+	if len(tiles) != 6 {
+		t.Fatalf("got %d tiles of a 130x70 frame, want 6", len(tiles))
+	}
+	if want := image.Rect(64, 0, 128, 64); tiles[0] != want {
+		t.Errorf("first tile = %v, want the middle one %v", tiles[0], want)
+	}
+	for _, tile := range tiles {
+		if !tile.In(image.Rect(0, 0, 130, 70)) {
+			t.Errorf("tile %v runs off the frame", tile)
+		}
+	}
+	if got := r.Tiles(image.Rect(70, 10, 80, 20)); len(got) != 1 || got[0] != image.Rect(64, 0, 128, 64) {
+		t.Errorf("tiles over a small region = %v, want just the one it lies in", got)
+	}
+}
+
+func TestRenderTiles(t *testing.T) {
+	r := newTestRenderer(96, 96)
+	tiles := r.Tiles(image.Rect(0, 0, 96, 96))
+	dst := image.NewRGBA(image.Rect(0, 0, 96, 96))
+	var mu sync.Mutex
+	var n atomic.Int32
+	if !r.RenderTiles(dst, &mu, tiles, nil, func() { n.Add(1) }) {
+		t.Error("RenderTiles reported a finished render as stale")
+	}
+	if int(n.Load()) != len(tiles) {
+		t.Errorf("done called %d times for %d tiles", n.Load(), len(tiles))
+	}
+	if c := dst.RGBAAt(48, 48); c.A == 0 {
+		t.Error("the middle of the frame was not drawn")
+	}
+
+	skipped := image.NewRGBA(image.Rect(0, 0, 96, 96))
+	if r.RenderTiles(skipped, &mu, tiles, func() bool { return true }, nil) {
+		t.Error("RenderTiles reported a stale render as finished")
+	}
+	for _, p := range skipped.Pix {
+		if p != 0 {
+			t.Fatal("a stale render drew tiles")
+		}
+	}
+}
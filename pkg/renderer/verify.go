@@ -0,0 +1,203 @@
+package renderer
+
+import (
+	"fmt"
+	"grinder/pkg/geometry"
+	"grinder/pkg/math"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+const (
+	// verifySize is the width and height of the shape ID images Verify
+	// compares.
+	verifySize = 128
+	// verifySteps is how finely Verify marches each pixel ray through the
+	// live shapes, over the whole near to far range.
+	verifySteps = 1024
+	// minCoverage is the share of the live shapes' pixels the bake must hit
+	// for Verify to pass.
+	minCoverage = 0.95
+	// minShapeCoverage is the share of a shape's live pixels the bake must
+	// show as that shape before Verify calls it under-represented.
+	minShapeCoverage = 0.8
+)
+
+// Verification is the outcome of comparing a bake with its live shapes,
+// pixel by pixel, at the bake camera.
+type Verification struct {
+	Pixels  int // pixels the live shapes cover
+	Covered int // of those, pixels the bake hits too
+	Matched int // of those, pixels the bake hits with the same shape
+	// Live and Baked count per shape ID the pixels it covers live and the
+	// pixels of those the bake shows as it.
+	Live, Baked [maxMaterials]int
+}
+
+// Coverage is the share of the live shapes' pixels the bake hits.
+func (v *Verification) Coverage() float64 {
+	if v.Pixels == 0 {
+		return 1
+	}
+	return float64(v.Covered) / float64(v.Pixels)
+}
+
+// Match is the share of the live shapes' pixels the bake hits with the
+// same shape.
+func (v *Verification) Match() float64 {
+	if v.Pixels == 0 {
+		return 1
+	}
+	return float64(v.Matched) / float64(v.Pixels)
+}
+
+// UnderRepresented returns the IDs of the shapes the bake shows on less than
+// minShapeCoverage of their live pixels, in order.
+func (v *Verification) UnderRepresented() []int {
+	var ids []int
+	for id, n := range v.Live {
+		if n > 0 && float64(v.Baked[id]) < minShapeCoverage*float64(n) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// add merges the counts of o into v.
+func (v *Verification) add(o *Verification) {
+	v.Pixels += o.Pixels
+	v.Covered += o.Covered
+	v.Matched += o.Matched
+	for id := range v.Live {
+		v.Live[id] += o.Live[id]
+		v.Baked[id] += o.Baked[id]
+	}
+}
+
+// Verify renders a verifySize² shape ID image of bakedFile and of the live
+// shapes from the bake camera and compares them. It fails when the bake hits
+// less than minCoverage of the pixels the shapes cover, and names the shapes
+// it under-represents.
+func (e *BakeEngine) Verify(bakedFile string) error {
+	scene, err := LoadBakedScene(bakedFile)
+	if err != nil {
+		return err
+	}
+	defer scene.Close()
+	fmt.Printf("Verifying baked scene %s...\nAtoms: %d, TLASRoot offset: %d\n", bakedFile, scene.Header.AtomCount, scene.Header.TLASRoot)
+	v := e.verify(scene)
+	fmt.Printf("Coverage: %.1f%% of %d shape pixels, same shape on %.1f%%\n", 100*v.Coverage(), v.Pixels, 100*v.Match())
+	under := v.UnderRepresented()
+	for _, id := range under {
+		fmt.Printf("Shape %d is under-represented: baked on %d of its %d pixels\n", id, v.Baked[id], v.Live[id])
+	}
+	if v.Coverage() < minCoverage {
+		return fmt.Errorf("bake covers %.1f%% of the shapes' pixels, want at least %.0f%% (under-represented shapes: %v)", 100*v.Coverage(), 100*minCoverage, under)
+	}
+	return nil
+}
+
+// verify compares the pixels of scene and the live shapes, a row at a time
+// in parallel.
+func (e *BakeEngine) verify(scene *BakedScene) *Verification {
+	bvh := geometry.NewBVH(e.Shapes)
+	var bounds *math.AABB3D
+	if e.ViewIndependent {
+		// Only the world cube was baked; the live shapes are cut to it too.
+		b := e.worldAABB()
+		bounds = &b
+	}
+	rows := make(chan int, verifySize)
+	for y := 0; y < verifySize; y++ {
+		rows <- y
+	}
+	close(rows)
+
+	total := &Verification{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v := &Verification{}
+			for y := range rows {
+				for x := 0; x < verifySize; x++ {
+					fx, fy := (float64(x)+0.5)/verifySize, (float64(y)+0.5)/verifySize
+					pNear, pFar := e.Camera.Project(fx, fy, e.Near), e.Camera.Project(fx, fy, e.Far)
+					id, ok := e.liveShapeAt(bvh, pNear, pFar, bounds)
+					if !ok {
+						continue
+					}
+					v.Pixels++
+					v.Live[id]++
+					hit, atom := scene.Intersect(math.Ray{Origin: pNear, Direction: pFar.Sub(pNear).Normalize()})
+					if !hit {
+						continue
+					}
+					v.Covered++
+					if atom.MaterialID == id {
+						v.Matched++
+						v.Baked[id]++
+					}
+				}
+			}
+			mu.Lock()
+			total.add(v)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return total
+}
+
+// liveShapeAt marches from pNear to pFar through the shapes and returns the
+// ID of the first one it steps into from outside, skipping points outside
+// bounds when bounds is set.
+func (e *BakeEngine) liveShapeAt(bvh *geometry.BVH, pNear, pFar math.Point3D, bounds *math.AABB3D) (uint8, bool) {
+	ray := math.Ray{Origin: pNear, Direction: pFar.Sub(pNear), Time: e.Time}
+	type span struct {
+		id     uint8
+		s      geometry.Shape
+		t0, t1 float64
+	}
+	var spans []span
+	for _, s := range bvh.IntersectsShapes(math.AABB3D{Min: pNear, Max: pNear}.Expand(pFar)) {
+		id, ok := e.shapeIDs[s]
+		if !ok {
+			continue
+		}
+		t0, t1, ok := s.GetAABB().IntersectRay(ray)
+		if ok && t1 >= 0 && t0 <= 1 {
+			spans = append(spans, span{id, s, max(t0, 0), min(t1, 1)})
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].t0 < spans[j].t0 })
+
+	best, bestT := uint8(0), 2.0
+	for _, sp := range spans {
+		if sp.t0 >= bestT {
+			break
+		}
+		// A ray that starts inside the shape, like one below a floor plane
+		// that crossed the frustum before the near plane, has to leave it
+		// before it can step in.
+		k0 := int(sp.t0 * verifySteps)
+		outside := k0 > 0
+		for k := k0; k <= int(sp.t1*verifySteps) && float64(k) < bestT*verifySteps; k++ {
+			t := float64(k) / verifySteps
+			p := ray.Origin.Add(ray.Direction.Mul(t))
+			if bounds != nil && !bounds.Contains(p) {
+				continue
+			}
+			if !sp.s.Contains(p, e.Time) {
+				outside = true
+			} else if outside {
+				best, bestT = sp.id, t
+				break
+			}
+		}
+	}
+	return best, bestT <= 1
+}
@@ -0,0 +1,38 @@
+package renderer
+
+import (
+	"grinder/pkg/geometry"
+	"grinder/pkg/math"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// TestBakeEngine_Verify checks that the test sphere's bake passes, and that
+// verifying it against a scene with a second shape the bake lacks fails and
+// names that shape.
+func TestBakeEngine_Verify(t *testing.T) {
+	engine, final := bakeTestScene(t)
+	if err := engine.Verify(final); err != nil {
+		t.Fatalf("Verify of a faithful bake failed: %v", err)
+	}
+
+	box := geometry.Box3D{Min: math.Point3D{X: 1.1, Y: -1, Z: -1}, Max: math.Point3D{X: 2, Y: 1, Z: 1}, Color: color.RGBA{G: 255, A: 255}}
+	withBox := NewBakeEngine(engine.Camera, append(engine.Shapes, box), engine.Light, 64, 64, 0.05, 3, 7, engine.CamTarget, engine.CamUp, engine.CamFov)
+	scene, err := LoadBakedScene(final)
+	if err != nil {
+		t.Fatalf("LoadBakedScene failed: %v", err)
+	}
+	defer scene.Close()
+	v := withBox.verify(scene)
+	if got := v.UnderRepresented(); len(got) != 1 || got[0] != 1 {
+		t.Errorf("UnderRepresented() = %v, want [1]", got)
+	}
+	if v.Baked[0] != v.Live[0] || v.Baked[1] != 0 {
+		t.Errorf("sphere baked on %d of %d pixels and box on %d, want all and none", v.Baked[0], v.Live[0], v.Baked[1])
+	}
+	err = withBox.Verify(final)
+	if err == nil || !strings.Contains(err.Error(), "[1]") {
+		t.Errorf("Verify = %v, want a coverage error naming shape 1", err)
+	}
+}
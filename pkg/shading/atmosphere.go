@@ -1,11 +1,54 @@
 package shading
 
 import (
+	"fmt"
 	"grinder/pkg/math"
 	"image/color"
 	gomath "math"
 )
 
+// Fog falloff types for Atmosphere.Type.
+const (
+	FogExp    = "exp"
+	FogLinear = "linear"
+)
+
+// Validate reports a configuration ApplyAtmosphere can't use. A disabled
+// atmosphere is always valid.
+func (c AtmosphereConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	a := c.Atmosphere
+	switch a.Type {
+	case "", FogExp:
+		if a.Density < 0 {
+			return fmt.Errorf("density must be >= 0, got %g", a.Density)
+		}
+	case FogLinear:
+		if a.End <= a.Start {
+			return fmt.Errorf("linear fog end must be greater than start, got start %g end %g", a.Start, a.End)
+		}
+		if a.Scattering > 0 {
+			return fmt.Errorf("scattering needs exp fog")
+		}
+	default:
+		return fmt.Errorf("unknown fog type: %q", a.Type)
+	}
+	return nil
+}
+
+// fogFactor returns how much of the fog color replaces the surface at the
+// given distance, in [0, 1].
+func (a Atmosphere) fogFactor(distance float64) float64 {
+	if a.Type == FogLinear {
+		return gomath.Max(0, gomath.Min(1, (distance-a.Start)/(a.End-a.Start)))
+	}
+	return 1.0 - gomath.Exp(-distance*a.Density)
+}
+
+// ApplyAtmosphere blends surfaceColor toward the fog color by the fog
+// factor at distance from the eye.
 func ApplyAtmosphere(surfaceColor color.RGBA, distance float64, config AtmosphereConfig) color.RGBA {
 	if !config.Enabled {
 		return surfaceColor
@@ -19,16 +62,49 @@ func ApplyAtmosphere(surfaceColor color.RGBA, distance float64, config Atmospher
 	}
 
 	// Calculate atmosphere blending factor
-	factor := 1.0 - gomath.Exp(-distance*config.Atmosphere.Density)
+	factor := config.Atmosphere.fogFactor(distance)
 
 	// Blend surface color with atmosphere color
 	finalColorVec := surfaceColorVec.Mul(1.0 - factor).Add(config.Atmosphere.Color.Mul(factor))
 
 	// Convert final color back to RGBA
-	return color.RGBA{
-		R: uint8(gomath.Min(255, finalColorVec.X*255.0)),
-		G: uint8(gomath.Min(255, finalColorVec.Y*255.0)),
-		B: uint8(gomath.Min(255, finalColorVec.Z*255.0)),
-		A: 255,
+	return math.ClampColor(finalColorVec.Mul(255))
+}
+
+// ApplyLitAtmosphere fogs the color seen at p from eye with single scattering
+// from the point light l, for a homogeneous medium. The surface is dimmed by
+// the transmittance exp(-density*d) as in ApplyAtmosphere, but instead of a
+// flat fog color the medium adds the light it scatters toward the eye. For a
+// light at distance h from the view ray, and b along it, the in-scattered
+// inverse-square light integrates in closed form to
+//
+//	I/h * (atan((d-b)/h) + atan(b/h))
+//
+// so the fog glows around the light and stays dark away from it. Extinction
+// on the way to the light is approximated by that at the closest point.
+// Only exp fog scatters; Validate rejects scattering on linear fog.
+func ApplyLitAtmosphere(surfaceColor color.RGBA, eye, p math.Point3D, l Light, config AtmosphereConfig) color.RGBA {
+	if !config.Enabled {
+		return surfaceColor
 	}
+	view := p.Sub(eye)
+	d := view.Length()
+	if d == 0 {
+		return surfaceColor
+	}
+	dir := view.Mul(1 / d)
+	toLight := l.Position.Sub(eye)
+	b := toLight.Dot(dir)
+	// Keep the ray from passing through the light's singularity.
+	h := gomath.Max(toLight.Sub(dir.Mul(b)).Length(), gomath.Max(l.Radius, 0.05))
+	airlight := l.Intensity / h * (gomath.Atan((d-b)/h) + gomath.Atan(b/h))
+
+	density := config.Atmosphere.Density
+	transmittance := gomath.Exp(-d * density)
+	scatter := config.Atmosphere.Scattering * airlight * gomath.Exp(-density*gomath.Max(0, gomath.Min(b, d)))
+	tint := l.tint()
+	fog := math.Point3D{X: config.Atmosphere.Color.X * tint.X, Y: config.Atmosphere.Color.Y * tint.Y, Z: config.Atmosphere.Color.Z * tint.Z}.Mul(scatter)
+
+	surface := math.Point3D{X: float64(surfaceColor.R), Y: float64(surfaceColor.G), Z: float64(surfaceColor.B)}
+	return math.ClampColor(surface.Mul(transmittance).Add(fog.Mul(255)))
 }
@@ -0,0 +1,91 @@
+package shading
+
+import (
+	"grinder/pkg/math"
+	"image/color"
+	gomath "math"
+	"testing"
+)
+
+func TestApplyLitAtmosphere(t *testing.T) {
+	config := AtmosphereConfig{
+		Enabled:    true,
+		Atmosphere: Atmosphere{Color: math.Point3D{X: 1, Y: 1, Z: 1}, Density: 0.1, Scattering: 0.1},
+	}
+	light := Light{Position: math.Point3D{Y: 1, Z: -5}, Intensity: 1}
+	eye := math.Point3D{}
+	black := color.RGBA{A: 255}
+
+	// A view ray passing just under the light picks up far more scattered
+	// light than one of the same length pointing away from it.
+	near := ApplyLitAtmosphere(black, eye, math.Point3D{Z: -10}, light, config)
+	away := ApplyLitAtmosphere(black, eye, math.Point3D{Z: 10}, light, config)
+	if near.R <= away.R {
+		t.Errorf("toward light R = %d, away R = %d; want the ray past the light brighter", near.R, away.R)
+	}
+
+	// The surface is dimmed by the same transmittance as ApplyAtmosphere.
+	config.Atmosphere.Scattering = 0
+	white := color.RGBA{R: 200, G: 200, B: 200, A: 255}
+	lit := ApplyLitAtmosphere(white, eye, math.Point3D{Z: -10}, light, config)
+	config.Atmosphere.Color = math.Point3D{}
+	flat := ApplyAtmosphere(white, 10, config)
+	if lit != flat {
+		t.Errorf("unlit medium = %v, want %v", lit, flat)
+	}
+
+	config.Enabled = false
+	if got := ApplyLitAtmosphere(white, eye, math.Point3D{Z: -10}, light, config); got != white {
+		t.Errorf("disabled = %v, want surface color %v", got, white)
+	}
+}
+
+func TestApplyAtmosphere_Modes(t *testing.T) {
+	surface := color.RGBA{R: 200, G: 200, B: 200, A: 255}
+	fog := math.Point3D{}
+	tests := []struct {
+		name     string
+		atmos    Atmosphere
+		distance float64
+		want     uint8
+	}{
+		// exp: 1 - exp(-0.5*2) of the way to black.
+		{"exp default", Atmosphere{Color: fog, Density: 0.5}, 2, uint8(200 * gomath.Exp(-1))},
+		{"exp", Atmosphere{Type: FogExp, Color: fog, Density: 0.5}, 2, uint8(200 * gomath.Exp(-1))},
+		{"exp at eye", Atmosphere{Type: FogExp, Color: fog, Density: 0.5}, 0, 200},
+		// linear: none before start, half way at the midpoint, full past end.
+		{"linear before start", Atmosphere{Type: FogLinear, Color: fog, Start: 2, End: 6}, 1, 200},
+		{"linear midpoint", Atmosphere{Type: FogLinear, Color: fog, Start: 2, End: 6}, 4, 100},
+		{"linear past end", Atmosphere{Type: FogLinear, Color: fog, Start: 2, End: 6}, 10, 0},
+	}
+	for _, tt := range tests {
+		config := AtmosphereConfig{Enabled: true, Atmosphere: tt.atmos}
+		if err := config.Validate(); err != nil {
+			t.Fatalf("%s: Validate: %v", tt.name, err)
+		}
+		got := ApplyAtmosphere(surface, tt.distance, config)
+		if d := int(got.R) - int(tt.want); d < -1 || d > 1 {
+			t.Errorf("%s: R = %d, want %d", tt.name, got.R, tt.want)
+		}
+	}
+}
+
+func TestAtmosphereConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name  string
+		atmos Atmosphere
+	}{
+		{"unknown type", Atmosphere{Type: "fractal"}},
+		{"negative density", Atmosphere{Density: -1}},
+		{"linear empty range", Atmosphere{Type: FogLinear, Start: 5, End: 5}},
+		{"linear scattering", Atmosphere{Type: FogLinear, Start: 0, End: 5, Scattering: 1}},
+	}
+	for _, tt := range tests {
+		if err := (AtmosphereConfig{Enabled: true, Atmosphere: tt.atmos}).Validate(); err == nil {
+			t.Errorf("%s: Validate() = nil, want an error", tt.name)
+		}
+		if err := (AtmosphereConfig{Atmosphere: tt.atmos}).Validate(); err != nil {
+			t.Errorf("%s: disabled Validate() = %v, want nil", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package shading
+
+// The Fraunhofer lines an Abbe number is measured at, in nanometres: a
+// glass's nominal index is its index at the d line.
+const (
+	lineD = 587.6
+	lineF = 486.1
+	lineC = 656.3
+)
+
+// ChannelWavelengths are the wavelengths, in nanometres, that red, green and
+// blue stand for when a dispersive glass splits light.
+var ChannelWavelengths = [3]float64{650, 550, 450}
+
+// DispersedIOR returns the index of refraction at wavelength nm of a glass
+// with index ior at the d line and Abbe number abbe, following Cauchy's
+// n = A + B/λ². Shorter wavelengths bend more. A non-positive abbe disperses
+// nothing.
+func DispersedIOR(ior, abbe, wavelength float64) float64 {
+	if abbe <= 0 {
+		return ior
+	}
+	b := (ior - 1) / abbe / (1/(lineF*lineF) - 1/(lineC*lineC))
+	return ior + b*(1/(wavelength*wavelength)-1/(lineD*lineD))
+}
@@ -0,0 +1,26 @@
+package shading
+
+import (
+	gomath "math"
+	"testing"
+)
+
+// TestDispersedIOR checks the index against the Abbe number's definition,
+// V = (n_d - 1) / (n_F - n_C), and that blue bends more than red.
+func TestDispersedIOR(t *testing.T) {
+	const ior, abbe = 1.5, 40.0
+	if got := DispersedIOR(ior, abbe, lineD); gomath.Abs(got-ior) > 1e-12 {
+		t.Errorf("index at the d line = %v, want %v", got, ior)
+	}
+	spread := DispersedIOR(ior, abbe, lineF) - DispersedIOR(ior, abbe, lineC)
+	if gomath.Abs(spread-(ior-1)/abbe) > 1e-12 {
+		t.Errorf("n_F - n_C = %v, want (n_d - 1) / V = %v", spread, (ior-1)/abbe)
+	}
+	red, blue := DispersedIOR(ior, abbe, ChannelWavelengths[0]), DispersedIOR(ior, abbe, ChannelWavelengths[2])
+	if !(blue > red) {
+		t.Errorf("blue index %v should exceed red index %v", blue, red)
+	}
+	if got := DispersedIOR(ior, 0, ChannelWavelengths[2]); got != ior {
+		t.Errorf("index without dispersion = %v, want %v", got, ior)
+	}
+}
@@ -0,0 +1,63 @@
+package shading
+
+import (
+	"grinder/pkg/math"
+	gomath "math"
+)
+
+// Environment gives the radiance arriving from a direction. It lights
+// surfaces in place of the constant ambient term.
+type Environment interface {
+	Radiance(dir math.Point3D) math.Point3D
+}
+
+// GradientEnvironment blends from Ground straight down to Sky straight up.
+type GradientEnvironment struct {
+	Sky, Ground math.Point3D
+}
+
+// Radiance returns the gradient color at dir's elevation.
+func (g GradientEnvironment) Radiance(dir math.Point3D) math.Point3D {
+	t := 0.5 * (dir.Normalize().Y + 1)
+	return g.Ground.Mul(1 - t).Add(g.Sky.Mul(t))
+}
+
+// EnvironmentMap is a latitude-longitude (equirectangular) radiance image:
+// u runs around the horizon starting behind -Z, with -Z in the middle and +X
+// at three quarters, and v runs from straight up to straight down. This is
+// the layout an EquirectangularCamera looking down -Z renders.
+type EnvironmentMap struct {
+	Width, Height int
+	Pixels        []math.Point3D // rows top to bottom
+}
+
+// NewEnvironmentMap wraps width x height linear RGB pixels, rows top to
+// bottom, scaled by intensity.
+func NewEnvironmentMap(width, height int, pixels []math.Point3D, intensity float64) *EnvironmentMap {
+	scaled := make([]math.Point3D, len(pixels))
+	for i, p := range pixels {
+		scaled[i] = p.Mul(intensity)
+	}
+	return &EnvironmentMap{Width: width, Height: height, Pixels: scaled}
+}
+
+// Radiance bilinearly samples the map in direction dir. It wraps around the
+// horizon and clamps at the poles.
+func (e *EnvironmentMap) Radiance(dir math.Point3D) math.Point3D {
+	d := dir.Normalize()
+	u := 0.5 + gomath.Atan2(d.X, -d.Z)/(2*gomath.Pi)
+	v := gomath.Acos(gomath.Max(-1, gomath.Min(1, d.Y))) / gomath.Pi
+
+	x := u*float64(e.Width) - 0.5
+	y := gomath.Max(0, gomath.Min(float64(e.Height-1), v*float64(e.Height)-0.5))
+	x0, y0 := int(gomath.Floor(x)), int(y)
+	fx, fy := x-float64(x0), y-float64(y0)
+	y1 := min(y0+1, e.Height-1)
+	at := func(px, py int) math.Point3D {
+		px = ((px % e.Width) + e.Width) % e.Width
+		return e.Pixels[py*e.Width+px]
+	}
+	top := at(x0, y0).Mul(1 - fx).Add(at(x0+1, y0).Mul(fx))
+	bottom := at(x0, y1).Mul(1 - fx).Add(at(x0+1, y1).Mul(fx))
+	return top.Mul(1 - fy).Add(bottom.Mul(fy))
+}
@@ -0,0 +1,55 @@
+package shading
+
+import (
+	"grinder/pkg/math"
+	gomath "math"
+	"testing"
+)
+
+func TestEnvironmentMap_Radiance(t *testing.T) {
+	// A 4x2 map: each pixel of the top row has its own color, and the
+	// bottom row is black.
+	pixels := []math.Point3D{
+		{X: 1}, {Y: 1}, {Z: 1}, {X: 1, Y: 1},
+		{}, {}, {}, {},
+	}
+	env := NewEnvironmentMap(4, 2, pixels, 2)
+	tests := []struct {
+		name string
+		dir  math.Point3D
+		want math.Point3D
+	}{
+		// -Z sits at u = 0.5, the boundary between columns 1 and 2.
+		{"forward", math.Point3D{Y: 1, Z: -1}, math.Point3D{Y: 1, Z: 1}},
+		// +X sits at u = 0.75, between columns 2 and 3.
+		{"right", math.Point3D{X: 1, Y: 1}, math.Point3D{X: 1, Y: 1, Z: 1}},
+		// Straight down clamps to the black bottom row.
+		{"down", math.Point3D{Y: -1}, math.Point3D{}},
+	}
+	for _, tt := range tests {
+		got := env.Radiance(tt.dir)
+		if got.Sub(tt.want).Length() > 1e-9 {
+			t.Errorf("%s: Radiance(%v) = %v, want %v", tt.name, tt.dir, got, tt.want)
+		}
+	}
+	// Straight up has no azimuth; it must still land on the top row.
+	if got := env.Radiance(math.Point3D{Y: 1}); gomath.IsNaN(got.X) || got.Length() == 0 {
+		t.Errorf("Radiance(up) = %v, want a top-row color", got)
+	}
+}
+
+func TestSkyEnvironment(t *testing.T) {
+	sun := math.Point3D{X: 1, Y: 0.5}
+	sky := NewSkyEnvironment(sun, 3)
+	toward := sky.Radiance(math.Point3D{X: 1, Y: 0.3})
+	away := sky.Radiance(math.Point3D{X: -1, Y: 0.3})
+	if toward.Length() <= away.Length() {
+		t.Errorf("sky toward the sun %v should be brighter than away from it %v", toward, away)
+	}
+	if zenith := sky.Radiance(math.Point3D{Y: 1}); zenith.Z <= zenith.X {
+		t.Errorf("zenith %v should be blue", zenith)
+	}
+	if ground := sky.Radiance(math.Point3D{Y: -1}); ground != sky.Ground {
+		t.Errorf("below the horizon = %v, want the ground color %v", ground, sky.Ground)
+	}
+}
@@ -0,0 +1,33 @@
+package shading
+
+import (
+	"grinder/pkg/math"
+	gomath "math"
+)
+
+// anisotropicGGX returns the specular factor of an anisotropic GGX lobe for
+// light arriving along l and leaving along v, both unit and pointing away
+// from the surface: the microfacet BRDF times the cosine at the light,
+// D·G / (4 n·v), with the Fresnel term left to the shape's specular color
+// and intensity. t is the unit tangent, perpendicular to n; ax is the
+// roughness along it and ay across it.
+func anisotropicGGX(n, t, l, v math.Point3D, ax, ay float64) float64 {
+	nl, nv := n.Dot(l), n.Dot(v)
+	if nl <= 0 || nv <= 0 {
+		return 0
+	}
+	b := n.Cross(t)
+	h := l.Add(v).Normalize()
+	ht, hb, hn := h.Dot(t)/ax, h.Dot(b)/ay, h.Dot(n)
+	k := ht*ht + hb*hb + hn*hn
+	d := 1 / (gomath.Pi * ax * ay * k * k)
+	g := 1 / (1 + smithLambda(n, t, b, l, ax, ay) + smithLambda(n, t, b, v, ax, ay))
+	return d * g / (4 * nv)
+}
+
+// smithLambda is the Smith masking term Λ of the anisotropic GGX
+// distribution for direction w.
+func smithLambda(n, t, b, w math.Point3D, ax, ay float64) float64 {
+	wt, wb, wn := w.Dot(t)*ax, w.Dot(b)*ay, w.Dot(n)
+	return (gomath.Sqrt(1+(wt*wt+wb*wb)/(wn*wn)) - 1) / 2
+}
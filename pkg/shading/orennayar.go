@@ -0,0 +1,35 @@
+package shading
+
+import (
+	"grinder/pkg/math"
+	gomath "math"
+)
+
+// orenNayar returns the diffuse factor of a rough surface by the Oren-Nayar
+// model for light arriving along l and leaving along v, both unit and
+// pointing away from the surface: the cosine at the light scaled by
+// A + B·max(0, cos(φl-φv))·sin α·tan β, where α and β are the larger and
+// smaller of the two angles to the normal n and φ their azimuths.
+// roughness is the standard deviation of the facet slopes in radians; at
+// zero it is Lambert's cosine.
+func orenNayar(n, l, v math.Point3D, roughness float64) float64 {
+	nl, nv := n.Dot(l), n.Dot(v)
+	if nl <= 0 {
+		return 0
+	}
+	nv = gomath.Max(nv, 0)
+	s2 := roughness * roughness
+	a := 1 - 0.5*s2/(s2+0.33)
+	b := 0.45 * s2 / (s2 + 0.09)
+
+	// The cosine between the azimuths, from l and v projected onto the
+	// tangent plane; either may stand along the normal and have none.
+	var cosPhi float64
+	lp, vp := l.Sub(n.Mul(nl)), v.Sub(n.Mul(nv))
+	if ll, vl := lp.Length(), vp.Length(); ll > 1e-9 && vl > 1e-9 {
+		cosPhi = gomath.Max(0, lp.Dot(vp)/(ll*vl))
+	}
+	thetaL, thetaV := gomath.Acos(gomath.Min(nl, 1)), gomath.Acos(gomath.Min(nv, 1))
+	alpha, beta := gomath.Max(thetaL, thetaV), gomath.Min(thetaL, thetaV)
+	return nl * (a + b*cosPhi*gomath.Sin(alpha)*gomath.Tan(beta))
+}
@@ -5,100 +5,176 @@ import (
 	"grinder/pkg/math"
 	"image/color"
 	gomath "math"
+	"sync"
 )
 
 // ShadedColor calculates the color of a point on a surface using the Phong reflection model.
-func ShadedColor(p math.Point3D, n math.Normal3D, eye math.Point3D, l Light, shape geometry.Shape, shapes []geometry.Shape, tSample float64) color.RGBA {
+// Toon shapes (see geometry.Toon) get banded light and inked silhouettes,
+// matte ones (see geometry.Matte) Oren-Nayar diffuse light, and emissive
+// ones (see geometry.Emissive) their glow on top.
+// Shadow occluders are gathered from bvh; a nil bvh shades without shadows.
+// With an env, the environment radiance along the normal is added as ambient
+// light; a nil env keeps the flat 0.15 ambient floor. scale is the size of
+// the surface sample p stands for, such as a pixel's footprint; shadow rays
+// start ShadowBias(p, scale) off the surface.
+func ShadedColor(p math.Point3D, n math.Normal3D, eye math.Point3D, l Light, shape geometry.Shape, bvh *geometry.BVH, tSample float64, env Environment, scale float64) color.RGBA {
+	return math.ClampColor(ShadedRadiance(p, n, eye, l, shape, bvh, tSample, env, scale))
+}
+
+// ShadedRadiance is ShadedColor before it is rounded to 8 bits: the color
+// on the 0-255 scale, unclamped. Callers averaging several samples should
+// sum these and convert once, so soft shadows don't band.
+func ShadedRadiance(p math.Point3D, n math.Normal3D, eye math.Point3D, l Light, shape geometry.Shape, bvh *geometry.BVH, tSample float64, env Environment, scale float64) math.Point3D {
 	lightVec := l.Position.Sub(p)
 	lightDir := lightVec.Normalize()
-	base := shape.GetColor()
+	shapeT := geometry.ShapeTime(shape, tSample)
+	base := shape.GetColorAt(p, shapeT)
+	viewDir := eye.Sub(p).Normalize()
+	bands, outline, toon := geometry.ToonOf(shape)
+	if toon && n.ToVector().Dot(viewDir) < outline {
+		// Silhouettes of toon shapes are inked.
+		return math.Point3D{}
+	}
 
 	// Shadow Check
-	// Shadow Check
-	shadowBias := 1e-4
+	shadowBias := ShadowBias(p, scale)
 	checkP := math.Point3D{X: p.X + n.X*shadowBias, Y: p.Y + n.Y*shadowBias, Z: p.Z + n.Z*shadowBias}
 
-	// Shadow Culling: Since GetAABB() now returns the full Motion Block,
-	// it will correctly find shapes that *might* cross the light path at ANY time.
-	cullAABB := math.AABB3D{
-		Min: math.Point3D{
-			X: gomath.Min(checkP.X, l.Position.X-l.Radius),
-			Y: gomath.Min(checkP.Y, l.Position.Y-l.Radius),
-			Z: gomath.Min(checkP.Z, l.Position.Z-l.Radius),
-		},
-		Max: math.Point3D{
-			X: gomath.Max(checkP.X, l.Position.X+l.Radius),
-			Y: gomath.Max(checkP.Y, l.Position.Y+l.Radius),
-			Z: gomath.Max(checkP.Z, l.Position.Z+l.Radius),
-		},
-	}
-
-	// Filter shapes to only those that could possibly cast a shadow.
-	var occluders []geometry.Shape
-
-	// Optimization: If the shapes list contains a BVH, use it for faster culling
-	var bvh *geometry.BVH
-	for _, s := range shapes {
-		if b, ok := s.(*geometry.BVH); ok {
-			bvh = b
-			break
-		}
-	}
-
-	if bvh != nil {
-		occluders = bvh.IntersectsShapes(cullAABB)
-		// Filter out the current shape from occluders
-		for i, o := range occluders {
-			if o == shape {
-				occluders = append(occluders[:i], occluders[i+1:]...)
-				break
-			}
-		}
-	} else {
-		occluders = make([]geometry.Shape, 0)
-		for _, s := range shapes {
-			if s == shape {
-				continue
-			}
-			if s.GetAABB().Intersects(cullAABB) {
-				occluders = append(occluders, s)
-			}
-		}
-	}
+	buf := occluderPool.Get().(*[]geometry.Shape)
+	occluders := ShadowOccludersInto(checkP, l, shape, bvh, (*buf)[:0])
 
 	shadowAttenuation := CalculateShadowAttenuation(checkP, l.Position, occluders, l.Radius, tSample)
+	*buf = occluders
+	occluderPool.Put(buf)
+
 	// Diffuse (Lambert) component
 	dot := n.Dot(lightDir)
-	diffuseFactor := gomath.Max(0.15, dot*l.Intensity*shadowAttenuation) // Ambient term is 0.15
+	falloff := l.Falloff(lightVec.Length())
+	radiance := l.Radiance().Mul(falloff)
+	lambert := gomath.Max(0, dot*shadowAttenuation)
+	if roughness, ok := geometry.RoughnessOf(shape); ok {
+		// Rough matte surfaces swap Lambert for Oren-Nayar.
+		lambert = orenNayar(n.ToVector(), lightDir, viewDir, roughness) * shadowAttenuation
+	}
+	if toon {
+		lambert = quantize(lambert, bands)
+	}
+	direct := radiance.Mul(lambert)
+	// Ambient term is 0.15 per channel
+	diffuse := math.Point3D{X: gomath.Max(0.15, direct.X), Y: gomath.Max(0.15, direct.Y), Z: gomath.Max(0.15, direct.Z)}
+	if env != nil {
+		// A cheap irradiance estimate: the sky seen straight along the normal.
+		diffuse = env.Radiance(n.ToVector()).Add(direct)
+	}
 
 	// Specular (Phong) component
 	var specularR, specularG, specularB float64
 	if shadowAttenuation > 0 { // No specular highlights in full shadow
-		viewDir := eye.Sub(p).Normalize()
-
 		// R = 2 * (N . L) * N - L
 		dotNL := n.Dot(lightDir)
 		reflectDir := n.ToVector().Mul(2 * dotNL).Sub(lightDir)
 
 		specularAngle := gomath.Max(0.0, viewDir.Dot(reflectDir))
 		specularFactor := gomath.Pow(specularAngle, shape.GetShininess())
+		if ax, ay, ok := geometry.AnisotropyOf(shape); ok {
+			// Brushed surfaces swap the Phong lobe for anisotropic GGX.
+			tangent := geometry.TangentAt(shape, p, shapeT)
+			specularFactor = anisotropicGGX(n.ToVector(), tangent, lightDir, viewDir, ax, ay)
+		}
+		if toon {
+			// A cel highlight is a flat spot, on where the Phong lobe is
+			// past half strength.
+			if specularFactor >= 0.5 {
+				specularFactor = 1
+			} else {
+				specularFactor = 0
+			}
+		}
 		specularIntensity := shape.GetSpecularIntensity()
 
 		specularColor := shape.GetSpecularColor()
-		specularR = float64(specularColor.R) * specularFactor * specularIntensity
-		specularG = float64(specularColor.G) * specularFactor * specularIntensity
-		specularB = float64(specularColor.B) * specularFactor * specularIntensity
+		// The highlight takes the light's tint and falloff, not its intensity.
+		tint := l.tint().Mul(falloff)
+		specularR = float64(specularColor.R) * specularFactor * specularIntensity * tint.X
+		specularG = float64(specularColor.G) * specularFactor * specularIntensity * tint.Y
+		specularB = float64(specularColor.B) * specularFactor * specularIntensity * tint.Z
 	}
 
 	// Combine components
-	finalR := float64(base.R)*diffuseFactor + specularR
-	finalG := float64(base.G)*diffuseFactor + specularG
-	finalB := float64(base.B)*diffuseFactor + specularB
-
-	return color.RGBA{
-		R: uint8(gomath.Min(255, finalR)),
-		G: uint8(gomath.Min(255, finalG)),
-		B: uint8(gomath.Min(255, finalB)),
-		A: 255,
+	result := math.Point3D{
+		X: float64(base.R)*diffuse.X + specularR,
+		Y: float64(base.G)*diffuse.Y + specularG,
+		Z: float64(base.B)*diffuse.Z + specularB,
+	}
+	if emission, ok := geometry.EmissionOf(shape); ok {
+		// Glowing shapes add their own light, lit or not.
+		result = result.Add(emission.Mul(255))
+	}
+	return result
+}
+
+// quantize rounds a light factor in [0, 1] up to one of bands flat steps,
+// the top one full light; unlit stays 0.
+func quantize(f float64, bands int) float64 {
+	if bands < 1 {
+		bands = 1
+	}
+	return gomath.Min(gomath.Ceil(f*float64(bands)), float64(bands)) / float64(bands)
+}
+
+// shadowBiasPrecision is the relative rounding error of a float32 position,
+// with a few ulps to spare. Baked atoms store their positions in float32.
+const shadowBiasPrecision = 4.0 / (1 << 23)
+
+// ShadowBias returns how far to lift a shadow ray's origin off the surface
+// at p. scale is the size of the sample p stands for, a pixel's footprint or
+// a baked atom, which bounds how far p may be from the true surface; the
+// bias follows it so shadows neither break up into acne nor detach from
+// their casters as a scene is scaled. Far from the origin it never drops
+// below the float32 rounding of p.
+func ShadowBias(p math.Point3D, scale float64) float64 {
+	extent := gomath.Max(gomath.Abs(p.X), gomath.Max(gomath.Abs(p.Y), gomath.Abs(p.Z)))
+	return gomath.Max(scale, shadowBiasPrecision*extent)
+}
+
+// occluderPool recycles the occluder lists ShadedColor gathers for every
+// shading sample.
+var occluderPool = sync.Pool{New: func() any { return new([]geometry.Shape) }}
+
+// ShadowOccluders returns the shapes in bvh that could shadow p from any
+// point of the light, leaving out shape itself. A nil bvh has no occluders.
+func ShadowOccluders(p math.Point3D, l Light, shape geometry.Shape, bvh *geometry.BVH) []geometry.Shape {
+	return ShadowOccludersInto(p, l, shape, bvh, nil)
+}
+
+// ShadowOccludersInto is ShadowOccluders appending to buf.
+func ShadowOccludersInto(p math.Point3D, l Light, shape geometry.Shape, bvh *geometry.BVH, buf []geometry.Shape) []geometry.Shape {
+	if bvh == nil {
+		return buf
+	}
+	// Shadow Culling: Since GetAABB() now returns the full Motion Block,
+	// it will correctly find shapes that *might* cross the light path at ANY time.
+	cullAABB := math.AABB3D{
+		Min: math.Point3D{
+			X: gomath.Min(p.X, l.Position.X-l.Radius),
+			Y: gomath.Min(p.Y, l.Position.Y-l.Radius),
+			Z: gomath.Min(p.Z, l.Position.Z-l.Radius),
+		},
+		Max: math.Point3D{
+			X: gomath.Max(p.X, l.Position.X+l.Radius),
+			Y: gomath.Max(p.Y, l.Position.Y+l.Radius),
+			Z: gomath.Max(p.Z, l.Position.Z+l.Radius),
+		},
+	}
+
+	// Filter shapes to only those that could possibly cast a shadow.
+	occluders := bvh.IntersectsShapesInto(cullAABB, buf)
+	// Filter out the current shape from occluders
+	for i, o := range occluders {
+		if o == shape {
+			occluders = append(occluders[:i], occluders[i+1:]...)
+			break
+		}
 	}
+	return occluders
 }
@@ -0,0 +1,335 @@
+package shading
+
+import (
+	"grinder/pkg/geometry"
+	"grinder/pkg/math"
+	"image/color"
+	gomath "math"
+	"testing"
+)
+
+// TestShadedColor_Environment shades a white sphere under a blue sky and a
+// green ground with the light off: the top must come out blue and the
+// bottom green.
+func TestShadedColor_Environment(t *testing.T) {
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	sphere := geometry.Sphere3D{Radius: 1, Color: white, SpecularColor: white}
+	env := GradientEnvironment{Sky: math.Point3D{X: 0.1, Y: 0.2, Z: 0.6}, Ground: math.Point3D{X: 0.1, Y: 0.5, Z: 0.1}}
+	eye := math.Point3D{Z: 5}
+	light := Light{Position: math.Point3D{Z: 10}}
+
+	top := ShadedColor(math.Point3D{Y: 1}, math.Normal3D{Y: 1}, eye, light, sphere, nil, 0, env, 0)
+	bottom := ShadedColor(math.Point3D{Y: -1}, math.Normal3D{Y: -1}, eye, light, sphere, nil, 0, env, 0)
+	if top.B <= top.G || top.B <= top.R {
+		t.Errorf("top = %v, want a blue tint", top)
+	}
+	if bottom.G <= bottom.B || bottom.G <= bottom.R {
+		t.Errorf("bottom = %v, want a green tint", bottom)
+	}
+}
+
+// TestShadedColor_LightColor lights a white sphere with a red light under a
+// blue sky: the lit side mixes to magenta while the unlit side stays blue.
+func TestShadedColor_LightColor(t *testing.T) {
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	sphere := geometry.Sphere3D{Radius: 1, Color: white, SpecularColor: white}
+	env := UniformEnvironment{Color: math.Point3D{Z: 0.6}}
+	eye := math.Point3D{Z: 5}
+	light := Light{Position: math.Point3D{Z: 10}, Intensity: 0.8, Color: math.Point3D{X: 1}}
+
+	lit := ShadedColor(math.Point3D{Z: 1}, math.Normal3D{Z: 1}, eye, light, sphere, nil, 0, env, 0)
+	if lit.R < 150 || lit.B < 150 || lit.G > 10 {
+		t.Errorf("lit side = %v, want magenta", lit)
+	}
+	unlit := ShadedColor(math.Point3D{Z: -1}, math.Normal3D{Z: -1}, eye, light, sphere, nil, 0, env, 0)
+	if unlit.R != 0 || unlit.B < 150 {
+		t.Errorf("unlit side = %v, want blue", unlit)
+	}
+
+	// Without a color the light stays white.
+	light.Color = math.Point3D{}
+	if got := light.Radiance(); got != (math.Point3D{X: 0.8, Y: 0.8, Z: 0.8}) {
+		t.Errorf("uncolored Radiance() = %v, want gray 0.8", got)
+	}
+}
+
+// TestShadedColor_InverseSquare checks that doubling the distance to an
+// inverse-square light quarters the light received.
+func TestShadedColor_InverseSquare(t *testing.T) {
+	gray := color.RGBA{R: 200, G: 200, B: 200, A: 255}
+	sphere := geometry.Sphere3D{Radius: 1, Color: gray}
+	p, n, eye := math.Point3D{Z: 1}, math.Normal3D{Z: 1}, math.Point3D{Z: 5}
+	light := Light{Intensity: 4, Attenuation: InverseSquare}
+
+	light.Position = math.Point3D{Z: 3}
+	near := ShadedColor(p, n, eye, light, sphere, nil, 0, nil, 0)
+	light.Position = math.Point3D{Z: 5}
+	far := ShadedColor(p, n, eye, light, sphere, nil, 0, nil, 0)
+	if near.R != 200 || far.R != 50 {
+		t.Errorf("received %d at distance 2 and %d at 4, want 200 and 50", near.R, far.R)
+	}
+
+	if got := light.Falloff(0); gomath.IsInf(got, 0) || got != 1/minAttenuation {
+		t.Errorf("Falloff(0) = %v, want the finite cap %v", got, 1/minAttenuation)
+	}
+	light.Attenuation = Attenuation{}
+	if got := light.Falloff(100); got != 1 {
+		t.Errorf("Falloff without attenuation = %v, want 1", got)
+	}
+}
+
+// stripedSphere is a white sphere with a black band below y=0.
+type stripedSphere struct{ geometry.Sphere3D }
+
+func (s stripedSphere) GetColorAt(p math.Point3D, t float64) color.RGBA {
+	if p.Y < 0 {
+		return color.RGBA{A: 255}
+	}
+	return s.Color
+}
+
+// TestShadedColor_ColorAt checks that shading takes the color at the
+// shaded point rather than the shape's single color.
+func TestShadedColor_ColorAt(t *testing.T) {
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	sphere := stripedSphere{geometry.Sphere3D{Radius: 1, Color: white}}
+	eye := math.Point3D{Z: 5}
+	light := Light{Position: math.Point3D{Z: 10}, Intensity: 1}
+
+	n := math.Normal3D{Y: 0.6, Z: 0.8}
+	top := ShadedColor(math.Point3D{Y: 0.6, Z: 0.8}, n, eye, light, sphere, nil, 0, nil, 0)
+	n.Y = -0.6
+	bottom := ShadedColor(math.Point3D{Y: -0.6, Z: 0.8}, n, eye, light, sphere, nil, 0, nil, 0)
+	if top.R < 150 || bottom.R != 0 {
+		t.Errorf("top = %v and bottom = %v, want lit white over black", top, bottom)
+	}
+}
+
+// TestShadedColor_ShadowBiasScale shades a tiled floor with a thin rug on
+// it, at a tiny and a large scale, with the bias following a pixel footprint
+// of 0.01. A point in the rug's shadow must stay shadowed (a fixed bias
+// lifted it over the rug at the tiny scale), and a point sampled just below
+// the floor next to the seam must stay lit under a low, bright light (a fixed bias
+// marched it through the next tile at the large scale).
+func TestShadedColor_ShadowBiasScale(t *testing.T) {
+	gray := color.RGBA{R: 200, G: 200, B: 200, A: 255}
+	for _, s := range []float64{1e-4, 1e3} {
+		at := func(x, y, z float64) math.Point3D { return math.Point3D{X: x, Y: y, Z: z}.Mul(s) }
+		tileA := geometry.Box3D{Min: at(-2, -0.1, -2), Max: at(0, 0, 2), Color: gray}
+		tileB := geometry.Box3D{Min: at(0, -0.1, -2), Max: at(2, 0, 2), Color: gray}
+		rug := geometry.Box3D{Min: at(-1.5, 0, -1), Max: at(-1, 0.2, 1), Color: gray}
+		shapes := []geometry.Shape{tileA, tileB, rug}
+		bvh := geometry.NewBVH(shapes)
+		n, eye, footprint := math.Normal3D{Y: 1}, at(0, 5, 5), 0.01*s
+
+		// lit reports whether p gets the full unshadowed light.
+		lit := func(p math.Point3D, light Light) bool {
+			want := ShadedColor(p, n, eye, light, tileA, nil, 0, nil, footprint)
+			return ShadedColor(p, n, eye, light, tileA, bvh, 0, nil, footprint) == want
+		}
+		west := Light{Position: at(-10, 3, 0), Intensity: 1}
+		if lit(at(-0.9, 0, 0), west) {
+			t.Errorf("scale %g: floor in the rug's shadow is lit", s)
+		}
+		if !lit(at(-0.2, 0, 0), west) {
+			t.Errorf("scale %g: floor past the rug's shadow is shadowed", s)
+		}
+		east := Light{Position: at(10, 0.1, 0), Intensity: 50}
+		if !lit(at(-0.001, -0.003, 0), east) {
+			t.Errorf("scale %g: floor by the seam is shadowed by the next tile", s)
+		}
+	}
+}
+
+// TestShadedRadiance_Average shades points along a dim gradient on a sphere,
+// averaging four light samples each as the renderer does. Averaging the
+// unrounded radiance stays within one 8-bit level of the exact mean, while
+// averaging 8-bit colors drifts a level or more.
+func TestShadedRadiance_Average(t *testing.T) {
+	gray := color.RGBA{R: 60, G: 60, B: 60, A: 255}
+	sphere := geometry.Sphere3D{Radius: 1, Color: gray}
+	env := UniformEnvironment{}
+	eye := math.Point3D{Z: 5}
+
+	worst8, worstLinear := 0.0, 0.0
+	for i := 0; i < 64; i++ {
+		a := float64(i) / 64 * gomath.Pi / 2
+		p := math.Point3D{X: gomath.Sin(a), Z: gomath.Cos(a)}
+		n := math.Normal3D{X: p.X, Z: p.Z}
+		var exact, linear math.Point3D
+		var eight float64
+		for k := 0; k < 4; k++ {
+			light := Light{Position: math.Point3D{X: 0.1 * float64(k), Z: 10}, Intensity: 0.3}
+			c := ShadedRadiance(p, n, eye, light, sphere, nil, 0, env, 0)
+			if got, want := ShadedColor(p, n, eye, light, sphere, nil, 0, env, 0), math.ClampColor(c); got != want {
+				t.Fatalf("ShadedColor = %v, want ClampColor(ShadedRadiance) = %v", got, want)
+			}
+			exact = exact.Add(c.Mul(0.25))
+			linear = linear.Add(c)
+			eight += float64(math.ClampColor(c).R)
+		}
+		worstLinear = gomath.Max(worstLinear, exact.X-float64(math.ClampColor(linear.Mul(0.25)).R))
+		worst8 = gomath.Max(worst8, exact.X-float64(uint8(eight/4)))
+	}
+	if worstLinear >= 1 {
+		t.Errorf("linear average is %.2f levels off the exact mean, want under 1", worstLinear)
+	}
+	if worst8 < 1 {
+		t.Errorf("8-bit average is at most %.2f levels off, want it to drift a level or more", worst8)
+	}
+}
+
+// shadowBenchScene is a floor under a grid of spheres with an area light,
+// so most shading samples run the occluder query.
+func shadowBenchScene() ([]geometry.Shape, *geometry.BVH, Light) {
+	shapes := []geometry.Shape{
+		geometry.Plane3D{Point: math.Point3D{Y: -1}, Normal: math.Normal3D{Y: 1}},
+	}
+	for i := 0; i < 64; i++ {
+		shapes = append(shapes, geometry.Sphere3D{
+			Center: math.Point3D{X: float64(i%8) - 3.5, Z: float64(i/8) - 3.5},
+			Radius: 0.3,
+		})
+	}
+	light := Light{Position: math.Point3D{X: 2, Y: 8, Z: 2}, Intensity: 1, Radius: 1}
+	return shapes, geometry.NewBVH(shapes), light
+}
+
+func BenchmarkShadedColor(b *testing.B) {
+	shapes, bvh, light := shadowBenchScene()
+	eye := math.Point3D{Y: 5, Z: 10}
+	n := math.Normal3D{Y: 1}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p := math.Point3D{X: float64(i%64)/8 - 4, Y: -1, Z: float64(i%8) - 4}
+		ShadedColor(p, n, eye, light, shapes[0], bvh, 0, nil, 0)
+	}
+}
+
+// TestShadedRadiance_Anisotropic lights a brushed cylinder from the eye and
+// compares points just off the highlight's peak, up the axis and around it.
+// Rough along the axis, the highlight must stretch along the length;
+// rough across it, around the circumference.
+func TestShadedRadiance_Anisotropic(t *testing.T) {
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	// Black, so only the highlight shows.
+	cylinder := geometry.Cylinder3D{Center: math.Point3D{Y: -2}, Height: 4, Radius: 1, Color: color.RGBA{A: 255}, SpecularColor: white, SpecularIntensity: 1}
+	eye := math.Point3D{Z: 5}
+	light := Light{Position: eye, Intensity: 1}
+	along, around := math.Point3D{Y: 0.4, Z: 1}, math.Point3D{X: gomath.Sin(0.1), Z: gomath.Cos(0.1)}
+	shade := func(s geometry.Shape, p math.Point3D) float64 {
+		n := math.Normal3D{X: p.X, Z: p.Z}
+		return ShadedRadiance(p, n, eye, light, s, nil, 0, nil, 0).X
+	}
+
+	lengthwise := geometry.Anisotropic{Shape: cylinder, AnisotropyX: 0.5, AnisotropyY: 0.05}
+	if a, b := shade(lengthwise, along), shade(lengthwise, around); a <= 2*b {
+		t.Errorf("rough along the axis: %v up the axis, %v around it; want the highlight stretched lengthwise", a, b)
+	}
+	crosswise := geometry.Anisotropic{Shape: cylinder, AnisotropyX: 0.05, AnisotropyY: 0.5}
+	if a, b := shade(crosswise, along), shade(crosswise, around); b <= 2*a {
+		t.Errorf("rough across the axis: %v up the axis, %v around it; want the highlight stretched around", a, b)
+	}
+}
+
+// TestShadedRadiance_Toon sweeps a toon sphere from its lit pole to its
+// terminator: the light must take no more distinct values than bands plus
+// the ambient floor, and the rim must be inked black.
+func TestShadedRadiance_Toon(t *testing.T) {
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	sphere := geometry.Toon{Shape: geometry.Sphere3D{Radius: 1, Color: white}, Bands: 3, Outline: 0.3}
+	eye := math.Point3D{Z: 5}
+	// Lit from above, so the sweep crosses every band while facing the eye.
+	light := Light{Position: math.Point3D{Y: 10, Z: 1}, Intensity: 1}
+	levels := map[float64]bool{}
+	for i := 0; i <= 100; i++ {
+		a := float64(i) / 100 * gomath.Pi / 2
+		p := math.Point3D{Y: gomath.Cos(a), Z: gomath.Sin(a)}
+		if p.Sub(eye).Normalize().Dot(p) > -0.35 {
+			continue // near the rim, checked below
+		}
+		levels[ShadedRadiance(p, math.Normal3D{Y: p.Y, Z: p.Z}, eye, light, sphere, nil, 0, nil, 0).X] = true
+	}
+	if len(levels) < 2 || len(levels) > 4 {
+		t.Errorf("toon sphere shaded with %d distinct levels %v, want 2 to 4 flat steps", len(levels), levels)
+	}
+
+	rim := math.Point3D{X: 1}
+	if got := ShadedRadiance(rim, math.Normal3D{X: 1}, eye, light, sphere, nil, 0, nil, 0); got != (math.Point3D{}) {
+		t.Errorf("silhouette = %v, want the black outline", got)
+	}
+	plain := ShadedRadiance(rim, math.Normal3D{X: 1}, eye, light, sphere.Shape, nil, 0, nil, 0)
+	if plain == (math.Point3D{}) {
+		t.Error("a plain sphere's silhouette came out black too")
+	}
+}
+
+func TestQuantize(t *testing.T) {
+	for _, tt := range []struct {
+		f     float64
+		bands int
+		want  float64
+	}{
+		{0, 3, 0}, {0.1, 3, 1.0 / 3}, {0.5, 3, 2.0 / 3}, {0.9, 3, 1}, {1, 3, 1}, {2, 3, 1}, {0.4, 1, 1}, {0.4, 0, 1},
+	} {
+		if got := quantize(tt.f, tt.bands); gomath.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("quantize(%v, %d) = %v, want %v", tt.f, tt.bands, got, tt.want)
+		}
+	}
+}
+
+// TestShadedRadiance_OrenNayar lights the top of a rough sphere at a grazing
+// angle and views it from the light's side: Oren-Nayar must keep more of
+// the light there than Lambert, while head-on it is the dimmer of the two.
+func TestShadedRadiance_OrenNayar(t *testing.T) {
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	sphere := geometry.Sphere3D{Radius: 1, Color: white}
+	matte := geometry.Matte{Shape: sphere, Roughness: 0.5}
+	top, up := math.Point3D{Y: 1}, math.Normal3D{Y: 1}
+	at := func(deg, dist float64) math.Point3D {
+		a := deg * gomath.Pi / 180
+		return top.Add(math.Point3D{X: gomath.Sin(a), Y: gomath.Cos(a)}.Mul(dist))
+	}
+	shade := func(s geometry.Shape, light Light, eye math.Point3D) float64 {
+		return ShadedRadiance(top, up, eye, light, s, nil, 0, nil, 0).X
+	}
+
+	grazing, eye := Light{Position: at(80, 10), Intensity: 4}, at(60, 5)
+	if rough, smooth := shade(matte, grazing, eye), shade(sphere, grazing, eye); rough <= 1.2*smooth {
+		t.Errorf("grazing light: Oren-Nayar %v, Lambert %v; want the rough sphere clearly brighter", rough, smooth)
+	}
+	overhead, above := Light{Position: at(0, 10), Intensity: 1}, at(0, 5)
+	if rough, smooth := shade(matte, overhead, above), shade(sphere, overhead, above); rough >= smooth {
+		t.Errorf("light overhead: Oren-Nayar %v, Lambert %v; want the rough sphere dimmer", rough, smooth)
+	}
+}
+
+// TestShadedRadiance_Emissive checks that an emissive sphere adds its glow
+// to the light it reflects, on its unlit side too.
+func TestShadedRadiance_Emissive(t *testing.T) {
+	gray := color.RGBA{R: 100, G: 100, B: 100, A: 255}
+	sphere := geometry.Sphere3D{Radius: 1, Color: gray}
+	lamp := geometry.Emissive{Shape: sphere, Color: color.RGBA{R: 255, A: 255}, Intensity: 0.5}
+	eye, light := math.Point3D{Z: 5}, Light{Position: math.Point3D{Z: 10}, Intensity: 1}
+	for _, side := range []float64{1, -1} {
+		p, n := math.Point3D{Z: side}, math.Normal3D{Z: side}
+		plain := ShadedRadiance(p, n, eye, light, sphere, nil, 0, nil, 0)
+		glow := ShadedRadiance(p, n, eye, light, lamp, nil, 0, nil, 0)
+		if want := plain.Add(math.Point3D{X: 127.5}); glow.Sub(want).Length() > 1e-9 {
+			t.Errorf("side %v: emissive radiance = %v, want %v", side, glow, want)
+		}
+	}
+}
+
+func TestOrenNayar_SmoothIsLambert(t *testing.T) {
+	n := math.Point3D{Y: 1}
+	l := math.Point3D{X: 0.6, Y: 0.8}
+	v := math.Point3D{X: -0.8, Y: 0.6}
+	if got := orenNayar(n, l, v, 0); gomath.Abs(got-0.8) > 1e-12 {
+		t.Errorf("orenNayar at roughness 0 = %v, want Lambert's 0.8", got)
+	}
+	if got := orenNayar(n, l.Mul(-1), v, 0.5); got != 0 {
+		t.Errorf("orenNayar lit from behind = %v, want 0", got)
+	}
+}
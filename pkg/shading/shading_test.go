@@ -0,0 +1,135 @@
+package shading
+
+import (
+	"grinder/pkg/geometry"
+	"grinder/pkg/math"
+	gomath "math"
+	"testing"
+)
+
+func TestCalculateShadowAttenuation_Penumbra(t *testing.T) {
+	// A slab covering x < 0 halfway between the point and the light: the
+	// point sits exactly under its edge.
+	slab := geometry.Box3D{Min: math.Point3D{X: -10, Y: 4, Z: -10}, Max: math.Point3D{X: 0, Y: 6, Z: 10}}
+	occluders := []geometry.Shape{slab}
+	light := math.Point3D{X: 0, Y: 10, Z: 0}
+
+	tests := []struct {
+		name string
+		p    math.Point3D
+		want float64
+	}{
+		{"edge", math.Point3D{X: 0, Y: 0, Z: 0.3}, 0.5},
+		{"umbra", math.Point3D{X: -3, Y: 0, Z: 0}, 0},
+		{"lit", math.Point3D{X: 3, Y: 0, Z: 0}, 1},
+	}
+	for _, tt := range tests {
+		got := CalculateShadowAttenuation(tt.p, light, occluders, 1, 0)
+		if gomath.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: attenuation = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if got := CalculateShadowAttenuation(math.Point3D{X: 0.01}, light, occluders, 0, 0); got != 1 {
+		t.Errorf("point light just past the edge: attenuation = %v, want 1", got)
+	}
+}
+
+func TestCalculateShadowAttenuation_ThinOccluder(t *testing.T) {
+	// 0.1 thick, and placed between two samples of a fixed 0.5 step.
+	slab := geometry.Box3D{Min: math.Point3D{X: -1, Y: 5.2, Z: -1}, Max: math.Point3D{X: 1, Y: 5.3, Z: 1}}
+	light := math.Point3D{X: 0, Y: 10, Z: 0}
+	if got := CalculateShadowAttenuation(math.Point3D{Z: 0.3}, light, []geometry.Shape{slab}, 0, 0); got != 0 {
+		t.Errorf("attenuation under a thin slab = %v, want 0", got)
+	}
+}
+
+func TestCalculateShadowAttenuation_Translucent(t *testing.T) {
+	light := math.Point3D{X: 0, Y: 10, Z: 0}
+	glass := geometry.Translucent{Shape: geometry.Sphere3D{Center: math.Point3D{Y: 5}, Radius: 1}, Opacity: 0.2}
+	if got := CalculateShadowAttenuation(math.Point3D{}, light, []geometry.Shape{glass}, 0, 0); gomath.Abs(got-0.8) > 1e-9 {
+		t.Errorf("attenuation under glass = %v, want 0.8", got)
+	}
+
+	// Each translucent occluder dims the ray once, however long it is
+	// inside, and a solid behind them still blocks it.
+	pane := geometry.Translucent{Shape: geometry.Box3D{Min: math.Point3D{X: -1, Y: 2, Z: -1}, Max: math.Point3D{X: 1, Y: 3, Z: 1}}, Opacity: 0.5}
+	if got := CalculateShadowAttenuation(math.Point3D{}, light, []geometry.Shape{glass, pane}, 0, 0); gomath.Abs(got-0.4) > 1e-9 {
+		t.Errorf("attenuation under glass and pane = %v, want 0.4", got)
+	}
+	solid := geometry.Box3D{Min: math.Point3D{X: -1, Y: 7, Z: -1}, Max: math.Point3D{X: 1, Y: 8, Z: 1}}
+	if got := CalculateShadowAttenuation(math.Point3D{}, light, []geometry.Shape{glass, solid}, 0, 0); got != 0 {
+		t.Errorf("attenuation under glass and a solid = %v, want 0", got)
+	}
+}
+
+func TestCalculateShadowAttenuation_Volume(t *testing.T) {
+	// 4 units of fog, marched in the 2-unit steps its own size allows.
+	fog := geometry.VolumeBox{Min: math.Point3D{X: -2, Y: 3, Z: -2}, Max: math.Point3D{X: 2, Y: 7, Z: 2}, Density: 0.3}
+	light := math.Point3D{X: 0, Y: 10, Z: 0}
+	want := gomath.Exp(-0.3 * 4)
+	if got := CalculateShadowAttenuation(math.Point3D{}, light, []geometry.Shape{fog}, 0, 0); gomath.Abs(got-want) > 1e-9 {
+		t.Errorf("attenuation under fog = %v, want %v", got, want)
+	}
+}
+
+// thinningFog is a fog box whose upper half is clear.
+type thinningFog struct {
+	geometry.VolumeBox
+}
+
+func (f thinningFog) DensityAt(p math.Point3D, t float64) float64 {
+	if p.Y > 5 {
+		return 0
+	}
+	return f.VolumeBox.DensityAt(p, t)
+}
+
+func TestCalculateShadowAttenuation_VolumeDensityAt(t *testing.T) {
+	// Only the sample at y=4 is in the fog; the one at y=6 is in the clear half.
+	fog := thinningFog{geometry.VolumeBox{Min: math.Point3D{X: -2, Y: 3, Z: -2}, Max: math.Point3D{X: 2, Y: 7, Z: 2}, Density: 0.3}}
+	light := math.Point3D{X: 0, Y: 10, Z: 0}
+	want := gomath.Exp(-0.3 * 2)
+	if got := CalculateShadowAttenuation(math.Point3D{}, light, []geometry.Shape{fog}, 0, 0); gomath.Abs(got-want) > 1e-9 {
+		t.Errorf("attenuation under half-clear fog = %v, want %v", got, want)
+	}
+}
+
+func TestShadowStep(t *testing.T) {
+	plane := geometry.Plane3D{Point: math.Point3D{}, Normal: math.Normal3D{Y: 1}}
+	big := geometry.Box3D{Min: math.Point3D{}, Max: math.Point3D{X: 10, Y: 10, Z: 10}}
+	thin := geometry.Box3D{Min: math.Point3D{}, Max: math.Point3D{X: 4, Y: 0.1, Z: 4}}
+	tests := []struct {
+		name      string
+		occluders []geometry.Shape
+		want      float64
+	}{
+		{"none", nil, 0.5},
+		{"plane only", []geometry.Shape{plane}, 0.5},
+		{"large box", []geometry.Shape{plane, big}, 5},
+		{"thin box", []geometry.Shape{big, thin}, 0.05},
+	}
+	for _, tt := range tests {
+		if got := shadowStep(tt.occluders); gomath.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("%s: step = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPenumbraScale_ContactHardening(t *testing.T) {
+	light := math.Point3D{X: 0, Y: 10, Z: 0}
+	p := math.Point3D{X: -0.5, Z: 0.3}
+	slabAt := func(y float64) []geometry.Shape {
+		return []geometry.Shape{geometry.Box3D{Min: math.Point3D{X: -10, Y: y, Z: -10}, Max: math.Point3D{X: 10, Y: y + 0.5, Z: 10}}}
+	}
+	low := PenumbraScale(p, light, slabAt(0.5), 1, 0)
+	high := PenumbraScale(p, light, slabAt(6), 1, 0)
+	if low > 0.1 {
+		t.Errorf("scale under a nearby occluder = %v, want a crisp shadow (< 0.1)", low)
+	}
+	if high < 0.5 || high > 1 {
+		t.Errorf("scale under a distant occluder = %v, want a wide penumbra in [0.5, 1]", high)
+	}
+	if clear := PenumbraScale(p, light, nil, 1, 0); clear != 1 {
+		t.Errorf("scale with nothing in the way = %v, want 1", clear)
+	}
+}
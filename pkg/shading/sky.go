@@ -0,0 +1,70 @@
+package shading
+
+import (
+	"grinder/pkg/math"
+	gomath "math"
+)
+
+// UniformEnvironment returns the same color in every direction.
+type UniformEnvironment struct {
+	Color math.Point3D
+}
+
+// Radiance returns the uniform color.
+func (u UniformEnvironment) Radiance(dir math.Point3D) math.Point3D { return u.Color }
+
+// SkyEnvironment is a cheap procedural daylight sky. Brightness follows the
+// Perez distribution with Preetham's luminance coefficients for the given
+// turbidity, so the sky brightens toward the horizon and around the sun; the
+// color blends from Horizon to Zenith with elevation and is then exposed
+// into [0, 1). Below the horizon it returns Ground.
+type SkyEnvironment struct {
+	Sun                     math.Point3D // direction toward the sun
+	Turbidity               float64      // haze, about 2 (clear) to 10 (hazy)
+	Zenith, Horizon, Ground math.Point3D
+}
+
+// NewSkyEnvironment returns a sky with default blue-to-white colors and a
+// brown ground.
+func NewSkyEnvironment(sun math.Point3D, turbidity float64) SkyEnvironment {
+	return SkyEnvironment{
+		Sun:       sun.Normalize(),
+		Turbidity: turbidity,
+		Zenith:    math.Point3D{X: 0.25, Y: 0.45, Z: 0.85},
+		Horizon:   math.Point3D{X: 0.75, Y: 0.82, Z: 0.9},
+		Ground:    math.Point3D{X: 0.2, Y: 0.17, Z: 0.14},
+	}
+}
+
+// Radiance returns the sky color in direction dir.
+func (s SkyEnvironment) Radiance(dir math.Point3D) math.Point3D {
+	d := dir.Normalize()
+	if d.Y < 0 {
+		return s.Ground
+	}
+	sun := s.Sun.Normalize()
+	// A small lift keeps the horizon term finite.
+	cosTheta := gomath.Max(d.Y, 0.01)
+	gamma := gomath.Acos(gomath.Max(-1, gomath.Min(1, d.Dot(sun))))
+	thetaSun := gomath.Acos(gomath.Max(0, gomath.Min(1, sun.Y)))
+	// Normalizing by the zenith value keeps the overhead sky at its color.
+	scale := s.perez(cosTheta, gamma) / s.perez(1, thetaSun)
+	t := gomath.Sqrt(cosTheta)
+	c := s.Horizon.Mul(1 - t).Add(s.Zenith.Mul(t)).Mul(scale)
+	// An exponential exposure curve rolls the bright sun glow off smoothly
+	// instead of clipping it.
+	return math.Point3D{X: 1 - gomath.Exp(-c.X), Y: 1 - gomath.Exp(-c.Y), Z: 1 - gomath.Exp(-c.Z)}
+}
+
+// perez evaluates the Perez sky distribution for luminance at view angle
+// cos(theta) from the zenith and angle gamma from the sun.
+func (s SkyEnvironment) perez(cosTheta, gamma float64) float64 {
+	T := s.Turbidity
+	a := 0.1787*T - 1.4630
+	b := -0.3554*T + 0.4275
+	c := -0.0227*T + 5.3251
+	d := 0.1206*T - 2.5771
+	e := -0.0670*T + 0.3703
+	cosGamma := gomath.Cos(gamma)
+	return (1 + a*gomath.Exp(b/cosTheta)) * (1 + c*gomath.Exp(d*gamma) + e*cosGamma*cosGamma)
+}